@@ -1,6 +1,10 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+)
 
 // GetPort returns the port to run the server on
 func GetPort() string {
@@ -28,3 +32,118 @@ func GetJWTSecret() string {
 	}
 	return secret
 }
+
+// GetStorageDir returns the directory where uploaded attachments are stored
+func GetStorageDir() string {
+	dir := os.Getenv("STORAGE_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	return dir
+}
+
+// GetBenchmarkMinGroupSize returns the minimum number of peer operators a
+// benchmark group needs before its aggregates are shown
+func GetBenchmarkMinGroupSize() int {
+	size, err := strconv.Atoi(os.Getenv("BENCHMARK_MIN_GROUP_SIZE"))
+	if err != nil || size < 2 {
+		size = 5
+	}
+	return size
+}
+
+// GetBenchmarkEpsilon returns the privacy budget for noise added to benchmark
+// aggregates, 1 by default. BENCHMARK_EPSILON=0 adds noise only on request.
+func GetBenchmarkEpsilon() float64 {
+	value := os.Getenv("BENCHMARK_EPSILON")
+	if value == "" {
+		return 1
+	}
+	epsilon, err := strconv.ParseFloat(value, 64)
+	if err != nil || epsilon < 0 {
+		return 1
+	}
+	return epsilon
+}
+
+// SMTPConfig holds the outgoing mail server settings
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	Security string // starttls, tls or none
+}
+
+// GetSMTPConfig returns the SMTP settings. Email delivery is disabled when
+// SMTP_HOST is empty. SMTP_SECURITY=none talks plain SMTP, as local mail
+// catchers expect.
+func GetSMTPConfig() SMTPConfig {
+	cfg := SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+		Security: os.Getenv("SMTP_SECURITY"),
+	}
+	if cfg.Security != "tls" && cfg.Security != "none" {
+		cfg.Security = "starttls"
+	}
+	port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if err != nil || port < 1 {
+		port = 587
+		if cfg.Security == "tls" {
+			port = 465
+		}
+	}
+	cfg.Port = port
+	if cfg.From == "" {
+		cfg.From = "FDM <no-reply@localhost>"
+	}
+	return cfg
+}
+
+// GetAppURL returns the base URL of the web application, used for links in emails
+func GetAppURL() string {
+	url := os.Getenv("APP_URL")
+	if url == "" {
+		url = "http://localhost:3000"
+	}
+	return strings.TrimRight(url, "/")
+}
+
+// GetWebhookAllowPrivateNetworks reports whether webhooks may be delivered to
+// loopback and private addresses. It is off so that companies cannot reach
+// internal services; enable it to test against a local receiver.
+func GetWebhookAllowPrivateNetworks() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS"))
+	return allow
+}
+
+// GetRetentionDays returns how many days finished email and webhook deliveries
+// and read notifications are kept before the retention_purge job deletes them
+func GetRetentionDays() int {
+	days, err := strconv.Atoi(os.Getenv("RETENTION_DAYS"))
+	if err != nil || days < 1 {
+		days = 90
+	}
+	return days
+}
+
+// GetQuotaWarningPercents returns the usage percentages of a subscription quota
+// at which the company is warned, from QUOTA_WARNING_PERCENTS (e.g. "80,90")
+func GetQuotaWarningPercents() []int {
+	value := os.Getenv("QUOTA_WARNING_PERCENTS")
+	if value == "" {
+		return []int{80, 90}
+	}
+	var percents []int
+	for _, part := range strings.Split(value, ",") {
+		percent, err := strconv.Atoi(strings.TrimSpace(part))
+		if err == nil && percent > 0 && percent < 100 {
+			percents = append(percents, percent)
+		}
+	}
+	return percents
+}
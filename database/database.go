@@ -26,8 +26,11 @@ func InitDB() (*sql.DB, error) {
 		return nil, fmt.Errorf("database file does not exist at path: %s", dbPath)
 	}
 
-	// Open database connection
-	db, err := sql.Open("sqlite", dbPath)
+	// Open database connection. The busy timeout lets concurrent write
+	// transactions wait for each other instead of failing with SQLITE_BUSY.
+	// Transactions take the write lock when they begin, so what they read
+	// cannot change before they commit.
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)&_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -6,10 +6,21 @@ import (
 	"io/ioutil"
 	"log"
 	"path/filepath"
+	"time"
 )
 
-// RunMigrations executes all SQL migrations in the migrations directory
+// RunMigrations executes all SQL migrations in the migrations directory.
+// Applied files are recorded in SchemaMigration so that migrations containing
+// non-idempotent statements (e.g. ALTER TABLE ... ADD COLUMN) only run once.
 func RunMigrations(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS SchemaMigration (
+		name TEXT PRIMARY KEY,
+		appliedAt INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create migration table: %w", err)
+	}
+
 	// Get migration files
 	migrationFiles, err := filepath.Glob("database/migrations/*.sql")
 	if err != nil {
@@ -18,8 +29,19 @@ func RunMigrations(db *sql.DB) error {
 
 	// Execute each migration file
 	for _, file := range migrationFiles {
+		name := filepath.Base(file)
+
+		var applied bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM SchemaMigration WHERE name = ?)", name).Scan(&applied)
+		if err != nil {
+			return fmt.Errorf("failed to check migration %s: %w", file, err)
+		}
+		if applied {
+			continue
+		}
+
 		log.Printf("Running migration: %s", file)
-		
+
 		// Read migration file
 		content, err := ioutil.ReadFile(file)
 		if err != nil {
@@ -32,8 +54,13 @@ func RunMigrations(db *sql.DB) error {
 			return fmt.Errorf("failed to execute migration %s: %w", file, err)
 		}
 
+		_, err = db.Exec("INSERT INTO SchemaMigration (name, appliedAt) VALUES (?, ?)", name, time.Now().UnixMilli())
+		if err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", file, err)
+		}
+
 		log.Printf("Successfully executed migration: %s", file)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
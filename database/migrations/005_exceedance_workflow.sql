@@ -0,0 +1,35 @@
+-- Exceedance review workflow
+-- Records every status transition and normalises the legacy free-text statuses
+-- ("Valid", "False", "Nuisance", "Under Review", ...) onto the workflow states.
+
+CREATE TABLE IF NOT EXISTS ExceedanceStatusHistory (
+    id TEXT PRIMARY KEY,
+    exceedanceId TEXT NOT NULL,
+    fromStatus TEXT,
+    toStatus TEXT NOT NULL,
+    userId TEXT,
+    comment TEXT,
+    createdAt INTEGER NOT NULL,
+    FOREIGN KEY (exceedanceId) REFERENCES Exceedance(id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_exceedance_status_history_exceedance ON ExceedanceStatusHistory(exceedanceId);
+
+UPDATE Exceedance SET eventStatus = 'under_review'
+WHERE lower(trim(eventStatus)) IN ('under review', 'under_review', 'in review', 'review', 'pending');
+
+UPDATE Exceedance SET eventStatus = 'validated'
+WHERE lower(trim(eventStatus)) IN ('valid', 'validated', 'approved', 'confirmed');
+
+UPDATE Exceedance SET eventStatus = 'false_positive'
+WHERE lower(trim(eventStatus)) IN ('false', 'false positive', 'false_positive', 'nuisance', 'invalid');
+
+UPDATE Exceedance SET eventStatus = 'needs_crew_contact'
+WHERE lower(trim(eventStatus)) IN ('needs crew contact', 'needs_crew_contact', 'crew contact');
+
+UPDATE Exceedance SET eventStatus = 'closed'
+WHERE lower(trim(eventStatus)) = 'closed';
+
+UPDATE Exceedance SET eventStatus = 'new'
+WHERE eventStatus NOT IN ('new', 'under_review', 'validated', 'false_positive', 'needs_crew_contact', 'closed');
@@ -0,0 +1,22 @@
+-- Exceedance assignment and analyst work queue
+
+ALTER TABLE Exceedance ADD COLUMN assigneeId TEXT REFERENCES User(id) ON DELETE SET NULL;
+ALTER TABLE Exceedance ADD COLUMN dueDate INTEGER;
+ALTER TABLE Exceedance ADD COLUMN priority TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_exceedance_assignee ON Exceedance(assigneeId);
+
+-- Tracks the last FDA picked per company for round-robin auto-assignment
+CREATE TABLE IF NOT EXISTS AssignmentRotation (
+    companyId TEXT PRIMARY KEY,
+    lastUserId TEXT,
+    updatedAt INTEGER NOT NULL
+);
+
+UPDATE Exceedance SET priority = CASE lower(exceedanceLevel)
+    WHEN 'critical' THEN 'critical'
+    WHEN 'high' THEN 'high'
+    WHEN 'medium' THEN 'medium'
+    ELSE 'low'
+END
+WHERE priority IS NULL;
@@ -0,0 +1,44 @@
+-- Threaded comments and file attachments on exceedances
+
+CREATE TABLE IF NOT EXISTS ExceedanceComment (
+    id TEXT PRIMARY KEY,
+    exceedanceId TEXT NOT NULL,
+    userId TEXT,
+    body TEXT NOT NULL,
+    editedAt INTEGER,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (exceedanceId) REFERENCES Exceedance(id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_exceedance_comment_exceedance ON ExceedanceComment(exceedanceId);
+
+CREATE TABLE IF NOT EXISTS ExceedanceCommentMention (
+    commentId TEXT NOT NULL,
+    userId TEXT NOT NULL,
+    PRIMARY KEY (commentId, userId),
+    FOREIGN KEY (commentId) REFERENCES ExceedanceComment(id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES User(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS ExceedanceAttachment (
+    id TEXT PRIMARY KEY,
+    exceedanceId TEXT NOT NULL,
+    userId TEXT,
+    fileName TEXT NOT NULL,
+    contentType TEXT,
+    size INTEGER NOT NULL,
+    storageKey TEXT NOT NULL,
+    createdAt INTEGER NOT NULL,
+    FOREIGN KEY (exceedanceId) REFERENCES Exceedance(id) ON DELETE CASCADE,
+    FOREIGN KEY (userId) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_exceedance_attachment_exceedance ON ExceedanceAttachment(exceedanceId);
+
+-- Carry existing single comments over as the first entry of each thread
+INSERT INTO ExceedanceComment (id, exceedanceId, userId, body, createdAt, updatedAt)
+SELECT lower(hex(randomblob(16))), id, NULL, comment, updatedAt, updatedAt
+FROM Exceedance
+WHERE comment IS NOT NULL AND trim(comment) != '';
@@ -0,0 +1,15 @@
+-- Stored responses for requests sent with an Idempotency-Key header so that
+-- retried batch submissions replay the original result instead of duplicating rows
+
+CREATE TABLE IF NOT EXISTS IdempotencyKey (
+    key TEXT NOT NULL,
+    userId TEXT NOT NULL,
+    endpoint TEXT NOT NULL,
+    requestHash TEXT NOT NULL,
+    statusCode INTEGER NOT NULL,
+    response TEXT NOT NULL,
+    createdAt INTEGER NOT NULL,
+    PRIMARY KEY (userId, endpoint, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_key_created ON IdempotencyKey(createdAt);
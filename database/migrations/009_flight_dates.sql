@@ -0,0 +1,6 @@
+-- Flights record the date they were flown, which can be well before their
+-- upload. Flights uploaded before are dated by their upload.
+
+ALTER TABLE Csv ADD COLUMN flightDate DATETIME;
+
+UPDATE Csv SET flightDate = createdAt WHERE flightDate IS NULL;
@@ -0,0 +1,43 @@
+-- Safety Performance Indicators: per-company indicators built on event codes or
+-- event types, with a target and statistical alert levels computed monthly
+
+CREATE TABLE IF NOT EXISTS SafetyPerformanceIndicator (
+    id TEXT PRIMARY KEY,
+    companyId TEXT NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT,
+    eventCodes TEXT NOT NULL DEFAULT '[]',
+    eventTypes TEXT NOT NULL DEFAULT '[]',
+    severities TEXT NOT NULL DEFAULT '[]',
+    formula TEXT NOT NULL DEFAULT 'rate',
+    ratePer INTEGER NOT NULL DEFAULT 1000,
+    target REAL,
+    alertSigmas TEXT NOT NULL DEFAULT '[1,2,3]',
+    baselineMonths INTEGER NOT NULL DEFAULT 12,
+    isActive BOOLEAN NOT NULL DEFAULT 1,
+    createdBy TEXT,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE,
+    FOREIGN KEY (createdBy) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_spi_company ON SafetyPerformanceIndicator(companyId);
+
+-- Computed monthly values. notifiedLevel is the highest alert level already
+-- notified for the month so breaches are only reported once.
+CREATE TABLE IF NOT EXISTS SafetyPerformanceIndicatorValue (
+    spiId TEXT NOT NULL,
+    month TEXT NOT NULL,
+    flights INTEGER NOT NULL,
+    events INTEGER NOT NULL,
+    value REAL NOT NULL,
+    mean REAL,
+    stdDev REAL,
+    alertThresholds TEXT NOT NULL DEFAULT '[]',
+    alertLevel INTEGER NOT NULL DEFAULT 0,
+    notifiedLevel INTEGER NOT NULL DEFAULT 0,
+    computedAt INTEGER NOT NULL,
+    PRIMARY KEY (spiId, month),
+    FOREIGN KEY (spiId) REFERENCES SafetyPerformanceIndicator(id) ON DELETE CASCADE
+);
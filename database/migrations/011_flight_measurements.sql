@@ -0,0 +1,15 @@
+-- Measurements computed per flight at ingest (touchdown g, approach speed
+-- deviation, rotation rate, bank below 1000 ft) for distribution analytics
+
+CREATE TABLE IF NOT EXISTS FlightMeasurement (
+    flightId TEXT NOT NULL,
+    aircraftId TEXT NOT NULL,
+    code TEXT NOT NULL,
+    value REAL NOT NULL,
+    computedAt INTEGER NOT NULL,
+    PRIMARY KEY (flightId, code),
+    FOREIGN KEY (flightId) REFERENCES Csv(id) ON DELETE CASCADE,
+    FOREIGN KEY (aircraftId) REFERENCES Aircraft(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_flight_measurement_code ON FlightMeasurement(code, aircraftId);
@@ -0,0 +1,44 @@
+-- Crew members linked to flights. The API only exposes the de-identified code;
+-- names and employee IDs are revealed to FDAs through a logged crew contact.
+
+CREATE TABLE IF NOT EXISTS CrewMember (
+    id TEXT PRIMARY KEY,
+    companyId TEXT NOT NULL,
+    code TEXT NOT NULL UNIQUE,
+    employeeId TEXT NOT NULL,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'captain',
+    isActive BOOLEAN NOT NULL DEFAULT 1,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    UNIQUE (companyId, employeeId),
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE
+);
+
+-- The role is the seat flown on the flight, which may differ from the crew
+-- member's usual role
+CREATE TABLE IF NOT EXISTS FlightCrew (
+    flightId TEXT NOT NULL,
+    crewMemberId TEXT NOT NULL,
+    role TEXT NOT NULL,
+    PRIMARY KEY (flightId, role),
+    FOREIGN KEY (flightId) REFERENCES Csv(id) ON DELETE CASCADE,
+    FOREIGN KEY (crewMemberId) REFERENCES CrewMember(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_flight_crew_member ON FlightCrew(crewMemberId);
+
+-- Every identity disclosure, kept for the confidentiality agreement audit
+CREATE TABLE IF NOT EXISTS CrewContact (
+    id TEXT PRIMARY KEY,
+    crewMemberId TEXT NOT NULL,
+    exceedanceId TEXT,
+    userId TEXT,
+    reason TEXT NOT NULL,
+    createdAt INTEGER NOT NULL,
+    FOREIGN KEY (crewMemberId) REFERENCES CrewMember(id) ON DELETE CASCADE,
+    FOREIGN KEY (exceedanceId) REFERENCES Exceedance(id) ON DELETE SET NULL,
+    FOREIGN KEY (userId) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_crew_contact_member ON CrewContact(crewMemberId);
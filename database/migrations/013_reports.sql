@@ -0,0 +1,42 @@
+-- Generated safety reports and the monthly schedules producing them. Report
+-- files are kept in storage under reports/<companyId>/.
+
+CREATE TABLE IF NOT EXISTS ReportSchedule (
+    id TEXT PRIMARY KEY,
+    companyId TEXT NOT NULL,
+    template TEXT NOT NULL,
+    formats TEXT NOT NULL DEFAULT '["pdf"]',
+    aircraftId TEXT,
+    eventCode TEXT,
+    isActive BOOLEAN NOT NULL DEFAULT 1,
+    lastPeriod TEXT,
+    createdBy TEXT,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE,
+    FOREIGN KEY (createdBy) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_schedule_company ON ReportSchedule(companyId);
+
+CREATE TABLE IF NOT EXISTS Report (
+    id TEXT PRIMARY KEY,
+    companyId TEXT NOT NULL,
+    scheduleId TEXT,
+    template TEXT NOT NULL,
+    title TEXT NOT NULL,
+    format TEXT NOT NULL,
+    periodStart INTEGER NOT NULL,
+    periodEnd INTEGER NOT NULL,
+    aircraftId TEXT,
+    eventCode TEXT,
+    storageKey TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    createdBy TEXT,
+    createdAt INTEGER NOT NULL,
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE,
+    FOREIGN KEY (scheduleId) REFERENCES ReportSchedule(id) ON DELETE SET NULL,
+    FOREIGN KEY (createdBy) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_report_company ON Report(companyId, createdAt);
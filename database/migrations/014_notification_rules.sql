@@ -0,0 +1,25 @@
+-- Per-company notification rules. A rule matches exceedances by event code,
+-- severity, aircraft and flight phase (an empty list matches any) and notifies
+-- the listed users and the company's users with the listed roles.
+
+CREATE TABLE IF NOT EXISTS NotificationRule (
+    id TEXT PRIMARY KEY,
+    companyId TEXT NOT NULL,
+    name TEXT NOT NULL,
+    eventCodes TEXT NOT NULL DEFAULT '[]',
+    severities TEXT NOT NULL DEFAULT '[]',
+    aircraftIds TEXT NOT NULL DEFAULT '[]',
+    phases TEXT NOT NULL DEFAULT '[]',
+    userIds TEXT NOT NULL DEFAULT '[]',
+    roles TEXT NOT NULL DEFAULT '[]',
+    channels TEXT NOT NULL DEFAULT '["in_app"]',
+    isActive BOOLEAN NOT NULL DEFAULT 1,
+    createdBy TEXT,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE,
+    FOREIGN KEY (createdBy) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_rule_company ON NotificationRule(companyId);
+CREATE INDEX IF NOT EXISTS idx_notification_user_exceedance ON Notification(userId, exceedanceId);
@@ -0,0 +1,38 @@
+-- Outgoing email queue and delivery log. Pending messages are retried with
+-- backoff; bodies are dropped once a message is sent.
+
+CREATE TABLE IF NOT EXISTS EmailDelivery (
+    id TEXT PRIMARY KEY,
+    userId TEXT,
+    exceedanceId TEXT,
+    toAddress TEXT NOT NULL,
+    template TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    textBody TEXT,
+    htmlBody TEXT,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    lastError TEXT,
+    nextAttemptAt INTEGER,
+    sentAt INTEGER,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (userId) REFERENCES User(id) ON DELETE SET NULL,
+    FOREIGN KEY (exceedanceId) REFERENCES Exceedance(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_delivery_status ON EmailDelivery(status, nextAttemptAt);
+CREATE INDEX IF NOT EXISTS idx_email_delivery_user ON EmailDelivery(userId, exceedanceId);
+
+-- Password reset tokens; only a SHA-256 hash of the token is stored
+CREATE TABLE IF NOT EXISTS PasswordReset (
+    id TEXT PRIMARY KEY,
+    userId TEXT NOT NULL,
+    tokenHash TEXT NOT NULL UNIQUE,
+    expiresAt INTEGER NOT NULL,
+    usedAt INTEGER,
+    createdAt INTEGER NOT NULL,
+    FOREIGN KEY (userId) REFERENCES User(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_reset_user ON PasswordReset(userId);
@@ -0,0 +1,15 @@
+-- Events pushed to connected clients over /api/stream. Ids increase with every
+-- event so a reconnecting client resumes after its Last-Event-ID. An event is
+-- addressed to one user, or to a company's users when userId is NULL; admins
+-- and FDAs receive every company event.
+
+CREATE TABLE IF NOT EXISTS StreamEvent (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    userId TEXT,
+    companyId TEXT,
+    data TEXT NOT NULL,
+    createdAt INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_stream_event_created ON StreamEvent(createdAt);
@@ -0,0 +1,40 @@
+-- Outgoing webhooks. A company subscribes URLs to event types; every matching
+-- event is queued in WebhookDelivery with its signed payload and posted by a
+-- background worker that retries failures with backoff.
+
+CREATE TABLE IF NOT EXISTS Webhook (
+    id TEXT PRIMARY KEY,
+    companyId TEXT NOT NULL,
+    url TEXT NOT NULL,
+    description TEXT,
+    eventTypes TEXT NOT NULL DEFAULT '[]',
+    secret TEXT NOT NULL,
+    isActive BOOLEAN NOT NULL DEFAULT 1,
+    createdBy TEXT,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE,
+    FOREIGN KEY (createdBy) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_company ON Webhook(companyId);
+
+CREATE TABLE IF NOT EXISTS WebhookDelivery (
+    id TEXT PRIMARY KEY,
+    webhookId TEXT NOT NULL,
+    eventType TEXT NOT NULL,
+    eventId TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    responseStatus INTEGER,
+    lastError TEXT,
+    nextAttemptAt INTEGER,
+    deliveredAt INTEGER,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (webhookId) REFERENCES Webhook(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_due ON WebhookDelivery(status, nextAttemptAt);
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_webhook ON WebhookDelivery(webhookId, createdAt);
@@ -0,0 +1,23 @@
+-- Per-user notification preferences: accepted channels, immediate or digest
+-- delivery per severity and quiet hours. Notifications held for a digest keep
+-- the time the digest is due and are stamped with the digest that sent them.
+
+CREATE TABLE IF NOT EXISTS NotificationPreference (
+    userId TEXT PRIMARY KEY,
+    channels TEXT NOT NULL DEFAULT '["in_app","email"]',
+    severityModes TEXT NOT NULL DEFAULT '{}',
+    defaultMode TEXT NOT NULL DEFAULT 'immediate',
+    digestHour INTEGER NOT NULL DEFAULT 8,
+    quietHoursStart TEXT,
+    quietHoursEnd TEXT,
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (userId) REFERENCES User(id) ON DELETE CASCADE
+);
+
+ALTER TABLE Notification ADD COLUMN deliveryMode TEXT NOT NULL DEFAULT 'immediate';
+ALTER TABLE Notification ADD COLUMN digestDueAt INTEGER;
+ALTER TABLE Notification ADD COLUMN digestEmail BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE Notification ADD COLUMN digestId TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_notification_digest_due ON Notification(digestDueAt) WHERE digestId IS NULL AND digestDueAt IS NOT NULL;
@@ -0,0 +1,34 @@
+-- Escalation policies notify successive tiers of users about exceedances that
+-- are still new (unacknowledged) a number of hours after they were created.
+-- ExceedanceEscalation records every tier that fired so none fires twice.
+
+CREATE TABLE IF NOT EXISTS EscalationPolicy (
+    id TEXT PRIMARY KEY,
+    companyId TEXT NOT NULL,
+    name TEXT NOT NULL,
+    severities TEXT NOT NULL DEFAULT '[]',
+    tiers TEXT NOT NULL DEFAULT '[]',
+    isActive BOOLEAN NOT NULL DEFAULT 1,
+    createdBy TEXT,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE,
+    FOREIGN KEY (createdBy) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_escalation_policy_company ON EscalationPolicy(companyId);
+
+CREATE TABLE IF NOT EXISTS ExceedanceEscalation (
+    id TEXT PRIMARY KEY,
+    exceedanceId TEXT NOT NULL,
+    policyId TEXT,
+    tier INTEGER NOT NULL,
+    afterHours INTEGER NOT NULL,
+    recipients TEXT NOT NULL DEFAULT '[]',
+    createdAt INTEGER NOT NULL,
+    FOREIGN KEY (exceedanceId) REFERENCES Exceedance(id) ON DELETE CASCADE,
+    FOREIGN KEY (policyId) REFERENCES EscalationPolicy(id) ON DELETE SET NULL,
+    UNIQUE (exceedanceId, policyId, tier)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exceedance_escalation_exceedance ON ExceedanceEscalation(exceedanceId);
@@ -0,0 +1,58 @@
+-- Notifications link to a typed target: an exceedance, a flight, a
+-- subscription or a user, each through its own foreign key. flightId is also
+-- set on exceedance notifications so the notifications of a flight can be
+-- grouped. SQLite cannot drop the NOT NULL on exceedanceId, so the table is
+-- rebuilt. SQLite only enforces the foreign keys with PRAGMA foreign_keys,
+-- which the server does not enable, so notifications are deleted with their
+-- targets by the handlers rather than by the cascades.
+--
+-- Notifications created before exceedances were looked up could hold a flight
+-- id in exceedanceId; those become flight notifications. Timestamps stored as
+-- text by older versions are converted to epoch milliseconds.
+
+CREATE TABLE Notification_new (
+    id TEXT NOT NULL PRIMARY KEY,
+    userId TEXT NOT NULL,
+    targetType TEXT NOT NULL DEFAULT 'exceedance',
+    exceedanceId TEXT,
+    flightId TEXT,
+    subscriptionId TEXT,
+    targetUserId TEXT,
+    message TEXT NOT NULL,
+    level TEXT NOT NULL,
+    isRead BOOLEAN NOT NULL DEFAULT false,
+    deliveryMode TEXT NOT NULL DEFAULT 'immediate',
+    digestDueAt INTEGER,
+    digestEmail BOOLEAN NOT NULL DEFAULT 0,
+    digestId TEXT,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL,
+    FOREIGN KEY (userId) REFERENCES User(id) ON DELETE CASCADE,
+    FOREIGN KEY (exceedanceId) REFERENCES Exceedance(id) ON DELETE CASCADE,
+    FOREIGN KEY (flightId) REFERENCES Csv(id) ON DELETE CASCADE,
+    FOREIGN KEY (subscriptionId) REFERENCES Subscription(id) ON DELETE CASCADE,
+    FOREIGN KEY (targetUserId) REFERENCES User(id) ON DELETE CASCADE
+);
+
+INSERT INTO Notification_new (id, userId, targetType, exceedanceId, flightId, message, level, isRead,
+    deliveryMode, digestDueAt, digestEmail, digestId, createdAt, updatedAt)
+SELECT n.id, n.userId,
+    CASE WHEN e.id IS NULL AND f.id IS NOT NULL THEN 'flight' ELSE 'exceedance' END,
+    CASE WHEN e.id IS NULL AND f.id IS NOT NULL THEN NULL ELSE n.exceedanceId END,
+    COALESCE(e.flightId, f.id),
+    n.message, n.level, n.isRead, n.deliveryMode, n.digestDueAt, n.digestEmail, n.digestId,
+    CASE WHEN typeof(n.createdAt) = 'integer' THEN n.createdAt
+        ELSE CAST(strftime('%s', substr(n.createdAt, 1, 19)) AS INTEGER) * 1000 END,
+    CASE WHEN typeof(n.updatedAt) = 'integer' THEN n.updatedAt
+        ELSE CAST(strftime('%s', substr(n.updatedAt, 1, 19)) AS INTEGER) * 1000 END
+FROM Notification n
+LEFT JOIN Exceedance e ON n.exceedanceId = e.id
+LEFT JOIN Csv f ON n.exceedanceId = f.id;
+
+DROP TABLE Notification;
+ALTER TABLE Notification_new RENAME TO Notification;
+
+CREATE INDEX IF NOT EXISTS idx_notification_user_created ON Notification(userId, createdAt);
+CREATE INDEX IF NOT EXISTS idx_notification_user_exceedance ON Notification(userId, exceedanceId);
+CREATE INDEX IF NOT EXISTS idx_notification_flight ON Notification(flightId);
+CREATE INDEX IF NOT EXISTS idx_notification_digest_due ON Notification(digestDueAt) WHERE digestId IS NULL AND digestDueAt IS NOT NULL;
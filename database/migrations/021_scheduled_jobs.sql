@@ -0,0 +1,32 @@
+-- Maintenance jobs run by the in-process scheduler and their run history.
+-- Jobs are registered at startup with a default cron schedule. lockedBy and
+-- lockedUntil claim a job for one server instance while it runs.
+
+CREATE TABLE IF NOT EXISTS ScheduledJob (
+    name TEXT PRIMARY KEY,
+    schedule TEXT NOT NULL,
+    isEnabled BOOLEAN NOT NULL DEFAULT 1,
+    nextRunAt INTEGER,
+    lockedBy TEXT,
+    lockedUntil INTEGER,
+    createdAt INTEGER NOT NULL,
+    updatedAt INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS JobRun (
+    id TEXT PRIMARY KEY,
+    jobName TEXT NOT NULL,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL,
+    triggeredBy TEXT,
+    instance TEXT NOT NULL,
+    result TEXT,
+    error TEXT,
+    startedAt INTEGER NOT NULL,
+    finishedAt INTEGER,
+    FOREIGN KEY (jobName) REFERENCES ScheduledJob(name) ON DELETE CASCADE,
+    FOREIGN KEY (triggeredBy) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_run_job ON JobRun(jobName, startedAt);
+CREATE INDEX IF NOT EXISTS idx_job_run_started ON JobRun(startedAt);
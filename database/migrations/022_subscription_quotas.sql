@@ -0,0 +1,26 @@
+-- Subscription quota enforcement. Flight files record their size so storage
+-- can be counted; sizes of files uploaded before are filled in when first
+-- counted. An admin override lets a company exceed its quotas, optionally
+-- until a given time. Quota warnings are sent once per month and threshold.
+
+ALTER TABLE Csv ADD COLUMN fileSize INTEGER;
+
+CREATE TABLE IF NOT EXISTS QuotaOverride (
+    companyId TEXT PRIMARY KEY,
+    expiresAt INTEGER,
+    reason TEXT,
+    createdBy TEXT,
+    createdAt INTEGER NOT NULL,
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE,
+    FOREIGN KEY (createdBy) REFERENCES User(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS QuotaWarning (
+    companyId TEXT NOT NULL,
+    resource TEXT NOT NULL,
+    threshold INTEGER NOT NULL,
+    period TEXT NOT NULL,
+    createdAt INTEGER NOT NULL,
+    PRIMARY KEY (companyId, resource, threshold, period),
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE
+);
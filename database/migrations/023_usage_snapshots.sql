@@ -0,0 +1,19 @@
+-- Daily usage per company, one row per UTC day. Flights processed and API
+-- calls are counted as they happen; active users, aircraft and storage are
+-- measured by the usage_snapshots job and stay NULL until it first runs that
+-- day.
+
+CREATE TABLE IF NOT EXISTS UsageSnapshot (
+    companyId TEXT NOT NULL,
+    date TEXT NOT NULL,
+    activeUsers INTEGER,
+    aircraft INTEGER,
+    storageBytes INTEGER,
+    flightsProcessed INTEGER NOT NULL DEFAULT 0,
+    apiCalls INTEGER NOT NULL DEFAULT 0,
+    updatedAt INTEGER NOT NULL,
+    PRIMARY KEY (companyId, date),
+    FOREIGN KEY (companyId) REFERENCES Company(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_snapshot_date ON UsageSnapshot(date);
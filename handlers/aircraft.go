@@ -35,126 +35,53 @@ func parseTimestamp(timeStr string) (time.Time, error) {
 	return time.Time{}, nil
 }
 
-// GetAircrafts retrieves all aircraft with related data
-func (h *AircraftHandler) GetAircrafts(c *gin.Context) {
-	query := `SELECT id, airline, aircraftMake, modelNumber, serialNumber, registration, companyId, parameters, createdAt, updatedAt FROM Aircraft`
-	rows, err := h.db.Query(query)
-	if err != nil {
-		println("GetAircrafts query error:", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
-		return
-	}
-	defer rows.Close()
-
-	var aircrafts []interface{}
-	for rows.Next() {
-		var aircraft models.Aircraft
-		var modelNumber, registration, parameters sql.NullString
-		var createdAtStr, updatedAtStr sql.NullString
-
-		err := rows.Scan(&aircraft.ID, &aircraft.Airline, &aircraft.AircraftMake, &modelNumber,
-			&aircraft.SerialNumber, &registration, &aircraft.CompanyID, &parameters, &createdAtStr, &updatedAtStr)
-		if err != nil {
-			println("GetAircrafts scan error:", err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning aircraft", "details": err.Error()})
-			return
-		}
-
-		// Handle nullable fields
-		if modelNumber.Valid {
-			aircraft.ModelNumber = &modelNumber.String
-		}
-		if registration.Valid {
-			aircraft.Registration = &registration.String
-		}
-		if parameters.Valid {
-			aircraft.Parameters = &parameters.String
-		}
-		// Parse timestamps
-		if createdAtStr.Valid {
-			if t, err := parseTimestamp(createdAtStr.String); err == nil {
-				aircraft.CreatedAt = t
-			}
-		}
-		if updatedAtStr.Valid {
-			if t, err := parseTimestamp(updatedAtStr.String); err == nil {
-				aircraft.UpdatedAt = t
-			}
-		}
-
-		// Get company details
-		company, _ := h.getAircraftCompany(aircraft.CompanyID)
-		if err != nil {
-			println("Error getting company for aircraft", aircraft.ID, ":", err.Error())
-			// Don't fail the request, just log the error
-		}
-
-		// Get related CSV files
-		csvs, err := h.getAircraftCSVs(aircraft.ID)
-		if err != nil {
-			println("Error getting CSVs for aircraft", aircraft.ID, ":", err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting CSV files", "details": err.Error()})
-			return
-		}
-
-		// Get related event logs
-		eventLogs, err := h.getAircraftEventLogs(aircraft.ID)
-		if err != nil {
-			println("Error getting event logs for aircraft", aircraft.ID, ":", err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting event logs", "details": err.Error()})
-			return
-		}
-
-		// Get related exceedances
-		exceedances, err := h.getAircraftExceedances(aircraft.ID)
-		if err != nil {
-			println("Error getting exceedances for aircraft", aircraft.ID, ":", err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting exceedances", "details": err.Error()})
-			return
-		}
+// aircraftListSpec lists the filters and sort keys accepted by GetAircrafts
+var aircraftListSpec = &listSpec{
+	idColumn: "id",
+	sorts: map[string]string{
+		"createdAt":    sqlEpochMillis("createdAt"),
+		"airline":      "COALESCE(airline, '')",
+		"aircraftMake": "COALESCE(aircraftMake, '')",
+		"serialNumber": "COALESCE(serialNumber, '')",
+		"registration": "COALESCE(registration, '')",
+	},
+	defaultSort: "-createdAt",
+	filters: map[string]listFilter{
+		"company":      eqFilter("companyId"),
+		"airline":      lowerFilter("airline"),
+		"aircraftMake": lowerFilter("aircraftMake"),
+		"modelNumber":  lowerFilter("modelNumber"),
+		"from":         dateFilter("createdAt", false),
+		"to":           dateFilter("createdAt", true),
+	},
+}
 
-		aircraftWithRelations := struct {
-			models.Aircraft
-			Company    *models.Company     `json:"company"`
-			CSV        []models.CSV        `json:"csv"`
-			EventLog   []models.EventLog   `json:"EventLog"`
-			Exceedance []models.Exceedance `json:"Exceedance"`
-		}{
-			Aircraft:   aircraft,
-			Company:    company,
-			CSV:        csvs,
-			EventLog:   eventLogs,
-			Exceedance: exceedances,
-		}
+const aircraftColumns = `id, airline, aircraftMake, modelNumber, serialNumber, registration, companyId, parameters, createdAt, updatedAt`
 
-		aircrafts = append(aircrafts, aircraftWithRelations)
-	}
-
-	c.JSON(http.StatusOK, aircrafts)
+// aircraftWithCompany is an aircraft with its company, as listed
+type aircraftWithCompany struct {
+	models.Aircraft
+	Company *models.Company `json:"company"`
 }
 
-// GetAircraftByID retrieves a single aircraft by its ID
-func (h *AircraftHandler) GetAircraftByID(c *gin.Context) {
-	aircraftID := c.Param("id")
-
-	query := `SELECT id, airline, aircraftMake, modelNumber, serialNumber, registration, companyId, parameters, createdAt, updatedAt FROM Aircraft WHERE id = ?`
+// aircraftWithRelations is an aircraft with its company, flights, events and exceedances
+type aircraftWithRelations struct {
+	aircraftWithCompany
+	CSV        []models.CSV        `json:"csv"`
+	EventLog   []models.EventLog   `json:"EventLog"`
+	Exceedance []models.Exceedance `json:"Exceedance"`
+}
 
+// scanAircraft scans the aircraftColumns of a row followed by any extra destinations
+func scanAircraft(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.Aircraft, error) {
 	var aircraft models.Aircraft
 	var modelNumber, registration, parameters sql.NullString
 	var createdAtStr, updatedAtStr sql.NullString
 
-	err := h.db.QueryRow(query, aircraftID).Scan(
-		&aircraft.ID, &aircraft.Airline, &aircraft.AircraftMake, &modelNumber,
-		&aircraft.SerialNumber, &registration, &aircraft.CompanyID, &parameters, &createdAtStr, &updatedAtStr,
-	)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Aircraft not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
-		return
+	dest := append([]interface{}{&aircraft.ID, &aircraft.Airline, &aircraft.AircraftMake, &modelNumber,
+		&aircraft.SerialNumber, &registration, &aircraft.CompanyID, &parameters, &createdAtStr, &updatedAtStr}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return aircraft, err
 	}
 
 	// Handle nullable fields
@@ -178,113 +105,155 @@ func (h *AircraftHandler) GetAircraftByID(c *gin.Context) {
 			aircraft.UpdatedAt = t
 		}
 	}
+	return aircraft, nil
+}
+
+// withCompanies loads the companies of a set of aircraft with one query
+func (h *AircraftHandler) withCompanies(aircrafts []models.Aircraft) []aircraftWithCompany {
+	result := make([]aircraftWithCompany, 0, len(aircrafts))
+	if len(aircrafts) == 0 {
+		return result
+	}
+
+	var companyIDs []string
+	for _, aircraft := range aircrafts {
+		companyIDs = append(companyIDs, aircraft.CompanyID)
+	}
+	companies, err := h.getAircraftCompanies(companyIDs)
+	if err != nil {
+		println("Error getting companies for aircraft:", err.Error())
+		// Don't fail the request, just log the error
+	}
+
+	for _, aircraft := range aircrafts {
+		result = append(result, aircraftWithCompany{Aircraft: aircraft, Company: companies[aircraft.CompanyID]})
+	}
+	return result
+}
+
+// withRelations loads the company, flights, events and exceedances of an aircraft
+func (h *AircraftHandler) withRelations(aircraft models.Aircraft) (aircraftWithRelations, error) {
+	result := aircraftWithRelations{aircraftWithCompany: h.withCompanies([]models.Aircraft{aircraft})[0]}
+	aircraftIDs := []string{aircraft.ID}
+
+	csvs, err := h.getAircraftCSVs(aircraftIDs)
+	if err != nil {
+		return result, err
+	}
+	eventLogs, err := h.getAircraftEventLogs(aircraftIDs)
+	if err != nil {
+		return result, err
+	}
+	exceedances, err := h.getAircraftExceedances(aircraftIDs)
+	if err != nil {
+		return result, err
+	}
 
-	// Get company details
-	company, _ := h.getAircraftCompany(aircraft.CompanyID)
+	result.CSV = csvs[aircraft.ID]
+	result.EventLog = eventLogs[aircraft.ID]
+	result.Exceedance = exceedances[aircraft.ID]
+	return result, nil
+}
+
+// GetAircrafts retrieves aircraft with their companies, one page at a time
+func (h *AircraftHandler) GetAircrafts(c *gin.Context) {
+	list, err := parseListQuery(c, aircraftListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantOf(c).restrict(list, "companyId")
+
+	total, err := list.count(h.db, "FROM Aircraft")
+	if err != nil {
+		println("GetAircrafts count error:", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
+		return
+	}
+
+	clause, args := list.pageClause()
+	rows, err := h.db.Query("SELECT "+aircraftColumns+", "+list.sortColumn()+" FROM Aircraft"+clause, args...)
+	if err != nil {
+		println("GetAircrafts query error:", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	var aircrafts []models.Aircraft
+	for rows.Next() {
+		var sortValue interface{}
+		aircraft, err := scanAircraft(rows, &sortValue)
+		if err != nil {
+			println("GetAircrafts scan error:", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning aircraft", "details": err.Error()})
+			return
+		}
+		if !list.accept(aircraft.ID, sortValue) {
+			break
+		}
+		aircrafts = append(aircrafts, aircraft)
+	}
+	rows.Close()
 
-	// Get related CSV files
-	csvs, _ := h.getAircraftCSVs(aircraft.ID)
+	list.writeHeaders(c, total)
+	c.JSON(http.StatusOK, h.withCompanies(aircrafts))
+}
 
-	// Get related event logs
-	eventLogs, _ := h.getAircraftEventLogs(aircraft.ID)
+// GetAircraftByID retrieves a single aircraft by its ID
+func (h *AircraftHandler) GetAircraftByID(c *gin.Context) {
+	aircraftID := c.Param("id")
+	if !aircraftResource.authorize(c, h.db, aircraftID) {
+		return
+	}
 
-	// Get related exceedances
-	exceedances, _ := h.getAircraftExceedances(aircraft.ID)
+	aircraft, err := scanAircraft(h.db.QueryRow("SELECT "+aircraftColumns+" FROM Aircraft WHERE id = ?", aircraftID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Aircraft not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
+		return
+	}
 
-	aircraftWithRelations := struct {
-		models.Aircraft
-		Company    *models.Company     `json:"company"`
-		CSV        []models.CSV        `json:"csv"`
-		EventLog   []models.EventLog   `json:"EventLog"`
-		Exceedance []models.Exceedance `json:"Exceedance"`
-	}{
-		Aircraft:   aircraft,
-		Company:    company,
-		CSV:        csvs,
-		EventLog:   eventLogs,
-		Exceedance: exceedances,
+	result, err := h.withRelations(aircraft)
+	if err != nil {
+		// Related records are optional here, return the aircraft with its company
+		c.JSON(http.StatusOK, result.aircraftWithCompany)
+		return
 	}
 
-	c.JSON(http.StatusOK, aircraftWithRelations)
+	c.JSON(http.StatusOK, result)
 }
 
 // GetAircraftsByUserID retrieves aircraft by company ID (kept for backward compatibility)
 func (h *AircraftHandler) GetAircraftsByUserID(c *gin.Context) {
 	companyID := c.Param("id")
+	if !tenantOf(c).allows(nullString(&companyID)) {
+		denyCrossTenant(c)
+		return
+	}
 
-	query := `SELECT id, airline, aircraftMake, modelNumber, serialNumber, registration, companyId, parameters, createdAt, updatedAt FROM Aircraft WHERE companyId = ?`
-	rows, err := h.db.Query(query, companyID)
+	rows, err := h.db.Query("SELECT "+aircraftColumns+" FROM Aircraft WHERE companyId = ?", companyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 	defer rows.Close()
 
-	var aircrafts []interface{}
+	var aircrafts []models.Aircraft
 	for rows.Next() {
-		var aircraft models.Aircraft
-		var modelNumber, registration, parameters sql.NullString
-		var createdAtStr, updatedAtStr sql.NullString
-
-		err := rows.Scan(&aircraft.ID, &aircraft.Airline, &aircraft.AircraftMake, &modelNumber,
-			&aircraft.SerialNumber, &registration, &aircraft.CompanyID, &parameters, &createdAtStr, &updatedAtStr)
+		aircraft, err := scanAircraft(rows)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning aircraft"})
 			return
 		}
-
-		// Handle nullable fields
-		if modelNumber.Valid {
-			aircraft.ModelNumber = &modelNumber.String
-		}
-		if registration.Valid {
-			aircraft.Registration = &registration.String
-		}
-		if parameters.Valid {
-			aircraft.Parameters = &parameters.String
-		}
-		// Parse timestamps
-		if createdAtStr.Valid {
-			if t, err := parseTimestamp(createdAtStr.String); err == nil {
-				aircraft.CreatedAt = t
-			}
-		}
-		if updatedAtStr.Valid {
-			if t, err := parseTimestamp(updatedAtStr.String); err == nil {
-				aircraft.UpdatedAt = t
-			}
-		}
-
-		// Get company details
-		company, _ := h.getAircraftCompany(aircraft.CompanyID)
-
-		// Get related CSV files
-		csvs, _ := h.getAircraftCSVs(aircraft.ID)
-
-		// Get related event logs
-		eventLogs, _ := h.getAircraftEventLogs(aircraft.ID)
-
-		// Get related exceedances
-		exceedances, _ := h.getAircraftExceedances(aircraft.ID)
-
-		aircraftWithRelations := struct {
-			models.Aircraft
-			Company    *models.Company     `json:"company"`
-			CSV        []models.CSV        `json:"csv"`
-			EventLog   []models.EventLog   `json:"EventLog"`
-			Exceedance []models.Exceedance `json:"Exceedance"`
-		}{
-			Aircraft:   aircraft,
-			Company:    company,
-			CSV:        csvs,
-			EventLog:   eventLogs,
-			Exceedance: exceedances,
-		}
-
-		aircrafts = append(aircrafts, aircraftWithRelations)
+		aircrafts = append(aircrafts, aircraft)
 	}
+	rows.Close()
 
-	c.JSON(http.StatusOK, aircrafts)
+	c.JSON(http.StatusOK, h.withCompanies(aircrafts))
 }
 
 // CreateAircraft creates a new aircraft
@@ -294,6 +263,19 @@ func (h *AircraftHandler) CreateAircraft(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !companyResource.authorize(c, h.db, req.CompanyID) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if !checkQuota(c, tx, req.CompanyID, models.QuotaAircraft, 1) {
+		return
+	}
 
 	// Generate ID and timestamps
 	id := uuid.New().String()
@@ -303,11 +285,15 @@ func (h *AircraftHandler) CreateAircraft(c *gin.Context) {
 	query := `INSERT INTO Aircraft (id, airline, aircraftMake, modelNumber, serialNumber, registration, companyId, parameters, createdAt, updatedAt) 
 			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := h.db.Exec(query, id, req.Airline, req.AircraftMake, req.ModelNumber, req.SerialNumber, req.Registration, req.CompanyID, req.Parameters, now.UnixMilli(), now.UnixMilli())
+	_, err = tx.Exec(query, id, req.Airline, req.AircraftMake, req.ModelNumber, req.SerialNumber, req.Registration, req.CompanyID, req.Parameters, now.UnixMilli(), now.UnixMilli())
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating aircraft"})
 		return
 	}
+	warnQuota(c, h.db, req.CompanyID, models.QuotaAircraft)
 
 	// Return created aircraft
 	aircraft := models.Aircraft{
@@ -334,11 +320,32 @@ func (h *AircraftHandler) UpdateAircraft(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	// The aircraft and the company it is assigned to must both be within the user's scope
+	if !aircraftResource.authorize(c, h.db, id) || !companyResource.authorize(c, h.db, req.CompanyID) {
+		return
+	}
+	// Moving the aircraft to another company counts against that company's aircraft quota
+	currentCompanyID, err := aircraftResource.companyID(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating aircraft"})
+		return
+	}
+	movesCompany := currentCompanyID.String != req.CompanyID
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if movesCompany && !checkQuota(c, tx, req.CompanyID, models.QuotaAircraft, 1) {
+		return
+	}
 
 	now := time.Now()
 
 	query := `UPDATE Aircraft SET airline = ?, aircraftMake = ?, modelNumber = ?, serialNumber = ?, registration = ?, companyId = ?, parameters = ?, updatedAt = ? WHERE id = ?`
-	result, err := h.db.Exec(query, req.Airline, req.AircraftMake, req.ModelNumber, req.SerialNumber, req.Registration, req.CompanyID, req.Parameters, now.UnixMilli(), id)
+	result, err := tx.Exec(query, req.Airline, req.AircraftMake, req.ModelNumber, req.SerialNumber, req.Registration, req.CompanyID, req.Parameters, now.UnixMilli(), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating aircraft"})
 		return
@@ -349,6 +356,13 @@ func (h *AircraftHandler) UpdateAircraft(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Aircraft not found"})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating aircraft"})
+		return
+	}
+	if movesCompany {
+		warnQuota(c, h.db, req.CompanyID, models.QuotaAircraft)
+	}
 
 	// Return updated aircraft
 	aircraft := models.Aircraft{
@@ -388,20 +402,29 @@ func (h *AircraftHandler) DeleteAircraft(c *gin.Context) {
 
 // Helper functions
 
-func (h *AircraftHandler) getAircraftCSVs(aircraftID string) ([]models.CSV, error) {
-	query := `SELECT id, name, file, status, departure, pilot, destination, flightHours, aircraftId, createdAt, updatedAt FROM Csv WHERE aircraftId = ?`
-	rows, err := h.db.Query(query, aircraftID)
+// stringArgs converts ids to query arguments
+func stringArgs(ids []string) []interface{} {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return args
+}
+
+func (h *AircraftHandler) getAircraftCSVs(aircraftIDs []string) (map[string][]models.CSV, error) {
+	query := `SELECT id, name, file, status, departure, destination, flightHours, aircraftId, createdAt, updatedAt FROM Csv WHERE aircraftId IN (` + placeholders(len(aircraftIDs)) + `)`
+	rows, err := h.db.Query(query, stringArgs(aircraftIDs)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var csvs []models.CSV
+	csvs := map[string][]models.CSV{}
 	for rows.Next() {
 		var csv models.CSV
 		var createdAtStr, updatedAtStr sql.NullString
 
-		err := rows.Scan(&csv.ID, &csv.Name, &csv.File, &csv.Status, &csv.Departure, &csv.Pilot,
+		err := rows.Scan(&csv.ID, &csv.Name, &csv.File, &csv.Status, &csv.Departure,
 			&csv.Destination, &csv.FlightHours, &csv.AircraftID, &createdAtStr, &updatedAtStr)
 		if err != nil {
 			continue
@@ -418,21 +441,33 @@ func (h *AircraftHandler) getAircraftCSVs(aircraftID string) ([]models.CSV, erro
 			}
 		}
 
-		csvs = append(csvs, csv)
+		csvs[csv.AircraftID] = append(csvs[csv.AircraftID], csv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
 	}
 
+	crews, err := loadFlightCrews(h.db, "f.aircraftId IN ("+placeholders(len(aircraftIDs))+")", stringArgs(aircraftIDs)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, flights := range csvs {
+		for i := range flights {
+			flights[i].Crew = crews[flights[i].ID]
+		}
+	}
 	return csvs, nil
 }
 
-func (h *AircraftHandler) getAircraftEventLogs(aircraftID string) ([]models.EventLog, error) {
-	query := `SELECT id, eventName, displayName, eventCode, eventDescription, eventParameter, eventTrigger, eventType, flightPhase, high, high1, high2, low, low1, low2, triggerType, detectionPeriod, severities, sop, aircraftId, createdAt, updatedAt FROM EventLog WHERE aircraftId = ?`
-	rows, err := h.db.Query(query, aircraftID)
+func (h *AircraftHandler) getAircraftEventLogs(aircraftIDs []string) (map[string][]models.EventLog, error) {
+	query := `SELECT id, eventName, displayName, eventCode, eventDescription, eventParameter, eventTrigger, eventType, flightPhase, high, high1, high2, low, low1, low2, triggerType, detectionPeriod, severities, sop, aircraftId, createdAt, updatedAt FROM EventLog WHERE aircraftId IN (` + placeholders(len(aircraftIDs)) + `)`
+	rows, err := h.db.Query(query, stringArgs(aircraftIDs)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var eventLogs []models.EventLog
+	eventLogs := map[string][]models.EventLog{}
 	for rows.Next() {
 		var eventLog models.EventLog
 		var createdAtStr, updatedAtStr sql.NullString
@@ -456,21 +491,21 @@ func (h *AircraftHandler) getAircraftEventLogs(aircraftID string) ([]models.Even
 			}
 		}
 
-		eventLogs = append(eventLogs, eventLog)
+		eventLogs[eventLog.AircraftID] = append(eventLogs[eventLog.AircraftID], eventLog)
 	}
 
-	return eventLogs, nil
+	return eventLogs, rows.Err()
 }
 
-func (h *AircraftHandler) getAircraftExceedances(aircraftID string) ([]models.Exceedance, error) {
-	query := `SELECT id, exceedanceValues, flightPhase, parameterName, description, eventStatus, aircraftId, flightId, file, eventId, comment, exceedanceLevel, createdAt, updatedAt FROM Exceedance WHERE aircraftId = ?`
-	rows, err := h.db.Query(query, aircraftID)
+func (h *AircraftHandler) getAircraftExceedances(aircraftIDs []string) (map[string][]models.Exceedance, error) {
+	query := `SELECT id, exceedanceValues, flightPhase, parameterName, description, eventStatus, aircraftId, flightId, file, eventId, comment, exceedanceLevel, createdAt, updatedAt FROM Exceedance WHERE aircraftId IN (` + placeholders(len(aircraftIDs)) + `)`
+	rows, err := h.db.Query(query, stringArgs(aircraftIDs)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var exceedances []models.Exceedance
+	exceedances := map[string][]models.Exceedance{}
 	for rows.Next() {
 		var exceedance models.Exceedance
 		var createdAtStr, updatedAtStr sql.NullString
@@ -494,50 +529,70 @@ func (h *AircraftHandler) getAircraftExceedances(aircraftID string) ([]models.Ex
 			}
 		}
 
-		exceedances = append(exceedances, exceedance)
+		exceedances[exceedance.AircraftID] = append(exceedances[exceedance.AircraftID], exceedance)
 	}
 
-	return exceedances, nil
+	return exceedances, rows.Err()
 }
 
-func (h *AircraftHandler) getAircraftCompany(companyID string) (*models.Company, error) {
-	var company models.Company
-	query := `SELECT id, name, email, phone, address, country, logo, status, subscriptionId, createdAt, updatedAt FROM Company WHERE id = ?`
-
-	var createdAtStr, updatedAtStr sql.NullString
-	err := h.db.QueryRow(query, companyID).Scan(
-		&company.ID, &company.Name, &company.Email, &company.Phone,
-		&company.Address, &company.Country, &company.Logo, &company.Status,
-		&company.SubscriptionID, &createdAtStr, &updatedAtStr)
-
+func (h *AircraftHandler) getAircraftCompanies(companyIDs []string) (map[string]*models.Company, error) {
+	companies := map[string]*models.Company{}
+	query := `SELECT id, name, email, phone, address, country, logo, status, subscriptionId, createdAt, updatedAt FROM Company WHERE id IN (` + placeholders(len(companyIDs)) + `)`
+	rows, err := h.db.Query(query, stringArgs(companyIDs)...)
 	if err != nil {
-		return nil, err
+		return companies, err
 	}
+	defer rows.Close()
 
-	if createdAtStr.Valid {
-		if t, err := parseTimestamp(createdAtStr.String); err == nil {
-			company.CreatedAt = t
+	for rows.Next() {
+		var company models.Company
+		var createdAtStr, updatedAtStr sql.NullString
+		err := rows.Scan(
+			&company.ID, &company.Name, &company.Email, &company.Phone,
+			&company.Address, &company.Country, &company.Logo, &company.Status,
+			&company.SubscriptionID, &createdAtStr, &updatedAtStr)
+		if err != nil {
+			continue
 		}
-	}
-	if updatedAtStr.Valid {
-		if t, err := parseTimestamp(updatedAtStr.String); err == nil {
-			company.UpdatedAt = t
+
+		if createdAtStr.Valid {
+			if t, err := parseTimestamp(createdAtStr.String); err == nil {
+				company.CreatedAt = t
+			}
+		}
+		if updatedAtStr.Valid {
+			if t, err := parseTimestamp(updatedAtStr.String); err == nil {
+				company.UpdatedAt = t
+			}
 		}
+		companies[company.ID] = &company
 	}
+	rows.Close()
 
-	// Get primary user (gatekeeper or first active user) for notification purposes
-	var user models.User
-	userQuery := `SELECT id, email, fullName, role FROM User WHERE companyId = ? AND isActive = 1 ORDER BY 
+	// Get primary user (gatekeeper or first active user) of each company for notification purposes
+	userQuery := `SELECT id, email, fullName, role, companyId FROM User WHERE companyId IN (` + placeholders(len(companyIDs)) + `) AND isActive = 1 ORDER BY 
 		CASE role 
 			WHEN 'gatekeeper' THEN 1 
 			WHEN 'user' THEN 2 
 			ELSE 3 
-		END 
-		LIMIT 1`
+		END`
+	userRows, err := h.db.Query(userQuery, stringArgs(companyIDs)...)
+	if err != nil {
+		return companies, nil
+	}
+	defer userRows.Close()
 
-	var fullName sql.NullString
-	userErr := h.db.QueryRow(userQuery, companyID).Scan(&user.ID, &user.Email, &fullName, &user.Role)
-	if userErr == nil {
+	for userRows.Next() {
+		var user models.User
+		var fullName sql.NullString
+		var companyID string
+		if err := userRows.Scan(&user.ID, &user.Email, &fullName, &user.Role, &companyID); err != nil {
+			continue
+		}
+		company := companies[companyID]
+		if company == nil || len(company.Users) > 0 {
+			continue
+		}
 		if fullName.Valid {
 			user.FullName = &fullName.String
 		}
@@ -545,5 +600,5 @@ func (h *AircraftHandler) getAircraftCompany(companyID string) (*models.Company,
 		company.Users = []models.User{user}
 	}
 
-	return &company, nil
+	return companies, nil
 }
@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"fdm-backend/models"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Airport and route analytics attribute each exceedance by its flight phases:
+// takeoff phases to the departure airport, approach and landing phases to the
+// destination, and everything else to the route only. Risk weighs events by
+// severity with the ranks used for sorting exceedances (low 1, medium 2,
+// high 3, critical 4).
+
+const (
+	defaultAirportLimit = 50
+	maxAirportLimit     = 500
+)
+
+var departurePhases = map[string]bool{
+	"TAXI-OUT": true, "TAXI_OUT": true, "TAXI OUT": true, "TAKEOFF": true, "TAKE-OFF": true,
+	"REJECTED_TAKEOFF": true, "INITIAL_CLIMB": true, "INITIAL CLIMB": true,
+}
+
+var arrivalPhases = map[string]bool{
+	"APPROACH": true, "FINAL_APPROACH": true, "FINAL APPROACH": true, "LANDING": true, "FLARE": true,
+	"ROLLOUT": true, "GO_AROUND": true, "GO-AROUND": true, "TAXI-IN": true, "TAXI_IN": true, "TAXI IN": true,
+}
+
+// airportFlight is a flight with the exceedances attributed to each end
+type airportFlight struct {
+	flight            models.AirportFlight
+	events            int
+	risk              float64
+	departureEvents   int
+	arrivalEvents     int
+	enRouteEvents     int
+	departureRisk     float64
+	arrivalRisk       float64
+	departurePhases   []string
+	arrivalPhases     []string
+	enRoutePhases     []string
+	departureSeverity map[string]int
+	arrivalSeverity   map[string]int
+	allSeverity       map[string]int
+}
+
+func severityWeight(level string) float64 {
+	switch level {
+	case "medium":
+		return 2
+	case "high":
+		return 3
+	case "critical":
+		return 4
+	}
+	return 1
+}
+
+// loadAirportFlights reads the flights in scope with their attributed
+// exceedances. It writes an error response and returns false when the scope
+// parameters are invalid or the flights cannot be read.
+func (h *AnalyticsHandler) loadAirportFlights(c *gin.Context, extra []string, extraArgs []interface{}) ([]*airportFlight, bool) {
+	conditions, args, err := flightScope(c, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	conditions = append(conditions, extra...)
+	args = append(args, extraArgs...)
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	rows, err := h.db.Query(`SELECT f.id, COALESCE(f.name, ''), f.aircraftId, COALESCE(a.registration, a.serialNumber, f.aircraftId),
+			upper(trim(COALESCE(f.departure, ''))), upper(trim(COALESCE(f.destination, ''))), `+sqlEpochMillis("f.createdAt")+`
+		FROM Csv f
+		LEFT JOIN Aircraft a ON f.aircraftId = a.id`+where, args...)
+	if err != nil {
+		log.Println("Error querying airport flights:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	var flights []*airportFlight
+	byID := map[string]*airportFlight{}
+	for rows.Next() {
+		af := &airportFlight{
+			departureSeverity: map[string]int{},
+			arrivalSeverity:   map[string]int{},
+			allSeverity:       map[string]int{},
+		}
+		var createdAt int64
+		f := &af.flight
+		if err := rows.Scan(&f.FlightID, &f.Name, &f.AircraftID, &f.AircraftLabel, &f.Departure, &f.Destination, &createdAt); err != nil {
+			continue
+		}
+		f.CreatedAt = time.UnixMilli(createdAt)
+		flights = append(flights, af)
+		byID[f.FlightID] = af
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error reading airport flights:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+
+	rows, err = h.db.Query(`SELECT e.flightId, COALESCE(e.flightPhase, ''), lower(COALESCE(e.exceedanceLevel, ''))
+		FROM Exceedance e
+		JOIN Csv f ON e.flightId = f.id
+		LEFT JOIN Aircraft a ON f.aircraftId = a.id`+where, args...)
+	if err != nil {
+		log.Println("Error querying airport exceedances:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var flightID, phases, severity string
+		if err := rows.Scan(&flightID, &phases, &severity); err != nil {
+			continue
+		}
+		af, ok := byID[flightID]
+		if !ok {
+			continue
+		}
+		if severity == "" {
+			severity = "unknown"
+		}
+		weight := severityWeight(severity)
+		af.allSeverity[severity]++
+		af.events++
+		af.risk += weight
+
+		// An exceedance spanning taxi-out and taxi-in counts at both airports
+		var departure, arrival bool
+		for _, phase := range splitList(strings.ToUpper(phases)) {
+			switch {
+			case departurePhases[phase]:
+				departure = true
+				af.departurePhases = appendUnique(af.departurePhases, phase)
+			case arrivalPhases[phase]:
+				arrival = true
+				af.arrivalPhases = appendUnique(af.arrivalPhases, phase)
+			default:
+				af.enRoutePhases = appendUnique(af.enRoutePhases, phase)
+			}
+		}
+		if departure {
+			af.departureEvents++
+			af.departureRisk += weight
+			af.departureSeverity[severity]++
+		}
+		if arrival {
+			af.arrivalEvents++
+			af.arrivalRisk += weight
+			af.arrivalSeverity[severity]++
+		}
+		if !departure && !arrival {
+			af.enRouteEvents++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error reading airport exceedances:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return flights, true
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// parseAirportRanking reads the limit, minFlights and sort parameters
+func parseAirportRanking(c *gin.Context, sorts []string, defaultSort string) (limit, minFlights int, sortKey string, ok bool) {
+	limit, minFlights, sortKey = defaultAirportLimit, 1, c.DefaultQuery("sort", defaultSort)
+	if !containsString(sorts, sortKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of " + strings.Join(sorts, ", ")})
+		return 0, 0, "", false
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return 0, 0, "", false
+		}
+		if n > maxAirportLimit {
+			n = maxAirportLimit
+		}
+		limit = n
+	}
+	if v := c.Query("minFlights"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "minFlights must be a non-negative integer"})
+			return 0, 0, "", false
+		}
+		minFlights = n
+	}
+	return limit, minFlights, sortKey, true
+}
+
+var airportSorts = []string{"arrivalRate", "arrivalRisk", "departureRate", "departureRisk", "events", "movements"}
+
+// GetAirportStats ranks airports by exceedances attributed to their takeoffs and
+// approaches, riskiest first.
+//
+//	?sort=arrivalRate|arrivalRisk|departureRate|departureRisk|events|movements&minFlights=10&limit=20&from=2025-01-01
+//
+// minFlights ignores airports with fewer arrivals (arrival sorts), departures
+// (departure sorts) or movements than given.
+func (h *AnalyticsHandler) GetAirportStats(c *gin.Context) {
+	limit, minFlights, sortKey, ok := parseAirportRanking(c, airportSorts, "arrivalRate")
+	if !ok {
+		return
+	}
+	flights, ok := h.loadAirportFlights(c, nil, nil)
+	if !ok {
+		return
+	}
+
+	airports := map[string]*models.AirportStats{}
+	airportFor := func(code string) *models.AirportStats {
+		a, ok := airports[code]
+		if !ok {
+			a = &models.AirportStats{Airport: code, Severities: map[string]int{}}
+			airports[code] = a
+		}
+		return a
+	}
+	departureRisk, arrivalRisk := map[string]float64{}, map[string]float64{}
+	for _, af := range flights {
+		if code := af.flight.Departure; code != "" {
+			a := airportFor(code)
+			a.Departures++
+			a.DepartureEvents += af.departureEvents
+			departureRisk[code] += af.departureRisk
+			for severity, n := range af.departureSeverity {
+				a.Severities[severity] += n
+			}
+		}
+		if code := af.flight.Destination; code != "" {
+			a := airportFor(code)
+			a.Arrivals++
+			a.ArrivalEvents += af.arrivalEvents
+			arrivalRisk[code] += af.arrivalRisk
+			for severity, n := range af.arrivalSeverity {
+				a.Severities[severity] += n
+			}
+		}
+	}
+
+	result := []models.AirportStats{}
+	for code, a := range airports {
+		a.DepartureRate = eventRate(a.DepartureEvents, a.Departures)
+		a.ArrivalRate = eventRate(a.ArrivalEvents, a.Arrivals)
+		a.DepartureRisk = riskRate(departureRisk[code], a.Departures)
+		a.ArrivalRisk = riskRate(arrivalRisk[code], a.Arrivals)
+
+		movements := a.Departures + a.Arrivals
+		switch {
+		case strings.HasPrefix(sortKey, "arrival"):
+			movements = a.Arrivals
+		case strings.HasPrefix(sortKey, "departure"):
+			movements = a.Departures
+		}
+		if movements >= minFlights {
+			result = append(result, *a)
+		}
+	}
+
+	value := func(a models.AirportStats) float64 {
+		switch sortKey {
+		case "arrivalRisk":
+			return a.ArrivalRisk
+		case "departureRate":
+			return a.DepartureRate
+		case "departureRisk":
+			return a.DepartureRisk
+		case "events":
+			return float64(a.DepartureEvents + a.ArrivalEvents)
+		case "movements":
+			return float64(a.Departures + a.Arrivals)
+		}
+		return a.ArrivalRate
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if vi, vj := value(result[i]), value(result[j]); vi != vj {
+			return vi > vj
+		}
+		return result[i].Airport < result[j].Airport
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+var routeSorts = []string{"rate", "risk", "events", "flights"}
+
+// GetRouteStats ranks city pairs by the exceedances of their flights, riskiest first.
+//
+//	?sort=rate|risk|events|flights&minFlights=10&limit=20&from=2025-01-01
+func (h *AnalyticsHandler) GetRouteStats(c *gin.Context) {
+	limit, minFlights, sortKey, ok := parseAirportRanking(c, routeSorts, "rate")
+	if !ok {
+		return
+	}
+	flights, ok := h.loadAirportFlights(c, nil, nil)
+	if !ok {
+		return
+	}
+
+	routes := map[string]*models.RouteStats{}
+	risk := map[string]float64{}
+	for _, af := range flights {
+		key := routeKey(af.flight.Departure, af.flight.Destination)
+		r, ok := routes[key]
+		if !ok {
+			r = &models.RouteStats{
+				Route:       key,
+				Departure:   af.flight.Departure,
+				Destination: af.flight.Destination,
+				Severities:  map[string]int{},
+			}
+			routes[key] = r
+		}
+		r.Flights++
+		r.Events += af.events
+		r.DepartureEvents += af.departureEvents
+		r.ArrivalEvents += af.arrivalEvents
+		r.EnRouteEvents += af.enRouteEvents
+		for severity, n := range af.allSeverity {
+			r.Severities[severity] += n
+		}
+		risk[key] += af.risk
+	}
+
+	result := []models.RouteStats{}
+	for key, r := range routes {
+		r.Rate = eventRate(r.Events, r.Flights)
+		r.Risk = riskRate(risk[key], r.Flights)
+		if r.Flights >= minFlights {
+			result = append(result, *r)
+		}
+	}
+
+	value := func(r models.RouteStats) float64 {
+		switch sortKey {
+		case "risk":
+			return r.Risk
+		case "events":
+			return float64(r.Events)
+		case "flights":
+			return float64(r.Flights)
+		}
+		return r.Rate
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if vi, vj := value(result[i]), value(result[j]); vi != vj {
+			return vi > vj
+		}
+		return result[i].Route < result[j].Route
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetAirportFlights drills down to the flights departing from or arriving at an
+// airport with the exceedances attributed to it, most events first.
+//
+//	?side=arrival|departure (default both)&limit=50
+func (h *AnalyticsHandler) GetAirportFlights(c *gin.Context) {
+	code := strings.ToUpper(strings.TrimSpace(c.Param("code")))
+	side := c.Query("side")
+	var condition string
+	var args []interface{}
+	switch side {
+	case "arrival":
+		condition, args = "upper(trim(f.destination)) = ?", []interface{}{code}
+	case "departure":
+		condition, args = "upper(trim(f.departure)) = ?", []interface{}{code}
+	case "":
+		condition, args = "(upper(trim(f.departure)) = ? OR upper(trim(f.destination)) = ?)", []interface{}{code, code}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "side must be arrival or departure"})
+		return
+	}
+
+	flights, ok := h.loadAirportFlights(c, []string{condition}, args)
+	if !ok {
+		return
+	}
+
+	result := make([]models.AirportFlight, 0, len(flights))
+	for _, af := range flights {
+		f := af.flight
+		f.Phases = []string{}
+		if side != "arrival" && f.Departure == code {
+			f.Events += af.departureEvents
+			f.Risk += af.departureRisk
+			f.Phases = append(f.Phases, af.departurePhases...)
+		}
+		if side != "departure" && f.Destination == code {
+			f.Events += af.arrivalEvents
+			f.Risk += af.arrivalRisk
+			f.Phases = append(f.Phases, af.arrivalPhases...)
+		}
+		result = append(result, f)
+	}
+	writeAirportFlights(c, result)
+}
+
+// GetRouteFlights drills down to the flights of a city pair with all their exceedances.
+// Either side may be left out to match every flight from or to the other.
+//
+//	?departure=HKJK&destination=HKMO&limit=50
+func (h *AnalyticsHandler) GetRouteFlights(c *gin.Context) {
+	departure := strings.ToUpper(strings.TrimSpace(c.Query("departure")))
+	destination := strings.ToUpper(strings.TrimSpace(c.Query("destination")))
+	if departure == "" && destination == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "departure or destination is required"})
+		return
+	}
+
+	var conditions []string
+	var args []interface{}
+	if departure != "" {
+		conditions = append(conditions, "upper(trim(f.departure)) = ?")
+		args = append(args, departure)
+	}
+	if destination != "" {
+		conditions = append(conditions, "upper(trim(f.destination)) = ?")
+		args = append(args, destination)
+	}
+
+	flights, ok := h.loadAirportFlights(c, conditions, args)
+	if !ok {
+		return
+	}
+
+	result := make([]models.AirportFlight, 0, len(flights))
+	for _, af := range flights {
+		f := af.flight
+		f.Events = af.events
+		f.Risk = af.risk
+		f.Phases = append(append(append([]string{}, af.departurePhases...), af.enRoutePhases...), af.arrivalPhases...)
+		result = append(result, f)
+	}
+	writeAirportFlights(c, result)
+}
+
+// writeAirportFlights sorts drill-down flights by risk and applies the limit
+func writeAirportFlights(c *gin.Context, flights []models.AirportFlight) {
+	limit := defaultAirportLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		if n > maxAirportLimit {
+			n = maxAirportLimit
+		}
+		limit = n
+	}
+
+	sort.Slice(flights, func(i, j int) bool {
+		a, b := flights[i], flights[j]
+		if a.Risk != b.Risk {
+			return a.Risk > b.Risk
+		}
+		if a.Events != b.Events {
+			return a.Events > b.Events
+		}
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+	c.Header("X-Total-Count", strconv.Itoa(len(flights)))
+	if len(flights) > limit {
+		flights = flights[:limit]
+	}
+	c.JSON(http.StatusOK, flights)
+}
+
+// riskRate returns severity-weighted events per 1,000 flights
+func riskRate(risk float64, flights int) float64 {
+	if flights == 0 {
+		return 0
+	}
+	return round2(risk * 1000 / float64(flights))
+}
@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/models"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnalyticsHandler serves fleet safety analytics. Every query is limited to the
+// caller's company; admins and FDAs see all operators unless they pass company.
+type AnalyticsHandler struct {
+	db *sql.DB
+}
+
+func NewAnalyticsHandler(db *sql.DB) *AnalyticsHandler {
+	return &AnalyticsHandler{db: db}
+}
+
+const (
+	defaultTrendPeriods = 12
+	maxTrendPeriods     = 156
+	defaultTrendWindow  = 3
+	defaultTrendSeries  = 20
+)
+
+// trendFlight is a flight counted in a trend
+type trendFlight struct {
+	bucket        int
+	aircraftID    string
+	aircraftLabel string
+	route         string
+}
+
+// trendCounts holds flight and event counts per bucket
+type trendCounts struct {
+	key, label string
+	flights    []int
+	events     []int
+}
+
+func newTrendCounts(key, label string, buckets int) *trendCounts {
+	return &trendCounts{key: key, label: label, flights: make([]int, buckets), events: make([]int, buckets)}
+}
+
+// sum returns the flights and events in buckets [from, to)
+func (t *trendCounts) sum(from, to int) (flights, events int) {
+	for i := from; i < to; i++ {
+		flights += t.flights[i]
+		events += t.events[i]
+	}
+	return flights, events
+}
+
+// GetTrends returns the exceedance rate per 1,000 flights by month or week,
+// optionally broken down by event code, severity, phase, aircraft or route.
+//
+//	?interval=month|week&from=2025-01-01&to=2025-12-31&groupBy=eventCode&window=3
+//
+// Flights and their exceedances are bucketed by the date the flight was flown. The
+// range is compared with the same number of periods before it, which also seed
+// the moving average of the first periods.
+func (h *AnalyticsHandler) GetTrends(c *gin.Context) {
+	interval := c.DefaultQuery("interval", models.TrendIntervalMonth)
+	if interval != models.TrendIntervalMonth && interval != models.TrendIntervalWeek {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be month or week"})
+		return
+	}
+
+	groupBy := c.Query("groupBy")
+	if groupBy != "" && !containsString(models.TrendGroups, groupBy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "groupBy must be one of " + strings.Join(models.TrendGroups, ", ")})
+		return
+	}
+
+	end := time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		t, err := parseDateParam(v, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+			return
+		}
+		end = t.UTC()
+	}
+	end = addPeriods(periodStart(end, interval), interval, 1)
+
+	start := addPeriods(end, interval, -defaultTrendPeriods)
+	if v := c.Query("from"); v != "" {
+		t, err := parseDateParam(v, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+			return
+		}
+		start = periodStart(t.UTC(), interval)
+	}
+	if !start.Before(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	periods := 0
+	for t := start; t.Before(end); t = addPeriods(t, interval, 1) {
+		if periods++; periods > maxTrendPeriods {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d periods can be requested", maxTrendPeriods)})
+			return
+		}
+	}
+
+	// Bucket boundaries: the previous range followed by the requested one
+	buckets := 2 * periods
+	bounds := make([]time.Time, buckets+1)
+	for i := range bounds {
+		bounds[i] = addPeriods(start, interval, i-periods)
+	}
+
+	window := defaultTrendWindow
+	if v := c.Query("window"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "window must be a positive integer"})
+			return
+		}
+		window = n
+	}
+	if window > periods {
+		window = periods
+	}
+
+	limit := defaultTrendSeries
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		limit = n
+	}
+
+	// Scope and filters shared by the flight and exceedance queries
+	conditions, args, err := flightScope(c, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Callers limited to their company get it whatever company they pass
+	var companyID *string
+	if tenant := tenantOf(c); !tenant.all {
+		companyID = &tenant.companyID
+	} else if v := strings.TrimSpace(c.Query("company")); v != "" {
+		companyID = &v
+	}
+	conditions = append(conditions, sqlEpochMillis("f.flightDate")+" >= ?", sqlEpochMillis("f.flightDate")+" < ?")
+	args = append(args, bounds[0].UnixMilli(), end.UnixMilli())
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	total := newTrendCounts("", "", buckets)
+	series := map[string]*trendCounts{}
+	seriesFor := func(key, label string) *trendCounts {
+		s, ok := series[key]
+		if !ok {
+			s = newTrendCounts(key, label, buckets)
+			series[key] = s
+		}
+		return s
+	}
+
+	flights := map[string]*trendFlight{}
+	rows, err := h.db.Query(`SELECT f.id, f.aircraftId, COALESCE(a.registration, a.serialNumber, f.aircraftId),
+			COALESCE(f.departure, ''), COALESCE(f.destination, ''), `+sqlEpochMillis("f.flightDate")+`
+		FROM Csv f
+		LEFT JOIN Aircraft a ON f.aircraftId = a.id`+where, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, departure, destination string
+		var flight trendFlight
+		var createdAt int64
+		if err := rows.Scan(&id, &flight.aircraftID, &flight.aircraftLabel, &departure, &destination, &createdAt); err != nil {
+			continue
+		}
+		flight.bucket = bucketIndex(bounds, time.UnixMilli(createdAt))
+		if flight.bucket < 0 {
+			continue
+		}
+		flight.route = routeKey(departure, destination)
+		flights[id] = &flight
+
+		total.flights[flight.bucket]++
+		switch groupBy {
+		case "aircraft":
+			seriesFor(flight.aircraftID, flight.aircraftLabel).flights[flight.bucket]++
+		case "route":
+			seriesFor(flight.route, flight.route).flights[flight.bucket]++
+		}
+	}
+
+	eventRows, err := h.db.Query(`SELECT e.flightId, COALESCE(el.eventCode, ''), COALESCE(el.displayName, e.description, ''),
+			COALESCE(e.exceedanceLevel, ''), COALESCE(e.flightPhase, '')
+		FROM Exceedance e
+		JOIN Csv f ON e.flightId = f.id
+		LEFT JOIN Aircraft a ON f.aircraftId = a.id
+		LEFT JOIN EventLog el ON e.eventId = el.id`+where, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer eventRows.Close()
+	for eventRows.Next() {
+		var flightID, eventCode, eventName, severity, phases string
+		if err := eventRows.Scan(&flightID, &eventCode, &eventName, &severity, &phases); err != nil {
+			continue
+		}
+		flight, ok := flights[flightID]
+		if !ok {
+			continue
+		}
+		total.events[flight.bucket]++
+
+		switch groupBy {
+		case "eventCode":
+			if eventCode == "" {
+				eventCode = "Unknown"
+			}
+			if eventName == "" {
+				eventName = eventCode
+			}
+			seriesFor(eventCode, eventName).events[flight.bucket]++
+		case "severity":
+			if severity == "" {
+				severity = "Unknown"
+			}
+			seriesFor(severity, severity).events[flight.bucket]++
+		case "phase":
+			// Exceedances spanning several phases count once in each
+			for _, phase := range splitList(strings.ToUpper(phases)) {
+				seriesFor(phase, phase).events[flight.bucket]++
+			}
+		case "aircraft":
+			seriesFor(flight.aircraftID, flight.aircraftLabel).events[flight.bucket]++
+		case "route":
+			seriesFor(flight.route, flight.route).events[flight.bucket]++
+		}
+	}
+
+	// Event breakdowns share the fleet's flight counts
+	if groupBy == "eventCode" || groupBy == "severity" || groupBy == "phase" {
+		for _, s := range series {
+			copy(s.flights, total.flights)
+		}
+	}
+
+	response := models.TrendsResponse{
+		Interval:  interval,
+		GroupBy:   groupBy,
+		Window:    window,
+		CompanyID: companyID,
+		Periods:   trendPoints(total, bounds, interval, periods, window),
+		Series:    []models.TrendSeries{},
+	}
+
+	currentFlights, currentEvents := total.sum(periods, buckets)
+	previousFlights, previousEvents := total.sum(0, periods)
+	response.Comparison = models.TrendComparison{
+		Current:  models.TrendTotals{From: start, To: end, Flights: currentFlights, Events: currentEvents, Rate: eventRate(currentEvents, currentFlights)},
+		Previous: models.TrendTotals{From: bounds[0], To: start, Flights: previousFlights, Events: previousEvents, Rate: eventRate(previousEvents, previousFlights)},
+	}
+	response.Comparison.RateChange = round2(response.Comparison.Current.Rate - response.Comparison.Previous.Rate)
+	response.Comparison.RateChangePercent = changePercent(response.Comparison.Previous.Rate, response.Comparison.Current.Rate)
+
+	for _, s := range series {
+		flights, events := s.sum(periods, buckets)
+		previousFlights, previousEvents := s.sum(0, periods)
+		if flights == 0 && events == 0 {
+			continue
+		}
+		rate := eventRate(events, flights)
+		previousRate := eventRate(previousEvents, previousFlights)
+		response.Series = append(response.Series, models.TrendSeries{
+			Key:               s.key,
+			Label:             s.label,
+			Flights:           flights,
+			Events:            events,
+			Rate:              rate,
+			PreviousRate:      previousRate,
+			RateChangePercent: changePercent(previousRate, rate),
+			Points:            trendPoints(s, bounds, interval, periods, window),
+		})
+	}
+	sort.Slice(response.Series, func(i, j int) bool {
+		a, b := response.Series[i], response.Series[j]
+		if a.Rate != b.Rate {
+			return a.Rate > b.Rate
+		}
+		return a.Key < b.Key
+	})
+	if len(response.Series) > limit {
+		response.Series = response.Series[:limit]
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// flightScope returns conditions on Csv f and Aircraft a limiting flights to the
+// caller's company and the company, aircraft and, when dates is set, from/to
+// query parameters
+func flightScope(c *gin.Context, dates bool) ([]string, []interface{}, error) {
+	condition, args := tenantOf(c).condition("a.companyId")
+	conditions := []string{condition}
+	filters := map[string]listFilter{
+		"company":  eqFilter("a.companyId"),
+		"aircraft": eqFilter("f.aircraftId"),
+	}
+	if dates {
+		filters["from"] = dateFilter("f.createdAt", false)
+		filters["to"] = dateFilter("f.createdAt", true)
+	}
+	for _, param := range []string{"company", "aircraft", "from", "to"} {
+		filter, ok := filters[param]
+		value := strings.TrimSpace(c.Query(param))
+		if !ok || value == "" {
+			continue
+		}
+		filterCondition, filterArgs, err := filter(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %v", param, err)
+		}
+		conditions = append(conditions, filterCondition)
+		args = append(args, filterArgs...)
+	}
+	return conditions, args, nil
+}
+
+// trendPoints builds the points of the requested range. The moving average is
+// the rate over the trailing window, pooling flights and events so quiet
+// periods do not dominate.
+func trendPoints(counts *trendCounts, bounds []time.Time, interval string, periods, window int) []models.TrendPoint {
+	points := make([]models.TrendPoint, 0, periods)
+	for i := periods; i < 2*periods; i++ {
+		flights, events := counts.sum(i, i+1)
+		windowFlights, windowEvents := counts.sum(i-window+1, i+1)
+		points = append(points, models.TrendPoint{
+			Period:        periodLabel(bounds[i], interval),
+			Start:         bounds[i],
+			Flights:       flights,
+			Events:        events,
+			Rate:          eventRate(events, flights),
+			MovingAverage: eventRate(windowEvents, windowFlights),
+		})
+	}
+	return points
+}
+
+// periodStart truncates t to the start of its month, ISO week (Monday) or day
+func periodStart(t time.Time, interval string) time.Time {
+	if interval == models.TrendIntervalDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	if interval == models.TrendIntervalWeek {
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// addPeriods moves a period start n months, weeks or days
+func addPeriods(t time.Time, interval string, n int) time.Time {
+	if interval == models.TrendIntervalDay {
+		return t.AddDate(0, 0, n)
+	}
+	if interval == models.TrendIntervalWeek {
+		return t.AddDate(0, 0, 7*n)
+	}
+	return t.AddDate(0, n, 0)
+}
+
+// periodLabel names a period, e.g. 2025-11, 2025-W47 or 2025-11-17
+func periodLabel(start time.Time, interval string) string {
+	if interval == models.TrendIntervalDay {
+		return start.Format("2006-01-02")
+	}
+	if interval == models.TrendIntervalWeek {
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return start.Format("2006-01")
+}
+
+// bucketIndex returns the bucket holding t, or -1 when t is outside the bounds
+func bucketIndex(bounds []time.Time, t time.Time) int {
+	i := sort.Search(len(bounds), func(i int) bool { return bounds[i].After(t) }) - 1
+	if i < 0 || i >= len(bounds)-1 {
+		return -1
+	}
+	return i
+}
+
+// routeKey names a city pair, e.g. HKJK-HKMO
+func routeKey(departure, destination string) string {
+	departure = strings.ToUpper(strings.TrimSpace(departure))
+	destination = strings.ToUpper(strings.TrimSpace(destination))
+	if departure == "" && destination == "" {
+		return "Unknown"
+	}
+	if departure == "" {
+		departure = "?"
+	}
+	if destination == "" {
+		destination = "?"
+	}
+	return departure + "-" + destination
+}
+
+// eventRate returns events per 1,000 flights
+func eventRate(events, flights int) float64 {
+	if flights == 0 {
+		return 0
+	}
+	return round2(float64(events) * 1000 / float64(flights))
+}
+
+// changePercent returns the relative change from previous to current, or nil
+// when there is no previous rate to compare with
+func changePercent(previous, current float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	change := round2((current - previous) / previous * 100)
+	return &change
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fdm-backend/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTrendsCountFlightsByFlightDate(t *testing.T) {
+	db := newTenantTestDB(t)
+	// Flown in March, uploaded now
+	if _, err := db.Exec("UPDATE Csv SET flightDate = ?", time.Date(2025, 3, 14, 8, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		actor   tenantActor
+		query   string
+		company string
+	}{
+		{gatekeeperAActor, "", "company-a"},
+		{adminActor, "&company=company-b", "company-b"},
+	}
+	for _, tc := range cases {
+		path := "/api/analytics/trends?from=2025-01-01&to=2025-04-30" + tc.query
+		w := tenantRequest{method: http.MethodGet, path: path}.serve(newTenantTestRouter(db, tc.actor))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body = %s", tc.actor.role, w.Code, w.Body)
+		}
+		var trends models.TrendsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &trends); err != nil {
+			t.Fatal(err)
+		}
+		if trends.CompanyID == nil || *trends.CompanyID != tc.company {
+			t.Errorf("%s: companyId = %v, want %s", tc.actor.role, trends.CompanyID, tc.company)
+		}
+		for _, p := range trends.Periods {
+			want := 0
+			if p.Period == "2025-03" {
+				want = 1
+			}
+			if p.Flights != want {
+				t.Errorf("%s: %s flights = %d, want %d", tc.actor.role, p.Period, p.Flights, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fdm-backend/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// criticalDueWindow is the default time allowed to review an auto-assigned critical exceedance
+const criticalDueWindow = 48 * time.Hour
+
+// validateAssignee checks that a user exists, is active and may review exceedances
+func validateAssignee(exec dbExecutor, userID string) error {
+	var role string
+	var isActive bool
+	err := exec.QueryRow("SELECT role, isActive FROM User WHERE id = ?", userID).Scan(&role, &isActive)
+	if err != nil {
+		return err
+	}
+	if !isActive || (role != models.RoleFDA && role != models.RoleAdmin) {
+		return errInvalidAssignee
+	}
+	return nil
+}
+
+var errInvalidAssignee = errors.New("Assignee must be an active FDA or admin user")
+
+// nextRoundRobinAssignee picks the next active FDA for the company owning an aircraft.
+// FDAs belonging to the company are preferred; analysts without a company (who
+// review for every operator) are used when the company has none. Returns an
+// empty string when nobody is available.
+func nextRoundRobinAssignee(exec dbExecutor, aircraftID string, now time.Time) (string, error) {
+	var companyID sql.NullString
+	err := exec.QueryRow("SELECT companyId FROM Aircraft WHERE id = ?", aircraftID).Scan(&companyID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	candidates, err := activeFDAIDs(exec, "companyId = ?", companyID.String)
+	if err != nil {
+		return "", err
+	}
+	if len(candidates) == 0 {
+		candidates, err = activeFDAIDs(exec, "companyId IS NULL")
+		if err != nil {
+			return "", err
+		}
+	}
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	var lastUserID sql.NullString
+	err = exec.QueryRow("SELECT lastUserId FROM AssignmentRotation WHERE companyId = ?", companyID.String).Scan(&lastUserID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+
+	next := candidates[0]
+	for i, id := range candidates {
+		if id == lastUserID.String {
+			next = candidates[(i+1)%len(candidates)]
+			break
+		}
+	}
+
+	_, err = exec.Exec(`INSERT INTO AssignmentRotation (companyId, lastUserId, updatedAt) VALUES (?, ?, ?)
+		ON CONFLICT(companyId) DO UPDATE SET lastUserId = excluded.lastUserId, updatedAt = excluded.updatedAt`,
+		companyID.String, next, now.UnixMilli())
+	if err != nil {
+		return "", err
+	}
+	return next, nil
+}
+
+// activeFDAIDs lists active FDA users matching filter in a stable order
+func activeFDAIDs(exec dbExecutor, filter string, args ...interface{}) ([]string, error) {
+	rows, err := exec.Query("SELECT id FROM User WHERE role = 'fda' AND isActive = 1 AND "+filter+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// applyAssignment updates the assignment fields of a single exceedance
+func applyAssignment(exec dbExecutor, id string, assigneeID *string, dueDate models.OptionalTime, priority *string, now time.Time) (bool, error) {
+	sets := []string{"updatedAt = ?"}
+	args := []interface{}{now.UnixMilli()}
+
+	if assigneeID != nil {
+		if *assigneeID == "" {
+			sets = append(sets, "assigneeId = NULL")
+		} else {
+			sets = append(sets, "assigneeId = ?")
+			args = append(args, *assigneeID)
+		}
+	}
+	if dueDate.Set {
+		if dueDate.Time == nil {
+			sets = append(sets, "dueDate = NULL")
+		} else {
+			sets = append(sets, "dueDate = ?")
+			args = append(args, dueDate.Time.UnixMilli())
+		}
+	}
+	if priority != nil {
+		sets = append(sets, "priority = ?")
+		args = append(args, *priority)
+	}
+
+	args = append(args, id)
+	result, err := exec.Exec("UPDATE Exceedance SET "+strings.Join(sets, ", ")+" WHERE id = ?", args...)
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// validateAssignmentFields normalises the priority and checks the assignee
+func validateAssignmentFields(c *gin.Context, exec dbExecutor, assigneeID *string, priority *string) bool {
+	if priority != nil {
+		normalized, ok := models.NormalizeExceedancePriority(*priority)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid priority: " + *priority, "allowed": models.ExceedancePriorities})
+			return false
+		}
+		*priority = normalized
+	}
+	if assigneeID != nil && *assigneeID != "" {
+		err := validateAssignee(exec, *assigneeID)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee not found"})
+			return false
+		}
+		if err == errInvalidAssignee {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateExceedanceAssignment sets the assignee, due date and priority of an exceedance
+func (h *ExceedanceHandler) UpdateExceedanceAssignment(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.UpdateAssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.AssigneeID == nil && !req.DueDate.Set && req.Priority == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if !validateAssignmentFields(c, h.db, req.AssigneeID, req.Priority) {
+		return
+	}
+
+	found, err := applyAssignment(h.db, id, req.AssigneeID, req.DueDate, req.Priority, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating assignment"})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exceedance not found"})
+		return
+	}
+
+	h.GetExceedanceByID(c)
+}
+
+// BulkAssignExceedances reassigns a set of exceedances in a single transaction
+func (h *ExceedanceHandler) BulkAssignExceedances(c *gin.Context) {
+	var req models.BulkAssignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.IDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No exceedance ids provided"})
+		return
+	}
+	if req.AssigneeID == nil && !req.DueDate.Set && req.Priority == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+	if !validateAssignmentFields(c, h.db, req.AssigneeID, req.Priority) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var notFound []string
+	for _, id := range req.IDs {
+		found, err := applyAssignment(tx, id, req.AssigneeID, req.DueDate, req.Priority, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating assignment"})
+			return
+		}
+		if !found {
+			notFound = append(notFound, id)
+		}
+	}
+	if len(notFound) > 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exceedances not found", "ids": notFound})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating assignment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exceedances reassigned", "updated": len(req.IDs)})
+}
+
+// GetExceedanceQueue returns the analyst work queue ordered by priority, due date and age.
+// Filters: assignee (me, unassigned or a user id), status (comma separated, defaults to
+// open statuses, "all" for every status), severity, priority, minAgeHours, maxAgeHours
+// and overdue=true.
+func (h *ExceedanceHandler) GetExceedanceQueue(c *gin.Context) {
+	now := time.Now()
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	switch assignee := c.Query("assignee"); assignee {
+	case "":
+	case "me":
+		conditions = append(conditions, "e.assigneeId = ?")
+		args = append(args, c.GetString("userId"))
+	case "unassigned":
+		conditions = append(conditions, "e.assigneeId IS NULL")
+	default:
+		conditions = append(conditions, "e.assigneeId = ?")
+		args = append(args, assignee)
+	}
+
+	statuses := models.OpenExceedanceStatuses
+	if status := c.Query("status"); status != "" {
+		statuses = nil
+		if status != "all" {
+			for _, s := range strings.Split(status, ",") {
+				normalized, ok := models.NormalizeExceedanceStatus(s)
+				if !ok {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event status: " + s, "allowed": models.ExceedanceStatuses})
+					return
+				}
+				statuses = append(statuses, normalized)
+			}
+		}
+	}
+	if len(statuses) > 0 {
+		conditions = append(conditions, "e.eventStatus IN ("+placeholders(len(statuses))+")")
+		for _, s := range statuses {
+			args = append(args, s)
+		}
+	}
+
+	if severity := c.Query("severity"); severity != "" {
+		levels := strings.Split(strings.ToLower(severity), ",")
+		conditions = append(conditions, "lower(e.exceedanceLevel) IN ("+placeholders(len(levels))+")")
+		for _, l := range levels {
+			args = append(args, strings.TrimSpace(l))
+		}
+	}
+
+	if priority := c.Query("priority"); priority != "" {
+		values := strings.Split(strings.ToLower(priority), ",")
+		conditions = append(conditions, "e.priority IN ("+placeholders(len(values))+")")
+		for _, p := range values {
+			args = append(args, strings.TrimSpace(p))
+		}
+	}
+
+	if v := c.Query("minAgeHours"); v != "" {
+		hours, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid minAgeHours"})
+			return
+		}
+		conditions = append(conditions, "e.createdAt <= ?")
+		args = append(args, now.Add(-time.Duration(hours*float64(time.Hour))).UnixMilli())
+	}
+	if v := c.Query("maxAgeHours"); v != "" {
+		hours, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid maxAgeHours"})
+			return
+		}
+		conditions = append(conditions, "e.createdAt >= ?")
+		args = append(args, now.Add(-time.Duration(hours*float64(time.Hour))).UnixMilli())
+	}
+
+	if c.Query("overdue") == "true" {
+		conditions = append(conditions, "e.dueDate IS NOT NULL AND e.dueDate < ?")
+		args = append(args, now.UnixMilli())
+	}
+
+	query := `SELECT e.id, COALESCE(e.eventStatus, ''), e.exceedanceLevel, e.priority, e.assigneeId, u.fullName, e.dueDate,
+			  COALESCE(e.description, ''), COALESCE(e.flightPhase, ''), el.eventName, COALESCE(e.flightId, ''), c.name,
+			  COALESCE(e.aircraftId, ''), a.companyId, e.createdAt
+			  FROM Exceedance e
+			  LEFT JOIN User u ON e.assigneeId = u.id
+			  LEFT JOIN EventLog el ON e.eventId = el.id
+			  LEFT JOIN Csv c ON e.flightId = c.id
+			  LEFT JOIN Aircraft a ON e.aircraftId = a.id
+			  WHERE ` + strings.Join(conditions, " AND ") + `
+			  ORDER BY CASE e.priority WHEN 'critical' THEN 0 WHEN 'high' THEN 1 WHEN 'medium' THEN 2 ELSE 3 END,
+			  e.dueDate IS NULL, e.dueDate ASC, e.createdAt ASC`
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		log.Println("Error querying exceedance queue:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	queue := []models.ExceedanceQueueItem{}
+	for rows.Next() {
+		var item models.ExceedanceQueueItem
+		var dueDate sql.NullInt64
+		var createdAt int64
+		err := rows.Scan(&item.ID, &item.EventStatus, &item.ExceedanceLevel, &item.Priority, &item.AssigneeID,
+			&item.AssigneeName, &dueDate, &item.Description, &item.FlightPhase, &item.EventName, &item.FlightID,
+			&item.FlightName, &item.AircraftID, &item.CompanyID, &createdAt)
+		if err != nil {
+			log.Println("Error scanning exceedance queue:", err)
+			continue
+		}
+		item.CreatedAt = time.UnixMilli(createdAt)
+		item.AgeHours = now.Sub(item.CreatedAt).Hours()
+		if dueDate.Valid {
+			due := time.UnixMilli(dueDate.Int64)
+			item.DueDate = &due
+			item.Overdue = due.Before(now)
+		}
+		queue = append(queue, item)
+	}
+
+	c.JSON(http.StatusOK, queue)
+}
+
+// placeholders returns n comma separated SQL parameter markers
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
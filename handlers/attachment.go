@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/models"
+	"fdm-backend/storage"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxAttachmentSize limits files attached to exceedances (crew reports, photos, ATC transcripts)
+const maxAttachmentSize = 25 << 20 // 25 MiB
+
+// attachmentStorageKey returns where an attachment's content is kept in storage
+func attachmentStorageKey(exceedanceID, attachmentID, fileName string) string {
+	return "exceedances/" + exceedanceID + "/" + attachmentID + filepath.Ext(fileName)
+}
+
+// attachmentStorageKeys lists the stored files of every attachment of exceedances matching filter
+func attachmentStorageKeys(exec dbExecutor, filter string, args ...interface{}) ([]string, error) {
+	rows, err := exec.Query("SELECT storageKey FROM ExceedanceAttachment WHERE exceedanceId IN (SELECT id FROM Exceedance WHERE "+filter+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// removeStoredFiles deletes attachment content from storage, logging failures
+func removeStoredFiles(keys []string) {
+	for _, key := range keys {
+		if err := storage.Default().Delete(key); err != nil {
+			log.Printf("Warning: Failed to delete attachment %s: %v", key, err)
+		}
+	}
+}
+
+// GetExceedanceAttachments lists the files attached to an exceedance
+func (h *ExceedanceHandler) GetExceedanceAttachments(c *gin.Context) {
+	id := c.Param("id")
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT at.id, at.exceedanceId, at.userId, u.fullName, at.fileName, at.contentType, at.size, at.createdAt
+		FROM ExceedanceAttachment at
+		LEFT JOIN User u ON at.userId = u.id
+		WHERE at.exceedanceId = ?
+		ORDER BY at.createdAt ASC`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	attachments := []models.ExceedanceAttachment{}
+	for rows.Next() {
+		var attachment models.ExceedanceAttachment
+		var createdAt int64
+		err := rows.Scan(&attachment.ID, &attachment.ExceedanceID, &attachment.UserID, &attachment.UserName,
+			&attachment.FileName, &attachment.ContentType, &attachment.Size, &createdAt)
+		if err != nil {
+			log.Println("Error scanning attachment:", err)
+			continue
+		}
+		attachment.CreatedAt = time.UnixMilli(createdAt)
+		attachments = append(attachments, attachment)
+	}
+
+	c.JSON(http.StatusOK, attachments)
+}
+
+// UploadExceedanceAttachment attaches a file to an exceedance
+func (h *ExceedanceHandler) UploadExceedanceAttachment(c *gin.Context) {
+	id := c.Param("id")
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	if file.Size > maxAttachmentSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File exceeds the %d MiB limit", maxAttachmentSize>>20)})
+		return
+	}
+	companyID, err := exceedanceResource.companyID(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	// Checked again with the insert; this spares storing a file that cannot be kept
+	if !checkQuota(c, h.db, companyID.String, models.QuotaStorage, file.Size) {
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read uploaded file"})
+		return
+	}
+	defer src.Close()
+
+	now := time.Now()
+	userID := c.GetString("userId")
+	attachment := models.ExceedanceAttachment{
+		ID:           uuid.New().String(),
+		ExceedanceID: id,
+		FileName:     filepath.Base(file.Filename),
+		CreatedAt:    now,
+	}
+	if userID != "" {
+		attachment.UserID = &userID
+		h.db.QueryRow("SELECT fullName FROM User WHERE id = ?", userID).Scan(&attachment.UserName)
+	}
+	if contentType := file.Header.Get("Content-Type"); contentType != "" {
+		attachment.ContentType = &contentType
+	}
+
+	key := attachmentStorageKey(id, attachment.ID, attachment.FileName)
+	attachment.Size, err = storage.Default().Save(key, src)
+	if err != nil {
+		log.Println("Error storing attachment:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "File upload failed"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		storage.Default().Delete(key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if !checkQuota(c, tx, companyID.String, models.QuotaStorage, attachment.Size) {
+		storage.Default().Delete(key)
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO ExceedanceAttachment (id, exceedanceId, userId, fileName, contentType, size, storageKey, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		attachment.ID, id, attachment.UserID, attachment.FileName, attachment.ContentType, attachment.Size, key, now.UnixMilli())
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		storage.Default().Delete(key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving attachment"})
+		return
+	}
+	warnQuota(c, h.db, companyID.String, models.QuotaStorage)
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// DownloadExceedanceAttachment streams an attachment's content
+func (h *ExceedanceHandler) DownloadExceedanceAttachment(c *gin.Context) {
+	id := c.Param("id")
+	attachmentID := c.Param("attachmentId")
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
+	var fileName, key string
+	var contentType sql.NullString
+	var size int64
+	err := h.db.QueryRow("SELECT fileName, contentType, size, storageKey FROM ExceedanceAttachment WHERE id = ? AND exceedanceId = ?",
+		attachmentID, id).Scan(&fileName, &contentType, &size, &key)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	reader, err := storage.Default().Open(key)
+	if err != nil {
+		log.Println("Error opening attachment:", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	defer reader.Close()
+
+	if !contentType.Valid || contentType.String == "" {
+		contentType.String = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, size, contentType.String, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename=%q", fileName),
+	})
+}
+
+// DeleteExceedanceAttachment removes an attachment. Uploaders may delete their
+// own files; admins and FDAs may delete any file.
+func (h *ExceedanceHandler) DeleteExceedanceAttachment(c *gin.Context) {
+	id := c.Param("id")
+	attachmentID := c.Param("attachmentId")
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
+	var uploaderID sql.NullString
+	var key string
+	err := h.db.QueryRow("SELECT userId, storageKey FROM ExceedanceAttachment WHERE id = ? AND exceedanceId = ?",
+		attachmentID, id).Scan(&uploaderID, &key)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	role := c.GetString("userRole")
+	isUploader := uploaderID.Valid && uploaderID.String == c.GetString("userId")
+	if !isUploader && role != models.RoleAdmin && role != models.RoleFDA {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied", "message": "You can only delete your own attachments"})
+		return
+	}
+
+	if _, err := h.db.Exec("DELETE FROM ExceedanceAttachment WHERE id = ?", attachmentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting attachment"})
+		return
+	}
+	removeStoredFiles([]string{key})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
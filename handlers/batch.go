@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exceedanceBatchValidator checks rows of an exceedance batch, caching the
+// flights, aircraft and events it has already looked up
+type exceedanceBatchValidator struct {
+	exec          dbExecutor
+	role          string
+	userCompanyID string
+
+	aircraftCompany map[string]sql.NullString // aircraft id -> company id
+	flightAircraft  map[string]sql.NullString // flight id -> aircraft id
+	eventAircraft   map[string]sql.NullString // event id -> aircraft id
+	assignees       map[string]error
+}
+
+func newExceedanceBatchValidator(exec dbExecutor, c *gin.Context) *exceedanceBatchValidator {
+	return &exceedanceBatchValidator{
+		exec:            exec,
+		role:            c.GetString("userRole"),
+		userCompanyID:   c.GetString("userCompanyId"),
+		aircraftCompany: map[string]sql.NullString{},
+		flightAircraft:  map[string]sql.NullString{},
+		eventAircraft:   map[string]sql.NullString{},
+		assignees:       map[string]error{},
+	}
+}
+
+// lookup runs a single-column query and caches the result. found is false when no row exists.
+func (v *exceedanceBatchValidator) lookup(cache map[string]sql.NullString, query, id string) (value sql.NullString, found bool, err error) {
+	if value, ok := cache[id]; ok {
+		return value, true, nil
+	}
+	err = v.exec.QueryRow(query, id).Scan(&value)
+	if err == sql.ErrNoRows {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, err
+	}
+	cache[id] = value
+	return value, true, nil
+}
+
+func (v *exceedanceBatchValidator) companyOfAircraft(aircraftID string) (sql.NullString, bool, error) {
+	return v.lookup(v.aircraftCompany, "SELECT companyId FROM Aircraft WHERE id = ?", aircraftID)
+}
+
+// validate normalises a row in place and returns its validation errors. A
+// non-nil error is only returned for database failures.
+func (v *exceedanceBatchValidator) validate(index int, exceedance *models.Exceedance) ([]models.RowError, error) {
+	var rowErrors []models.RowError
+	fail := func(field, message string) {
+		rowErrors = append(rowErrors, models.RowError{Index: index, Field: field, Message: message})
+	}
+
+	// New detections enter the review workflow as "new"; later states are only
+	// reached through workflow transitions
+	if exceedance.EventStatus == "" {
+		exceedance.EventStatus = models.ExceedanceStatusNew
+	}
+	if status, ok := models.NormalizeExceedanceStatus(exceedance.EventStatus); !ok {
+		fail("eventStatus", "Invalid event status: "+exceedance.EventStatus+" (allowed: "+strings.Join(models.ExceedanceStatuses, ", ")+")")
+	} else if status != models.ExceedanceStatusNew {
+		fail("eventStatus", "New exceedances must have status "+models.ExceedanceStatusNew+"; use the workflow to move them on")
+	} else {
+		exceedance.EventStatus = status
+	}
+
+	if exceedance.Priority != nil {
+		if priority, ok := models.NormalizeExceedancePriority(*exceedance.Priority); ok {
+			exceedance.Priority = &priority
+		} else {
+			fail("priority", "Invalid priority: "+*exceedance.Priority+" (allowed: "+strings.Join(models.ExceedancePriorities, ", ")+")")
+		}
+	}
+
+	if exceedance.AssigneeID != nil && *exceedance.AssigneeID != "" {
+		err, checked := v.assignees[*exceedance.AssigneeID]
+		if !checked {
+			err = validateAssignee(v.exec, *exceedance.AssigneeID)
+			if err != nil && err != sql.ErrNoRows && err != errInvalidAssignee {
+				return nil, err
+			}
+			v.assignees[*exceedance.AssigneeID] = err
+		}
+		if err == sql.ErrNoRows {
+			fail("assigneeId", "Assignee not found")
+		} else if err != nil {
+			fail("assigneeId", err.Error())
+		}
+	}
+
+	// Flight, aircraft and event must exist and belong to the same company
+	var aircraftCompany sql.NullString
+	aircraftOK := false
+	if exceedance.AircraftID == "" {
+		fail("aircraftId", "aircraftId is required")
+	} else {
+		company, found, err := v.companyOfAircraft(exceedance.AircraftID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case !found:
+			fail("aircraftId", "Aircraft not found")
+		case v.role != models.RoleAdmin && v.role != models.RoleFDA && (!company.Valid || company.String != v.userCompanyID):
+			fail("aircraftId", "Aircraft belongs to another company")
+		default:
+			aircraftCompany = company
+			aircraftOK = true
+		}
+	}
+
+	if exceedance.FlightID == "" {
+		fail("flightId", "flightId is required")
+	} else {
+		flightAircraft, found, err := v.lookup(v.flightAircraft, "SELECT aircraftId FROM Csv WHERE id = ?", exceedance.FlightID)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			fail("flightId", "Flight not found")
+		} else if aircraftOK && flightAircraft.Valid && flightAircraft.String != exceedance.AircraftID {
+			company, _, err := v.companyOfAircraft(flightAircraft.String)
+			if err != nil {
+				return nil, err
+			}
+			if company != aircraftCompany {
+				fail("flightId", "Flight belongs to a different company than the aircraft")
+			}
+		}
+	}
+
+	if exceedance.EventID != nil && *exceedance.EventID != "" {
+		eventAircraft, found, err := v.lookup(v.eventAircraft, "SELECT aircraftId FROM EventLog WHERE id = ?", *exceedance.EventID)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			fail("eventId", "Event not found")
+		} else if aircraftOK && eventAircraft.Valid && eventAircraft.String != exceedance.AircraftID {
+			company, _, err := v.companyOfAircraft(eventAircraft.String)
+			if err != nil {
+				return nil, err
+			}
+			if company != aircraftCompany {
+				fail("eventId", "Event belongs to a different company than the aircraft")
+			}
+		}
+	}
+
+	return rowErrors, nil
+}
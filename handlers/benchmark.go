@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fdm-backend/config"
+	"fdm-backend/models"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Benchmarks compare a company with other operators without revealing them:
+// peers only appear as aggregates of at least config.GetBenchmarkMinGroupSize()
+// operators, and Laplace noise is added to every peer-derived figure. The
+// noise of a figure is derived from the company, date range, group and
+// statistic, so repeating a query returns the same figures and averaging
+// repeated answers does not cancel the noise.
+
+const (
+	defaultBenchmarkEpsilon = 1.0
+	minBenchmarkEpsilon     = 0.01
+	benchmarkRateCap        = 2000 // events per 1,000 flights
+)
+
+// operatorCounts are one operator's flights and exceedances in a benchmark group
+type operatorCounts struct {
+	flights, events int
+}
+
+func (o operatorCounts) rate() float64 {
+	return eventRate(o.events, o.flights)
+}
+
+// benchmarkGroup maps operator (company id) to its counts
+type benchmarkGroup map[string]*operatorCounts
+
+func (g benchmarkGroup) add(companyID string, flights, events int) {
+	o, ok := g[companyID]
+	if !ok {
+		o = &operatorCounts{}
+		g[companyID] = o
+	}
+	o.flights += flights
+	o.events += events
+}
+
+// benchmarkNoise adds Laplace noise calibrated to clipped per-operator rates.
+// query names the company and date range the noise is drawn for.
+type benchmarkNoise struct {
+	epsilon float64
+	query   string
+}
+
+// laplace returns noise for a statistic that one operator can move by at most
+// sensitivity. The noise is a keyed hash of the query, group and statistic
+// rather than random, so the same figure always gets the same noise; it does
+// not depend on epsilon beyond its scale, so asking with several budgets does
+// not reveal more either.
+func (n *benchmarkNoise) laplace(group, statistic string, sensitivity float64) float64 {
+	mac := hmac.New(sha256.New, []byte(config.GetJWTSecret()))
+	mac.Write([]byte(n.query + "\x00" + group + "\x00" + statistic))
+	// Uniform in (-0.5, 0.5), never exactly ±0.5
+	u := (float64(binary.BigEndian.Uint64(mac.Sum(nil))>>11)+0.5)/(1<<53) - 0.5
+	scale := sensitivity / n.epsilon
+	return -scale * math.Copysign(1, u) * math.Log(1-2*math.Abs(u))
+}
+
+// GetBenchmarks compares the caller's company with anonymized peer aggregates,
+// overall, per aircraft type the company operates and per severity.
+//
+//	?from=2025-01-01&to=2025-12-31&noise=true&epsilon=0.5
+//
+// Admins and FDAs pick the company with ?company=<id>.
+func (h *AnalyticsHandler) GetBenchmarks(c *gin.Context) {
+	tenant := tenantOf(c)
+	companyID := strings.TrimSpace(c.Query("company"))
+	if !tenant.all {
+		if companyID != "" && companyID != tenant.companyID {
+			denyCrossTenant(c)
+			return
+		}
+		companyID = tenant.companyID
+	}
+	if companyID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "company is required"})
+		return
+	}
+
+	var noise *benchmarkNoise
+	if epsilon := config.GetBenchmarkEpsilon(); epsilon > 0 {
+		noise = &benchmarkNoise{epsilon: epsilon}
+	}
+	if v := c.Query("noise"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "noise must be true or false"})
+			return
+		}
+		if enabled && noise == nil {
+			noise = &benchmarkNoise{epsilon: defaultBenchmarkEpsilon}
+		}
+	}
+	if v := c.Query("epsilon"); v != "" && noise != nil {
+		epsilon, err := strconv.ParseFloat(v, 64)
+		if err != nil || epsilon < minBenchmarkEpsilon {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "epsilon must be a number of at least 0.01"})
+			return
+		}
+		// Callers may ask for more noise than configured, never less
+		if epsilon < noise.epsilon {
+			noise.epsilon = epsilon
+		}
+	}
+
+	// Ranges are whole days, so the noise of a range cannot be redrawn by
+	// shifting its bounds by a few seconds
+	var conditions []string
+	var args []interface{}
+	days := map[string]string{}
+	for param, filter := range map[string]listFilter{
+		"from": dateFilter("f.createdAt", false),
+		"to":   dateFilter("f.createdAt", true),
+	} {
+		value := strings.TrimSpace(c.Query(param))
+		if value == "" {
+			continue
+		}
+		t, err := parseDateParam(value, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ": " + err.Error()})
+			return
+		}
+		days[param] = t.UTC().Format("2006-01-02")
+		condition, filterArgs, err := filter(days[param])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ": " + err.Error()})
+			return
+		}
+		conditions = append(conditions, condition)
+		args = append(args, filterArgs...)
+	}
+	if noise != nil {
+		noise.query = companyID + "\x00" + days["from"] + "\x00" + days["to"]
+	}
+	where := " WHERE a.companyId IS NOT NULL"
+	if len(conditions) > 0 {
+		where += " AND " + strings.Join(conditions, " AND ")
+	}
+
+	// Flights per operator and aircraft type
+	overall := benchmarkGroup{}
+	types := map[string]benchmarkGroup{}
+	rows, err := h.db.Query(`SELECT a.companyId, TRIM(COALESCE(a.aircraftMake, '') || ' ' || COALESCE(a.modelNumber, '')), COUNT(*)
+		FROM Csv f
+		JOIN Aircraft a ON f.aircraftId = a.id`+where+`
+		GROUP BY 1, 2`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for rows.Next() {
+		var operator, aircraftType string
+		var flights int
+		if err := rows.Scan(&operator, &aircraftType, &flights); err != nil {
+			continue
+		}
+		overall.add(operator, flights, 0)
+		if types[aircraftType] == nil {
+			types[aircraftType] = benchmarkGroup{}
+		}
+		types[aircraftType].add(operator, flights, 0)
+	}
+	rows.Close()
+
+	// Exceedances per operator, aircraft type and severity
+	severities := map[string]benchmarkGroup{}
+	rows, err = h.db.Query(`SELECT a.companyId, TRIM(COALESCE(a.aircraftMake, '') || ' ' || COALESCE(a.modelNumber, '')),
+			lower(COALESCE(e.exceedanceLevel, 'unknown')), COUNT(*)
+		FROM Exceedance e
+		JOIN Csv f ON e.flightId = f.id
+		JOIN Aircraft a ON f.aircraftId = a.id`+where+`
+		GROUP BY 1, 2, 3`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	for rows.Next() {
+		var operator, aircraftType, severity string
+		var events int
+		if err := rows.Scan(&operator, &aircraftType, &severity, &events); err != nil {
+			continue
+		}
+		overall.add(operator, 0, events)
+		if types[aircraftType] != nil {
+			types[aircraftType].add(operator, 0, events)
+		}
+		if severities[severity] == nil {
+			severities[severity] = benchmarkGroup{}
+		}
+		severities[severity].add(operator, 0, events)
+	}
+	rows.Close()
+
+	// Severity rates are per 1,000 flights of each operator
+	for _, group := range severities {
+		for operator, counts := range group {
+			if o, ok := overall[operator]; ok {
+				counts.flights = o.flights
+			}
+		}
+	}
+
+	minGroupSize := config.GetBenchmarkMinGroupSize()
+	response := models.BenchmarkResponse{
+		CompanyID:    companyID,
+		MinGroupSize: minGroupSize,
+		Overall:      compareWithPeers("overall", companyID, overall, minGroupSize, noise),
+		ByType:       []models.BenchmarkComparison{},
+		BySeverity:   []models.BenchmarkComparison{},
+	}
+	if noise != nil {
+		response.Noise = &models.BenchmarkNoise{Epsilon: noise.epsilon, RateCap: benchmarkRateCap}
+	}
+	for aircraftType, group := range types {
+		if _, ok := group[companyID]; ok {
+			response.ByType = append(response.ByType, compareWithPeers(aircraftType, companyID, group, minGroupSize, noise))
+		}
+	}
+	for severity, group := range severities {
+		// Every operator with flights is a peer, including those without events of this severity
+		for operator, o := range overall {
+			if _, ok := group[operator]; !ok && o.flights > 0 {
+				group[operator] = &operatorCounts{flights: o.flights}
+			}
+		}
+		response.BySeverity = append(response.BySeverity, compareWithPeers(severity, companyID, group, minGroupSize, noise))
+	}
+	sort.Slice(response.ByType, func(i, j int) bool { return response.ByType[i].Key < response.ByType[j].Key })
+	sort.Slice(response.BySeverity, func(i, j int) bool { return response.BySeverity[i].Key < response.BySeverity[j].Key })
+
+	c.JSON(http.StatusOK, response)
+}
+
+// compareWithPeers compares one operator with the other operators of a group.
+// Peer aggregates and the rank are only returned when the group has at least
+// minGroupSize peers with flights.
+func compareWithPeers(key, companyID string, group benchmarkGroup, minGroupSize int, noise *benchmarkNoise) models.BenchmarkComparison {
+	comparison := models.BenchmarkComparison{Key: key}
+	own := operatorCounts{}
+	if o, ok := group[companyID]; ok {
+		own = *o
+	}
+	comparison.Company = models.BenchmarkFigures{Flights: own.flights, Events: own.events, Rate: own.rate()}
+
+	var rates []float64
+	for operator, counts := range group {
+		if operator != companyID && counts.flights > 0 {
+			rates = append(rates, math.Min(counts.rate(), benchmarkRateCap))
+		}
+	}
+	comparison.Peers.Operators = len(rates)
+	if len(rates) < minGroupSize {
+		// Even the operator count would identify small groups
+		comparison.Peers = models.PeerAggregate{Suppressed: true}
+		return comparison
+	}
+	sort.Float64s(rates)
+
+	// One operator moves the mean of n clipped rates by at most cap/n and the
+	// rank by at most 100/n. A percentile can move by up to the whole cap, so
+	// noise hiding one operator would swamp it: percentiles are only published
+	// without noise.
+	n := float64(len(rates))
+	perturb := func(statistic string, v, sensitivity, max float64) float64 {
+		if noise == nil {
+			return round2(v)
+		}
+		return round2(math.Max(0, math.Min(max, v+noise.laplace(key, statistic, sensitivity))))
+	}
+
+	var sum float64
+	for _, r := range rates {
+		sum += r
+	}
+	mean := perturb("mean", sum/n, benchmarkRateCap/n, benchmarkRateCap)
+	comparison.Peers.Mean = &mean
+	if noise == nil {
+		comparison.Peers.Percentiles = map[string]float64{}
+		for _, p := range []float64{25, 50, 75, 90} {
+			comparison.Peers.Percentiles["p"+strconv.Itoa(int(p))] = round2(getPercentile(rates, p))
+		}
+	}
+
+	if own.flights > 0 {
+		ownRate := math.Min(own.rate(), benchmarkRateCap)
+		var below, equal float64
+		for _, r := range rates {
+			if r < ownRate {
+				below++
+			} else if r == ownRate {
+				equal++
+			}
+		}
+		rank := perturb("rank", (below+equal/2)/n*100, 100/n, 100)
+		comparison.PercentileRank = &rank
+	}
+	return comparison
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/models"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkItems caps the number of exceedances a single bulk request may touch
+const maxBulkItems = 1000
+
+// selectExceedanceIDs returns the ids of exceedances matching a bulk filter,
+// limited to the requesting user's company unless they work across operators
+func selectExceedanceIDs(exec dbExecutor, c *gin.Context, filter *models.ExceedanceFilter) ([]string, error) {
+	conditions := []string{"1 = 1"}
+	var args []interface{}
+
+	if filter.FlightID != "" {
+		conditions = append(conditions, "e.flightId = ?")
+		args = append(args, filter.FlightID)
+	}
+	if filter.EventCode != "" {
+		conditions = append(conditions, "el.eventCode = ?")
+		args = append(args, filter.EventCode)
+	}
+	if filter.Phase != "" {
+		// Exceedances spanning several phases store them comma separated
+		conditions = append(conditions, "instr(upper(e.flightPhase), upper(?)) > 0")
+		args = append(args, filter.Phase)
+	}
+	if filter.Severity != "" {
+		conditions = append(conditions, "lower(e.exceedanceLevel) = lower(?)")
+		args = append(args, filter.Severity)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "e.eventStatus = ?")
+		args = append(args, filter.Status)
+	}
+
+	tenant, tenantArgs := tenantOf(c).condition("a.companyId")
+	conditions = append(conditions, tenant)
+	args = append(args, tenantArgs...)
+
+	rows, err := exec.Query(`SELECT e.id FROM Exceedance e
+		LEFT JOIN EventLog el ON e.eventId = el.id
+		LEFT JOIN Aircraft a ON e.aircraftId = a.id
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY e.createdAt ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// BulkUpdateExceedances changes status, comments, reassigns or deletes a set of
+// exceedances in one transaction. Every item is attempted and reported; if any
+// item fails the transaction is rolled back and nothing is changed.
+func (h *ExceedanceHandler) BulkUpdateExceedances(c *gin.Context) {
+	var req models.BulkExceedanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := c.GetString("userRole")
+	userID := c.GetString("userId")
+
+	// Validate the action and its parameters before touching any rows
+	var status string
+	var comment string
+	switch req.Action {
+	case models.BulkActionStatus:
+		var ok bool
+		status, ok = models.NormalizeExceedanceStatus(req.EventStatus)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event status", "allowed": models.ExceedanceStatuses})
+			return
+		}
+	case models.BulkActionComment:
+		if req.Comment != nil {
+			comment = strings.TrimSpace(*req.Comment)
+		}
+		if comment == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Comment is required"})
+			return
+		}
+	case models.BulkActionAssign, models.BulkActionDelete:
+		if role != models.RoleAdmin && role != models.RoleFDA {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":    "Access denied",
+				"message":  "Only admins and FDAs can " + req.Action + " exceedances",
+				"userRole": role,
+			})
+			return
+		}
+		if req.Action == models.BulkActionAssign {
+			if req.AssigneeID == nil && !req.DueDate.Set && req.Priority == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+				return
+			}
+			if !validateAssignmentFields(c, h.db, req.AssigneeID, req.Priority) {
+				return
+			}
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid action",
+			"allowed": []string{models.BulkActionStatus, models.BulkActionComment, models.BulkActionAssign, models.BulkActionDelete},
+		})
+		return
+	}
+
+	if (len(req.IDs) == 0) == (req.Filter == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either ids or filter"})
+		return
+	}
+	if req.Filter != nil {
+		if *req.Filter == (models.ExceedanceFilter{}) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Filter must have at least one criterion"})
+			return
+		}
+		if req.Filter.Status != "" {
+			normalized, ok := models.NormalizeExceedanceStatus(req.Filter.Status)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid filter status", "allowed": models.ExceedanceStatuses})
+				return
+			}
+			req.Filter.Status = normalized
+		}
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	ids := req.IDs
+	if req.Filter != nil {
+		ids, err = selectExceedanceIDs(tx, c, req.Filter)
+		if err != nil {
+			log.Println("Error selecting exceedances:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if len(ids) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No exceedances match the filter"})
+			return
+		}
+	}
+	if len(ids) > maxBulkItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A bulk request may affect at most %d exceedances, %d selected", maxBulkItems, len(ids))})
+		return
+	}
+
+	now := time.Now()
+	results := make([]models.BulkItemResult, 0, len(ids))
+	failed := 0
+	var storedFiles []string
+
+	for _, id := range ids {
+		result := models.BulkItemResult{ID: id}
+		err := h.applyBulkAction(tx, c, &req, id, status, comment, role, userID, now, &storedFiles)
+		if _, isWorkflowErr := err.(*workflowError); isWorkflowErr {
+			result.Error = err.Error()
+		} else if err == sql.ErrNoRows {
+			result.Error = "Exceedance not found"
+		} else if err != nil {
+			log.Printf("Error applying bulk %s to exceedance %s: %v", req.Action, id, err)
+			result.Error = "Database error"
+		}
+		result.Success = err == nil
+		if err != nil {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":     "No changes applied: some exceedances could not be updated",
+			"action":    req.Action,
+			"committed": false,
+			"succeeded": len(ids) - failed,
+			"failed":    failed,
+			"results":   results,
+		})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	removeStoredFiles(storedFiles)
+	wakeWebhookWorker()
+
+	c.JSON(http.StatusOK, gin.H{
+		"action":    req.Action,
+		"committed": true,
+		"succeeded": len(ids),
+		"failed":    0,
+		"results":   results,
+	})
+}
+
+// applyBulkAction performs a validated bulk action on a single exceedance.
+// Attachment files of deleted exceedances are appended to storedFiles so they
+// can be removed once the transaction commits.
+func (h *ExceedanceHandler) applyBulkAction(tx *sql.Tx, c *gin.Context, req *models.BulkExceedanceRequest, id, status, comment, role, userID string, now time.Time, storedFiles *[]string) error {
+	companyID, err := exceedanceCompanyID(tx, id)
+	if err != nil {
+		return err
+	}
+	if !canAccessCompanyData(c, companyID) {
+		return &workflowError{http.StatusForbidden, gin.H{"error": "Access denied", "message": "You can only access your own company's data"}}
+	}
+
+	switch req.Action {
+	case models.BulkActionStatus:
+		return changeExceedanceStatus(tx, id, status, role, userID, req.Comment, now)
+
+	case models.BulkActionComment:
+		_, err := tx.Exec("UPDATE Exceedance SET comment = ?, updatedAt = ? WHERE id = ?", comment, now.UnixMilli(), id)
+		if err != nil {
+			return err
+		}
+		_, err = addComment(tx, id, userID, comment, now)
+		return err
+
+	case models.BulkActionAssign:
+		_, err := applyAssignment(tx, id, req.AssigneeID, req.DueDate, req.Priority, now)
+		return err
+
+	case models.BulkActionDelete:
+		keys, err := attachmentStorageKeys(tx, "id = ?", id)
+		if err != nil {
+			return err
+		}
+		if err := deleteExceedanceChildRows(tx, "id = ?", id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM Exceedance WHERE id = ?", id); err != nil {
+			return err
+		}
+		*storedFiles = append(*storedFiles, keys...)
+	}
+	return nil
+}
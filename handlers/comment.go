@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/models"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// mentionPattern matches @username and @email mentions in comment bodies
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9._+-]+(?:@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+)?)`)
+
+// resolveMentions returns the ids of active users mentioned in body who may see
+// exceedances of the given company
+func resolveMentions(exec dbExecutor, body string, companyID sql.NullString) ([]string, error) {
+	seen := map[string]bool{}
+	var userIDs []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		handle := strings.ToLower(strings.TrimRight(match[1], "."))
+		if handle == "" {
+			continue
+		}
+
+		var userID string
+		err := exec.QueryRow(`SELECT id FROM User
+			WHERE isActive = 1 AND (lower(username) = ? OR lower(email) = ?)
+			AND (role IN ('admin', 'fda') OR companyId = ?)`,
+			handle, handle, companyID.String).Scan(&userID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !seen[userID] {
+			seen[userID] = true
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs, nil
+}
+
+// syncMentions records the users mentioned in a comment and notifies those not
+// mentioned before. Users no longer mentioned after an edit are removed.
+func syncMentions(exec dbExecutor, comment *models.ExceedanceComment, authorName string, companyID sql.NullString, now time.Time) error {
+	resolved, err := resolveMentions(exec, comment.Body, companyID)
+	if err != nil {
+		return err
+	}
+
+	comment.Mentions = []string{}
+	for _, userID := range resolved {
+		if comment.UserID == nil || userID != *comment.UserID {
+			comment.Mentions = append(comment.Mentions, userID)
+		}
+	}
+
+	query := "DELETE FROM ExceedanceCommentMention WHERE commentId = ?"
+	args := []interface{}{comment.ID}
+	if len(comment.Mentions) > 0 {
+		query += " AND userId NOT IN (" + placeholders(len(comment.Mentions)) + ")"
+		for _, userID := range comment.Mentions {
+			args = append(args, userID)
+		}
+	}
+	if _, err := exec.Exec(query, args...); err != nil {
+		return err
+	}
+
+	var description, flightID string
+	exec.QueryRow("SELECT COALESCE(description, ''), COALESCE(flightId, '') FROM Exceedance WHERE id = ?", comment.ExceedanceID).
+		Scan(&description, &flightID)
+	message := authorName + " mentioned you on exceedance: " + description
+	target := notificationTarget{kind: models.NotificationTargetExceedance, id: comment.ExceedanceID, flightID: flightID}
+
+	for _, userID := range comment.Mentions {
+		result, err := exec.Exec("INSERT OR IGNORE INTO ExceedanceCommentMention (commentId, userId) VALUES (?, ?)", comment.ID, userID)
+		if err != nil {
+			return err
+		}
+		if added, _ := result.RowsAffected(); added == 0 {
+			continue
+		}
+		if _, err := createNotification(exec, userID, target, message, "mention", now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addComment appends a comment to an exceedance thread and notifies mentioned users
+func addComment(exec dbExecutor, exceedanceID, userID, body string, now time.Time) (models.ExceedanceComment, error) {
+	comment := models.ExceedanceComment{
+		ID:           uuid.New().String(),
+		ExceedanceID: exceedanceID,
+		Body:         body,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if userID != "" {
+		comment.UserID = &userID
+	}
+
+	_, err := exec.Exec(`INSERT INTO ExceedanceComment (id, exceedanceId, userId, body, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		comment.ID, exceedanceID, comment.UserID, body, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return comment, err
+	}
+
+	companyID, err := exceedanceCompanyID(exec, exceedanceID)
+	if err != nil {
+		return comment, err
+	}
+	var authorName sql.NullString
+	exec.QueryRow("SELECT fullName FROM User WHERE id = ?", userID).Scan(&authorName)
+	name := "Someone"
+	if authorName.Valid {
+		comment.UserName = &authorName.String
+		name = authorName.String
+	}
+
+	return comment, syncMentions(exec, &comment, name, companyID, now)
+}
+
+// getComment loads a single comment with its author and mentions
+func getComment(exec dbExecutor, exceedanceID, commentID string) (models.ExceedanceComment, error) {
+	var comment models.ExceedanceComment
+	var editedAt sql.NullInt64
+	var createdAt, updatedAt int64
+	err := exec.QueryRow(`SELECT cm.id, cm.exceedanceId, cm.userId, u.fullName, cm.body, cm.editedAt, cm.createdAt, cm.updatedAt
+		FROM ExceedanceComment cm
+		LEFT JOIN User u ON cm.userId = u.id
+		WHERE cm.id = ? AND cm.exceedanceId = ?`, commentID, exceedanceID).Scan(
+		&comment.ID, &comment.ExceedanceID, &comment.UserID, &comment.UserName, &comment.Body,
+		&editedAt, &createdAt, &updatedAt)
+	if err != nil {
+		return comment, err
+	}
+	comment.CreatedAt = time.UnixMilli(createdAt)
+	comment.UpdatedAt = time.UnixMilli(updatedAt)
+	if editedAt.Valid {
+		t := time.UnixMilli(editedAt.Int64)
+		comment.EditedAt = &t
+	}
+
+	comment.Mentions = []string{}
+	rows, err := exec.Query("SELECT userId FROM ExceedanceCommentMention WHERE commentId = ?", commentID)
+	if err != nil {
+		return comment, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err == nil {
+			comment.Mentions = append(comment.Mentions, userID)
+		}
+	}
+	return comment, rows.Err()
+}
+
+// GetExceedanceComments returns the comment thread of an exceedance, oldest first
+func (h *ExceedanceHandler) GetExceedanceComments(c *gin.Context) {
+	id := c.Param("id")
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT cm.id, cm.exceedanceId, cm.userId, u.fullName, cm.body, cm.editedAt, cm.createdAt, cm.updatedAt
+		FROM ExceedanceComment cm
+		LEFT JOIN User u ON cm.userId = u.id
+		WHERE cm.exceedanceId = ?
+		ORDER BY cm.createdAt ASC`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	comments := []models.ExceedanceComment{}
+	index := map[string]int{}
+	for rows.Next() {
+		var comment models.ExceedanceComment
+		var editedAt sql.NullInt64
+		var createdAt, updatedAt int64
+		err := rows.Scan(&comment.ID, &comment.ExceedanceID, &comment.UserID, &comment.UserName, &comment.Body,
+			&editedAt, &createdAt, &updatedAt)
+		if err != nil {
+			log.Println("Error scanning comment:", err)
+			continue
+		}
+		comment.CreatedAt = time.UnixMilli(createdAt)
+		comment.UpdatedAt = time.UnixMilli(updatedAt)
+		if editedAt.Valid {
+			t := time.UnixMilli(editedAt.Int64)
+			comment.EditedAt = &t
+		}
+		comment.Mentions = []string{}
+		index[comment.ID] = len(comments)
+		comments = append(comments, comment)
+	}
+
+	mentionRows, err := h.db.Query(`SELECT m.commentId, m.userId FROM ExceedanceCommentMention m
+		JOIN ExceedanceComment cm ON m.commentId = cm.id
+		WHERE cm.exceedanceId = ?`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer mentionRows.Close()
+	for mentionRows.Next() {
+		var commentID, userID string
+		if err := mentionRows.Scan(&commentID, &userID); err != nil {
+			continue
+		}
+		if i, ok := index[commentID]; ok {
+			comments[i].Mentions = append(comments[i].Mentions, userID)
+		}
+	}
+
+	c.JSON(http.StatusOK, comments)
+}
+
+// CreateExceedanceComment adds a comment to an exceedance thread
+func (h *ExceedanceHandler) CreateExceedanceComment(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment body is required"})
+		return
+	}
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating comment"})
+		return
+	}
+	defer tx.Rollback()
+
+	comment, err := addComment(tx, id, c.GetString("userId"), body, time.Now())
+	if err != nil {
+		log.Println("Error creating comment:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating comment"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating comment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// UpdateExceedanceComment edits a comment. Only the author may edit; newly
+// mentioned users are notified.
+func (h *ExceedanceHandler) UpdateExceedanceComment(c *gin.Context) {
+	id := c.Param("id")
+	commentID := c.Param("commentId")
+
+	var req models.CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Comment body is required"})
+		return
+	}
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
+	comment, err := getComment(h.db, id, commentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	userID := c.GetString("userId")
+	if comment.UserID == nil || *comment.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied", "message": "You can only edit your own comments"})
+		return
+	}
+
+	now := time.Now()
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating comment"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE ExceedanceComment SET body = ?, editedAt = ?, updatedAt = ? WHERE id = ?",
+		body, now.UnixMilli(), now.UnixMilli(), commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating comment"})
+		return
+	}
+
+	companyID, err := exceedanceCompanyID(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating comment"})
+		return
+	}
+	authorName := "Someone"
+	if comment.UserName != nil {
+		authorName = *comment.UserName
+	}
+	comment.Body = body
+	if err := syncMentions(tx, &comment, authorName, companyID, now); err != nil {
+		log.Println("Error notifying mentions:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating comment"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating comment"})
+		return
+	}
+
+	comment, err = getComment(h.db, id, commentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, comment)
+}
+
+// DeleteExceedanceComment removes a comment. Authors may delete their own
+// comments; admins and FDAs may delete any comment.
+func (h *ExceedanceHandler) DeleteExceedanceComment(c *gin.Context) {
+	id := c.Param("id")
+	commentID := c.Param("commentId")
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
+	comment, err := getComment(h.db, id, commentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	role := c.GetString("userRole")
+	isAuthor := comment.UserID != nil && *comment.UserID == c.GetString("userId")
+	if !isAuthor && role != models.RoleAdmin && role != models.RoleFDA {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied", "message": "You can only delete your own comments"})
+		return
+	}
+
+	if _, err := h.db.Exec("DELETE FROM ExceedanceCommentMention WHERE commentId = ?", commentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting comment"})
+		return
+	}
+	if _, err := h.db.Exec("DELETE FROM ExceedanceComment WHERE id = ?", commentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting comment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
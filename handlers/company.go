@@ -163,6 +163,9 @@ func (h *CompanyHandler) GetCompanies(c *gin.Context) {
 // GetCompanyByID retrieves a company by ID with subscription details
 func (h *CompanyHandler) GetCompanyByID(c *gin.Context) {
 	id := c.Param("id")
+	if !companyResource.authorize(c, h.db, id) {
+		return
+	}
 
 	company, err := h.getCompanyByID(id)
 	if err != nil {
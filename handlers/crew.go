@@ -0,0 +1,646 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fdm-backend/models"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Crew confidentiality follows the FOQA agreements: flights and analytics only
+// ever show a crew member's de-identified code. The name and employee ID are
+// returned to an FDA by a crew contact, which is logged with its reason.
+
+// CrewHandler manages crew members and their flights
+type CrewHandler struct {
+	db *sql.DB
+}
+
+func NewCrewHandler(db *sql.DB) *CrewHandler {
+	return &CrewHandler{db: db}
+}
+
+const crewColumns = `id, companyId, code, role, isActive, employeeId, name, createdAt, updatedAt`
+
+// scanCrewMember reads a crew member, dropping the identity unless reveal is set
+func scanCrewMember(row interface{ Scan(...interface{}) error }, reveal bool) (models.CrewMember, error) {
+	var m models.CrewMember
+	var employeeID, name string
+	var createdAt, updatedAt int64
+	err := row.Scan(&m.ID, &m.CompanyID, &m.Code, &m.Role, &m.IsActive, &employeeID, &name, &createdAt, &updatedAt)
+	if err != nil {
+		return m, err
+	}
+	if reveal {
+		m.EmployeeID = &employeeID
+		m.Name = &name
+	}
+	m.CreatedAt = time.UnixMilli(createdAt)
+	m.UpdatedAt = time.UnixMilli(updatedAt)
+	return m, nil
+}
+
+func getCrewMember(exec dbExecutor, id string, reveal bool) (models.CrewMember, error) {
+	return scanCrewMember(exec.QueryRow("SELECT "+crewColumns+" FROM CrewMember WHERE id = ?", id), reveal)
+}
+
+func isCrewRole(role string) bool {
+	return role == models.CrewRoleCaptain || role == models.CrewRoleFirstOfficer
+}
+
+// newCrewCode returns an unused de-identified code such as CRW-3FA9C1
+func newCrewCode(exec dbExecutor) (string, error) {
+	for {
+		code := "CRW-" + strings.ToUpper(strings.ReplaceAll(uuid.New().String(), "-", "")[:6])
+		var n int
+		if err := exec.QueryRow("SELECT COUNT(*) FROM CrewMember WHERE code = ?", code).Scan(&n); err != nil {
+			return "", err
+		}
+		if n == 0 {
+			return code, nil
+		}
+	}
+}
+
+// employeeIDTaken reports whether another crew member of the company has the employee ID
+func employeeIDTaken(exec dbExecutor, companyID, employeeID, exceptID string) (bool, error) {
+	var n int
+	err := exec.QueryRow("SELECT COUNT(*) FROM CrewMember WHERE companyId = ? AND employeeId = ? AND id != ?",
+		companyID, employeeID, exceptID).Scan(&n)
+	return n > 0, err
+}
+
+// GetCrewMembers lists the crew of the caller's company by code
+//
+//	?company=<id>&role=captain&active=true
+func (h *CrewHandler) GetCrewMembers(c *gin.Context) {
+	condition, args := tenantOf(c).condition("companyId")
+	if v := strings.TrimSpace(c.Query("company")); v != "" {
+		condition += " AND companyId = ?"
+		args = append(args, v)
+	}
+	if v := strings.TrimSpace(c.Query("role")); v != "" {
+		condition += " AND role = ?"
+		args = append(args, v)
+	}
+	switch c.Query("active") {
+	case "true":
+		condition += " AND isActive = 1"
+	case "false":
+		condition += " AND isActive = 0"
+	}
+
+	rows, err := h.db.Query("SELECT "+crewColumns+" FROM CrewMember WHERE "+condition+" ORDER BY code", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	crew := []models.CrewMember{}
+	for rows.Next() {
+		m, err := scanCrewMember(rows, false)
+		if err != nil {
+			log.Println("Error scanning crew member:", err)
+			continue
+		}
+		crew = append(crew, m)
+	}
+
+	c.JSON(http.StatusOK, crew)
+}
+
+// GetCrewMemberByID returns a single de-identified crew member
+func (h *CrewHandler) GetCrewMemberByID(c *gin.Context) {
+	id := c.Param("id")
+	if !crewResource.authorize(c, h.db, id) {
+		return
+	}
+
+	m, err := getCrewMember(h.db, id, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, m)
+}
+
+// CreateCrewMember adds a crew member. Gatekeepers add crew to their own
+// company; admins and FDAs must name the company. The response only carries
+// the assigned code.
+func (h *CrewHandler) CreateCrewMember(c *gin.Context) {
+	var req models.CrewMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyID, ok := requestedCompany(c, h.db, req.CompanyID)
+	if !ok {
+		return
+	}
+
+	var employeeID, name string
+	if req.EmployeeID != nil {
+		employeeID = strings.TrimSpace(*req.EmployeeID)
+	}
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+	}
+	if employeeID == "" || name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "employeeId and name are required"})
+		return
+	}
+	role := models.CrewRoleCaptain
+	if req.Role != nil {
+		role = *req.Role
+	}
+	if !isCrewRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "role must be captain or first_officer"})
+		return
+	}
+
+	if taken, err := employeeIDTaken(h.db, companyID, employeeID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	} else if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "A crew member with this employee ID already exists"})
+		return
+	}
+	code, err := newCrewCode(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	now := time.Now()
+	m := models.CrewMember{
+		ID:        uuid.New().String(),
+		CompanyID: companyID,
+		Code:      code,
+		Role:      role,
+		IsActive:  req.IsActive == nil || *req.IsActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	_, err = h.db.Exec(`INSERT INTO CrewMember (`+crewColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.ID, m.CompanyID, m.Code, m.Role, m.IsActive, employeeID, name, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating crew member"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, m)
+}
+
+// UpdateCrewMember changes a crew member's details. The identity can be
+// corrected but is not returned.
+func (h *CrewHandler) UpdateCrewMember(c *gin.Context) {
+	id := c.Param("id")
+	if !crewResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var req models.CrewMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	m, err := getCrewMember(h.db, id, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.CompanyID != nil && *req.CompanyID != m.CompanyID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "companyId cannot be changed"})
+		return
+	}
+	employeeID, name := *m.EmployeeID, *m.Name
+	if req.EmployeeID != nil {
+		employeeID = strings.TrimSpace(*req.EmployeeID)
+	}
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+	}
+	if employeeID == "" || name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "employeeId and name cannot be empty"})
+		return
+	}
+	if req.Role != nil {
+		if !isCrewRole(*req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be captain or first_officer"})
+			return
+		}
+		m.Role = *req.Role
+	}
+	if req.IsActive != nil {
+		m.IsActive = *req.IsActive
+	}
+
+	if taken, err := employeeIDTaken(h.db, m.CompanyID, employeeID, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	} else if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "A crew member with this employee ID already exists"})
+		return
+	}
+
+	now := time.Now()
+	_, err = h.db.Exec(`UPDATE CrewMember SET employeeId = ?, name = ?, role = ?, isActive = ?, updatedAt = ? WHERE id = ?`,
+		employeeID, name, m.Role, m.IsActive, now.UnixMilli(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating crew member"})
+		return
+	}
+
+	m.EmployeeID, m.Name = nil, nil
+	m.UpdatedAt = now
+	c.JSON(http.StatusOK, m)
+}
+
+// flightCrewSeats maps the seats of a crew request to crew member ids. Omitted
+// seats are left out; an empty id clears the seat.
+func flightCrewSeats(captainID, firstOfficerID *string) map[string]string {
+	seats := map[string]string{}
+	if captainID != nil {
+		seats[models.CrewRoleCaptain] = strings.TrimSpace(*captainID)
+	}
+	if firstOfficerID != nil {
+		seats[models.CrewRoleFirstOfficer] = strings.TrimSpace(*firstOfficerID)
+	}
+	return seats
+}
+
+// validateFlightCrew checks that the crew members exist, are active and belong
+// to the company operating the flight
+func validateFlightCrew(exec dbExecutor, companyID sql.NullString, seats map[string]string) error {
+	if seats[models.CrewRoleCaptain] != "" && seats[models.CrewRoleCaptain] == seats[models.CrewRoleFirstOfficer] {
+		return errors.New("captain and first officer must be different crew members")
+	}
+	for role, crewID := range seats {
+		if crewID == "" {
+			continue
+		}
+		var crewCompanyID string
+		var active bool
+		err := exec.QueryRow("SELECT companyId, isActive FROM CrewMember WHERE id = ?", crewID).Scan(&crewCompanyID, &active)
+		if err == sql.ErrNoRows || (err == nil && (!companyID.Valid || crewCompanyID != companyID.String)) {
+			return errors.New(role + " not found")
+		}
+		if err != nil {
+			return err
+		}
+		if !active {
+			return errors.New(role + " is not active")
+		}
+	}
+	return nil
+}
+
+// setFlightCrew stores the seats of a flight
+func setFlightCrew(exec dbExecutor, flightID string, seats map[string]string) error {
+	for role, crewID := range seats {
+		if _, err := exec.Exec("DELETE FROM FlightCrew WHERE flightId = ? AND role = ?", flightID, role); err != nil {
+			return err
+		}
+		if crewID == "" {
+			continue
+		}
+		if _, err := exec.Exec("INSERT INTO FlightCrew (flightId, crewMemberId, role) VALUES (?, ?, ?)", flightID, crewID, role); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadFlightCrew(exec dbExecutor, flightID string) ([]models.FlightCrewMember, error) {
+	rows, err := exec.Query(`SELECT fc.crewMemberId, cm.code, fc.role
+		FROM FlightCrew fc
+		JOIN CrewMember cm ON fc.crewMemberId = cm.id
+		WHERE fc.flightId = ?
+		ORDER BY fc.role`, flightID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	crew := []models.FlightCrewMember{}
+	for rows.Next() {
+		var m models.FlightCrewMember
+		if err := rows.Scan(&m.CrewMemberID, &m.Code, &m.Role); err != nil {
+			continue
+		}
+		crew = append(crew, m)
+	}
+	return crew, rows.Err()
+}
+
+// loadFlightCrews returns the de-identified crew of the flights matching a
+// condition on Csv f, keyed by flight id
+func loadFlightCrews(exec dbExecutor, condition string, args ...interface{}) (map[string][]models.FlightCrewMember, error) {
+	rows, err := exec.Query(`SELECT fc.flightId, fc.crewMemberId, cm.code, fc.role
+		FROM FlightCrew fc
+		JOIN CrewMember cm ON fc.crewMemberId = cm.id
+		JOIN Csv f ON fc.flightId = f.id
+		WHERE `+condition+`
+		ORDER BY fc.flightId, fc.role`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	crews := map[string][]models.FlightCrewMember{}
+	for rows.Next() {
+		var flightID string
+		var m models.FlightCrewMember
+		if err := rows.Scan(&flightID, &m.CrewMemberID, &m.Code, &m.Role); err != nil {
+			continue
+		}
+		crews[flightID] = append(crews[flightID], m)
+	}
+	return crews, rows.Err()
+}
+
+// GetFlightCrew returns the de-identified crew of a flight
+func (h *CrewHandler) GetFlightCrew(c *gin.Context) {
+	id := c.Param("id")
+	if !flightResource.authorize(c, h.db, id) {
+		return
+	}
+
+	crew, err := loadFlightCrew(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, crew)
+}
+
+// UpdateFlightCrew sets the captain and first officer of a flight
+func (h *CrewHandler) UpdateFlightCrew(c *gin.Context) {
+	id := c.Param("id")
+	if !flightResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var req models.FlightCrewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyID, err := flightResource.companyID(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	seats := flightCrewSeats(req.CaptainID, req.FirstOfficerID)
+	if err := validateFlightCrew(h.db, companyID, seats); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := setFlightCrew(tx, id, seats); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating flight crew"})
+		return
+	}
+	crew, err := loadFlightCrew(tx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating flight crew"})
+		return
+	}
+
+	c.JSON(http.StatusOK, crew)
+}
+
+// ContactCrewMember reveals a crew member's identity to the FDA so the crew
+// can be contacted about an event. Every contact is logged with its reason.
+func (h *CrewHandler) ContactCrewMember(c *gin.Context) {
+	id := c.Param("id")
+	if !crewResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var req models.CrewContactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+
+	// The exceedance, if given, must be from a flight the crew member flew
+	if req.ExceedanceID != nil && *req.ExceedanceID != "" {
+		var n int
+		err := h.db.QueryRow(`SELECT COUNT(*) FROM Exceedance e
+			JOIN FlightCrew fc ON fc.flightId = e.flightId
+			WHERE e.id = ? AND fc.crewMemberId = ?`, *req.ExceedanceID, id).Scan(&n)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if n == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Exceedance is not from a flight of this crew member"})
+			return
+		}
+	} else {
+		req.ExceedanceID = nil
+	}
+
+	now := time.Now()
+	userID := c.GetString("userId")
+	contact := models.CrewContact{
+		ID:           uuid.New().String(),
+		CrewMemberID: id,
+		ExceedanceID: req.ExceedanceID,
+		UserID:       &userID,
+		Reason:       reason,
+		CreatedAt:    now,
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO CrewContact (id, crewMemberId, exceedanceId, userId, reason, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?)`, contact.ID, id, contact.ExceedanceID, userID, reason, now.UnixMilli())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging crew contact"})
+		return
+	}
+	m, err := getCrewMember(tx, id, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	// The identity is only released once the contact is logged
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging crew contact"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.CrewContactResponse{Contact: contact, CrewMember: m})
+}
+
+// GetCrewContacts returns the identity disclosures of a crew member, newest first
+func (h *CrewHandler) GetCrewContacts(c *gin.Context) {
+	id := c.Param("id")
+	if !crewResource.authorize(c, h.db, id) {
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT cc.id, cc.crewMemberId, cc.exceedanceId, cc.userId, u.fullName, cc.reason, cc.createdAt
+		FROM CrewContact cc
+		LEFT JOIN User u ON cc.userId = u.id
+		WHERE cc.crewMemberId = ?
+		ORDER BY cc.createdAt DESC`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	contacts := []models.CrewContact{}
+	for rows.Next() {
+		var contact models.CrewContact
+		var createdAt int64
+		err := rows.Scan(&contact.ID, &contact.CrewMemberID, &contact.ExceedanceID, &contact.UserID,
+			&contact.UserName, &contact.Reason, &createdAt)
+		if err != nil {
+			continue
+		}
+		contact.CreatedAt = time.UnixMilli(createdAt)
+		contacts = append(contacts, contact)
+	}
+
+	c.JSON(http.StatusOK, contacts)
+}
+
+var crewSorts = []string{"rate", "risk", "events", "flights"}
+
+// GetCrewStats ranks crew members by the exceedances of the flights they flew,
+// identified by code only.
+//
+//	?role=captain|first_officer (seat flown)&sort=rate|risk|events|flights&minFlights=10&limit=20&from=2025-01-01
+func (h *AnalyticsHandler) GetCrewStats(c *gin.Context) {
+	limit, minFlights, sortKey, ok := parseAirportRanking(c, crewSorts, "rate")
+	if !ok {
+		return
+	}
+	conditions, args, err := flightScope(c, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if role := c.Query("role"); role != "" {
+		if !isCrewRole(role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be captain or first_officer"})
+			return
+		}
+		conditions = append(conditions, "fc.role = ?")
+		args = append(args, role)
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	rows, err := h.db.Query(`SELECT cm.id, cm.code, cm.role, COUNT(*)
+		FROM FlightCrew fc
+		JOIN CrewMember cm ON fc.crewMemberId = cm.id
+		JOIN Csv f ON fc.flightId = f.id
+		LEFT JOIN Aircraft a ON f.aircraftId = a.id`+where+`
+		GROUP BY cm.id`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	crew := map[string]*models.CrewStats{}
+	for rows.Next() {
+		s := &models.CrewStats{Severities: map[string]int{}}
+		if err := rows.Scan(&s.CrewMemberID, &s.Code, &s.Role, &s.Flights); err != nil {
+			continue
+		}
+		crew[s.CrewMemberID] = s
+	}
+	rows.Close()
+
+	rows, err = h.db.Query(`SELECT fc.crewMemberId, lower(COALESCE(NULLIF(e.exceedanceLevel, ''), 'unknown')), COUNT(*)
+		FROM FlightCrew fc
+		JOIN Exceedance e ON e.flightId = fc.flightId
+		JOIN Csv f ON fc.flightId = f.id
+		LEFT JOIN Aircraft a ON f.aircraftId = a.id`+where+`
+		GROUP BY 1, 2`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	risk := map[string]float64{}
+	for rows.Next() {
+		var crewID, severity string
+		var events int
+		if err := rows.Scan(&crewID, &severity, &events); err != nil {
+			continue
+		}
+		if s, ok := crew[crewID]; ok {
+			s.Events += events
+			s.Severities[severity] += events
+			risk[crewID] += severityWeight(severity) * float64(events)
+		}
+	}
+	rows.Close()
+
+	result := []models.CrewStats{}
+	for id, s := range crew {
+		s.Rate = eventRate(s.Events, s.Flights)
+		s.Risk = riskRate(risk[id], s.Flights)
+		if s.Flights >= minFlights {
+			result = append(result, *s)
+		}
+	}
+
+	value := func(s models.CrewStats) float64 {
+		switch sortKey {
+		case "risk":
+			return s.Risk
+		case "events":
+			return float64(s.Events)
+		case "flights":
+			return float64(s.Flights)
+		}
+		return s.Rate
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if vi, vj := value(result[i]), value(result[j]); vi != vj {
+			return vi > vj
+		}
+		return result[i].Code < result[j].Code
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -6,13 +6,16 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"path/filepath"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// flightFileDir is where uploaded flight files are stored
+const flightFileDir = "csvs"
+
 type CSVHandler struct {
 	db *sql.DB
 }
@@ -30,36 +33,115 @@ func (h *CSVHandler) UploadCSV(c *gin.Context) {
 		return
 	}
 
+	now := time.Now()
+	flightDate := now
+	if req.FlightDate != nil && *req.FlightDate != "" {
+		t, err := parseDateParam(*req.FlightDate, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid flightDate: " + err.Error()})
+			return
+		}
+		flightDate = t
+	}
+
+	// Flights can only be uploaded for the company's own aircraft
+	if !aircraftResource.authorize(c, h.db, req.AircraftID) {
+		return
+	}
+
+	companyID, err := aircraftResource.companyID(h.db, req.AircraftID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	seats := flightCrewSeats(req.CaptainID, req.FirstOfficerID)
+	if err := validateFlightCrew(h.db, companyID, seats); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Get uploaded file
 	file, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded", "code": 400})
 		return
 	}
+	// Checked again with the insert; this spares saving a file that cannot be kept
+	if !checkQuota(c, h.db, companyID.String, models.QuotaFlights, 1) ||
+		!checkQuota(c, h.db, companyID.String, models.QuotaStorage, file.Size) {
+		return
+	}
 
 	// Generate unique filename
 	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
 	filename := fmt.Sprintf("%d-%s", timestamp, file.Filename)
 
-	// Save file to csvs directory
-	csvPath := filepath.Join("csvs", filename)
+	// Save file to the flight file directory
+	csvPath := flightFilePath(filename)
 	if err := c.SaveUploadedFile(file, csvPath); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "File upload failed", "code": 500})
 		return
 	}
+	// The file is only kept once its record is committed
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(csvPath)
+		}
+	}()
 
 	// Save to database
 	id := uuid.New().String()
-	now := time.Now()
 
-	query := `INSERT INTO Csv (id, name, file, aircraftId, departure, destination, flightHours, pilot, createdAt, updatedAt) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO Csv (id, name, file, fileSize, aircraftId, departure, destination, flightHours, pilot, flightDate, createdAt, updatedAt) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err = h.db.Exec(query, id, req.Name, filename, req.AircraftID, req.Departure, req.Destination, req.FlightHours, req.Pilot, now, now)
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if !checkQuota(c, tx, companyID.String, models.QuotaFlights, 1) ||
+		!checkQuota(c, tx, companyID.String, models.QuotaStorage, file.Size) {
+		return
+	}
+	_, err = tx.Exec(query, id, req.Name, filename, file.Size, req.AircraftID, req.Departure, req.Destination, req.FlightHours, req.Pilot, flightDate, now, now)
+	if err == nil {
+		err = setFlightCrew(tx, id, seats)
+	}
+	var crew []models.FlightCrewMember
+	if err == nil {
+		crew, err = loadFlightCrew(tx, id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving CSV record", "details": err.Error()})
 		return
 	}
+	committed = true
+
+	if err := addUsage(h.db, companyID.String, usageDate(now), usageFlightsProcessed, 1, now); err != nil {
+		log.Printf("Warning: Failed to record usage of flight %s: %v", id, err)
+	}
+	warnQuota(c, h.db, companyID.String, models.QuotaFlights)
+	warnQuota(c, h.db, companyID.String, models.QuotaStorage)
+
+	// Progress is pushed to the company's users watching the stream
+	progress := models.IngestProgress{JobID: id, Job: models.IngestJobUpload, FlightID: id, Stage: models.IngestStageReceived, Total: 1}
+	publishIngestProgress(h.db, "", companyID.String, progress)
+	progress.Stage = models.IngestStageProcessing
+	publishIngestProgress(h.db, "", companyID.String, progress)
+
+	// Measurements are best effort: files from unknown recorders still upload
+	if _, err := storeFlightMeasurements(h.db, id, req.AircraftID, csvPath, now); err != nil {
+		log.Printf("Warning: Failed to compute measurements for flight %s: %v", id, err)
+		progress.Error = "measurements: " + err.Error()
+	}
+	progress.Stage, progress.Processed = models.IngestStageCompleted, 1
+	publishIngestProgress(h.db, "", companyID.String, progress)
 
 	// Return created CSV record
 	csv := models.CSV{
@@ -70,49 +152,104 @@ func (h *CSVHandler) UploadCSV(c *gin.Context) {
 		Departure:   req.Departure,
 		Destination: req.Destination,
 		FlightHours: req.FlightHours,
-		Pilot:       req.Pilot,
+		FlightDate:  &flightDate,
+		Crew:        crew,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
 
+	if err := queueWebhooks(h.db, companyID.String, models.WebhookEventFlightUploaded, flightWebhookData(csv), now); err != nil {
+		log.Printf("Warning: Failed to queue webhooks for flight %s: %v", id, err)
+	}
+	wakeWebhookWorker()
+
 	c.JSON(http.StatusOK, csv)
 }
 
-// GetCSVs retrieves all CSV files with exceedances
+// csvListSpec lists the filters and sort keys accepted by GetCSVs
+var csvListSpec = &listSpec{
+	idColumn: "c.id",
+	sorts: map[string]string{
+		"createdAt":   sqlEpochMillis("c.createdAt"),
+		"name":        "COALESCE(c.name, '')",
+		"status":      "COALESCE(c.status, '')",
+		"flightHours": "COALESCE(c.flightHours, '')",
+	},
+	defaultSort: "-createdAt",
+	filters: map[string]listFilter{
+		"aircraft":    eqFilter("c.aircraftId"),
+		"company":     eqFilter("a.companyId"),
+		"status":      lowerFilter("c.status"),
+		"departure":   lowerFilter("c.departure"),
+		"destination": lowerFilter("c.destination"),
+		"from":        dateFilter("c.createdAt", false),
+		"to":          dateFilter("c.createdAt", true),
+	},
+}
+
+// GetCSVs retrieves CSV files with their exceedances, one page at a time
 func (h *CSVHandler) GetCSVs(c *gin.Context) {
-	query := `SELECT c.id, c.name, c.file, c.status, c.departure, c.pilot, c.destination, c.flightHours, c.aircraftId, c.createdAt, c.updatedAt,
-			  a.id as aircraft_id, a.airline, a.aircraftMake, a.modelNumber, a.serialNumber, a.registration, a.companyId, a.parameters, a.createdAt as aircraft_createdAt, a.updatedAt as aircraft_updatedAt,
-			  co.id as company_id, co.name as company_name, co.email as company_email, co.phone as company_phone, co.address as company_address, co.country as company_country, co.logo as company_logo, co.status as company_status, co.subscriptionId as company_subscriptionId, co.createdAt as company_createdAt, co.updatedAt as company_updatedAt
-			  FROM Csv c
+	list, err := parseListQuery(c, csvListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantOf(c).restrict(list, "a.companyId")
+
+	const from = ` FROM Csv c
 			  LEFT JOIN Aircraft a ON c.aircraftId = a.id
 			  LEFT JOIN Company co ON a.companyId = co.id`
-	rows, err := h.db.Query(query)
+
+	total, err := list.count(h.db, from)
 	if err != nil {
+		log.Println("Error counting CSVs:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query := `SELECT c.id, c.name, c.file, c.status, c.departure, c.destination, c.flightHours, c.aircraftId, c.createdAt, c.updatedAt, c.flightDate,
+			  a.id as aircraft_id, a.airline, a.aircraftMake, a.modelNumber, a.serialNumber, a.registration, a.companyId, a.parameters, a.createdAt as aircraft_createdAt, a.updatedAt as aircraft_updatedAt,
+			  co.id as company_id, co.name as company_name, co.email as company_email, co.phone as company_phone, co.address as company_address, co.country as company_country, co.logo as company_logo, co.status as company_status, co.subscriptionId as company_subscriptionId, co.createdAt as company_createdAt, co.updatedAt as company_updatedAt,
+			  ` + list.sortColumn() + from
+	clause, args := list.pageClause()
+	rows, err := h.db.Query(query+clause, args...)
+	if err != nil {
+		log.Println("Error querying CSVs:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 	defer rows.Close()
 
-	var csvs []interface{}
+	type csvWithExceedances struct {
+		models.CSV
+		Aircraft   *models.Aircraft    `json:"aircraft"`
+		Exceedance []models.Exceedance `json:"Exceedance"`
+	}
+	csvs := []*csvWithExceedances{}
+	var csvIDs []string
 	for rows.Next() {
 		var csv models.CSV
 		var aircraft models.Aircraft
 		var company models.Company
-		var createdAtStr, updatedAtStr sql.NullString
+		var createdAtStr, updatedAtStr, flightDateStr sql.NullString
 		var aircraftID sql.NullString
 		var aircraftCreatedAtStr, aircraftUpdatedAtStr sql.NullString
 		var companyID sql.NullString
 		var companyCreatedAtStr, companyUpdatedAtStr sql.NullString
+		var sortValue interface{}
 
-		err := rows.Scan(&csv.ID, &csv.Name, &csv.File, &csv.Status, &csv.Departure, &csv.Pilot,
-			&csv.Destination, &csv.FlightHours, &csv.AircraftID, &createdAtStr, &updatedAtStr,
+		err := rows.Scan(&csv.ID, &csv.Name, &csv.File, &csv.Status, &csv.Departure,
+			&csv.Destination, &csv.FlightHours, &csv.AircraftID, &createdAtStr, &updatedAtStr, &flightDateStr,
 			&aircraftID, &aircraft.Airline, &aircraft.AircraftMake, &aircraft.ModelNumber,
 			&aircraft.SerialNumber, &aircraft.Registration, &aircraft.CompanyID, &aircraft.Parameters, &aircraftCreatedAtStr, &aircraftUpdatedAtStr,
-			&companyID, &company.Name, &company.Email, &company.Phone, &company.Address, &company.Country, &company.Logo, &company.Status, &company.SubscriptionID, &companyCreatedAtStr, &companyUpdatedAtStr)
+			&companyID, &company.Name, &company.Email, &company.Phone, &company.Address, &company.Country, &company.Logo, &company.Status, &company.SubscriptionID, &companyCreatedAtStr, &companyUpdatedAtStr, &sortValue)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning CSV"})
 			return
 		}
+		if !list.accept(csv.ID, sortValue) {
+			break
+		}
 
 		// Parse CSV timestamps
 		if createdAtStr.Valid {
@@ -127,6 +264,12 @@ func (h *CSVHandler) GetCSVs(c *gin.Context) {
 				csv.UpdatedAt = parsedTime
 			}
 		}
+		if flightDateStr.Valid {
+			parsedTime, err := parseTimestamp(flightDateStr.String)
+			if err == nil {
+				csv.FlightDate = &parsedTime
+			}
+		}
 
 		// Handle aircraft
 		var aircraftPtr *models.Aircraft
@@ -172,32 +315,47 @@ func (h *CSVHandler) GetCSVs(c *gin.Context) {
 			aircraftPtr = &aircraft
 		}
 
-		// Get related exceedances
-		exceedances, _ := h.getCSVExceedances(csv.ID)
-
-		csvWithExceedances := struct {
-			models.CSV
-			Aircraft   *models.Aircraft    `json:"aircraft"`
-			Exceedance []models.Exceedance `json:"Exceedance"`
-		}{
-			CSV:        csv,
-			Aircraft:   aircraftPtr,
-			Exceedance: exceedances,
-		}
+		csvs = append(csvs, &csvWithExceedances{CSV: csv, Aircraft: aircraftPtr})
+		csvIDs = append(csvIDs, csv.ID)
+	}
+	rows.Close()
 
-		csvs = append(csvs, csvWithExceedances)
+	// Load the exceedances of the whole page in one query
+	exceedances, err := h.getCSVExceedances(csvIDs)
+	if err != nil {
+		log.Println("Error loading CSV exceedances:", err)
+	}
+	crews, err := loadFlightCrews(h.db, "f.id IN ("+placeholders(len(csvIDs))+")", stringArgs(csvIDs)...)
+	if err != nil {
+		log.Println("Error loading CSV crews:", err)
+	}
+	for _, csv := range csvs {
+		csv.Exceedance = exceedances[csv.ID]
+		csv.Crew = crews[csv.ID]
 	}
 
+	list.writeHeaders(c, total)
 	c.JSON(http.StatusOK, csvs)
 }
 
-// DownloadCSV serves a CSV file for download
+// DownloadCSV serves a CSV file for download. The flight is looked up by id or stored file name.
 func (h *CSVHandler) DownloadCSV(c *gin.Context) {
-	filename := c.Param("id")
-	filePath := filepath.Join("csvs", filename)
+	var id, filename string
+	err := h.db.QueryRow("SELECT id, file FROM Csv WHERE id = ? OR file = ?", c.Param("id"), c.Param("id")).Scan(&id, &filename)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !flightResource.authorize(c, h.db, id) {
+		return
+	}
 
-	// Check if file exists
-	if _, err := filepath.Abs(filePath); err != nil {
+	filePath := flightFilePath(filename)
+	if _, err := os.Stat(filePath); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
@@ -208,14 +366,17 @@ func (h *CSVHandler) DownloadCSV(c *gin.Context) {
 // GetCSVByID retrieves a CSV record by ID
 func (h *CSVHandler) GetCSVByID(c *gin.Context) {
 	id := c.Param("id")
+	if !flightResource.authorize(c, h.db, id) {
+		return
+	}
 
-	query := `SELECT id, name, file, status, departure, pilot, destination, flightHours, aircraftId, createdAt, updatedAt FROM Csv WHERE id = ?`
+	query := `SELECT id, name, file, status, departure, destination, flightHours, aircraftId, createdAt, updatedAt, flightDate FROM Csv WHERE id = ?`
 
 	var csv models.CSV
-	var createdAtStr, updatedAtStr sql.NullString
+	var createdAtStr, updatedAtStr, flightDateStr sql.NullString
 	row := h.db.QueryRow(query, id)
-	err := row.Scan(&csv.ID, &csv.Name, &csv.File, &csv.Status, &csv.Departure, &csv.Pilot,
-		&csv.Destination, &csv.FlightHours, &csv.AircraftID, &createdAtStr, &updatedAtStr)
+	err := row.Scan(&csv.ID, &csv.Name, &csv.File, &csv.Status, &csv.Departure,
+		&csv.Destination, &csv.FlightHours, &csv.AircraftID, &createdAtStr, &updatedAtStr, &flightDateStr)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -240,14 +401,32 @@ func (h *CSVHandler) GetCSVByID(c *gin.Context) {
 			csv.UpdatedAt = parsedTime
 		}
 	}
+	if flightDateStr.Valid {
+		parsedTime, err := parseTimestamp(flightDateStr.String)
+		if err == nil {
+			csv.FlightDate = &parsedTime
+		}
+	}
+	if csv.Crew, err = loadFlightCrew(h.db, id); err != nil {
+		log.Printf("Error loading crew of flight %s: %v", id, err)
+	}
 
 	c.JSON(http.StatusOK, csv)
 }
 
 
 
-// Helper function to get exceedances for a CSV with related EventLog and Aircraft data
-func (h *CSVHandler) getCSVExceedances(csvID string) ([]models.Exceedance, error) {
+// Helper function to get the exceedances of several CSVs with related EventLog and Aircraft data, keyed by CSV id
+func (h *CSVHandler) getCSVExceedances(csvIDs []string) (map[string][]models.Exceedance, error) {
+	exceedances := map[string][]models.Exceedance{}
+	if len(csvIDs) == 0 {
+		return exceedances, nil
+	}
+	args := make([]interface{}, len(csvIDs))
+	for i, id := range csvIDs {
+		args[i] = id
+	}
+
 	query := `SELECT e.id, e.exceedanceValues, e.flightPhase, e.parameterName, e.description, e.eventStatus, 
 			  e.aircraftId, e.flightId, e.file, e.eventId, e.comment, e.exceedanceLevel, e.createdAt, e.updatedAt,
 			  a.serialNumber as aircraftRegistration,
@@ -256,14 +435,13 @@ func (h *CSVHandler) getCSVExceedances(csvID string) ([]models.Exceedance, error
 			  FROM Exceedance e
 			  LEFT JOIN Aircraft a ON e.aircraftId = a.id
 			  LEFT JOIN EventLog ev ON e.eventId = ev.id
-			  WHERE e.flightId = ?`
-	rows, err := h.db.Query(query, csvID)
+			  WHERE e.flightId IN (` + placeholders(len(csvIDs)) + `)`
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var exceedances []models.Exceedance
 	for rows.Next() {
 		var exceedance models.Exceedance
 		var createdAtStr, updatedAtStr sql.NullString
@@ -334,10 +512,10 @@ func (h *CSVHandler) getCSVExceedances(csvID string) ([]models.Exceedance, error
 			exceedance.EventLog = eventLog
 		}
 
-		exceedances = append(exceedances, exceedance)
+		exceedances[exceedance.FlightID] = append(exceedances[exceedance.FlightID], exceedance)
 	}
 
-	return exceedances, nil
+	return exceedances, rows.Err()
 }
 
 // DeleteCSV deletes a CSV file and its associated data
@@ -359,11 +537,24 @@ func (h *CSVHandler) DeleteCSV(c *gin.Context) {
 	}
 
 	// Delete associated exceedances first (foreign key constraint)
+	if err := deleteExceedanceChildren(h.db, "flightId = ?", id); err != nil {
+		log.Printf("Warning: Failed to delete exceedance history: %v", err)
+	}
 	_, err = h.db.Exec("DELETE FROM Exceedance WHERE flightId = ?", id)
 	if err != nil {
 		log.Printf("Warning: Failed to delete associated exceedances: %v", err)
 	}
 
+	if _, err := h.db.Exec("DELETE FROM FlightMeasurement WHERE flightId = ?", id); err != nil {
+		log.Printf("Warning: Failed to delete flight measurements: %v", err)
+	}
+	if _, err := h.db.Exec("DELETE FROM FlightCrew WHERE flightId = ?", id); err != nil {
+		log.Printf("Warning: Failed to delete flight crew: %v", err)
+	}
+	if _, err := h.db.Exec("DELETE FROM Notification WHERE flightId = ?", id); err != nil {
+		log.Printf("Warning: Failed to delete flight notifications: %v", err)
+	}
+
 	// Delete CSV record from database
 	query := "DELETE FROM Csv WHERE id = ?"
 	result, err := h.db.Exec(query, id)
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestFailedUploadRemovesFile(t *testing.T) {
+	db := newTenantTestDB(t)
+	_, err := db.Exec(`CREATE TRIGGER fail_csv_insert BEFORE INSERT ON Csv BEGIN SELECT RAISE(ABORT, 'insert failed'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := uploadTestFlight(t, newTenantTestRouter(db, gatekeeperAActor), map[string]string{
+		"name": "Flight A2", "aircraftId": "aircraft-a"})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("upload: status = %d, want %d (body %s)", w.Code, http.StatusInternalServerError, w.Body)
+	}
+
+	files, err := os.ReadDir(flightFileDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		t.Errorf("file %s kept after the failed upload", f.Name())
+	}
+}
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/mailer"
+	"fdm-backend/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Emails are queued in EmailDelivery, usually inside the transaction that
+// caused them, and sent by a background worker that callers wake once the
+// transaction is committed. Failed attempts are retried with backoff; after the
+// last attempt the message is marked failed and an admin can retry it from the
+// delivery log.
+
+// EmailHandler serves the email delivery log and runs the delivery worker
+type EmailHandler struct {
+	db *sql.DB
+}
+
+func NewEmailHandler(db *sql.DB) *EmailHandler {
+	return &EmailHandler{db: db}
+}
+
+const (
+	emailPollInterval = 30 * time.Second
+	emailBatchSize    = 100
+)
+
+// emailRetryDelays[n-1] is the wait after the nth failed attempt. A message is
+// marked failed when its attempts run out.
+var emailRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour}
+
+// emailWake nudges the delivery worker when messages were queued
+var emailWake = make(chan struct{}, 1)
+
+func wakeEmailWorker() {
+	select {
+	case emailWake <- struct{}{}:
+	default:
+	}
+}
+
+// queueEmail renders a template and queues it for delivery. Nothing is queued
+// when email is not configured or the address is empty; the returned id is
+// then empty.
+func queueEmail(exec dbExecutor, userID, exceedanceID *string, to, template string, data map[string]interface{}, now time.Time) (string, error) {
+	if !mailer.Enabled() || to == "" {
+		return "", nil
+	}
+	msg, err := mailer.Render(template, to, data)
+	if err != nil {
+		return "", err
+	}
+
+	id := uuid.New().String()
+	_, err = exec.Exec(`INSERT INTO EmailDelivery (id, userId, exceedanceId, toAddress, template, subject, textBody, htmlBody,
+			status, attempts, nextAttemptAt, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		id, userID, exceedanceID, to, template, msg.Subject, msg.Text, msg.HTML,
+		models.EmailStatusPending, now.UnixMilli(), now.UnixMilli(), now.UnixMilli())
+	return id, err
+}
+
+// queueUserEmail queues an email to a user's address
+func queueUserEmail(exec dbExecutor, userID string, exceedanceID *string, template string, data map[string]interface{}, now time.Time) error {
+	var email string
+	if err := exec.QueryRow("SELECT COALESCE(email, '') FROM User WHERE id = ?", userID).Scan(&email); err != nil {
+		return err
+	}
+	_, err := queueEmail(exec, &userID, exceedanceID, email, template, data, now)
+	return err
+}
+
+// MonitorEmailDeliveries sends queued emails until the process exits. It
+// returns immediately when SMTP is not configured.
+func (h *EmailHandler) MonitorEmailDeliveries() {
+	sender := mailer.Default()
+	if sender == nil {
+		log.Println("SMTP_HOST is not set, email delivery is disabled")
+		return
+	}
+
+	// Messages a previous process stopped sending are sent again
+	if _, err := h.db.Exec("UPDATE EmailDelivery SET status = ? WHERE status = ?", models.EmailStatusPending, models.EmailStatusSending); err != nil {
+		log.Println("Error resetting email deliveries:", err)
+	}
+
+	ticker := time.NewTicker(emailPollInterval)
+	defer ticker.Stop()
+	for {
+		h.deliverDueEmails(sender, time.Now())
+		select {
+		case <-ticker.C:
+		case <-emailWake:
+		}
+	}
+}
+
+func (h *EmailHandler) deliverDueEmails(sender mailer.Sender, now time.Time) {
+	rows, err := h.db.Query(`SELECT id FROM EmailDelivery WHERE status = ? AND nextAttemptAt <= ?
+		ORDER BY nextAttemptAt LIMIT ?`, models.EmailStatusPending, now.UnixMilli(), emailBatchSize)
+	if err != nil {
+		log.Println("Error loading email deliveries:", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := deliverEmail(h.db, sender, id); err != nil {
+			log.Println("Error delivering email:", err)
+		}
+	}
+}
+
+// deliverEmail sends a pending message once and records the outcome. Messages
+// already claimed by another delivery are left alone.
+func deliverEmail(db *sql.DB, sender mailer.Sender, id string) error {
+	now := time.Now()
+	result, err := db.Exec("UPDATE EmailDelivery SET status = ?, updatedAt = ? WHERE id = ? AND status = ?",
+		models.EmailStatusSending, now.UnixMilli(), id, models.EmailStatusPending)
+	if err != nil {
+		return err
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return nil
+	}
+
+	var msg mailer.Message
+	var attempts int
+	err = db.QueryRow(`SELECT toAddress, subject, COALESCE(textBody, ''), COALESCE(htmlBody, ''), attempts
+		FROM EmailDelivery WHERE id = ?`, id).Scan(&msg.To, &msg.Subject, &msg.Text, &msg.HTML, &attempts)
+	if err != nil {
+		return err
+	}
+
+	sendErr := sender.Send(msg)
+	attempts++
+	now = time.Now()
+	switch {
+	case sendErr == nil:
+		_, err = db.Exec(`UPDATE EmailDelivery SET status = ?, attempts = ?, lastError = NULL, nextAttemptAt = NULL,
+			sentAt = ?, textBody = NULL, htmlBody = NULL, updatedAt = ? WHERE id = ?`,
+			models.EmailStatusSent, attempts, now.UnixMilli(), now.UnixMilli(), id)
+	case attempts > len(emailRetryDelays):
+		log.Printf("Email %s to %s failed after %d attempts: %v", id, msg.To, attempts, sendErr)
+		_, err = db.Exec(`UPDATE EmailDelivery SET status = ?, attempts = ?, lastError = ?, nextAttemptAt = NULL,
+			updatedAt = ? WHERE id = ?`,
+			models.EmailStatusFailed, attempts, sendErr.Error(), now.UnixMilli(), id)
+	default:
+		next := now.Add(emailRetryDelays[attempts-1])
+		_, err = db.Exec(`UPDATE EmailDelivery SET status = ?, attempts = ?, lastError = ?, nextAttemptAt = ?,
+			updatedAt = ? WHERE id = ?`,
+			models.EmailStatusPending, attempts, sendErr.Error(), next.UnixMilli(), now.UnixMilli(), id)
+	}
+	return err
+}
+
+// emailDeliveryListSpec lists the filters and sort keys accepted by GetEmailDeliveries
+var emailDeliveryListSpec = &listSpec{
+	idColumn: "id",
+	sorts: map[string]string{
+		"createdAt": "createdAt",
+		"status":    "status",
+	},
+	defaultSort: "-createdAt",
+	filters: map[string]listFilter{
+		"status":     lowerFilter("status"),
+		"template":   eqFilter("template"),
+		"user":       eqFilter("userId"),
+		"exceedance": eqFilter("exceedanceId"),
+		"recipient":  lowerFilter("toAddress"),
+		"from":       dateFilter("createdAt", false),
+		"to":         dateFilter("createdAt", true),
+	},
+}
+
+const emailDeliveryColumns = `id, userId, exceedanceId, toAddress, template, subject, status, attempts, lastError,
+	nextAttemptAt, sentAt, createdAt, updatedAt`
+
+func scanEmailDelivery(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.EmailDelivery, error) {
+	var d models.EmailDelivery
+	var nextAttemptAt, sentAt sql.NullInt64
+	var createdAt, updatedAt int64
+	dest := []interface{}{&d.ID, &d.UserID, &d.ExceedanceID, &d.To, &d.Template, &d.Subject, &d.Status, &d.Attempts,
+		&d.LastError, &nextAttemptAt, &sentAt, &createdAt, &updatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return d, err
+	}
+	if nextAttemptAt.Valid {
+		t := time.UnixMilli(nextAttemptAt.Int64)
+		d.NextAttemptAt = &t
+	}
+	if sentAt.Valid {
+		t := time.UnixMilli(sentAt.Int64)
+		d.SentAt = &t
+	}
+	d.CreatedAt = time.UnixMilli(createdAt)
+	d.UpdatedAt = time.UnixMilli(updatedAt)
+	return d, nil
+}
+
+// GetEmailDeliveries lists the email delivery log, one page at a time
+func (h *EmailHandler) GetEmailDeliveries(c *gin.Context) {
+	list, err := parseListQuery(c, emailDeliveryListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	const from = " FROM EmailDelivery"
+	total, err := list.count(h.db, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	clause, args := list.pageClause()
+	rows, err := h.db.Query("SELECT "+emailDeliveryColumns+", "+list.sortColumn()+from+clause, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.EmailDelivery{}
+	for rows.Next() {
+		var sortValue interface{}
+		d, err := scanEmailDelivery(rows, &sortValue)
+		if err != nil {
+			log.Println("Error scanning email delivery:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning email delivery"})
+			return
+		}
+		if !list.accept(d.ID, sortValue) {
+			break
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	list.writeHeaders(c, total)
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// GetEmailDeliveryByID returns one entry of the email delivery log
+func (h *EmailHandler) GetEmailDeliveryByID(c *gin.Context) {
+	d, err := scanEmailDelivery(h.db.QueryRow("SELECT "+emailDeliveryColumns+" FROM EmailDelivery WHERE id = ?", c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// RetryEmailDelivery queues a failed email again with a fresh set of attempts
+func (h *EmailHandler) RetryEmailDelivery(c *gin.Context) {
+	id := c.Param("id")
+	var status string
+	err := h.db.QueryRow("SELECT status FROM EmailDelivery WHERE id = ?", id).Scan(&status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if status != models.EmailStatusFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only failed emails can be retried"})
+		return
+	}
+
+	now := time.Now()
+	_, err = h.db.Exec("UPDATE EmailDelivery SET status = ?, attempts = 0, nextAttemptAt = ?, updatedAt = ? WHERE id = ? AND status = ?",
+		models.EmailStatusPending, now.UnixMilli(), now.UnixMilli(), id, models.EmailStatusFailed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrying email"})
+		return
+	}
+	wakeEmailWorker()
+	c.JSON(http.StatusOK, gin.H{"message": "Email queued for delivery"})
+}
+
+// SendTestEmail sends a test email right away and returns its delivery entry,
+// including the SMTP error if the first attempt failed
+func (h *EmailHandler) SendTestEmail(c *gin.Context) {
+	var req models.TestEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sender := mailer.Default()
+	if sender == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Email delivery is not configured"})
+		return
+	}
+
+	userID := c.GetString("userId")
+	id, err := queueEmail(h.db, &userID, nil, req.To, mailer.TemplateTest, nil, time.Now())
+	if err != nil {
+		log.Println("Error queueing test email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error queueing email"})
+		return
+	}
+	if err := deliverEmail(h.db, sender, id); err != nil {
+		log.Println("Error delivering test email:", err)
+	}
+
+	d, err := scanEmailDelivery(h.db.QueryRow("SELECT "+emailDeliveryColumns+" FROM EmailDelivery WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fdm-backend/mailer"
+	"fdm-backend/models"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Escalation policies make sure unacknowledged exceedances are noticed. An
+// exceedance counts as acknowledged once it leaves the new status. While it
+// is new, each tier of every matching policy fires once, afterHours after the
+// exceedance was created, notifying the tier's recipients through its
+// channels. Tiers fire in order, so a policy can reach the analyst on duty
+// first and the chief FDA and safety manager later.
+
+const escalationInterval = 5 * time.Minute
+
+// EscalationHandler manages escalation policies and escalates exceedances
+type EscalationHandler struct {
+	db *sql.DB
+}
+
+func NewEscalationHandler(db *sql.DB) *EscalationHandler {
+	return &EscalationHandler{db: db}
+}
+
+const escalationPolicyColumns = "id, companyId, name, severities, tiers, isActive, createdBy, createdAt, updatedAt"
+
+func scanEscalationPolicy(row interface{ Scan(...interface{}) error }) (models.EscalationPolicy, error) {
+	var policy models.EscalationPolicy
+	var severities, tiers string
+	var createdAt, updatedAt int64
+	err := row.Scan(&policy.ID, &policy.CompanyID, &policy.Name, &severities, &tiers, &policy.IsActive,
+		&policy.CreatedBy, &createdAt, &updatedAt)
+	if err != nil {
+		return policy, err
+	}
+	policy.Severities, policy.Tiers = []string{}, []models.EscalationTier{}
+	if err := json.Unmarshal([]byte(severities), &policy.Severities); err != nil {
+		return policy, err
+	}
+	if err := json.Unmarshal([]byte(tiers), &policy.Tiers); err != nil {
+		return policy, err
+	}
+	policy.CreatedAt = time.UnixMilli(createdAt)
+	policy.UpdatedAt = time.UnixMilli(updatedAt)
+	return policy, nil
+}
+
+func getEscalationPolicy(exec dbExecutor, id string) (models.EscalationPolicy, error) {
+	return scanEscalationPolicy(exec.QueryRow("SELECT "+escalationPolicyColumns+" FROM EscalationPolicy WHERE id = ?", id))
+}
+
+// applyEscalationPolicyRequest copies the fields present in req onto policy
+func applyEscalationPolicyRequest(policy *models.EscalationPolicy, req models.EscalationPolicyRequest) {
+	if req.Name != nil {
+		policy.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Severities != nil {
+		policy.Severities = cleanList(req.Severities, true)
+	}
+	if req.Tiers != nil {
+		policy.Tiers = make([]models.EscalationTier, len(req.Tiers))
+		for i, tier := range req.Tiers {
+			tier.UserIDs = cleanList(tier.UserIDs, false)
+			tier.Roles = cleanList(tier.Roles, true)
+			tier.Channels = cleanList(tier.Channels, true)
+			if len(tier.Channels) == 0 {
+				tier.Channels = []string{models.NotificationChannelInApp}
+			}
+			policy.Tiers[i] = tier
+		}
+	}
+	if req.IsActive != nil {
+		policy.IsActive = *req.IsActive
+	}
+}
+
+// validateEscalationPolicy checks a policy and that the users its tiers name
+// belong to its company
+func validateEscalationPolicy(exec dbExecutor, policy models.EscalationPolicy) error {
+	if policy.Name == "" {
+		return errors.New("name is required")
+	}
+	for _, severity := range policy.Severities {
+		if !containsString(models.ExceedancePriorities, severity) {
+			return errors.New("severities must be one of " + strings.Join(models.ExceedancePriorities, ", "))
+		}
+	}
+	if len(policy.Tiers) == 0 {
+		return errors.New("at least one tier is required")
+	}
+	for i, tier := range policy.Tiers {
+		name := fmt.Sprintf("tier %d: ", i+1)
+		if tier.AfterHours < 1 {
+			return errors.New(name + "afterHours must be at least 1")
+		}
+		if i > 0 && tier.AfterHours <= policy.Tiers[i-1].AfterHours {
+			return errors.New(name + "afterHours must be later than the previous tier")
+		}
+		for _, channel := range tier.Channels {
+			if !containsString(models.NotificationChannels, channel) {
+				return errors.New(name + "channels must be one of " + strings.Join(models.NotificationChannels, ", "))
+			}
+		}
+		if err := validateRecipients(exec, policy.CompanyID, tier.UserIDs, tier.Roles); err != nil {
+			return errors.New(name + err.Error())
+		}
+	}
+	return nil
+}
+
+// GetEscalationPolicies lists the escalation policies of the caller's company
+func (h *EscalationHandler) GetEscalationPolicies(c *gin.Context) {
+	condition, args := tenantOf(c).condition("companyId")
+	if v := strings.TrimSpace(c.Query("company")); v != "" {
+		condition += " AND companyId = ?"
+		args = append(args, v)
+	}
+
+	rows, err := h.db.Query("SELECT "+escalationPolicyColumns+" FROM EscalationPolicy WHERE "+condition+" ORDER BY name", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	policies := []models.EscalationPolicy{}
+	for rows.Next() {
+		policy, err := scanEscalationPolicy(rows)
+		if err != nil {
+			log.Println("Error scanning escalation policy:", err)
+			continue
+		}
+		policies = append(policies, policy)
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+// GetEscalationPolicyByID returns a single escalation policy
+func (h *EscalationHandler) GetEscalationPolicyByID(c *gin.Context) {
+	id := c.Param("id")
+	if !escalationPolicyResource.authorize(c, h.db, id) {
+		return
+	}
+
+	policy, err := getEscalationPolicy(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// CreateEscalationPolicy defines a new policy. Gatekeepers create policies for
+// their own company; admins and FDAs must name the company.
+func (h *EscalationHandler) CreateEscalationPolicy(c *gin.Context) {
+	var req models.EscalationPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	companyID, ok := requestedCompany(c, h.db, req.CompanyID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	userID := c.GetString("userId")
+	policy := models.EscalationPolicy{
+		ID:         uuid.New().String(),
+		CompanyID:  companyID,
+		Severities: []string{},
+		Tiers:      []models.EscalationTier{},
+		IsActive:   true,
+		CreatedBy:  &userID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	applyEscalationPolicyRequest(&policy, req)
+	if err := validateEscalationPolicy(h.db, policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.db.Exec(`INSERT INTO EscalationPolicy (`+escalationPolicyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		policy.ID, policy.CompanyID, policy.Name, jsonText(policy.Severities), jsonText(policy.Tiers),
+		policy.IsActive, policy.CreatedBy, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		log.Println("Error creating escalation policy:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating escalation policy"})
+		return
+	}
+	c.JSON(http.StatusCreated, policy)
+}
+
+// UpdateEscalationPolicy changes an escalation policy. Tiers that already
+// fired for an exceedance do not fire again.
+func (h *EscalationHandler) UpdateEscalationPolicy(c *gin.Context) {
+	id := c.Param("id")
+	if !escalationPolicyResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var req models.EscalationPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := getEscalationPolicy(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.CompanyID != nil && *req.CompanyID != policy.CompanyID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "companyId cannot be changed"})
+		return
+	}
+	applyEscalationPolicyRequest(&policy, req)
+	if err := validateEscalationPolicy(h.db, policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	policy.UpdatedAt = now
+	_, err = h.db.Exec(`UPDATE EscalationPolicy SET name = ?, severities = ?, tiers = ?, isActive = ?, updatedAt = ? WHERE id = ?`,
+		policy.Name, jsonText(policy.Severities), jsonText(policy.Tiers), policy.IsActive, now.UnixMilli(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating escalation policy"})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeleteEscalationPolicy removes an escalation policy. The escalations it made
+// stay on the exceedances.
+func (h *EscalationHandler) DeleteEscalationPolicy(c *gin.Context) {
+	id := c.Param("id")
+	if !escalationPolicyResource.authorize(c, h.db, id) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE ExceedanceEscalation SET policyId = NULL WHERE policyId = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting escalation policy"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM EscalationPolicy WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting escalation policy"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting escalation policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Escalation policy deleted successfully"})
+}
+
+// exceedanceEscalations returns the escalations of an exceedance, oldest first
+func exceedanceEscalations(exec dbExecutor, exceedanceID string) ([]models.ExceedanceEscalation, error) {
+	rows, err := exec.Query(`SELECT x.id, x.exceedanceId, x.policyId, p.name, x.tier, x.afterHours, x.recipients, x.createdAt
+		FROM ExceedanceEscalation x
+		LEFT JOIN EscalationPolicy p ON x.policyId = p.id
+		WHERE x.exceedanceId = ?
+		ORDER BY x.createdAt, x.tier`, exceedanceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	escalations := []models.ExceedanceEscalation{}
+	for rows.Next() {
+		var e models.ExceedanceEscalation
+		var recipients string
+		var createdAt int64
+		if err := rows.Scan(&e.ID, &e.ExceedanceID, &e.PolicyID, &e.PolicyName, &e.Tier, &e.AfterHours,
+			&recipients, &createdAt); err != nil {
+			return nil, err
+		}
+		e.Recipients = []string{}
+		json.Unmarshal([]byte(recipients), &e.Recipients)
+		e.CreatedAt = time.UnixMilli(createdAt)
+		escalations = append(escalations, e)
+	}
+	return escalations, rows.Err()
+}
+
+// MonitorEscalations escalates unacknowledged exceedances until the process
+// exits
+func (h *EscalationHandler) MonitorEscalations() {
+	ticker := time.NewTicker(escalationInterval)
+	defer ticker.Stop()
+	for {
+		h.escalateExceedances(time.Now())
+		<-ticker.C
+	}
+}
+
+// escalateExceedances fires every tier that is due on the exceedances still new
+func (h *EscalationHandler) escalateExceedances(now time.Time) {
+	rows, err := h.db.Query("SELECT " + escalationPolicyColumns + " FROM EscalationPolicy WHERE isActive = 1")
+	if err != nil {
+		log.Println("Error loading escalation policies:", err)
+		return
+	}
+	var policies []models.EscalationPolicy
+	for rows.Next() {
+		if policy, err := scanEscalationPolicy(rows); err == nil {
+			policies = append(policies, policy)
+		}
+	}
+	rows.Close()
+
+	escalated := 0
+	for _, policy := range policies {
+		for i, tier := range policy.Tiers {
+			exceedanceIDs, err := h.dueEscalations(policy, i+1, tier, now)
+			if err != nil {
+				log.Printf("Error finding exceedances to escalate for policy %s: %v", policy.ID, err)
+				break
+			}
+			for _, exceedanceID := range exceedanceIDs {
+				if err := h.escalate(policy, i+1, tier, exceedanceID, now); err != nil {
+					log.Printf("Error escalating exceedance %s: %v", exceedanceID, err)
+					continue
+				}
+				escalated++
+			}
+		}
+	}
+	if escalated > 0 {
+		log.Printf("Escalated %d unacknowledged exceedance(s)", escalated)
+		wakeEmailWorker()
+		wakeWebhookWorker()
+	}
+}
+
+// dueEscalations returns the new exceedances of a policy's company that a tier
+// is due for and has not escalated yet
+func (h *EscalationHandler) dueEscalations(policy models.EscalationPolicy, tierNumber int, tier models.EscalationTier, now time.Time) ([]string, error) {
+	query := `SELECT e.id FROM Exceedance e
+		JOIN Aircraft a ON e.aircraftId = a.id
+		WHERE a.companyId = ? AND e.eventStatus = ? AND e.createdAt <= ?
+		AND NOT EXISTS (SELECT 1 FROM ExceedanceEscalation x WHERE x.exceedanceId = e.id AND x.policyId = ? AND x.tier = ?)`
+	args := []interface{}{policy.CompanyID, models.ExceedanceStatusNew,
+		now.Add(-time.Duration(tier.AfterHours) * time.Hour).UnixMilli(), policy.ID, tierNumber}
+	if len(policy.Severities) > 0 {
+		query += " AND COALESCE(e.priority, lower(e.exceedanceLevel)) IN (" + placeholders(len(policy.Severities)) + ")"
+		args = append(args, stringArgs(policy.Severities)...)
+	}
+	rows, err := h.db.Query(query+" ORDER BY e.createdAt", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// escalate records a tier escalating an exceedance and notifies the tier's
+// recipients
+func (h *EscalationHandler) escalate(policy models.EscalationPolicy, tierNumber int, tier models.EscalationTier, exceedanceID string, now time.Time) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var level, description, registration, flight, flightID, status string
+	err = tx.QueryRow(`SELECT COALESCE(e.exceedanceLevel, ''), COALESCE(e.description, ''),
+			COALESCE(a.registration, a.serialNumber, ''), COALESCE(f.name, ''), COALESCE(e.flightId, ''), e.eventStatus
+		FROM Exceedance e
+		LEFT JOIN Aircraft a ON e.aircraftId = a.id
+		LEFT JOIN Csv f ON e.flightId = f.id
+		WHERE e.id = ?`, exceedanceID).Scan(&level, &description, &registration, &flight, &flightID, &status)
+	if err != nil {
+		return err
+	}
+	if status != models.ExceedanceStatusNew {
+		return nil // acknowledged in the meantime
+	}
+
+	recipients, err := ruleRecipients(tx, policy.CompanyID, tier.UserIDs, tier.Roles)
+	if err != nil {
+		return err
+	}
+	if recipients == nil {
+		recipients = []string{}
+	}
+	escalation := models.ExceedanceEscalation{
+		ID:           uuid.New().String(),
+		ExceedanceID: exceedanceID,
+		PolicyID:     &policy.ID,
+		PolicyName:   &policy.Name,
+		Tier:         tierNumber,
+		AfterHours:   tier.AfterHours,
+		Recipients:   recipients,
+		CreatedAt:    now,
+	}
+	// The unique key makes a concurrent run skip the tier instead of notifying twice
+	result, err := tx.Exec(`INSERT OR IGNORE INTO ExceedanceEscalation (id, exceedanceId, policyId, tier, afterHours, recipients, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		escalation.ID, exceedanceID, policy.ID, tierNumber, tier.AfterHours, jsonText(recipients), now.UnixMilli())
+	if err != nil {
+		return err
+	}
+	if inserted, _ := result.RowsAffected(); inserted == 0 {
+		return nil
+	}
+
+	hours := fmt.Sprintf("%d hours", tier.AfterHours)
+	if tier.AfterHours == 1 {
+		hours = "1 hour"
+	}
+	target := notificationTarget{kind: models.NotificationTargetExceedance, id: exceedanceID, flightID: flightID}
+	message := fmt.Sprintf("Escalation: %s has not been reviewed for %s (Level %s)", description, hours, level)
+	email := map[string]interface{}{
+		"Level":       level,
+		"Description": description,
+		"Aircraft":    registration,
+		"Flight":      flight,
+		"Hours":       tier.AfterHours,
+		"Policy":      policy.Name,
+		"Tier":        tierNumber,
+		"Link":        target.link().URL,
+	}
+	// Recipients' preferences apply as they do to new exceedances
+	for _, userID := range recipients {
+		pref, err := loadNotificationPreference(tx, userID)
+		if err != nil {
+			return err
+		}
+		inApp := containsString(tier.Channels, models.NotificationChannelInApp) &&
+			containsString(pref.Channels, models.NotificationChannelInApp)
+		emailed := containsString(tier.Channels, models.NotificationChannelEmail) &&
+			containsString(pref.Channels, models.NotificationChannelEmail)
+		held := dueAt(pref, modeFor(pref, level), now).After(now)
+		if inApp || (emailed && held) {
+			if _, err := insertNotification(tx, pref, target, message, level, emailed && held, now); err != nil {
+				return err
+			}
+		}
+		if emailed && !held {
+			id := exceedanceID
+			if err := queueUserEmail(tx, userID, &id, mailer.TemplateExceedanceEscalation, email, now); err != nil {
+				return err
+			}
+		}
+	}
+	if err := queueWebhooks(tx, policy.CompanyID, models.WebhookEventExceedanceEscalated, escalation, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
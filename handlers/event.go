@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"fdm-backend/models"
+	"log"
 	"net/http"
 	"time"
 
@@ -26,22 +27,9 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 		return
 	}
 
-	// Debug logging
-	println("=== CreateEvent Debug ===")
-	if req.TriggerType != nil {
-		println("TriggerType received:", *req.TriggerType)
-	} else {
-		println("TriggerType is nil")
-	}
-	if req.DetectionPeriod != nil {
-		println("DetectionPeriod received:", *req.DetectionPeriod)
-	} else {
-		println("DetectionPeriod is nil")
-	}
-	if req.Severities != nil {
-		println("Severities received:", *req.Severities)
-	} else {
-		println("Severities is nil")
+	// Events can only be defined for the company's own aircraft
+	if !aircraftResource.authorize(c, h.db, req.AircraftID) {
+		return
 	}
 
 	// Generate ID and timestamps
@@ -89,28 +77,68 @@ func (h *EventHandler) CreateEvent(c *gin.Context) {
 	c.JSON(http.StatusOK, event)
 }
 
-// GetEvents retrieves all events with aircraft information
+// eventListSpec lists the filters and sort keys accepted by GetEvents
+var eventListSpec = &listSpec{
+	idColumn: "e.id",
+	sorts: map[string]string{
+		"createdAt":   sqlEpochMillis("e.createdAt"),
+		"eventCode":   "COALESCE(e.eventCode, '')",
+		"displayName": "COALESCE(e.displayName, '')",
+	},
+	defaultSort: "-createdAt",
+	filters: map[string]listFilter{
+		"aircraft":    eqFilter("e.aircraftId"),
+		"company":     eqFilter("a.companyId"),
+		"eventCode":   eqFilter("e.eventCode"),
+		"eventType":   lowerFilter("e.eventType"),
+		"triggerType": lowerFilter("e.triggerType"),
+		"phase":       containsFilter("e.flightPhase"),
+		"from":        dateFilter("e.createdAt", false),
+		"to":          dateFilter("e.createdAt", true),
+	},
+}
+
+// GetEvents retrieves events with aircraft information, one page at a time
 func (h *EventHandler) GetEvents(c *gin.Context) {
-	query := `SELECT e.id, e.eventName, e.displayName, e.eventCode, e.eventDescription, e.eventParameter, e.eventTrigger, e.eventType, e.flightPhase, e.high, e.high1, e.high2, e.low, e.low1, e.low2, e.triggerType, e.detectionPeriod, e.severities, e.sop, e.aircraftId, e.createdAt, e.updatedAt,
-			  a.id as aircraft_id, a.airline, a.aircraftMake, a.modelNumber, a.serialNumber, a.companyId, a.parameters, a.createdAt as aircraft_createdAt, a.updatedAt as aircraft_updatedAt,
-			  c.id as company_id, c.name as company_name, c.email as company_email, c.phone as company_phone, c.address as company_address, c.country as company_country, c.logo as company_logo, c.status as company_status, c.subscriptionId as company_subscriptionId, c.createdAt as company_createdAt, c.updatedAt as company_updatedAt
-			  FROM EventLog e 
+	list, err := parseListQuery(c, eventListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantOf(c).restrict(list, "a.companyId")
+
+	const from = ` FROM EventLog e 
 			  LEFT JOIN Aircraft a ON e.aircraftId = a.id
 			  LEFT JOIN Company c ON a.companyId = c.id`
 
-	rows, err := h.db.Query(query)
+	total, err := list.count(h.db, from)
+	if err != nil {
+		log.Println("Error counting events:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query := `SELECT e.id, e.eventName, e.displayName, e.eventCode, e.eventDescription, e.eventParameter, e.eventTrigger, e.eventType, e.flightPhase, e.high, e.high1, e.high2, e.low, e.low1, e.low2, e.triggerType, e.detectionPeriod, e.severities, e.sop, e.aircraftId, e.createdAt, e.updatedAt,
+			  a.id as aircraft_id, a.airline, a.aircraftMake, a.modelNumber, a.serialNumber, a.companyId, a.parameters, a.createdAt as aircraft_createdAt, a.updatedAt as aircraft_updatedAt,
+			  c.id as company_id, c.name as company_name, c.email as company_email, c.phone as company_phone, c.address as company_address, c.country as company_country, c.logo as company_logo, c.status as company_status, c.subscriptionId as company_subscriptionId, c.createdAt as company_createdAt, c.updatedAt as company_updatedAt,
+			  ` + list.sortColumn() + from
+
+	clause, args := list.pageClause()
+	rows, err := h.db.Query(query+clause, args...)
 	if err != nil {
+		log.Println("Error querying events:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 	defer rows.Close()
 
-	var events []interface{}
+	events := []interface{}{}
 	for rows.Next() {
 		var event models.EventLog
 		var aircraft models.Aircraft
 		var company models.Company
 		var eventCreatedAtStr, eventUpdatedAtStr, aircraftCreatedAtStr, aircraftUpdatedAtStr, companyCreatedAtStr, companyUpdatedAtStr sql.NullString
+		var sortValue interface{}
 
 		err := rows.Scan(&event.ID, &event.EventName, &event.DisplayName, &event.EventCode,
 			&event.EventDescription, &event.EventParameter, &event.EventTrigger, &event.EventType,
@@ -118,12 +146,15 @@ func (h *EventHandler) GetEvents(c *gin.Context) {
 			&event.Low1, &event.Low2, &event.TriggerType, &event.DetectionPeriod, &event.Severities, &event.SOP, &event.AircraftID, &eventCreatedAtStr, &eventUpdatedAtStr,
 			&aircraft.ID, &aircraft.Airline, &aircraft.AircraftMake, &aircraft.ModelNumber,
 			&aircraft.SerialNumber, &aircraft.CompanyID, &aircraft.Parameters, &aircraftCreatedAtStr, &aircraftUpdatedAtStr,
-			&company.ID, &company.Name, &company.Email, &company.Phone, &company.Address, &company.Country, &company.Logo, &company.Status, &company.SubscriptionID, &companyCreatedAtStr, &companyUpdatedAtStr)
+			&company.ID, &company.Name, &company.Email, &company.Phone, &company.Address, &company.Country, &company.Logo, &company.Status, &company.SubscriptionID, &companyCreatedAtStr, &companyUpdatedAtStr, &sortValue)
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning event"})
 			return
 		}
+		if !list.accept(event.ID, sortValue) {
+			break
+		}
 
 		// Handle nullable timestamps for event using parseTimestamp
 		if eventCreatedAtStr.Valid {
@@ -181,12 +212,16 @@ func (h *EventHandler) GetEvents(c *gin.Context) {
 		events = append(events, eventWithAircraft)
 	}
 
+	list.writeHeaders(c, total)
 	c.JSON(http.StatusOK, events)
 }
 
 // GetEventByID retrieves an event by ID
 func (h *EventHandler) GetEventByID(c *gin.Context) {
 	id := c.Param("id")
+	if !eventResource.authorize(c, h.db, id) {
+		return
+	}
 
 	query := `SELECT id, eventName, displayName, eventCode, eventDescription, eventParameter, eventTrigger, eventType, flightPhase, high, high1, high2, low, low1, low2, triggerType, detectionPeriod, severities, sop, aircraftId, createdAt, updatedAt FROM EventLog WHERE id = ?`
 
@@ -233,33 +268,6 @@ func (h *EventHandler) UpdateEvent(c *gin.Context) {
 		return
 	}
 
-	// Debug logging
-	println("=== UpdateEvent Debug ===")
-	println("Event ID:", id)
-	if req.EventName != nil {
-		println("EventName received:", *req.EventName)
-	} else {
-		println("EventName is nil")
-	}
-	println("DisplayName:", req.DisplayName)
-	println("EventCode:", req.EventCode)
-	println("EventTrigger:", req.EventTrigger)
-	if req.TriggerType != nil {
-		println("TriggerType received:", *req.TriggerType)
-	} else {
-		println("TriggerType is nil")
-	}
-	if req.DetectionPeriod != nil {
-		println("DetectionPeriod received:", *req.DetectionPeriod)
-	} else {
-		println("DetectionPeriod is nil")
-	}
-	if req.Severities != nil {
-		println("Severities received:", *req.Severities)
-	} else {
-		println("Severities is nil")
-	}
-
 	now := time.Now()
 
 	query := `UPDATE EventLog SET eventName = ?, displayName = ?, eventCode = ?, eventDescription = ?, eventParameter = ?, eventTrigger = ?, eventType = ?, flightPhase = ?, high = ?, low = ?, low1 = ?, high1 = ?, low2 = ?, high2 = ?, triggerType = ?, detectionPeriod = ?, severities = ?, sop = ?, aircraftId = ?, updatedAt = ? WHERE id = ?`
@@ -268,7 +276,7 @@ func (h *EventHandler) UpdateEvent(c *gin.Context) {
 		req.EventParameter, req.EventTrigger, req.EventType, req.FlightPhase, req.High, req.Low,
 		req.Low1, req.High1, req.Low2, req.High2, req.TriggerType, req.DetectionPeriod, req.Severities, req.SOP, req.AircraftID, now.UnixMilli(), id)
 	if err != nil {
-		println("Database error:", err.Error())
+		log.Printf("Error updating event %s: %v", id, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating event"})
 		return
 	}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fdm-backend/config"
 	"fdm-backend/models"
 	"log"
 	"net/http"
@@ -20,27 +22,73 @@ func NewExceedanceHandler(db *sql.DB) *ExceedanceHandler {
 	return &ExceedanceHandler{db: db}
 }
 
-// GetExceedances retrieves all exceedances with related data
+// exceedanceListSpec lists the filters and sort keys accepted by GetExceedances
+var exceedanceListSpec = &listSpec{
+	idColumn: "e.id",
+	sorts: map[string]string{
+		"createdAt": "COALESCE(e.createdAt, 0)",
+		"updatedAt": "COALESCE(e.updatedAt, 0)",
+		"dueDate":   "COALESCE(e.dueDate, 0)",
+		"status":    "COALESCE(e.eventStatus, '')",
+		"severity":  "(CASE lower(e.exceedanceLevel) WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 WHEN 'critical' THEN 4 ELSE 0 END)",
+		"priority":  "(CASE e.priority WHEN 'low' THEN 1 WHEN 'medium' THEN 2 WHEN 'high' THEN 3 WHEN 'critical' THEN 4 ELSE 0 END)",
+	},
+	defaultSort: "-createdAt",
+	filters: map[string]listFilter{
+		"aircraft":  eqFilter("e.aircraftId"),
+		"company":   eqFilter("a.companyId"),
+		"flight":    eqFilter("e.flightId"),
+		"assignee":  eqFilter("e.assigneeId"),
+		"eventCode": eqFilter("el.eventCode"),
+		"phase":     containsFilter("e.flightPhase"),
+		"severity":  lowerFilter("e.exceedanceLevel"),
+		"status":    lowerFilter("e.eventStatus"),
+		"priority":  lowerFilter("e.priority"),
+		"from":      dateFilter("e.createdAt", false),
+		"to":        dateFilter("e.createdAt", true),
+	},
+}
+
+// GetExceedances retrieves exceedances with related data, one page at a time
 func (h *ExceedanceHandler) GetExceedances(c *gin.Context) {
-	query := `SELECT e.id, COALESCE(e.exceedanceValues, '') as exceedanceValues, COALESCE(e.flightPhase, '') as flightPhase, COALESCE(e.parameterName, '') as parameterName, COALESCE(e.description, '') as description, COALESCE(e.eventStatus, '') as eventStatus, COALESCE(e.aircraftId, '') as aircraftId, COALESCE(e.flightId, '') as flightId, e.file, e.eventId, e.comment, e.exceedanceLevel, e.createdAt, e.updatedAt,
-			  el.id as eventlog_id, el.eventName, COALESCE(el.displayName, '') as displayName, COALESCE(el.eventCode, '') as eventCode, COALESCE(el.eventDescription, '') as eventDescription, COALESCE(el.eventParameter, '') as eventParameter, COALESCE(el.eventTrigger, '') as eventTrigger, COALESCE(el.eventType, '') as eventType, COALESCE(el.flightPhase, '') as eventlog_flightPhase, el.high, el.high1, el.high2, el.low, el.low1, el.low2, el.triggerType, el.detectionPeriod, el.severities, COALESCE(el.sop, '') as sop, COALESCE(el.aircraftId, '') as eventlog_aircraftId, el.createdAt as eventlog_createdAt, el.updatedAt as eventlog_updatedAt,
-			  c.id as csv_id, COALESCE(c.name, '') as name, COALESCE(c.file, '') as csv_file, c.status, c.departure, c.pilot, c.destination, c.flightHours, COALESCE(c.aircraftId, '') as csv_aircraftId, c.createdAt as csv_createdAt, c.updatedAt as csv_updatedAt,
-			  a.id as aircraft_id, COALESCE(a.airline, '') as airline, COALESCE(a.aircraftMake, '') as aircraftMake, a.modelNumber, COALESCE(a.serialNumber, '') as serialNumber, COALESCE(a.companyId, '') as companyId, a.parameters, a.createdAt as aircraft_createdAt, a.updatedAt as aircraft_updatedAt,
-			  co.id as company_id, COALESCE(co.name, '') as company_name, COALESCE(co.email, '') as company_email, co.phone as company_phone, co.address as company_address, co.country as company_country, co.logo as company_logo, COALESCE(co.status, '') as company_status, co.subscriptionId as company_subscriptionId, co.createdAt as company_createdAt, co.updatedAt as company_updatedAt
-			  FROM Exceedance e 
+	list, err := parseListQuery(c, exceedanceListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantOf(c).restrict(list, "a.companyId")
+
+	const from = ` FROM Exceedance e 
 			  LEFT JOIN EventLog el ON e.eventId = el.id 
 			  LEFT JOIN Csv c ON e.flightId = c.id 
 			  LEFT JOIN Aircraft a ON e.aircraftId = a.id
 			  LEFT JOIN Company co ON a.companyId = co.id`
 
-	rows, err := h.db.Query(query)
+	total, err := list.count(h.db, from)
+	if err != nil {
+		log.Println("Error counting exceedances:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	query := `SELECT e.id, COALESCE(e.exceedanceValues, '') as exceedanceValues, COALESCE(e.flightPhase, '') as flightPhase, COALESCE(e.parameterName, '') as parameterName, COALESCE(e.description, '') as description, COALESCE(e.eventStatus, '') as eventStatus, COALESCE(e.aircraftId, '') as aircraftId, COALESCE(e.flightId, '') as flightId, e.file, e.eventId, e.comment, e.exceedanceLevel, e.createdAt, e.updatedAt, e.assigneeId, e.dueDate, e.priority,
+			  el.id as eventlog_id, el.eventName, COALESCE(el.displayName, '') as displayName, COALESCE(el.eventCode, '') as eventCode, COALESCE(el.eventDescription, '') as eventDescription, COALESCE(el.eventParameter, '') as eventParameter, COALESCE(el.eventTrigger, '') as eventTrigger, COALESCE(el.eventType, '') as eventType, COALESCE(el.flightPhase, '') as eventlog_flightPhase, el.high, el.high1, el.high2, el.low, el.low1, el.low2, el.triggerType, el.detectionPeriod, el.severities, COALESCE(el.sop, '') as sop, COALESCE(el.aircraftId, '') as eventlog_aircraftId, el.createdAt as eventlog_createdAt, el.updatedAt as eventlog_updatedAt,
+			  c.id as csv_id, COALESCE(c.name, '') as name, COALESCE(c.file, '') as csv_file, c.status, c.departure, c.destination, c.flightHours, COALESCE(c.aircraftId, '') as csv_aircraftId, c.createdAt as csv_createdAt, c.updatedAt as csv_updatedAt,
+			  a.id as aircraft_id, COALESCE(a.airline, '') as airline, COALESCE(a.aircraftMake, '') as aircraftMake, a.modelNumber, COALESCE(a.serialNumber, '') as serialNumber, COALESCE(a.companyId, '') as companyId, a.parameters, a.createdAt as aircraft_createdAt, a.updatedAt as aircraft_updatedAt,
+			  co.id as company_id, COALESCE(co.name, '') as company_name, COALESCE(co.email, '') as company_email, co.phone as company_phone, co.address as company_address, co.country as company_country, co.logo as company_logo, COALESCE(co.status, '') as company_status, co.subscriptionId as company_subscriptionId, co.createdAt as company_createdAt, co.updatedAt as company_updatedAt,
+			  ` + list.sortColumn() + from
+
+	clause, args := list.pageClause()
+	rows, err := h.db.Query(query+clause, args...)
 	if err != nil {
+		log.Println("Error querying exceedances:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
 	defer rows.Close()
 
-	var exceedances []interface{}
+	exceedances := []interface{}{}
+	var flights []*models.CSV
 	for rows.Next() {
 		var exceedance models.Exceedance
 		var eventLog models.EventLog
@@ -56,28 +104,34 @@ func (h *ExceedanceHandler) GetExceedances(c *gin.Context) {
 		var aircraftID sql.NullString
 		var aircraftCreatedAt, aircraftUpdatedAt sql.NullInt64
 		var exceedanceCreatedAt, exceedanceUpdatedAt sql.NullInt64
+		var dueDate sql.NullInt64
 		var companyID sql.NullString
 		var companyCreatedAt, companyUpdatedAt sql.NullTime
+		var sortValue interface{}
 
 		err := rows.Scan(&exceedance.ID, &exceedance.ExceedanceValues, &exceedance.FlightPhase,
 			&exceedance.ParameterName, &exceedance.Description, &exceedance.EventStatus,
 			&exceedance.AircraftID, &exceedance.FlightID, &exceedance.File, &exceedance.EventID,
 			&exceedance.Comment, &exceedance.ExceedanceLevel, &exceedanceCreatedAt, &exceedanceUpdatedAt,
+			&exceedance.AssigneeID, &dueDate, &exceedance.Priority,
 			&eventLogID, &eventLog.EventName, &eventLog.DisplayName, &eventLog.EventCode,
 			&eventLog.EventDescription, &eventLog.EventParameter, &eventLog.EventTrigger, &eventLog.EventType,
 			&eventLog.FlightPhase, &eventLog.High, &eventLog.High1, &eventLog.High2, &eventLog.Low,
 			&eventLog.Low1, &eventLog.Low2, &eventLog.TriggerType, &eventLog.DetectionPeriod, &eventLog.Severities, &eventLog.SOP, &eventLog.AircraftID, &eventLogCreatedAt, &eventLogUpdatedAt,
-			&csvID, &csv.Name, &csv.File, &csv.Status, &csv.Departure, &csv.Pilot,
+			&csvID, &csv.Name, &csv.File, &csv.Status, &csv.Departure,
 			&csv.Destination, &csv.FlightHours, &csv.AircraftID, &csvCreatedAt, &csvUpdatedAt,
 			&aircraftID, &aircraft.Airline, &aircraft.AircraftMake, &aircraft.ModelNumber,
 			&aircraft.SerialNumber, &aircraft.CompanyID, &aircraft.Parameters, &aircraftCreatedAt, &aircraftUpdatedAt,
-			&companyID, &company.Name, &company.Email, &company.Phone, &company.Address, &company.Country, &company.Logo, &company.Status, &company.SubscriptionID, &companyCreatedAt, &companyUpdatedAt)
+			&companyID, &company.Name, &company.Email, &company.Phone, &company.Address, &company.Country, &company.Logo, &company.Status, &company.SubscriptionID, &companyCreatedAt, &companyUpdatedAt, &sortValue)
 
 		if err != nil {
 			log.Println("Error scanning exceedance:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning exceedance"})
 			return
 		}
+		if !list.accept(exceedance.ID, sortValue) {
+			break
+		}
 
 		// Handle exceedance timestamps
 		if exceedanceCreatedAt.Valid {
@@ -86,6 +140,10 @@ func (h *ExceedanceHandler) GetExceedances(c *gin.Context) {
 		if exceedanceUpdatedAt.Valid {
 			exceedance.UpdatedAt = time.UnixMilli(exceedanceUpdatedAt.Int64)
 		}
+		if dueDate.Valid {
+			due := time.UnixMilli(dueDate.Int64)
+			exceedance.DueDate = &due
+		}
 
 		// Handle nullable eventlog
 		var eventLogPtr *models.EventLog
@@ -143,28 +201,51 @@ func (h *ExceedanceHandler) GetExceedances(c *gin.Context) {
 		exceedanceWithRelations := struct {
 			models.Exceedance
 			EventLog *models.EventLog `json:"eventlog"`
-			CSV      models.CSV       `json:"csv"`
+			CSV      *models.CSV      `json:"csv"`
 			Aircraft models.Aircraft  `json:"aircraft"`
 		}{
 			Exceedance: exceedance,
 			EventLog:   eventLogPtr,
-			CSV:        csv,
+			CSV:        &csv,
 			Aircraft:   aircraft,
 		}
 
 		exceedances = append(exceedances, exceedanceWithRelations)
+		flights = append(flights, &csv)
 	}
+	rows.Close()
 
+	// Attach the de-identified crew of each flight
+	flightIDs := make([]string, 0, len(flights))
+	for _, flight := range flights {
+		if flight.ID != "" {
+			flightIDs = append(flightIDs, flight.ID)
+		}
+	}
+	if len(flightIDs) > 0 {
+		crews, err := loadFlightCrews(h.db, "f.id IN ("+placeholders(len(flightIDs))+")", stringArgs(flightIDs)...)
+		if err != nil {
+			log.Println("Error loading exceedance crews:", err)
+		}
+		for _, flight := range flights {
+			flight.Crew = crews[flight.ID]
+		}
+	}
+
+	list.writeHeaders(c, total)
 	c.JSON(http.StatusOK, exceedances)
 }
 
 // GetExceedanceByID retrieves an exceedance by ID with related data
 func (h *ExceedanceHandler) GetExceedanceByID(c *gin.Context) {
 	id := c.Param("id")
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
 
-	query := `SELECT e.id, COALESCE(e.exceedanceValues, '') as exceedanceValues, COALESCE(e.flightPhase, '') as flightPhase, COALESCE(e.parameterName, '') as parameterName, COALESCE(e.description, '') as description, COALESCE(e.eventStatus, '') as eventStatus, COALESCE(e.aircraftId, '') as aircraftId, COALESCE(e.flightId, '') as flightId, e.file, e.eventId, e.comment, e.exceedanceLevel, e.createdAt, e.updatedAt,
+	query := `SELECT e.id, COALESCE(e.exceedanceValues, '') as exceedanceValues, COALESCE(e.flightPhase, '') as flightPhase, COALESCE(e.parameterName, '') as parameterName, COALESCE(e.description, '') as description, COALESCE(e.eventStatus, '') as eventStatus, COALESCE(e.aircraftId, '') as aircraftId, COALESCE(e.flightId, '') as flightId, e.file, e.eventId, e.comment, e.exceedanceLevel, e.createdAt, e.updatedAt, e.assigneeId, e.dueDate, e.priority,
 			  el.id as eventlog_id, el.eventName, COALESCE(el.displayName, '') as displayName, COALESCE(el.eventCode, '') as eventCode, COALESCE(el.eventDescription, '') as eventDescription, COALESCE(el.eventParameter, '') as eventParameter, COALESCE(el.eventTrigger, '') as eventTrigger, COALESCE(el.eventType, '') as eventType, COALESCE(el.flightPhase, '') as eventlog_flightPhase, el.high, el.high1, el.high2, el.low, el.low1, el.low2, el.triggerType, el.detectionPeriod, el.severities, COALESCE(el.sop, '') as sop, COALESCE(el.aircraftId, '') as eventlog_aircraftId, el.createdAt as eventlog_createdAt, el.updatedAt as eventlog_updatedAt,
-			  c.id as csv_id, COALESCE(c.name, '') as name, COALESCE(c.file, '') as csv_file, c.status, c.departure, c.pilot, c.destination, c.flightHours, COALESCE(c.aircraftId, '') as csv_aircraftId, c.createdAt as csv_createdAt, c.updatedAt as csv_updatedAt,
+			  c.id as csv_id, COALESCE(c.name, '') as name, COALESCE(c.file, '') as csv_file, c.status, c.departure, c.destination, c.flightHours, COALESCE(c.aircraftId, '') as csv_aircraftId, c.createdAt as csv_createdAt, c.updatedAt as csv_updatedAt,
 			  a.id as aircraft_id, COALESCE(a.airline, '') as airline, COALESCE(a.aircraftMake, '') as aircraftMake, a.modelNumber, COALESCE(a.serialNumber, '') as serialNumber, COALESCE(a.companyId, '') as companyId, a.parameters, a.createdAt as aircraft_createdAt, a.updatedAt as aircraft_updatedAt,
 			  co.id as company_id, COALESCE(co.name, '') as company_name, COALESCE(co.email, '') as company_email, co.phone as company_phone, co.address as company_address, co.country as company_country, co.logo as company_logo, COALESCE(co.status, '') as company_status, co.subscriptionId as company_subscriptionId, co.createdAt as company_createdAt, co.updatedAt as company_updatedAt
 			  FROM Exceedance e 
@@ -188,6 +269,7 @@ func (h *ExceedanceHandler) GetExceedanceByID(c *gin.Context) {
 	var aircraftID sql.NullString
 	var aircraftCreatedAtStr, aircraftUpdatedAtStr sql.NullString
 	var exceedanceCreatedAtStr, exceedanceUpdatedAtStr sql.NullString
+	var dueDate sql.NullInt64
 	var companyID sql.NullString
 	var companyCreatedAtStr, companyUpdatedAtStr sql.NullString
 
@@ -196,11 +278,12 @@ func (h *ExceedanceHandler) GetExceedanceByID(c *gin.Context) {
 		&exceedance.ParameterName, &exceedance.Description, &exceedance.EventStatus,
 		&exceedance.AircraftID, &exceedance.FlightID, &exceedance.File, &exceedance.EventID,
 		&exceedance.Comment, &exceedance.ExceedanceLevel, &exceedanceCreatedAtStr, &exceedanceUpdatedAtStr,
+		&exceedance.AssigneeID, &dueDate, &exceedance.Priority,
 		&eventLogID, &eventLog.EventName, &eventLog.DisplayName, &eventLog.EventCode,
 		&eventLog.EventDescription, &eventLog.EventParameter, &eventLog.EventTrigger, &eventLog.EventType,
 		&eventLog.FlightPhase, &eventLog.High, &eventLog.High1, &eventLog.High2, &eventLog.Low,
 		&eventLog.Low1, &eventLog.Low2, &eventLog.TriggerType, &eventLog.DetectionPeriod, &eventLog.Severities, &eventLog.SOP, &eventLog.AircraftID, &eventLogCreatedAtStr, &eventLogUpdatedAtStr,
-		&csvID, &csv.Name, &csv.File, &csv.Status, &csv.Departure, &csv.Pilot,
+		&csvID, &csv.Name, &csv.File, &csv.Status, &csv.Departure,
 		&csv.Destination, &csv.FlightHours, &csv.AircraftID, &csvCreatedAtStr, &csvUpdatedAtStr,
 		&aircraftID, &aircraft.Airline, &aircraft.AircraftMake, &aircraft.ModelNumber,
 		&aircraft.SerialNumber, &aircraft.CompanyID, &aircraft.Parameters, &aircraftCreatedAtStr, &aircraftUpdatedAtStr,
@@ -229,6 +312,10 @@ func (h *ExceedanceHandler) GetExceedanceByID(c *gin.Context) {
 			exceedance.UpdatedAt = parsedTime
 		}
 	}
+	if dueDate.Valid {
+		due := time.UnixMilli(dueDate.Int64)
+		exceedance.DueDate = &due
+	}
 
 	// Handle nullable eventlog
 	var eventLogPtr *models.EventLog
@@ -318,6 +405,11 @@ func (h *ExceedanceHandler) GetExceedanceByID(c *gin.Context) {
 		CSV:        csv,
 		Aircraft:   aircraft,
 	}
+	if csv.ID != "" {
+		if response.CSV.Crew, err = loadFlightCrew(h.db, csv.ID); err != nil {
+			log.Printf("Error loading crew of flight %s: %v", csv.ID, err)
+		}
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -325,6 +417,9 @@ func (h *ExceedanceHandler) GetExceedanceByID(c *gin.Context) {
 // GetExceedancesByFlightID retrieves exceedances by flight ID
 func (h *ExceedanceHandler) GetExceedancesByFlightID(c *gin.Context) {
 	flightID := c.Param("id")
+	if !flightResource.authorize(c, h.db, flightID) {
+		return
+	}
 
 	query := `SELECT id, exceedanceValues, flightPhase, parameterName, description, eventStatus, aircraftId, flightId, file, eventId, comment, exceedanceLevel, createdAt, updatedAt FROM Exceedance WHERE flightId = ?`
 	rows, err := h.db.Query(query, flightID)
@@ -367,31 +462,115 @@ func (h *ExceedanceHandler) GetExceedancesByFlightID(c *gin.Context) {
 	c.JSON(http.StatusOK, exceedances)
 }
 
-// CreateExceedances creates multiple exceedances
+// CreateExceedances creates a batch of exceedances atomically. Every row is
+// validated before anything is written and all row errors are returned together.
+// Requests sent with an Idempotency-Key header replay the original response when retried.
 func (h *ExceedanceHandler) CreateExceedances(c *gin.Context) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	var exceedances []models.Exceedance
-	if err := c.ShouldBindJSON(&exceedances); err != nil {
+	if err := json.Unmarshal(body, &exceedances); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if len(exceedances) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No exceedances provided"})
+		return
+	}
 
-	var createdExceedances []models.Exceedance
 	now := time.Now()
+	userID := c.GetString("userId")
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	requestHash := hashRequest(body)
+	const endpoint = "POST /api/exceedances"
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if idempotencyKey != "" {
+		stored, err := lookupIdempotentResponse(tx, userID, endpoint, idempotencyKey, requestHash, now)
+		if err != nil {
+			writeIdempotencyError(c, err)
+			return
+		}
+		if stored != nil {
+			replayResponse(c, stored)
+			return
+		}
+	}
+
+	validator := newExceedanceBatchValidator(tx, c)
+	rowErrors := []models.RowError{}
+	for i := range exceedances {
+		errs, err := validator.validate(i, &exceedances[i])
+		if err != nil {
+			log.Println("Error validating exceedance batch:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		rowErrors = append(rowErrors, errs...)
+	}
+	if len(rowErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "errors": rowErrors})
+		return
+	}
+
+	for i := range exceedances {
+		exceedance := &exceedances[i]
+
+		// Priority defaults to the severity level
+		if exceedance.Priority == nil {
+			priority := models.PriorityForLevel(exceedance.ExceedanceLevel)
+			exceedance.Priority = &priority
+		}
+
+		// Events of critical severity are assigned round-robin to the company's
+		// analysts, whatever priority the caller set
+		if exceedance.AssigneeID == nil && models.PriorityForLevel(exceedance.ExceedanceLevel) == models.ExceedancePriorityCritical {
+			assignee, err := nextRoundRobinAssignee(tx, exceedance.AircraftID, now)
+			if err != nil {
+				log.Println("Error auto-assigning exceedance:", err)
+			} else if assignee != "" {
+				exceedance.AssigneeID = &assignee
+				if exceedance.DueDate == nil {
+					due := now.Add(criticalDueWindow)
+					exceedance.DueDate = &due
+				}
+			}
+		}
+		var dueDate *int64
+		if exceedance.DueDate != nil {
+			due := exceedance.DueDate.UnixMilli()
+			dueDate = &due
+		}
 
-	for _, exceedance := range exceedances {
 		// Generate ID
 		id := uuid.New().String()
 
-		query := `INSERT INTO Exceedance (id, exceedanceValues, flightPhase, parameterName, description, eventStatus, aircraftId, flightId, file, eventId, comment, exceedanceLevel, createdAt, updatedAt) 
-				  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		query := `INSERT INTO Exceedance (id, exceedanceValues, flightPhase, parameterName, description, eventStatus, aircraftId, flightId, file, eventId, comment, exceedanceLevel, assigneeId, dueDate, priority, createdAt, updatedAt) 
+				  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-		_, err := h.db.Exec(query, id, exceedance.ExceedanceValues, exceedance.FlightPhase,
+		_, err := tx.Exec(query, id, exceedance.ExceedanceValues, exceedance.FlightPhase,
 			exceedance.ParameterName, exceedance.Description, exceedance.EventStatus,
 			exceedance.AircraftID, exceedance.FlightID, exceedance.File, exceedance.EventID,
-			exceedance.Comment, exceedance.ExceedanceLevel, now.UnixMilli(), now.UnixMilli())
-
+			exceedance.Comment, exceedance.ExceedanceLevel, exceedance.AssigneeID, dueDate, exceedance.Priority,
+			now.UnixMilli(), now.UnixMilli())
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exceedance"})
+			log.Println("Error creating exceedance:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exceedance", "index": i})
+			return
+		}
+
+		if err := recordStatusTransition(tx, id, nil, exceedance.EventStatus, userID, nil, now); err != nil {
+			log.Println("Error recording initial exceedance status:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exceedance", "index": i})
 			return
 		}
 
@@ -399,14 +578,68 @@ func (h *ExceedanceHandler) CreateExceedances(c *gin.Context) {
 		exceedance.ID = id
 		exceedance.CreatedAt = now
 		exceedance.UpdatedAt = now
+	}
+
+	// Tell the companies' integrations
+	companies := map[string]string{}
+	for _, exceedance := range exceedances {
+		companyID, ok := companies[exceedance.AircraftID]
+		if !ok {
+			company, err := aircraftResource.companyID(tx, exceedance.AircraftID)
+			if err != nil {
+				log.Println("Error loading exceedance company:", err)
+			}
+			companyID = company.String
+			companies[exceedance.AircraftID] = companyID
+		}
+		if err := queueWebhooks(tx, companyID, models.WebhookEventExceedanceCreated, exceedanceWebhookData(exceedance), now); err != nil {
+			log.Println("Error queueing exceedance webhooks:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exceedance"})
+			return
+		}
+	}
 
-		createdExceedances = append(createdExceedances, exceedance)
+	// Notify the recipients of the company's notification rules
+	exceedanceIDs := make([]string, len(exceedances))
+	for i := range exceedances {
+		exceedanceIDs[i] = exceedances[i].ID
+	}
+	if _, err := notifyExceedances(tx, exceedanceIDs, now); err != nil {
+		log.Println("Error notifying exceedances:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exceedance"})
+		return
+	}
+
+	if idempotencyKey != "" {
+		if _, err := storeIdempotentResponse(tx, userID, endpoint, idempotencyKey, requestHash, http.StatusOK, exceedances, now); err != nil {
+			// A concurrent retry with the same key committed first; replay its result
+			tx.Rollback()
+			stored, lookupErr := lookupIdempotentResponse(h.db, userID, endpoint, idempotencyKey, requestHash, now)
+			if lookupErr != nil {
+				writeIdempotencyError(c, lookupErr)
+				return
+			}
+			if stored != nil {
+				replayResponse(c, stored)
+				return
+			}
+			log.Println("Error storing idempotency key:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exceedance"})
+			return
+		}
 	}
 
-	c.JSON(http.StatusOK, createdExceedances)
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating exceedance"})
+		return
+	}
+	wakeEmailWorker()
+	wakeWebhookWorker()
+
+	c.JSON(http.StatusOK, exceedances)
 }
 
-// UpdateExceedance updates an existing exceedance
+// UpdateExceedance moves an exceedance through the review workflow and updates its comment
 func (h *ExceedanceHandler) UpdateExceedance(c *gin.Context) {
 	id := c.Param("id")
 	var req models.UpdateExceedanceRequest
@@ -415,50 +648,105 @@ func (h *ExceedanceHandler) UpdateExceedance(c *gin.Context) {
 		return
 	}
 
+	status, ok := models.NormalizeExceedanceStatus(req.EventStatus)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event status", "allowed": models.ExceedanceStatuses})
+		return
+	}
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
 	now := time.Now()
 
-	query := `UPDATE Exceedance SET comment = ?, eventStatus = ?, updatedAt = ? WHERE id = ?`
-	result, err := h.db.Exec(query, req.Comment, req.EventStatus, now.UnixMilli(), id)
+	tx, err := h.db.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating exceedance"})
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Exceedance not found"})
+	err = changeExceedanceStatus(tx, id, status, c.GetString("userRole"), c.GetString("userId"), req.Comment, now)
+	if wfErr, ok := err.(*workflowError); ok {
+		c.JSON(wfErr.status, wfErr.body)
+		return
+	}
+	if err != nil {
+		log.Println("Error updating exceedance:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating exceedance"})
 		return
 	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating exceedance"})
+		return
+	}
+	wakeWebhookWorker()
+
 	// Return updated exceedance
 	h.GetExceedanceByID(c)
 }
 
-// DeleteExceedance deletes an exceedance
+// DeleteExceedance deletes an exceedance with its history, comments,
+// attachments and notifications
 func (h *ExceedanceHandler) DeleteExceedance(c *gin.Context) {
 	id := c.Param("id")
 
-	query := `DELETE FROM Exceedance WHERE id = ?`
-	result, err := h.db.Exec(query, id)
+	tx, err := h.db.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting exceedance"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
+	defer tx.Rollback()
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM Exceedance WHERE id = ?)", id).Scan(&exists); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Exceedance not found"})
 		return
 	}
+	keys, err := attachmentStorageKeys(tx, "id = ?", id)
+	if err != nil {
+		log.Println("Error loading exceedance attachments:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting exceedance"})
+		return
+	}
+	if err := deleteExceedanceChildRows(tx, "id = ?", id); err != nil {
+		log.Println("Error deleting exceedance children:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting exceedance"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM Exceedance WHERE id = ?", id); err != nil {
+		log.Println("Error deleting exceedance:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting exceedance"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting exceedance"})
+		return
+	}
+	// Attachment files are only removed once their rows are gone
+	removeStoredFiles(keys)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Exceedance deleted successfully"})
 }
 
-// GetGlobalBenchmarks returns aggregated benchmarking data across all clients
+// GetGlobalBenchmarks returns aggregated benchmarking data across all clients.
+// Callers other than admins and FDAs only see models and event types flown by
+// enough operators that no single competitor can be singled out.
 func (h *ExceedanceHandler) GetGlobalBenchmarks(c *gin.Context) {
 	// Optional filter by aircraft model
 	aircraftModel := c.Query("model")
 
+	minOperators := 1
+	if !tenantOf(c).all {
+		minOperators = config.GetBenchmarkMinGroupSize()
+	}
+
 	// Get total flights and exceedances grouped by aircraft model
 	var modelQuery string
 	var rows *sql.Rows
@@ -471,6 +759,7 @@ func (h *ExceedanceHandler) GetGlobalBenchmarks(c *gin.Context) {
 				a.modelNumber,
 				COUNT(DISTINCT csv.id) as totalFlights,
 				COUNT(e.id) as totalExceedances,
+				COUNT(DISTINCT CASE WHEN csv.id IS NOT NULL THEN a.companyId END) as operators,
 				SUM(CASE WHEN e.exceedanceLevel = 'None' THEN 1 ELSE 0 END) as severityNone,
 				SUM(CASE WHEN e.exceedanceLevel = 'Low' THEN 1 ELSE 0 END) as severityLow,
 				SUM(CASE WHEN e.exceedanceLevel = 'Medium' THEN 1 ELSE 0 END) as severityMedium,
@@ -489,6 +778,7 @@ func (h *ExceedanceHandler) GetGlobalBenchmarks(c *gin.Context) {
 				a.modelNumber,
 				COUNT(DISTINCT csv.id) as totalFlights,
 				COUNT(e.id) as totalExceedances,
+				COUNT(DISTINCT CASE WHEN csv.id IS NOT NULL THEN a.companyId END) as operators,
 				SUM(CASE WHEN e.exceedanceLevel = 'None' THEN 1 ELSE 0 END) as severityNone,
 				SUM(CASE WHEN e.exceedanceLevel = 'Low' THEN 1 ELSE 0 END) as severityLow,
 				SUM(CASE WHEN e.exceedanceLevel = 'Medium' THEN 1 ELSE 0 END) as severityMedium,
@@ -527,11 +817,15 @@ func (h *ExceedanceHandler) GetGlobalBenchmarks(c *gin.Context) {
 	for rows.Next() {
 		var stats ModelStats
 		var modelNumber sql.NullString
-		err := rows.Scan(&stats.AircraftMake, &modelNumber, &stats.TotalFlights, &stats.TotalExceedances,
+		var operators int
+		err := rows.Scan(&stats.AircraftMake, &modelNumber, &stats.TotalFlights, &stats.TotalExceedances, &operators,
 			&stats.SeverityNone, &stats.SeverityLow, &stats.SeverityMedium, &stats.SeverityHigh, &stats.SeverityCritical)
 		if err != nil {
 			continue
 		}
+		if operators < minOperators {
+			continue
+		}
 
 		if modelNumber.Valid {
 			stats.ModelNumber = modelNumber.String
@@ -595,11 +889,13 @@ func (h *ExceedanceHandler) GetGlobalBenchmarks(c *gin.Context) {
 			COUNT(*) as count
 		FROM Exceedance e
 		LEFT JOIN EventLog el ON e.eventId = el.id
+		LEFT JOIN Aircraft a ON e.aircraftId = a.id
 		GROUP BY eventName
+		HAVING COUNT(DISTINCT a.companyId) >= ?
 		ORDER BY count DESC
 		LIMIT 20`
 
-	eventRows, err := h.db.Query(eventTypeQuery)
+	eventRows, err := h.db.Query(eventTypeQuery, minOperators)
 	if err == nil {
 		defer eventRows.Close()
 	}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"fdm-backend/models"
+	"fdm-backend/reports"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Exports stream a list view as one flat table in CSV, XLSX or JSON. They take
+// the same filters and sort as the list endpoints but return every matching row
+// rather than a page; the joined event, flight, aircraft and company fields
+// become columns of their own.
+//
+//	GET /api/export/exceedances?format=xlsx&aircraft=<id>&from=2025-01-01&severity=high
+
+// exportFlushRows is how often the response is flushed while streaming
+const exportFlushRows = 500
+
+type ExportHandler struct {
+	db *sql.DB
+}
+
+func NewExportHandler(db *sql.DB) *ExportHandler {
+	return &ExportHandler{db: db}
+}
+
+// Kinds of export column
+const (
+	exportText = iota
+	exportNumber
+	exportTime // Unix milliseconds, written as RFC3339 UTC
+)
+
+type exportColumn struct {
+	name string
+	expr string
+	kind int
+}
+
+// exportSpec describes one exportable list
+type exportSpec struct {
+	name    string // file and worksheet name
+	list    *listSpec
+	from    string
+	columns []exportColumn
+}
+
+func textColumn(name, expr string) exportColumn { return exportColumn{name, expr, exportText} }
+
+func numberColumn(name, expr string) exportColumn { return exportColumn{name, expr, exportNumber} }
+
+func timeColumn(name, column string) exportColumn {
+	return exportColumn{name, sqlEpochMillis(column), exportTime}
+}
+
+// crewCodeColumn selects the crew code of a flight seat; identities are never exported
+func crewCodeColumn(name, flightColumn, role string) exportColumn {
+	return textColumn(name, fmt.Sprintf(`(SELECT m.code FROM FlightCrew fc JOIN CrewMember m ON m.id = fc.crewMemberId
+			  WHERE fc.flightId = %s AND fc.role = '%s')`, flightColumn, role))
+}
+
+var exceedanceExport = &exportSpec{
+	name: "exceedances",
+	list: exceedanceListSpec,
+	from: ` FROM Exceedance e
+			  LEFT JOIN EventLog el ON e.eventId = el.id
+			  LEFT JOIN Csv c ON e.flightId = c.id
+			  LEFT JOIN Aircraft a ON e.aircraftId = a.id
+			  LEFT JOIN Company co ON a.companyId = co.id`,
+	columns: []exportColumn{
+		textColumn("id", "e.id"),
+		timeColumn("createdAt", "e.createdAt"),
+		timeColumn("updatedAt", "e.updatedAt"),
+		textColumn("status", "e.eventStatus"),
+		textColumn("severity", "e.exceedanceLevel"),
+		textColumn("priority", "e.priority"),
+		textColumn("assigneeId", "e.assigneeId"),
+		timeColumn("dueDate", "e.dueDate"),
+		textColumn("flightPhase", "e.flightPhase"),
+		textColumn("parameterName", "e.parameterName"),
+		textColumn("description", "e.description"),
+		textColumn("exceedanceValues", "e.exceedanceValues"),
+		textColumn("comment", "e.comment"),
+		textColumn("eventId", "e.eventId"),
+		textColumn("eventCode", "el.eventCode"),
+		textColumn("eventName", "el.eventName"),
+		textColumn("eventDisplayName", "el.displayName"),
+		textColumn("eventType", "el.eventType"),
+		textColumn("eventParameter", "el.eventParameter"),
+		textColumn("eventTriggerType", "el.triggerType"),
+		textColumn("flightId", "e.flightId"),
+		textColumn("flightName", "c.name"),
+		timeColumn("flightCreatedAt", "c.createdAt"),
+		textColumn("departure", "c.departure"),
+		textColumn("destination", "c.destination"),
+		textColumn("flightHours", "c.flightHours"),
+		textColumn("aircraftId", "e.aircraftId"),
+		textColumn("registration", "a.registration"),
+		textColumn("airline", "a.airline"),
+		textColumn("aircraftMake", "a.aircraftMake"),
+		textColumn("modelNumber", "a.modelNumber"),
+		textColumn("serialNumber", "a.serialNumber"),
+		textColumn("companyId", "a.companyId"),
+		textColumn("companyName", "co.name"),
+	},
+}
+
+var flightExport = &exportSpec{
+	name: "flights",
+	list: csvListSpec,
+	from: ` FROM Csv c
+			  LEFT JOIN Aircraft a ON c.aircraftId = a.id
+			  LEFT JOIN Company co ON a.companyId = co.id`,
+	columns: []exportColumn{
+		textColumn("id", "c.id"),
+		textColumn("name", "c.name"),
+		textColumn("file", "c.file"),
+		textColumn("status", "c.status"),
+		timeColumn("createdAt", "c.createdAt"),
+		timeColumn("updatedAt", "c.updatedAt"),
+		textColumn("departure", "c.departure"),
+		textColumn("destination", "c.destination"),
+		textColumn("flightHours", "c.flightHours"),
+		crewCodeColumn("captainCode", "c.id", models.CrewRoleCaptain),
+		crewCodeColumn("firstOfficerCode", "c.id", models.CrewRoleFirstOfficer),
+		numberColumn("exceedances", "(SELECT COUNT(*) FROM Exceedance x WHERE x.flightId = c.id)"),
+		textColumn("aircraftId", "c.aircraftId"),
+		textColumn("registration", "a.registration"),
+		textColumn("airline", "a.airline"),
+		textColumn("aircraftMake", "a.aircraftMake"),
+		textColumn("modelNumber", "a.modelNumber"),
+		textColumn("serialNumber", "a.serialNumber"),
+		textColumn("companyId", "a.companyId"),
+		textColumn("companyName", "co.name"),
+	},
+}
+
+var eventExport = &exportSpec{
+	name: "events",
+	list: eventListSpec,
+	from: ` FROM EventLog e
+			  LEFT JOIN Aircraft a ON e.aircraftId = a.id
+			  LEFT JOIN Company c ON a.companyId = c.id`,
+	columns: []exportColumn{
+		textColumn("id", "e.id"),
+		textColumn("eventCode", "e.eventCode"),
+		textColumn("eventName", "e.eventName"),
+		textColumn("displayName", "e.displayName"),
+		textColumn("eventDescription", "e.eventDescription"),
+		textColumn("eventParameter", "e.eventParameter"),
+		textColumn("eventTrigger", "e.eventTrigger"),
+		textColumn("eventType", "e.eventType"),
+		textColumn("flightPhase", "e.flightPhase"),
+		textColumn("triggerType", "e.triggerType"),
+		textColumn("high", "e.high"),
+		textColumn("high1", "e.high1"),
+		textColumn("high2", "e.high2"),
+		textColumn("low", "e.low"),
+		textColumn("low1", "e.low1"),
+		textColumn("low2", "e.low2"),
+		textColumn("detectionPeriod", "e.detectionPeriod"),
+		textColumn("severities", "e.severities"),
+		textColumn("sop", "e.sop"),
+		timeColumn("createdAt", "e.createdAt"),
+		timeColumn("updatedAt", "e.updatedAt"),
+		textColumn("aircraftId", "e.aircraftId"),
+		textColumn("registration", "a.registration"),
+		textColumn("airline", "a.airline"),
+		textColumn("aircraftMake", "a.aircraftMake"),
+		textColumn("modelNumber", "a.modelNumber"),
+		textColumn("companyId", "a.companyId"),
+		textColumn("companyName", "c.name"),
+	},
+}
+
+// ExportExceedances streams the filtered exceedance list
+func (h *ExportHandler) ExportExceedances(c *gin.Context) {
+	h.export(c, exceedanceExport)
+}
+
+// ExportFlights streams the filtered flight list
+func (h *ExportHandler) ExportFlights(c *gin.Context) {
+	h.export(c, flightExport)
+}
+
+// ExportEvents streams the filtered event list
+func (h *ExportHandler) ExportEvents(c *gin.Context) {
+	h.export(c, eventExport)
+}
+
+func (h *ExportHandler) export(c *gin.Context, spec *exportSpec) {
+	format := strings.ToLower(c.DefaultQuery("format", reports.FormatCSV))
+	if !reports.IsTableFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, xlsx or json"})
+		return
+	}
+	list, err := parseListQuery(c, spec.list)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tenantOf(c).restrict(list, "a.companyId")
+
+	total, err := list.count(h.db, spec.from)
+	if err != nil {
+		log.Printf("Error counting %s export: %v", spec.name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if format == reports.FormatXLSX && total > reports.MaxXLSXRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%d rows exceed the XLSX limit of %d, narrow the filters or export CSV", total, reports.MaxXLSXRows)})
+		return
+	}
+
+	names := make([]string, len(spec.columns))
+	exprs := make([]string, len(spec.columns))
+	for i, column := range spec.columns {
+		names[i] = column.name
+		exprs[i] = column.expr
+	}
+	clause, args := list.orderClause()
+	rows, err := h.db.Query("SELECT "+strings.Join(exprs, ", ")+spec.from+clause, args...)
+	if err != nil {
+		log.Printf("Error querying %s export: %v", spec.name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("%s-%s.%s", spec.name, time.Now().UTC().Format("2006-01-02"), format)
+	c.Header("Content-Type", reports.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	c.Status(http.StatusOK)
+
+	// From here on the status is sent; failures can only cut the stream short
+	table, err := reports.NewTableWriter(c.Writer, format, spec.name, names)
+	if err != nil {
+		log.Printf("Error starting %s export: %v", spec.name, err)
+		return
+	}
+	values := make([]interface{}, len(spec.columns))
+	pointers := make([]interface{}, len(spec.columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	written := 0
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			log.Printf("Error scanning %s export: %v", spec.name, err)
+			return
+		}
+		cells := make([]interface{}, len(values))
+		for i, value := range values {
+			cells[i] = exportCell(spec.columns[i].kind, value)
+		}
+		if err := table.WriteRow(cells); err != nil {
+			log.Printf("Error writing %s export: %v", spec.name, err)
+			return
+		}
+		if written++; written%exportFlushRows == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error reading %s export: %v", spec.name, err)
+		return
+	}
+	if err := table.Close(); err != nil {
+		log.Printf("Error finishing %s export: %v", spec.name, err)
+	}
+}
+
+// exportCell converts a scanned value to a table cell. NULL stays empty.
+func exportCell(kind int, value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	switch kind {
+	case exportTime:
+		if ms, ok := value.(int64); ok {
+			return time.UnixMilli(ms).UTC().Format(time.RFC3339)
+		}
+		return nil
+	case exportNumber:
+		switch v := value.(type) {
+		case int64, float64:
+			return v
+		}
+		return nil
+	}
+	if value == nil {
+		return nil
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
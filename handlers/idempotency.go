@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyTTL is how long a stored response is replayed for a repeated Idempotency-Key
+const idempotencyTTL = 24 * time.Hour
+
+// errIdempotencyKeyReused is returned when a key is sent again with a different request body
+var errIdempotencyKeyReused = errors.New("Idempotency-Key was already used with a different request")
+
+// storedResponse is a response recorded for an idempotency key
+type storedResponse struct {
+	status int
+	body   []byte
+}
+
+// hashRequest fingerprints a request body so reused keys can be detected
+func hashRequest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupIdempotentResponse returns the response stored for a key, or nil if the
+// key has not been used (or has expired)
+func lookupIdempotentResponse(exec dbExecutor, userID, endpoint, key, requestHash string, now time.Time) (*storedResponse, error) {
+	_, err := exec.Exec("DELETE FROM IdempotencyKey WHERE createdAt < ?", now.Add(-idempotencyTTL).UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+
+	var storedHash, body string
+	var status int
+	err = exec.QueryRow("SELECT requestHash, statusCode, response FROM IdempotencyKey WHERE userId = ? AND endpoint = ? AND key = ?",
+		userID, endpoint, key).Scan(&storedHash, &status, &body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if storedHash != requestHash {
+		return nil, errIdempotencyKeyReused
+	}
+	return &storedResponse{status: status, body: []byte(body)}, nil
+}
+
+// storeIdempotentResponse records the response for a key. It fails with a
+// constraint error if a concurrent request stored the same key first.
+func storeIdempotentResponse(exec dbExecutor, userID, endpoint, key, requestHash string, status int, response interface{}, now time.Time) ([]byte, error) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	_, err = exec.Exec(`INSERT INTO IdempotencyKey (key, userId, endpoint, requestHash, statusCode, response, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, key, userID, endpoint, requestHash, status, string(body), now.UnixMilli())
+	return body, err
+}
+
+// replayResponse writes a stored response, marking it as a replay
+func replayResponse(c *gin.Context, resp *storedResponse) {
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(resp.status, "application/json; charset=utf-8", resp.body)
+}
+
+// writeIdempotencyError reports a failed idempotency lookup
+func writeIdempotencyError(c *gin.Context, err error) {
+	if err == errIdempotencyKeyReused {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// List endpoints share one query layer: cursor pagination, filters and sorting
+// parsed from query parameters. Responses stay plain JSON arrays; the total number
+// of matching rows and the cursor of the next page are returned in the
+// X-Total-Count and X-Next-Cursor headers.
+//
+//	?limit=50&sort=-createdAt&aircraft=<id>&from=2025-01-01&to=2025-01-31&cursor=<X-Next-Cursor>
+const (
+	defaultListLimit = 100
+	maxListLimit     = 500
+)
+
+// listFilter turns a query parameter value into a SQL condition
+type listFilter func(value string) (string, []interface{}, error)
+
+// listSpec describes how an endpoint can be filtered and sorted
+type listSpec struct {
+	idColumn    string                // unique column used to break sort ties
+	sorts       map[string]string     // sort key -> SQL expression (must not be NULL)
+	defaultSort string                // sort key, prefixed with "-" for descending
+	filters     map[string]listFilter // query parameter -> filter
+}
+
+// listCursor marks the last row of a page
+type listCursor struct {
+	Sort  string      `json:"s"`
+	Value interface{} `json:"v"`
+	ID    string      `json:"id"`
+}
+
+// listQuery holds the parsed list parameters for one request
+type listQuery struct {
+	spec     *listSpec
+	sortKey  string
+	sortExpr string
+	desc     bool
+	limit    int
+	cursor   *listCursor
+
+	conditions []string
+	args       []interface{}
+
+	rows int
+	last *listCursor
+	more bool
+}
+
+// parseListQuery reads limit, cursor, sort and filter parameters for spec
+func parseListQuery(c *gin.Context, spec *listSpec) (*listQuery, error) {
+	q := &listQuery{spec: spec, limit: defaultListLimit}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, errors.New("limit must be a positive integer")
+		}
+		if limit > maxListLimit {
+			limit = maxListLimit
+		}
+		q.limit = limit
+	}
+
+	sortParam := c.DefaultQuery("sort", spec.defaultSort)
+	q.desc = strings.HasPrefix(sortParam, "-")
+	q.sortKey = strings.TrimPrefix(sortParam, "-")
+	expr, ok := spec.sorts[q.sortKey]
+	if !ok {
+		keys := make([]string, 0, len(spec.sorts))
+		for k := range spec.sorts {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("invalid sort %q, allowed: %s (prefix with - for descending)", q.sortKey, strings.Join(keys, ", "))
+	}
+	q.sortExpr = expr
+
+	for param, filter := range spec.filters {
+		value := strings.TrimSpace(c.Query(param))
+		if value == "" {
+			continue
+		}
+		condition, args, err := filter(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", param, err)
+		}
+		q.where(condition, args...)
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := decodeCursor(v)
+		if err != nil || cursor.Sort != sortParam {
+			return nil, errors.New("invalid cursor")
+		}
+		q.cursor = cursor
+	}
+
+	return q, nil
+}
+
+// where adds a condition applied to both the page and the total count
+func (q *listQuery) where(condition string, args ...interface{}) {
+	q.conditions = append(q.conditions, condition)
+	q.args = append(q.args, args...)
+}
+
+// filterClause returns the WHERE clause for the filters only, for counting
+func (q *listQuery) filterClause() (string, []interface{}) {
+	if len(q.conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND "), q.args
+}
+
+// pageClause returns the WHERE, ORDER BY and LIMIT clauses for the requested page.
+// One row more than the limit is fetched to detect whether another page exists.
+func (q *listQuery) pageClause() (string, []interface{}) {
+	conditions := append([]string{}, q.conditions...)
+	args := append([]interface{}{}, q.args...)
+
+	if q.cursor != nil {
+		op := ">"
+		if q.desc {
+			op = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND %s %s ?))", q.sortExpr, op, q.sortExpr, q.spec.idColumn, op))
+		args = append(args, q.cursor.Value, q.cursor.Value, q.cursor.ID)
+	}
+
+	clause := ""
+	if len(conditions) > 0 {
+		clause = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	direction := "ASC"
+	if q.desc {
+		direction = "DESC"
+	}
+	clause += fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %d", q.sortExpr, direction, q.spec.idColumn, direction, q.limit+1)
+	return clause, args
+}
+
+// orderClause returns the WHERE and ORDER BY clauses for every matching row,
+// ignoring the limit and cursor. Exports use it to stream the whole list.
+func (q *listQuery) orderClause() (string, []interface{}) {
+	clause, args := q.filterClause()
+	direction := "ASC"
+	if q.desc {
+		direction = "DESC"
+	}
+	clause += fmt.Sprintf(" ORDER BY %s %s, %s %s", q.sortExpr, direction, q.spec.idColumn, direction)
+	return clause, args
+}
+
+// sortColumn is selected as the last column of every page query so the cursor
+// can be built from the last row
+func (q *listQuery) sortColumn() string {
+	return q.sortExpr
+}
+
+// accept records a fetched row and reports whether it belongs to the page. It
+// returns false for the extra row fetched beyond the limit.
+func (q *listQuery) accept(id string, sortValue interface{}) bool {
+	if q.rows >= q.limit {
+		q.more = true
+		return false
+	}
+	q.rows++
+	if b, ok := sortValue.([]byte); ok {
+		sortValue = string(b)
+	}
+	sortParam := q.sortKey
+	if q.desc {
+		sortParam = "-" + sortParam
+	}
+	q.last = &listCursor{Sort: sortParam, Value: sortValue, ID: id}
+	return true
+}
+
+// count returns the number of rows matching the filters
+func (q *listQuery) count(exec dbExecutor, from string) (int, error) {
+	clause, args := q.filterClause()
+	var total int
+	err := exec.QueryRow("SELECT COUNT(*) "+from+clause, args...).Scan(&total)
+	return total, err
+}
+
+// writeHeaders sets the pagination headers for the page that was read
+func (q *listQuery) writeHeaders(c *gin.Context, total int) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if q.more && q.last != nil {
+		c.Header("X-Next-Cursor", encodeCursor(q.last))
+	}
+}
+
+func encodeCursor(cursor *listCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var cursor listCursor
+	if err := decoder.Decode(&cursor); err != nil {
+		return nil, err
+	}
+	if n, ok := cursor.Value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			cursor.Value = i
+		} else if f, err := n.Float64(); err == nil {
+			cursor.Value = f
+		}
+	}
+	return &cursor, nil
+}
+
+// sqlEpochMillis returns a SQL expression converting a timestamp column to Unix
+// milliseconds. Columns hold either integer milliseconds or Go time strings such
+// as "2025-11-26 09:44:59.3847265 +0300 EAT".
+func sqlEpochMillis(column string) string {
+	offset := fmt.Sprintf("substr(substr(%[1]s, 20), instr(substr(%[1]s, 20), ' ') + 1, 5)", column)
+	return fmt.Sprintf(`(CASE WHEN typeof(%[1]s) = 'integer' THEN %[1]s ELSE CAST(round(
+		(julianday(substr(%[1]s, 1, 19)) - 2440587.5) * 86400000
+		+ CAST(('0' || substr(%[1]s, 20, instr(substr(%[1]s, 20) || ' ', ' ') - 1)) AS REAL) * 1000
+		- (CASE substr(%[2]s, 1, 1) WHEN '-' THEN -1 ELSE 1 END)
+		  * (CAST(substr(%[2]s, 2, 2) AS INTEGER) * 60 + CAST(substr(%[2]s, 4, 2) AS INTEGER)) * 60000
+	) AS INTEGER) END)`, column, offset)
+}
+
+// eqFilter matches a column against one or more comma separated values
+func eqFilter(column string) listFilter {
+	return func(value string) (string, []interface{}, error) {
+		values := splitList(value)
+		if len(values) == 0 {
+			return "", nil, errors.New("no values given")
+		}
+		args := make([]interface{}, len(values))
+		for i, v := range values {
+			args[i] = v
+		}
+		return column + " IN (" + placeholders(len(values)) + ")", args, nil
+	}
+}
+
+// lowerFilter matches a column case-insensitively against comma separated values
+func lowerFilter(column string) listFilter {
+	return func(value string) (string, []interface{}, error) {
+		values := splitList(strings.ToLower(value))
+		if len(values) == 0 {
+			return "", nil, errors.New("no values given")
+		}
+		args := make([]interface{}, len(values))
+		for i, v := range values {
+			args[i] = v
+		}
+		return "lower(" + column + ") IN (" + placeholders(len(values)) + ")", args, nil
+	}
+}
+
+// containsFilter matches columns holding comma separated lists, such as the flight
+// phases an exceedance spans
+func containsFilter(column string) listFilter {
+	return func(value string) (string, []interface{}, error) {
+		return "instr(upper(" + column + "), upper(?)) > 0", []interface{}{value}, nil
+	}
+}
+
+// boolFilter matches a boolean column against true/false
+func boolFilter(column string) listFilter {
+	return func(value string) (string, []interface{}, error) {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", nil, err
+		}
+		return column + " = ?", []interface{}{b}, nil
+	}
+}
+
+// dateFilter compares a timestamp column against a date (2006-01-02) or RFC3339
+// time. Upper bounds given as a date include the whole day.
+func dateFilter(column string, upper bool) listFilter {
+	return func(value string) (string, []interface{}, error) {
+		t, err := parseDateParam(value, upper)
+		if err != nil {
+			return "", nil, err
+		}
+		op := ">="
+		if upper {
+			op = "<="
+		}
+		return sqlEpochMillis(column) + " " + op + " ?", []interface{}{t.UnixMilli()}, nil
+	}
+}
+
+// parseDateParam reads a date (2006-01-02) or RFC3339 time. Upper bounds given
+// as a date resolve to the last millisecond of that day.
+func parseDateParam(value string, upper bool) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, errors.New("expected YYYY-MM-DD or RFC3339 time")
+	}
+	if upper {
+		t = t.Add(24*time.Hour - time.Millisecond)
+	}
+	return t, nil
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
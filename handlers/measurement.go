@@ -0,0 +1,714 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fdm-backend/models"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Flight measurements are computed from the uploaded flight data file when a
+// flight is ingested and stored in FlightMeasurement. Recorders name parameters
+// differently, so each measurement lists the column names it accepts; flights
+// missing a required column simply have no value for that measurement.
+
+const (
+	defaultHistogramBins   = 20
+	maxHistogramBins       = 100
+	maxMeasurementOutliers = 50
+)
+
+// flightColumns lists accepted column names per parameter, compared after
+// upper-casing and collapsing whitespace
+var flightColumns = map[string][]string{
+	"phase":    {"PHASE", "FLIGHT PHASE"},
+	"time":     {"TIME(SEC)", "TIME (SEC)", "TIME SEC"},
+	"accel":    {"ACCN NORM", "VERTICAL ACCELERATION", "NORMAL ACCELERATION", "NORMAL ACCEL", "VRTG"},
+	"airspeed": {"AIRSPEED_AVG", "COMPUTED AIRSPEED", "INDICATED AIRSPEED", "AIRSPEED", "AIRSPEED L", "IAS", "CAS"},
+	"agl":      {"ALTITUDE_AGL", "RADIO ALTITUDE", "RADIO HEIGHT", "RADIO ALT", "RAD ALT"},
+	"pitch":    {"PITCH ATTITUDE", "PITCH ANGLE", "PITCH"},
+	"roll":     {"ROLL ATTITUDE", "ROLL ANGLE", "BANK ANGLE", "ROLL"},
+}
+
+// groundPhases are flight phases spent on the ground. TAKEOFF is neither ground
+// nor airborne: it covers the takeoff roll and the rotation.
+var groundPhases = map[string]bool{
+	"GROUND": true, "TAXI": true, "TAXI-OUT": true, "TAXI_OUT": true, "TAXI-IN": true, "TAXI_IN": true,
+	"ROLLOUT": true, "LANDING_ROLL": true, "PARKED": true,
+}
+
+// measurement computes one value from a flight record, reporting false when
+// the flight lacks the data
+type measurement struct {
+	models.MeasurementDefinition
+	compute func(f *flightRecord) (float64, bool)
+}
+
+var measurements = []measurement{
+	{models.MeasurementDefinition{
+		Code:        "touchdown_g",
+		Name:        "Touchdown vertical acceleration",
+		Unit:        "g",
+		Description: "Peak normal acceleration from 2 s before to 4 s after touchdown",
+	}, touchdownG},
+	{models.MeasurementDefinition{
+		Code:        "approach_speed_deviation",
+		Name:        "Approach speed deviation",
+		Unit:        "kt",
+		Description: "Largest deviation from the median airspeed between 1000 ft and 50 ft AGL on final approach",
+	}, approachSpeedDeviation},
+	{models.MeasurementDefinition{
+		Code:        "rotation_rate",
+		Name:        "Rotation rate",
+		Unit:        "deg/s",
+		Description: "Peak pitch rate from the start of the takeoff roll until 5 s after liftoff",
+	}, rotationRate},
+	{models.MeasurementDefinition{
+		Code:        "max_bank_below_1000ft",
+		Name:        "Max bank below 1000 ft",
+		Unit:        "deg",
+		Description: "Largest bank angle while airborne below 1000 ft AGL",
+	}, maxBankBelow1000ft},
+}
+
+func findMeasurement(code string) (measurement, bool) {
+	for _, m := range measurements {
+		if m.Code == code {
+			return m, true
+		}
+	}
+	return measurement{}, false
+}
+
+// flightRecord holds the parameters of a flight needed by the measurements.
+// Missing samples are NaN.
+type flightRecord struct {
+	samples int
+	phase   []string
+	series  map[string][]float64
+}
+
+// readFlightRecord parses a flight data CSV. Samples are assumed to be one
+// second apart unless the file has a time column.
+func readFlightRecord(r io.Reader) (*flightRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.Join(strings.Fields(strings.ToUpper(name)), " ")] = i
+	}
+	columns := map[string]int{}
+	for param, names := range flightColumns {
+		for _, name := range names {
+			if i, ok := index[name]; ok {
+				columns[param] = i
+				break
+			}
+		}
+	}
+
+	f := &flightRecord{series: map[string][]float64{}}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for param, i := range columns {
+			value := ""
+			if i < len(record) {
+				value = strings.TrimSpace(record[i])
+			}
+			if param == "phase" {
+				f.phase = append(f.phase, strings.ToUpper(value))
+				continue
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				v = math.NaN()
+			}
+			f.series[param] = append(f.series[param], v)
+		}
+		f.samples++
+	}
+
+	if _, ok := f.series["time"]; !ok {
+		t := make([]float64, f.samples)
+		for i := range t {
+			t[i] = float64(i)
+		}
+		f.series["time"] = t
+	}
+	return f, nil
+}
+
+func (f *flightRecord) has(params ...string) bool {
+	for _, p := range params {
+		if _, ok := f.series[p]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// airborne reports whether sample i is in flight, from the phase column or,
+// without one, from the height above ground
+func (f *flightRecord) airborne(i int) bool {
+	if f.phase != nil {
+		phase := f.phase[i]
+		return phase != "" && phase != "TAKEOFF" && !groundPhases[phase]
+	}
+	if agl, ok := f.series["agl"]; ok {
+		return agl[i] > 10
+	}
+	return false
+}
+
+func (f *flightRecord) canLocatePhases() bool {
+	return f.phase != nil || f.has("agl")
+}
+
+// touchdown returns the first sample on the ground after the last airborne one
+func (f *flightRecord) touchdown() int {
+	if !f.canLocatePhases() {
+		return -1
+	}
+	for i := f.samples - 1; i > 0; i-- {
+		if f.airborne(i - 1) {
+			if f.airborne(i) {
+				return -1 // the recording ends in flight
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// liftoff returns the first airborne sample
+func (f *flightRecord) liftoff() int {
+	if !f.canLocatePhases() {
+		return -1
+	}
+	for i := 0; i < f.samples; i++ {
+		if f.airborne(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// window returns the samples within seconds of sample i
+func (f *flightRecord) window(i int, before, after float64) (int, int) {
+	t := f.series["time"]
+	from, to := i, i
+	for from > 0 && (math.IsNaN(t[from-1]) || t[i]-t[from-1] <= before) {
+		from--
+	}
+	for to < f.samples-1 && (math.IsNaN(t[to+1]) || t[to+1]-t[i] <= after) {
+		to++
+	}
+	return from, to
+}
+
+func touchdownG(f *flightRecord) (float64, bool) {
+	td := f.touchdown()
+	if td < 0 || !f.has("accel") {
+		return 0, false
+	}
+	from, to := f.window(td, 2, 4)
+	return maxOf(f.series["accel"][from:to+1], func(v float64) float64 { return v })
+}
+
+func approachSpeedDeviation(f *flightRecord) (float64, bool) {
+	td := f.touchdown()
+	if td < 0 || !f.has("agl", "airspeed") {
+		return 0, false
+	}
+	agl, airspeed := f.series["agl"], f.series["airspeed"]
+
+	// Final approach runs from the last time above 1000 ft to touchdown
+	start := td
+	for start > 0 && !(agl[start-1] >= 1000) {
+		start--
+	}
+	var speeds []float64
+	for i := start; i < td; i++ {
+		if agl[i] >= 50 && agl[i] <= 1000 && !math.IsNaN(airspeed[i]) && f.airborne(i) {
+			speeds = append(speeds, airspeed[i])
+		}
+	}
+	if len(speeds) == 0 {
+		return 0, false
+	}
+	sorted := append([]float64{}, speeds...)
+	sort.Float64s(sorted)
+	median := getPercentile(sorted, 50)
+	return maxOf(speeds, func(v float64) float64 { return math.Abs(v - median) })
+}
+
+func rotationRate(f *flightRecord) (float64, bool) {
+	liftoff := f.liftoff()
+	if liftoff < 0 || !f.has("pitch") {
+		return 0, false
+	}
+	start := liftoff
+	if f.phase != nil {
+		for start > 0 && f.phase[start-1] == "TAKEOFF" {
+			start--
+		}
+	} else {
+		start, _ = f.window(liftoff, 30, 0)
+	}
+	_, end := f.window(liftoff, 0, 5)
+
+	pitch, t := f.series["pitch"], f.series["time"]
+	best, found := 0.0, false
+	last := -1
+	for i := start; i <= end; i++ {
+		if math.IsNaN(pitch[i]) || math.IsNaN(t[i]) {
+			continue
+		}
+		if last >= 0 && t[i] > t[last] {
+			if rate := (pitch[i] - pitch[last]) / (t[i] - t[last]); !found || rate > best {
+				best, found = rate, true
+			}
+		}
+		last = i
+	}
+	return best, found
+}
+
+func maxBankBelow1000ft(f *flightRecord) (float64, bool) {
+	if !f.has("agl", "roll") {
+		return 0, false
+	}
+	agl, roll := f.series["agl"], f.series["roll"]
+	var banks []float64
+	for i := 0; i < f.samples; i++ {
+		if f.airborne(i) && agl[i] < 1000 {
+			banks = append(banks, roll[i])
+		}
+	}
+	return maxOf(banks, math.Abs)
+}
+
+// maxOf returns the largest transformed value, skipping missing samples
+func maxOf(values []float64, transform func(float64) float64) (float64, bool) {
+	best, found := 0.0, false
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		if v = transform(v); !found || v > best {
+			best, found = v, true
+		}
+	}
+	return best, found
+}
+
+// storeFlightMeasurements computes every measurement for a flight from its data
+// file and replaces the stored values in one transaction
+func storeFlightMeasurements(db *sql.DB, flightID, aircraftID, path string, now time.Time) ([]models.FlightMeasurement, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	record, err := readFlightRecord(file)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM FlightMeasurement WHERE flightId = ?", flightID); err != nil {
+		return nil, err
+	}
+	values := []models.FlightMeasurement{}
+	for _, m := range measurements {
+		value, ok := m.compute(record)
+		if !ok {
+			continue
+		}
+		value = math.Round(value*1000) / 1000
+		_, err := tx.Exec(`INSERT INTO FlightMeasurement (flightId, aircraftId, code, value, computedAt)
+			VALUES (?, ?, ?, ?, ?)`, flightID, aircraftID, m.Code, value, now.UnixMilli())
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, models.FlightMeasurement{
+			FlightID:   flightID,
+			AircraftID: aircraftID,
+			Code:       m.Code,
+			Name:       m.Name,
+			Unit:       m.Unit,
+			Value:      value,
+			ComputedAt: now,
+		})
+	}
+	return values, tx.Commit()
+}
+
+// flightFilePath returns where an uploaded flight file is stored
+func flightFilePath(file string) string {
+	return filepath.Join(flightFileDir, filepath.Base(file))
+}
+
+// GetMeasurementDefinitions lists the measurements computed for every flight
+func (h *AnalyticsHandler) GetMeasurementDefinitions(c *gin.Context) {
+	definitions := make([]models.MeasurementDefinition, len(measurements))
+	for i, m := range measurements {
+		definitions[i] = m.MeasurementDefinition
+	}
+	c.JSON(http.StatusOK, definitions)
+}
+
+// GetFlightMeasurements returns the measurements stored for a flight
+func (h *AnalyticsHandler) GetFlightMeasurements(c *gin.Context) {
+	id := c.Param("id")
+	if !flightResource.authorize(c, h.db, id) {
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT flightId, aircraftId, code, value, computedAt
+		FROM FlightMeasurement WHERE flightId = ? ORDER BY code`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	values := []models.FlightMeasurement{}
+	for rows.Next() {
+		var v models.FlightMeasurement
+		var computedAt int64
+		if err := rows.Scan(&v.FlightID, &v.AircraftID, &v.Code, &v.Value, &computedAt); err != nil {
+			log.Println("Error scanning measurement:", err)
+			continue
+		}
+		if m, ok := findMeasurement(v.Code); ok {
+			v.Name, v.Unit = m.Name, m.Unit
+		}
+		v.ComputedAt = time.UnixMilli(computedAt)
+		values = append(values, v)
+	}
+
+	c.JSON(http.StatusOK, values)
+}
+
+// measurementFlight is a flight whose measurements are recomputed
+type measurementFlight struct{ id, aircraftID, file string }
+
+// ComputeMeasurements recomputes measurements from the stored flight files, for
+// flights ingested before a measurement existed. The flights are recomputed in
+// the background, one transaction each; progress is pushed to the stream.
+func (h *AnalyticsHandler) ComputeMeasurements(c *gin.Context) {
+	var req models.ComputeMeasurementsRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	condition, args := tenantOf(c).condition("a.companyId")
+	if len(req.FlightIDs) > 0 {
+		condition += " AND f.id IN (" + placeholders(len(req.FlightIDs)) + ")"
+		args = append(args, stringArgs(req.FlightIDs)...)
+	}
+	rows, err := h.db.Query(`SELECT f.id, f.aircraftId, f.file FROM Csv f
+		LEFT JOIN Aircraft a ON f.aircraftId = a.id
+		WHERE `+condition, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	var flights []measurementFlight
+	for rows.Next() {
+		var f measurementFlight
+		if err := rows.Scan(&f.id, &f.aircraftID, &f.file); err == nil {
+			flights = append(flights, f)
+		}
+	}
+	rows.Close()
+
+	// Progress is pushed to the requesting user
+	progress := models.IngestProgress{JobID: uuid.New().String(), Job: models.IngestJobMeasurements, Stage: models.IngestStageReceived, Total: len(flights)}
+	userID := c.GetString("userId")
+	publishIngestProgress(h.db, userID, "", progress)
+	go h.computeMeasurements(userID, progress, flights)
+
+	c.JSON(http.StatusAccepted, gin.H{"jobId": progress.JobID, "total": len(flights)})
+}
+
+// computeMeasurements recomputes the measurements of flights, publishing
+// progress at most once a second
+func (h *AnalyticsHandler) computeMeasurements(userID string, progress models.IngestProgress, flights []measurementFlight) {
+	now := time.Now()
+	failed := 0
+	progress.Stage = models.IngestStageProcessing
+	lastPublished := time.Now()
+	for i, f := range flights {
+		if _, err := storeFlightMeasurements(h.db, f.id, f.aircraftID, flightFilePath(f.file), now); err != nil {
+			log.Printf("Warning: Failed to compute measurements for flight %s: %v", f.id, err)
+			failed++
+		}
+		progress.Processed, progress.FlightID = i+1, f.id
+		if time.Since(lastPublished) >= time.Second {
+			publishIngestProgress(h.db, userID, "", progress)
+			lastPublished = time.Now()
+		}
+	}
+	progress.Stage, progress.FlightID = models.IngestStageCompleted, ""
+	if failed > 0 {
+		progress.Error = fmt.Sprintf("measurements failed for %d of %d flights", failed, len(flights))
+	}
+	publishIngestProgress(h.db, userID, "", progress)
+}
+
+// measurementGroups maps groupBy values to the key and label columns
+var measurementGroups = map[string][2]string{
+	"aircraft": {"m.aircraftId", "COALESCE(a.registration, a.serialNumber, m.aircraftId)"},
+	"type":     {"COALESCE(a.aircraftMake, '') || ' ' || COALESCE(a.modelNumber, '')", "COALESCE(a.aircraftMake, '') || ' ' || COALESCE(a.modelNumber, '')"},
+	"company":  {"COALESCE(a.companyId, '')", "COALESCE(co.name, a.companyId, '')"},
+}
+
+// measurementSample is one flight's value of a measurement
+type measurementSample struct {
+	value         float64
+	flightID      string
+	flightName    string
+	aircraftID    string
+	aircraftLabel string
+	flightDate    int64
+}
+
+// GetMeasurementDistribution returns the histogram, percentiles and outliers of
+// a measurement, overall and optionally per aircraft, aircraft type or company.
+//
+//	?groupBy=aircraft|type|company&aircraft=<id>&type=<make or model>&from=2025-01-01&to=2025-12-31&bins=20
+func (h *AnalyticsHandler) GetMeasurementDistribution(c *gin.Context) {
+	m, ok := findMeasurement(c.Param("code"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Measurement not found"})
+		return
+	}
+
+	groupBy := c.Query("groupBy")
+	group, ok := measurementGroups[groupBy]
+	if groupBy != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "groupBy must be one of aircraft, type, company"})
+		return
+	}
+	if !ok {
+		group = [2]string{"''", "''"}
+	}
+
+	bins := defaultHistogramBins
+	if v := c.Query("bins"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bins must be a positive integer"})
+			return
+		}
+		if n > maxHistogramBins {
+			n = maxHistogramBins
+		}
+		bins = n
+	}
+
+	condition, args := tenantOf(c).condition("a.companyId")
+	conditions := []string{"m.code = ?", condition}
+	args = append([]interface{}{m.Code}, args...)
+	filters := map[string]listFilter{
+		"aircraft": eqFilter("m.aircraftId"),
+		"company":  eqFilter("a.companyId"),
+		"type": func(value string) (string, []interface{}, error) {
+			return "(lower(a.aircraftMake) = lower(?) OR lower(a.modelNumber) = lower(?))", []interface{}{value, value}, nil
+		},
+		"from": dateFilter("f.createdAt", false),
+		"to":   dateFilter("f.createdAt", true),
+	}
+	for param, filter := range filters {
+		value := strings.TrimSpace(c.Query(param))
+		if value == "" {
+			continue
+		}
+		filterCondition, filterArgs, err := filter(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + param + ": " + err.Error()})
+			return
+		}
+		conditions = append(conditions, filterCondition)
+		args = append(args, filterArgs...)
+	}
+
+	rows, err := h.db.Query(`SELECT m.value, m.flightId, COALESCE(f.name, ''), m.aircraftId,
+			COALESCE(a.registration, a.serialNumber, m.aircraftId), `+sqlEpochMillis("f.createdAt")+`,
+			`+group[0]+`, `+group[1]+`
+		FROM FlightMeasurement m
+		JOIN Csv f ON m.flightId = f.id
+		LEFT JOIN Aircraft a ON m.aircraftId = a.id
+		LEFT JOIN Company co ON a.companyId = co.id
+		WHERE `+strings.Join(conditions, " AND "), args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	var all []measurementSample
+	grouped := map[string][]measurementSample{}
+	labels := map[string]string{}
+	for rows.Next() {
+		var s measurementSample
+		var key, label string
+		err := rows.Scan(&s.value, &s.flightID, &s.flightName, &s.aircraftID, &s.aircraftLabel, &s.flightDate, &key, &label)
+		if err != nil {
+			log.Println("Error scanning measurement:", err)
+			continue
+		}
+		all = append(all, s)
+		if groupBy != "" {
+			grouped[key] = append(grouped[key], s)
+			labels[key] = strings.TrimSpace(label)
+		}
+	}
+
+	response := models.MeasurementDistribution{
+		Measurement: m.MeasurementDefinition,
+		GroupBy:     groupBy,
+		Overall:     measurementGroup("", "All flights", all, bins),
+		Groups:      []models.MeasurementGroup{},
+	}
+	for key, samples := range grouped {
+		response.Groups = append(response.Groups, measurementGroup(key, labels[key], samples, bins))
+	}
+	sort.Slice(response.Groups, func(i, j int) bool {
+		a, b := response.Groups[i], response.Groups[j]
+		if a.Stats.Count != b.Stats.Count {
+			return a.Stats.Count > b.Stats.Count
+		}
+		return a.Key < b.Key
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+// measurementGroup computes the distribution of samples. Outliers lie beyond
+// the Tukey fences and are listed furthest first.
+func measurementGroup(key, label string, samples []measurementSample, bins int) models.MeasurementGroup {
+	group := models.MeasurementGroup{
+		Key:      key,
+		Label:    label,
+		Stats:    models.MeasurementStats{Percentiles: map[string]float64{}, Histogram: []models.HistogramBin{}},
+		Outliers: []models.MeasurementOutlier{},
+	}
+	if len(samples) == 0 {
+		return group
+	}
+
+	values := make([]float64, len(samples))
+	for i, s := range samples {
+		values[i] = s.value
+	}
+	sort.Float64s(values)
+
+	stats := &group.Stats
+	stats.Count = len(values)
+	stats.Min, stats.Max = values[0], values[len(values)-1]
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	stats.Mean = round3(mean)
+	if len(values) > 1 {
+		stats.StdDev = round3(math.Sqrt(squares / float64(len(values)-1)))
+	}
+	for _, p := range []float64{5, 25, 50, 75, 95, 99} {
+		stats.Percentiles["p"+strconv.Itoa(int(p))] = round3(getPercentile(values, p))
+	}
+
+	width := (stats.Max - stats.Min) / float64(bins)
+	if width == 0 {
+		bins, width = 1, 1
+	}
+	for i := 0; i < bins; i++ {
+		stats.Histogram = append(stats.Histogram, models.HistogramBin{
+			Lower: round3(stats.Min + float64(i)*width),
+			Upper: round3(stats.Min + float64(i+1)*width),
+		})
+	}
+	for _, v := range values {
+		i := int((v - stats.Min) / width)
+		if i >= bins {
+			i = bins - 1
+		}
+		stats.Histogram[i].Count++
+	}
+
+	q1, q3 := getPercentile(values, 25), getPercentile(values, 75)
+	low, high := q1-1.5*(q3-q1), q3+1.5*(q3-q1)
+	for _, s := range samples {
+		outlier := models.MeasurementOutlier{
+			FlightID:      s.flightID,
+			FlightName:    s.flightName,
+			AircraftID:    s.aircraftID,
+			AircraftLabel: s.aircraftLabel,
+			Value:         s.value,
+			FlightDate:    time.UnixMilli(s.flightDate),
+		}
+		switch {
+		case s.value > high:
+			outlier.Fence, outlier.Direction = round3(high), "high"
+		case s.value < low:
+			outlier.Fence, outlier.Direction = round3(low), "low"
+		default:
+			continue
+		}
+		group.Outliers = append(group.Outliers, outlier)
+	}
+	sort.Slice(group.Outliers, func(i, j int) bool {
+		a, b := group.Outliers[i], group.Outliers[j]
+		return math.Abs(a.Value-a.Fence) > math.Abs(b.Value-b.Fence)
+	})
+	if len(group.Outliers) > maxMeasurementOutliers {
+		group.Outliers = group.Outliers[:maxMeasurementOutliers]
+	}
+	return group
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"database/sql"
 	"fdm-backend/models"
+	"fdm-backend/utils"
+	"log"
 	"net/http"
 	"time"
 
@@ -18,117 +20,178 @@ func NewNotificationHandler(db *sql.DB) *NotificationHandler {
 	return &NotificationHandler{db: db}
 }
 
-// CreateNotifications creates notifications for users based on exceedance data
+// CreateNotifications applies the notification rules to the exceedances of a
+// flight. Exceedances are notified when they are created, so this only reaches
+// recipients added since; nobody is notified of an exceedance twice.
 func (h *NotificationHandler) CreateNotifications(c *gin.Context) {
 	var req models.CreateNotificationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !flightResource.authorize(c, h.db, req.FlightID) {
+		return
+	}
 
-	// Get all users who should be notified (e.g., admins, operators)
-	query := `SELECT id FROM User WHERE role IN ('admin', 'operator')`
-	rows, err := h.db.Query(query)
+	rows, err := h.db.Query("SELECT id FROM Exceedance WHERE flightId = ? ORDER BY createdAt, id", req.FlightID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching exceedances"})
 		return
 	}
-	defer rows.Close()
-
-	var userIDs []string
+	var exceedanceIDs []string
 	for rows.Next() {
-		var userID string
-		if err := rows.Scan(&userID); err != nil {
-			continue
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			exceedanceIDs = append(exceedanceIDs, id)
 		}
-		userIDs = append(userIDs, userID)
 	}
+	rows.Close()
 
-	// Create notifications for each exceedance and user
-	now := time.Now()
-	var createdNotifications []models.Notification
-
-	for _, exc := range req.Exceedances {
-		// Create a message for the exceedance
-		message := createNotificationMessage(exc.Description, exc.Level, exc.Phase, exc.Parameter)
-
-		for _, userID := range userIDs {
-			id := uuid.New().String()
-			notification := models.Notification{
-				ID:           id,
-				UserID:       userID,
-				ExceedanceID: req.FlightID, // This might need to be adjusted based on your data structure
-				Message:      message,
-				Level:        exc.Level,
-				IsRead:       false,
-				CreatedAt:    now,
-				UpdatedAt:    now,
-			}
-
-			query := `INSERT INTO Notification (id, userId, exceedanceId, message, level, isRead, createdAt, updatedAt)
-					 VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
-
-			_, err := h.db.Exec(query, notification.ID, notification.UserID,
-				notification.ExceedanceID, notification.Message, notification.Level,
-				notification.IsRead, notification.CreatedAt.UnixMilli(),
-				notification.UpdatedAt.UnixMilli())
-
-			if err != nil {
-				continue
-			}
-
-			createdNotifications = append(createdNotifications, notification)
-		}
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
 	}
+	defer tx.Rollback()
 
+	createdNotifications, err := notifyExceedances(tx, exceedanceIDs, time.Now())
+	if err != nil {
+		log.Println("Error creating notifications:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating notifications"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating notifications"})
+		return
+	}
+	wakeEmailWorker()
+
+	if err := loadNotificationTargets(h.db, createdNotifications); err != nil {
+		log.Println("Error loading notification targets:", err)
+	}
 	c.JSON(http.StatusOK, createdNotifications)
 }
 
-// GetUserNotifications retrieves notifications for a specific user
+const notificationColumns = `id, userId, targetType, exceedanceId, flightId, subscriptionId, targetUserId, message, level,
+	isRead, deliveryMode, digestDueAt, digestId, createdAt, updatedAt`
+
+func scanNotification(row interface{ Scan(...interface{}) error }) (models.Notification, error) {
+	var notification models.Notification
+	var createdAt, updatedAt, digestDueAt sql.NullInt64
+	err := row.Scan(&notification.ID, &notification.UserID, &notification.TargetType,
+		&notification.ExceedanceID, &notification.FlightID, &notification.SubscriptionID, &notification.TargetUserID,
+		&notification.Message, &notification.Level, &notification.IsRead,
+		&notification.DeliveryMode, &digestDueAt, &notification.DigestID,
+		&createdAt, &updatedAt)
+	if err != nil {
+		return notification, err
+	}
+	notification.CreatedAt = utils.ConvertSQLiteTimestamp(createdAt)
+	notification.UpdatedAt = utils.ConvertSQLiteTimestamp(updatedAt)
+	notification.DigestDueAt = utils.ConvertSQLiteTimestampPtr(digestDueAt)
+	if id := targetID(notification); id != "" {
+		notification.Link = notificationLink(notification.TargetType, id)
+	}
+	return notification, nil
+}
+
+// GetUserNotifications retrieves notifications for a specific user with their
+// target records. ?digestId= and ?flightId= limit them to one digest or
+// flight; ?groupBy=flight groups them by flight, most recent first.
 func (h *NotificationHandler) GetUserNotifications(c *gin.Context) {
 	userID := c.Param("userId")
+	if !authorizeNotificationOwner(c, h.db, userID) {
+		return
+	}
+	groupBy := c.Query("groupBy")
+	if groupBy != "" && groupBy != "flight" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "groupBy must be flight"})
+		return
+	}
 
-	query := `SELECT n.id, n.userId, n.exceedanceId, n.message, n.level, n.isRead, n.createdAt, n.updatedAt
-			  FROM Notification n
-			  WHERE n.userId = ?
-			  ORDER BY n.createdAt DESC`
+	query := "SELECT " + notificationColumns + " FROM Notification WHERE userId = ?"
+	args := []interface{}{userID}
+	if digestID := c.Query("digestId"); digestID != "" {
+		query += " AND digestId = ?"
+		args = append(args, digestID)
+	}
+	if flightID := c.Query("flightId"); flightID != "" {
+		query += " AND flightId = ?"
+		args = append(args, flightID)
+	}
+	query += " ORDER BY createdAt DESC"
 
-	rows, err := h.db.Query(query, userID)
+	rows, err := h.db.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-	defer rows.Close()
 
 	var notifications []models.Notification
 	for rows.Next() {
-		var notification models.Notification
-		var createdAt, updatedAt sql.NullTime
-
-		err := rows.Scan(&notification.ID, &notification.UserID,
-			&notification.ExceedanceID, &notification.Message,
-			&notification.Level, &notification.IsRead,
-			&createdAt, &updatedAt)
-
+		notification, err := scanNotification(rows)
 		if err != nil {
 			continue
 		}
-
-		if createdAt.Valid {
-			notification.CreatedAt = createdAt.Time
-		}
-		if updatedAt.Valid {
-			notification.UpdatedAt = updatedAt.Time
-		}
 		notifications = append(notifications, notification)
 	}
+	rows.Close()
 
+	if err := loadNotificationTargets(h.db, notifications); err != nil {
+		log.Println("Error loading notification targets:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if groupBy == "flight" {
+		c.JSON(http.StatusOK, groupNotificationsByFlight(notifications))
+		return
+	}
 	c.JSON(http.StatusOK, notifications)
 }
 
+// groupNotificationsByFlight groups notifications, newest first, by flight in
+// order of their latest notification
+func groupNotificationsByFlight(notifications []models.Notification) []models.NotificationGroup {
+	groups := []models.NotificationGroup{}
+	index := map[string]int{}
+	for _, n := range notifications {
+		key := ""
+		if n.FlightID != nil {
+			key = *n.FlightID
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, models.NotificationGroup{FlightID: n.FlightID, Flight: n.Flight, LatestAt: n.CreatedAt})
+		}
+		group := &groups[i]
+		group.Count++
+		if !n.IsRead {
+			group.Unread++
+		}
+		group.Notifications = append(group.Notifications, n)
+	}
+	return groups
+}
+
 // MarkNotificationAsRead marks a notification as read
 func (h *NotificationHandler) MarkNotificationAsRead(c *gin.Context) {
 	id := c.Param("id")
+
+	var ownerID string
+	err := h.db.QueryRow("SELECT userId FROM Notification WHERE id = ?", id).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !authorizeNotificationOwner(c, h.db, ownerID) {
+		return
+	}
 	now := time.Now()
 
 	query := `UPDATE Notification SET isRead = true, updatedAt = ? WHERE id = ?`
@@ -147,13 +210,26 @@ func (h *NotificationHandler) MarkNotificationAsRead(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
 }
 
-// MarkAllNotificationsAsRead marks all notifications as read for a user
+// MarkAllNotificationsAsRead marks all notifications as read for a user, or
+// only those of one digest or flight with ?digestId= or ?flightId=
 func (h *NotificationHandler) MarkAllNotificationsAsRead(c *gin.Context) {
 	userID := c.Param("userId")
+	if !authorizeNotificationOwner(c, h.db, userID) {
+		return
+	}
 	now := time.Now()
 
 	query := `UPDATE Notification SET isRead = true, updatedAt = ? WHERE userId = ? AND isRead = false`
-	result, err := h.db.Exec(query, now.UnixMilli(), userID)
+	args := []interface{}{now.UnixMilli(), userID}
+	if digestID := c.Query("digestId"); digestID != "" {
+		query += " AND digestId = ?"
+		args = append(args, digestID)
+	}
+	if flightID := c.Query("flightId"); flightID != "" {
+		query += " AND flightId = ?"
+		args = append(args, flightID)
+	}
+	result, err := h.db.Exec(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating notifications"})
 		return
@@ -163,6 +239,45 @@ func (h *NotificationHandler) MarkAllNotificationsAsRead(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "All notifications marked as read", "updated": rowsAffected})
 }
 
+// createNotification stores a notification about a target for a single user
+func createNotification(exec dbExecutor, userID string, target notificationTarget, message, level string, now time.Time) (models.Notification, error) {
+	pref, err := loadNotificationPreference(exec, userID)
+	if err != nil {
+		return models.Notification{}, err
+	}
+	return insertNotification(exec, pref, target, message, level, false, now)
+}
+
+// insertNotification stores a notification and pushes it, unless the user's
+// preferences hold it for a digest. digestEmail includes a held notification
+// in the digest email as well.
+func insertNotification(exec dbExecutor, pref models.NotificationPreference, target notificationTarget, message, level string, digestEmail bool, now time.Time) (models.Notification, error) {
+	notification := models.Notification{
+		ID:           uuid.New().String(),
+		UserID:       pref.UserID,
+		Message:      message,
+		Level:        level,
+		DeliveryMode: modeFor(pref, level),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	target.apply(&notification)
+	var due interface{}
+	if d := dueAt(pref, notification.DeliveryMode, now); d.After(now) {
+		notification.DigestDueAt = &d
+		due = d.UnixMilli()
+	}
+	_, err := exec.Exec(`INSERT INTO Notification (`+notificationColumns+`, digestEmail)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, ?, ?, ?)`,
+		notification.ID, pref.UserID, notification.TargetType, notification.ExceedanceID, notification.FlightID,
+		notification.SubscriptionID, notification.TargetUserID, message, level, false, notification.DeliveryMode,
+		due, now.UnixMilli(), now.UnixMilli(), digestEmail && due != nil)
+	if err != nil || notification.DigestDueAt != nil {
+		return notification, err
+	}
+	return notification, publishEvent(exec, models.StreamEventNotification, pref.UserID, "", notification, now)
+}
+
 // Helper function to create notification messages
 func createNotificationMessage(description, level, phase, parameter string) string {
 	return description + " detected during " + phase + " phase. Parameter: " + parameter + " (Level " + level + ")"
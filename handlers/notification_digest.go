@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/config"
+	"fdm-backend/mailer"
+	"fdm-backend/models"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sendDueDigests sends a digest to every user with held notifications that
+// are due, for the notification_digests job. Notifications read before they
+// fall due are not sent. It returns how many digests were sent and how many
+// failed.
+func (h *NotificationHandler) sendDueDigests(now time.Time) (int, int, error) {
+	rows, err := h.db.Query(`SELECT DISTINCT userId FROM Notification
+		WHERE digestId IS NULL AND digestDueAt <= ? AND isRead = 0`, now.UnixMilli())
+	if err != nil {
+		return 0, 0, err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	rows.Close()
+
+	queued := false
+	sent, failed := 0, 0
+	for _, userID := range userIDs {
+		emailed, err := sendNotificationDigest(h.db, userID, now)
+		if err != nil {
+			log.Printf("Error sending notification digest to %s: %v", userID, err)
+			failed++
+			continue
+		}
+		sent++
+		queued = queued || emailed
+	}
+	if queued {
+		wakeEmailWorker()
+	}
+	return sent, failed, nil
+}
+
+// sendNotificationDigest gathers the due notifications of a user into one
+// digest, pushes it and emails the notifications marked for email. It reports
+// whether an email was queued.
+func sendNotificationDigest(db *sql.DB, userID string, now time.Time) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, targetType, COALESCE(exceedanceId, subscriptionId, targetUserId, flightId, ''), message, level, digestEmail FROM Notification
+		WHERE userId = ? AND digestId IS NULL AND digestDueAt <= ? AND isRead = 0
+		ORDER BY createdAt, id`, userID, now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	digest := models.NotificationDigest{
+		ID:              uuid.New().String(),
+		Levels:          map[string]int{},
+		NotificationIDs: []string{},
+		CreatedAt:       now,
+	}
+	var items []map[string]interface{}
+	for rows.Next() {
+		var id, kind, target, message, level string
+		var digestEmail bool
+		if err := rows.Scan(&id, &kind, &target, &message, &level, &digestEmail); err != nil {
+			rows.Close()
+			return false, err
+		}
+		digest.NotificationIDs = append(digest.NotificationIDs, id)
+		digest.Levels[level]++
+		if digestEmail {
+			link := ""
+			if target != "" {
+				link = notificationLink(kind, target).URL
+			}
+			items = append(items, map[string]interface{}{"Level": level, "Message": message, "Link": link})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	digest.Count = len(digest.NotificationIDs)
+	if digest.Count == 0 {
+		return false, nil
+	}
+
+	args := append([]interface{}{digest.ID, now.UnixMilli()}, stringArgs(digest.NotificationIDs)...)
+	if _, err := tx.Exec("UPDATE Notification SET digestId = ?, updatedAt = ? WHERE id IN ("+
+		placeholders(len(digest.NotificationIDs))+")", args...); err != nil {
+		return false, err
+	}
+
+	if len(items) > 0 {
+		var email string
+		var fullName sql.NullString
+		if err := tx.QueryRow("SELECT COALESCE(email, ''), fullName FROM User WHERE id = ?", userID).Scan(&email, &fullName); err != nil {
+			return false, err
+		}
+		name := fullName.String
+		if name == "" {
+			name = email
+		}
+		data := map[string]interface{}{
+			"Name":  name,
+			"Count": len(items),
+			"Items": items,
+			"Link":  config.GetAppURL() + "/notifications?digest=" + url.QueryEscape(digest.ID),
+		}
+		if _, err := queueEmail(tx, &userID, nil, email, mailer.TemplateNotificationDigest, data, now); err != nil {
+			return false, err
+		}
+	}
+	if err := publishEvent(tx, models.StreamEventNotificationDigest, userID, "", digest, now); err != nil {
+		return false, err
+	}
+	return len(items) > 0, tx.Commit()
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fdm-backend/models"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Notification preferences decide when a user hears about a notification.
+// Immediate notifications are pushed as they are created; hourly and daily
+// ones, and anything created during quiet hours, are held with the time they
+// are due and sent together in a digest by the notification_digests job. Held
+// notifications are listed in the app straight away but are not pushed.
+
+// defaultNotificationPreference applies to users who have not saved preferences
+func defaultNotificationPreference(userID string) models.NotificationPreference {
+	return models.NotificationPreference{
+		UserID:        userID,
+		Channels:      append([]string{}, models.NotificationChannels...),
+		SeverityModes: map[string]string{},
+		DefaultMode:   models.NotificationModeImmediate,
+		DigestHour:    8,
+		Timezone:      "UTC",
+	}
+}
+
+// loadNotificationPreference returns the preferences of a user, or the
+// defaults when they have none
+func loadNotificationPreference(exec dbExecutor, userID string) (models.NotificationPreference, error) {
+	pref := defaultNotificationPreference(userID)
+	var channels, severityModes string
+	var quietStart, quietEnd sql.NullString
+	var updatedAt int64
+	err := exec.QueryRow(`SELECT channels, severityModes, defaultMode, digestHour, quietHoursStart, quietHoursEnd, timezone, updatedAt
+		FROM NotificationPreference WHERE userId = ?`, userID).
+		Scan(&channels, &severityModes, &pref.DefaultMode, &pref.DigestHour, &quietStart, &quietEnd, &pref.Timezone, &updatedAt)
+	if err == sql.ErrNoRows {
+		return pref, nil
+	}
+	if err != nil {
+		return pref, err
+	}
+	if err := json.Unmarshal([]byte(channels), &pref.Channels); err != nil {
+		return pref, err
+	}
+	if err := json.Unmarshal([]byte(severityModes), &pref.SeverityModes); err != nil {
+		return pref, err
+	}
+	if quietStart.Valid && quietEnd.Valid {
+		pref.QuietHoursStart, pref.QuietHoursEnd = &quietStart.String, &quietEnd.String
+	}
+	updated := time.UnixMilli(updatedAt)
+	pref.UpdatedAt = &updated
+	return pref, nil
+}
+
+// applyNotificationPreferenceRequest copies the fields present in req onto pref
+func applyNotificationPreferenceRequest(pref *models.NotificationPreference, req models.NotificationPreferenceRequest) {
+	if req.Channels != nil {
+		pref.Channels = cleanList(req.Channels, true)
+	}
+	if req.SeverityModes != nil {
+		pref.SeverityModes = map[string]string{}
+		for severity, mode := range req.SeverityModes {
+			pref.SeverityModes[strings.ToLower(strings.TrimSpace(severity))] = strings.ToLower(strings.TrimSpace(mode))
+		}
+	}
+	if req.DefaultMode != nil {
+		pref.DefaultMode = strings.ToLower(strings.TrimSpace(*req.DefaultMode))
+	}
+	if req.DigestHour != nil {
+		pref.DigestHour = *req.DigestHour
+	}
+	if req.QuietHoursStart != nil || req.QuietHoursEnd != nil {
+		start, end := "", ""
+		if req.QuietHoursStart != nil {
+			start = strings.TrimSpace(*req.QuietHoursStart)
+		} else if pref.QuietHoursStart != nil {
+			start = *pref.QuietHoursStart
+		}
+		if req.QuietHoursEnd != nil {
+			end = strings.TrimSpace(*req.QuietHoursEnd)
+		} else if pref.QuietHoursEnd != nil {
+			end = *pref.QuietHoursEnd
+		}
+		pref.QuietHoursStart, pref.QuietHoursEnd = nil, nil
+		if start != "" || end != "" {
+			pref.QuietHoursStart, pref.QuietHoursEnd = &start, &end
+		}
+	}
+	if req.Timezone != nil {
+		pref.Timezone = strings.TrimSpace(*req.Timezone)
+	}
+}
+
+// validateNotificationPreference checks the modes, digest hour, quiet hours
+// and time zone of pref
+func validateNotificationPreference(pref models.NotificationPreference) error {
+	for _, channel := range pref.Channels {
+		if !containsString(models.NotificationChannels, channel) {
+			return errors.New("channels must be one of " + strings.Join(models.NotificationChannels, ", "))
+		}
+	}
+	modes := "modes must be one of " + strings.Join(models.NotificationModes, ", ")
+	if !containsString(models.NotificationModes, pref.DefaultMode) {
+		return errors.New(modes)
+	}
+	for severity, mode := range pref.SeverityModes {
+		if !containsString(models.ExceedancePriorities, severity) {
+			return errors.New("severityModes keys must be one of " + strings.Join(models.ExceedancePriorities, ", "))
+		}
+		if !containsString(models.NotificationModes, mode) {
+			return errors.New(modes)
+		}
+	}
+	if pref.DigestHour < 0 || pref.DigestHour > 23 {
+		return errors.New("digestHour must be between 0 and 23")
+	}
+	if pref.QuietHoursStart != nil {
+		start, err := parseClock(*pref.QuietHoursStart)
+		if err != nil {
+			return errors.New("quietHoursStart must be a time such as 22:00")
+		}
+		end, err := parseClock(*pref.QuietHoursEnd)
+		if err != nil {
+			return errors.New("quietHoursEnd must be a time such as 07:00")
+		}
+		if start == end {
+			return errors.New("quiet hours must not start and end at the same time")
+		}
+	}
+	if pref.Timezone == "" {
+		return errors.New("timezone is required")
+	}
+	if _, err := time.LoadLocation(pref.Timezone); err != nil {
+		return errors.New("unknown timezone: " + pref.Timezone)
+	}
+	return nil
+}
+
+// parseClock returns the minutes since midnight of an HH:MM time
+func parseClock(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil {
+		return 0, err
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, errors.New("out of range")
+	}
+	return hour*60 + minute, nil
+}
+
+// modeFor returns how notifications of a level are delivered. Exceedance
+// severities use their own mode when one is set; everything else, including
+// mentions and SPI alerts, uses the default mode.
+func modeFor(pref models.NotificationPreference, level string) string {
+	if mode, ok := pref.SeverityModes[strings.ToLower(level)]; ok {
+		return mode
+	}
+	return pref.DefaultMode
+}
+
+// dueAt returns when a notification created at now is delivered in mode:
+// immediately, at the start of the next hour or at the next digest hour, in
+// the user's time zone and moved to the end of quiet hours when it falls
+// inside them.
+func dueAt(pref models.NotificationPreference, mode string, now time.Time) time.Time {
+	loc, err := time.LoadLocation(pref.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	due := local
+	switch mode {
+	case models.NotificationModeHourly:
+		due = time.Date(local.Year(), local.Month(), local.Day(), local.Hour()+1, 0, 0, 0, loc)
+	case models.NotificationModeDaily:
+		due = time.Date(local.Year(), local.Month(), local.Day(), pref.DigestHour, 0, 0, 0, loc)
+		if !due.After(local) {
+			due = due.AddDate(0, 0, 1)
+		}
+	}
+	return afterQuietHours(pref, due)
+}
+
+// afterQuietHours moves t to the end of the quiet hours it falls in. Quiet
+// hours may span midnight, e.g. 22:00 to 07:00.
+func afterQuietHours(pref models.NotificationPreference, t time.Time) time.Time {
+	if pref.QuietHoursStart == nil || pref.QuietHoursEnd == nil {
+		return t
+	}
+	start, err := parseClock(*pref.QuietHoursStart)
+	if err != nil {
+		return t
+	}
+	end, err := parseClock(*pref.QuietHoursEnd)
+	if err != nil {
+		return t
+	}
+	minute := t.Hour()*60 + t.Minute()
+	quiet := (start < end && minute >= start && minute < end) || (start > end && (minute >= start || minute < end))
+	if !quiet {
+		return t
+	}
+	until := time.Date(t.Year(), t.Month(), t.Day(), end/60, end%60, 0, 0, t.Location())
+	if !until.After(t) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until
+}
+
+// authorizeNotificationOwner writes an error response and returns false unless
+// the requesting user is the user themselves or an admin. Notifications and
+// their preferences are personal, so colleagues cannot read them.
+func authorizeNotificationOwner(c *gin.Context, exec dbExecutor, userID string) bool {
+	if userID != "" && userID == c.GetString("userId") {
+		return true
+	}
+	if c.GetString("userRole") != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied", "message": "You can only access your own notifications"})
+		return false
+	}
+	return userResource.authorize(c, exec, userID)
+}
+
+// GetNotificationPreferences returns the notification preferences of a user
+func (h *NotificationHandler) GetNotificationPreferences(c *gin.Context) {
+	userID := c.Param("userId")
+	if !authorizeNotificationOwner(c, h.db, userID) {
+		return
+	}
+	pref, err := loadNotificationPreference(h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, pref)
+}
+
+// UpdateNotificationPreferences changes the notification preferences of a
+// user. Notifications already held keep the time they are due.
+func (h *NotificationHandler) UpdateNotificationPreferences(c *gin.Context) {
+	userID := c.Param("userId")
+	if !authorizeNotificationOwner(c, h.db, userID) {
+		return
+	}
+
+	var req models.NotificationPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pref, err := loadNotificationPreference(h.db, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	applyNotificationPreferenceRequest(&pref, req)
+	if err := validateNotificationPreference(pref); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	pref.UpdatedAt = &now
+	_, err = h.db.Exec(`INSERT INTO NotificationPreference (userId, channels, severityModes, defaultMode, digestHour,
+			quietHoursStart, quietHoursEnd, timezone, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(userId) DO UPDATE SET channels = excluded.channels, severityModes = excluded.severityModes,
+			defaultMode = excluded.defaultMode, digestHour = excluded.digestHour, quietHoursStart = excluded.quietHoursStart,
+			quietHoursEnd = excluded.quietHoursEnd, timezone = excluded.timezone, updatedAt = excluded.updatedAt`,
+		userID, jsonText(pref.Channels), jsonText(pref.SeverityModes), pref.DefaultMode, pref.DigestHour,
+		pref.QuietHoursStart, pref.QuietHoursEnd, pref.Timezone, now.UnixMilli())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating notification preferences"})
+		return
+	}
+	c.JSON(http.StatusOK, pref)
+}
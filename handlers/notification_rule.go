@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fdm-backend/mailer"
+	"fdm-backend/models"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Notification rules decide who hears about new exceedances. Every exceedance
+// created through the API is matched against the active rules of the company
+// owning its aircraft; each recipient is notified once per exceedance, however
+// many rules match. Companies that have not defined any rule notify their
+// gatekeepers and FDAs.
+
+// defaultNotificationRoles are notified by companies without notification rules
+var defaultNotificationRoles = []string{models.RoleGatekeeper, models.RoleFDA}
+
+const notificationRuleColumns = `id, companyId, name, eventCodes, severities, aircraftIds, phases, userIds, roles,
+	channels, isActive, createdBy, createdAt, updatedAt`
+
+func scanNotificationRule(row interface{ Scan(...interface{}) error }) (models.NotificationRule, error) {
+	var rule models.NotificationRule
+	var eventCodes, severities, aircraftIDs, phases, userIDs, roles, channels string
+	var createdAt, updatedAt int64
+	err := row.Scan(&rule.ID, &rule.CompanyID, &rule.Name, &eventCodes, &severities, &aircraftIDs, &phases,
+		&userIDs, &roles, &channels, &rule.IsActive, &rule.CreatedBy, &createdAt, &updatedAt)
+	if err != nil {
+		return rule, err
+	}
+	for _, list := range []struct {
+		text   string
+		values *[]string
+	}{
+		{eventCodes, &rule.EventCodes}, {severities, &rule.Severities}, {aircraftIDs, &rule.AircraftIDs},
+		{phases, &rule.Phases}, {userIDs, &rule.UserIDs}, {roles, &rule.Roles}, {channels, &rule.Channels},
+	} {
+		json.Unmarshal([]byte(list.text), list.values)
+		if *list.values == nil {
+			*list.values = []string{}
+		}
+	}
+	rule.CreatedAt = time.UnixMilli(createdAt)
+	rule.UpdatedAt = time.UnixMilli(updatedAt)
+	return rule, nil
+}
+
+func getNotificationRule(exec dbExecutor, id string) (models.NotificationRule, error) {
+	return scanNotificationRule(exec.QueryRow("SELECT "+notificationRuleColumns+" FROM NotificationRule WHERE id = ?", id))
+}
+
+// applyNotificationRuleRequest copies the fields present in req onto rule
+func applyNotificationRuleRequest(rule *models.NotificationRule, req models.NotificationRuleRequest) {
+	if req.Name != nil {
+		rule.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.EventCodes != nil {
+		rule.EventCodes = cleanList(req.EventCodes, false)
+	}
+	if req.Severities != nil {
+		rule.Severities = cleanList(req.Severities, true)
+	}
+	if req.AircraftIDs != nil {
+		rule.AircraftIDs = cleanList(req.AircraftIDs, false)
+	}
+	if req.Phases != nil {
+		rule.Phases = cleanList(req.Phases, false)
+		for i, phase := range rule.Phases {
+			rule.Phases[i] = strings.ToUpper(phase)
+		}
+	}
+	if req.UserIDs != nil {
+		rule.UserIDs = cleanList(req.UserIDs, false)
+	}
+	if req.Roles != nil {
+		rule.Roles = cleanList(req.Roles, true)
+	}
+	if req.Channels != nil {
+		rule.Channels = cleanList(req.Channels, true)
+	}
+	if req.IsActive != nil {
+		rule.IsActive = *req.IsActive
+	}
+}
+
+// validateNotificationRule checks a rule and that the aircraft and users it
+// names belong to its company
+func validateNotificationRule(exec dbExecutor, rule models.NotificationRule) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+	for _, severity := range rule.Severities {
+		if !containsString(models.ExceedancePriorities, severity) {
+			return errors.New("severities must be one of " + strings.Join(models.ExceedancePriorities, ", "))
+		}
+	}
+	if len(rule.Channels) == 0 {
+		return errors.New("at least one channel is required")
+	}
+	for _, channel := range rule.Channels {
+		if !containsString(models.NotificationChannels, channel) {
+			return errors.New("channels must be one of " + strings.Join(models.NotificationChannels, ", "))
+		}
+	}
+
+	for _, aircraftID := range rule.AircraftIDs {
+		companyID, err := aircraftResource.companyID(exec, aircraftID)
+		if err == sql.ErrNoRows || (err == nil && companyID.String != rule.CompanyID) {
+			return errors.New("aircraft " + aircraftID + " does not belong to the company")
+		} else if err != nil {
+			return err
+		}
+	}
+	return validateRecipients(exec, rule.CompanyID, rule.UserIDs, rule.Roles)
+}
+
+// validateRecipients checks recipient roles and that the users named belong
+// to the company. Admins and FDAs may be named by any company.
+func validateRecipients(exec dbExecutor, companyID string, userIDs, roles []string) error {
+	allowed := []string{models.RoleAdmin, models.RoleFDA, models.RoleGatekeeper, models.RoleUser}
+	for _, role := range roles {
+		if !containsString(allowed, role) {
+			return errors.New("roles must be one of " + strings.Join(allowed, ", "))
+		}
+	}
+	if len(userIDs) == 0 && len(roles) == 0 {
+		return errors.New("at least one user or role is required")
+	}
+	for _, userID := range userIDs {
+		var userCompanyID sql.NullString
+		var role string
+		err := exec.QueryRow("SELECT companyId, role FROM User WHERE id = ?", userID).Scan(&userCompanyID, &role)
+		if err == sql.ErrNoRows {
+			return errors.New("user " + userID + " not found")
+		} else if err != nil {
+			return err
+		}
+		if userCompanyID.String != companyID && role != models.RoleAdmin && role != models.RoleFDA {
+			return errors.New("user " + userID + " does not belong to the company")
+		}
+	}
+	return nil
+}
+
+// GetNotificationRules lists the notification rules of the caller's company
+func (h *NotificationHandler) GetNotificationRules(c *gin.Context) {
+	condition, args := tenantOf(c).condition("companyId")
+	if v := strings.TrimSpace(c.Query("company")); v != "" {
+		condition += " AND companyId = ?"
+		args = append(args, v)
+	}
+
+	rows, err := h.db.Query("SELECT "+notificationRuleColumns+" FROM NotificationRule WHERE "+condition+" ORDER BY name", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	rules := []models.NotificationRule{}
+	for rows.Next() {
+		rule, err := scanNotificationRule(rows)
+		if err != nil {
+			log.Println("Error scanning notification rule:", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// GetNotificationRuleByID returns a single notification rule
+func (h *NotificationHandler) GetNotificationRuleByID(c *gin.Context) {
+	id := c.Param("id")
+	if !notificationRuleResource.authorize(c, h.db, id) {
+		return
+	}
+
+	rule, err := getNotificationRule(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// CreateNotificationRule defines a new rule. Gatekeepers create rules for their
+// own company; admins and FDAs must name the company.
+func (h *NotificationHandler) CreateNotificationRule(c *gin.Context) {
+	var req models.NotificationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	companyID, ok := requestedCompany(c, h.db, req.CompanyID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	userID := c.GetString("userId")
+	rule := models.NotificationRule{
+		ID:          uuid.New().String(),
+		CompanyID:   companyID,
+		EventCodes:  []string{},
+		Severities:  []string{},
+		AircraftIDs: []string{},
+		Phases:      []string{},
+		UserIDs:     []string{},
+		Roles:       []string{},
+		Channels:    []string{models.NotificationChannelInApp},
+		IsActive:    true,
+		CreatedBy:   &userID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	applyNotificationRuleRequest(&rule, req)
+	if err := validateNotificationRule(h.db, rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.db.Exec(`INSERT INTO NotificationRule (`+notificationRuleColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.ID, rule.CompanyID, rule.Name, jsonText(rule.EventCodes), jsonText(rule.Severities),
+		jsonText(rule.AircraftIDs), jsonText(rule.Phases), jsonText(rule.UserIDs), jsonText(rule.Roles),
+		jsonText(rule.Channels), rule.IsActive, rule.CreatedBy, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		log.Println("Error creating notification rule:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating notification rule"})
+		return
+	}
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateNotificationRule changes a notification rule
+func (h *NotificationHandler) UpdateNotificationRule(c *gin.Context) {
+	id := c.Param("id")
+	if !notificationRuleResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var req models.NotificationRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := getNotificationRule(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.CompanyID != nil && *req.CompanyID != rule.CompanyID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "companyId cannot be changed"})
+		return
+	}
+	applyNotificationRuleRequest(&rule, req)
+	if err := validateNotificationRule(h.db, rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	rule.UpdatedAt = now
+	_, err = h.db.Exec(`UPDATE NotificationRule SET name = ?, eventCodes = ?, severities = ?, aircraftIds = ?, phases = ?,
+		userIds = ?, roles = ?, channels = ?, isActive = ?, updatedAt = ? WHERE id = ?`,
+		rule.Name, jsonText(rule.EventCodes), jsonText(rule.Severities), jsonText(rule.AircraftIDs),
+		jsonText(rule.Phases), jsonText(rule.UserIDs), jsonText(rule.Roles), jsonText(rule.Channels),
+		rule.IsActive, now.UnixMilli(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating notification rule"})
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteNotificationRule removes a notification rule
+func (h *NotificationHandler) DeleteNotificationRule(c *gin.Context) {
+	id := c.Param("id")
+	if !notificationRuleResource.authorize(c, h.db, id) {
+		return
+	}
+
+	if _, err := h.db.Exec("DELETE FROM NotificationRule WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting notification rule"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification rule deleted successfully"})
+}
+
+// ruleMatches reports whether an exceedance matches the filters of a rule
+func ruleMatches(rule models.NotificationRule, eventCode, level, aircraftID, phases string) bool {
+	if len(rule.EventCodes) > 0 && !containsString(rule.EventCodes, eventCode) {
+		return false
+	}
+	if len(rule.Severities) > 0 && !containsString(rule.Severities, strings.ToLower(strings.TrimSpace(level))) {
+		return false
+	}
+	if len(rule.AircraftIDs) > 0 && !containsString(rule.AircraftIDs, aircraftID) {
+		return false
+	}
+	if len(rule.Phases) > 0 {
+		matched := false
+		for _, phase := range strings.Split(phases, ",") {
+			if containsString(rule.Phases, strings.ToUpper(strings.TrimSpace(phase))) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleRecipients returns the active users a rule notifies
+func ruleRecipients(exec dbExecutor, companyID string, userIDs, roles []string) ([]string, error) {
+	var conditions []string
+	var args []interface{}
+	if len(userIDs) > 0 {
+		conditions = append(conditions, "id IN ("+placeholders(len(userIDs))+")")
+		for _, id := range userIDs {
+			args = append(args, id)
+		}
+	}
+	if len(roles) > 0 {
+		conditions = append(conditions, "(companyId = ? AND role IN ("+placeholders(len(roles))+"))")
+		args = append(args, companyID)
+		for _, role := range roles {
+			args = append(args, role)
+		}
+	}
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	rows, err := exec.Query("SELECT id FROM User WHERE isActive = 1 AND ("+strings.Join(conditions, " OR ")+") ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var recipients []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			recipients = append(recipients, id)
+		}
+	}
+	return recipients, rows.Err()
+}
+
+// notifyExceedances applies the notification rules to exceedances. Users who
+// were already notified of an exceedance through a channel are skipped, so
+// running it twice for the same exceedances notifies nobody twice. Queued
+// emails are sent once the caller wakes the email worker.
+//
+// Rule channels are narrowed to the channels each recipient accepts. When a
+// recipient's preferences hold the exceedance for a digest, the notification
+// is stored even if only email was chosen, so the digest can include it.
+func notifyExceedances(exec dbExecutor, exceedanceIDs []string, now time.Time) ([]models.Notification, error) {
+	notifications := []models.Notification{}
+	rulesByCompany := map[string][]models.NotificationRule{}
+	preferences := map[string]models.NotificationPreference{}
+	for _, exceedanceID := range exceedanceIDs {
+		var companyID, aircraftID, eventCode, level, phases, description, parameter, registration, flight, flightID string
+		err := exec.QueryRow(`SELECT COALESCE(a.companyId, ''), COALESCE(e.aircraftId, ''), COALESCE(el.eventCode, ''),
+				COALESCE(e.exceedanceLevel, ''), COALESCE(e.flightPhase, ''), COALESCE(e.description, ''), COALESCE(e.parameterName, ''),
+				COALESCE(a.registration, a.serialNumber, ''), COALESCE(f.name, ''), COALESCE(e.flightId, '')
+			FROM Exceedance e
+			LEFT JOIN EventLog el ON e.eventId = el.id
+			LEFT JOIN Aircraft a ON e.aircraftId = a.id
+			LEFT JOIN Csv f ON e.flightId = f.id
+			WHERE e.id = ?`, exceedanceID).
+			Scan(&companyID, &aircraftID, &eventCode, &level, &phases, &description, &parameter, &registration, &flight, &flightID)
+		if err != nil {
+			return notifications, err
+		}
+		if companyID == "" {
+			continue
+		}
+
+		rules, loaded := rulesByCompany[companyID]
+		if !loaded {
+			if rules, err = loadNotificationRules(exec, companyID); err != nil {
+				return notifications, err
+			}
+			rulesByCompany[companyID] = rules
+		}
+
+		// Recipients and the channels they are reached through, over all matching rules
+		channels := map[string][]string{}
+		var order []string
+		addRecipients := func(userIDs, roles, ruleChannels []string) error {
+			recipients, err := ruleRecipients(exec, companyID, userIDs, roles)
+			if err != nil {
+				return err
+			}
+			for _, userID := range recipients {
+				if _, seen := channels[userID]; !seen {
+					order = append(order, userID)
+				}
+				for _, channel := range ruleChannels {
+					if !containsString(channels[userID], channel) {
+						channels[userID] = append(channels[userID], channel)
+					}
+				}
+			}
+			return nil
+		}
+		if len(rules) == 0 {
+			err = addRecipients(nil, defaultNotificationRoles, []string{models.NotificationChannelInApp})
+		}
+		for _, rule := range rules {
+			if err == nil && rule.IsActive && ruleMatches(rule, eventCode, level, aircraftID, phases) {
+				err = addRecipients(rule.UserIDs, rule.Roles, rule.Channels)
+			}
+		}
+		if err != nil {
+			return notifications, err
+		}
+
+		target := notificationTarget{kind: models.NotificationTargetExceedance, id: exceedanceID, flightID: flightID}
+		message := createNotificationMessage(description, level, phases, parameter)
+		emailData := map[string]interface{}{
+			"Level":       level,
+			"Description": description,
+			"EventCode":   eventCode,
+			"Aircraft":    registration,
+			"Flight":      flight,
+			"Phase":       phases,
+			"Parameter":   parameter,
+			"Link":        target.link().URL,
+		}
+		for _, userID := range order {
+			pref, loaded := preferences[userID]
+			if !loaded {
+				if pref, err = loadNotificationPreference(exec, userID); err != nil {
+					return notifications, err
+				}
+				preferences[userID] = pref
+			}
+			inApp := containsString(channels[userID], models.NotificationChannelInApp) &&
+				containsString(pref.Channels, models.NotificationChannelInApp)
+			email := containsString(channels[userID], models.NotificationChannelEmail) &&
+				containsString(pref.Channels, models.NotificationChannelEmail)
+			held := dueAt(pref, modeFor(pref, level), now).After(now)
+
+			if inApp || (email && held) {
+				var notified int
+				err := exec.QueryRow("SELECT COUNT(*) FROM Notification WHERE userId = ? AND exceedanceId = ?", userID, exceedanceID).Scan(&notified)
+				if err != nil {
+					return notifications, err
+				}
+				if notified == 0 {
+					notification, err := insertNotification(exec, pref, target, message, level, email && held, now)
+					if err != nil {
+						return notifications, err
+					}
+					notifications = append(notifications, notification)
+				} else if email && held {
+					_, err := exec.Exec(`UPDATE Notification SET digestEmail = 1
+						WHERE userId = ? AND exceedanceId = ? AND digestDueAt IS NOT NULL AND digestId IS NULL`, userID, exceedanceID)
+					if err != nil {
+						return notifications, err
+					}
+				}
+			}
+			if email && !held {
+				var emailed int
+				err := exec.QueryRow("SELECT COUNT(*) FROM EmailDelivery WHERE userId = ? AND exceedanceId = ? AND template = ?",
+					userID, exceedanceID, mailer.TemplateExceedanceAlert).Scan(&emailed)
+				if err != nil {
+					return notifications, err
+				}
+				if emailed == 0 {
+					id := exceedanceID
+					if err := queueUserEmail(exec, userID, &id, mailer.TemplateExceedanceAlert, emailData, now); err != nil {
+						return notifications, err
+					}
+				}
+			}
+		}
+	}
+	return notifications, nil
+}
+
+// loadNotificationRules returns every rule of a company, active or not
+func loadNotificationRules(exec dbExecutor, companyID string) ([]models.NotificationRule, error) {
+	rows, err := exec.Query("SELECT "+notificationRuleColumns+" FROM NotificationRule WHERE companyId = ?", companyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rules := []models.NotificationRule{}
+	for rows.Next() {
+		rule, err := scanNotificationRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/config"
+	"fdm-backend/models"
+	"time"
+)
+
+// notificationTarget is the record a notification is about
+type notificationTarget struct {
+	kind     string
+	id       string
+	flightID string // the flight, or the flight of the exceedance
+}
+
+// exceedanceTarget targets an exceedance and groups it under its flight
+func exceedanceTarget(exec dbExecutor, exceedanceID string) (notificationTarget, error) {
+	var flightID sql.NullString
+	if err := exec.QueryRow("SELECT flightId FROM Exceedance WHERE id = ?", exceedanceID).Scan(&flightID); err != nil {
+		return notificationTarget{}, err
+	}
+	return notificationTarget{kind: models.NotificationTargetExceedance, id: exceedanceID, flightID: flightID.String}, nil
+}
+
+func subscriptionTarget(subscriptionID string) notificationTarget {
+	return notificationTarget{kind: models.NotificationTargetSubscription, id: subscriptionID}
+}
+
+// apply sets the target fields and link of a notification
+func (t notificationTarget) apply(n *models.Notification) {
+	n.TargetType = t.kind
+	id := t.id
+	switch t.kind {
+	case models.NotificationTargetExceedance:
+		n.ExceedanceID = &id
+	case models.NotificationTargetSubscription:
+		n.SubscriptionID = &id
+	case models.NotificationTargetUser:
+		n.TargetUserID = &id
+	}
+	if t.flightID != "" {
+		flightID := t.flightID
+		n.FlightID = &flightID
+	}
+	n.Link = t.link()
+}
+
+func (t notificationTarget) link() models.NotificationLink {
+	return notificationLink(t.kind, t.id)
+}
+
+// notificationLinkPaths maps target types to their route in the web app
+var notificationLinkPaths = map[string]string{
+	models.NotificationTargetExceedance:   "/exceedances/",
+	models.NotificationTargetFlight:       "/flights/",
+	models.NotificationTargetSubscription: "/subscriptions/",
+	models.NotificationTargetUser:         "/users/",
+}
+
+func notificationLink(kind, id string) models.NotificationLink {
+	path := notificationLinkPaths[kind] + id
+	return models.NotificationLink{Type: kind, ID: id, Path: path, URL: config.GetAppURL() + path}
+}
+
+// targetID returns the id of the record a scanned notification targets
+func targetID(n models.Notification) string {
+	var id *string
+	switch n.TargetType {
+	case models.NotificationTargetExceedance:
+		id = n.ExceedanceID
+	case models.NotificationTargetFlight:
+		id = n.FlightID
+	case models.NotificationTargetSubscription:
+		id = n.SubscriptionID
+	case models.NotificationTargetUser:
+		id = n.TargetUserID
+	}
+	if id == nil {
+		return ""
+	}
+	return *id
+}
+
+// loadNotificationTargets fills the target of each notification, and the
+// flight of exceedance notifications, with one query per target type.
+// Targets deleted since are left empty.
+func loadNotificationTargets(exec dbExecutor, notifications []models.Notification) error {
+	ids := map[string][]string{}
+	add := func(kind string, id *string) {
+		if id != nil && !containsString(ids[kind], *id) {
+			ids[kind] = append(ids[kind], *id)
+		}
+	}
+	for _, n := range notifications {
+		add(models.NotificationTargetExceedance, n.ExceedanceID)
+		add(models.NotificationTargetFlight, n.FlightID)
+		add(models.NotificationTargetSubscription, n.SubscriptionID)
+		add(models.NotificationTargetUser, n.TargetUserID)
+	}
+
+	exceedances, err := loadTargetExceedances(exec, ids[models.NotificationTargetExceedance])
+	if err != nil {
+		return err
+	}
+	flights, err := loadTargetFlights(exec, ids[models.NotificationTargetFlight])
+	if err != nil {
+		return err
+	}
+	subscriptions, err := loadTargetSubscriptions(exec, ids[models.NotificationTargetSubscription])
+	if err != nil {
+		return err
+	}
+	users, err := loadTargetUsers(exec, ids[models.NotificationTargetUser])
+	if err != nil {
+		return err
+	}
+	for i := range notifications {
+		n := &notifications[i]
+		if n.ExceedanceID != nil {
+			n.Exceedance = exceedances[*n.ExceedanceID]
+		}
+		if n.FlightID != nil {
+			n.Flight = flights[*n.FlightID]
+		}
+		if n.SubscriptionID != nil {
+			n.Subscription = subscriptions[*n.SubscriptionID]
+		}
+		if n.TargetUserID != nil {
+			n.TargetUser = users[*n.TargetUserID]
+		}
+	}
+	return nil
+}
+
+func loadTargetExceedances(exec dbExecutor, ids []string) (map[string]*models.Exceedance, error) {
+	found := map[string]*models.Exceedance{}
+	if len(ids) == 0 {
+		return found, nil
+	}
+	rows, err := exec.Query(`SELECT e.id, COALESCE(e.flightPhase, ''), COALESCE(e.parameterName, ''), COALESCE(e.description, ''),
+			COALESCE(e.eventStatus, ''), COALESCE(e.aircraftId, ''), COALESCE(e.flightId, ''), e.eventId, e.exceedanceLevel,
+			e.assigneeId, e.priority, `+sqlEpochMillis("e.createdAt")+`, `+sqlEpochMillis("e.updatedAt")+`, a.registration
+		FROM Exceedance e
+		LEFT JOIN Aircraft a ON e.aircraftId = a.id
+		WHERE e.id IN (`+placeholders(len(ids))+`)`, stringArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e models.Exceedance
+		var createdAt, updatedAt sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.FlightPhase, &e.ParameterName, &e.Description, &e.EventStatus, &e.AircraftID,
+			&e.FlightID, &e.EventID, &e.ExceedanceLevel, &e.AssigneeID, &e.Priority, &createdAt, &updatedAt,
+			&e.AircraftRegistration); err != nil {
+			return nil, err
+		}
+		e.CreatedAt, e.UpdatedAt = time.UnixMilli(createdAt.Int64), time.UnixMilli(updatedAt.Int64)
+		found[e.ID] = &e
+	}
+	return found, rows.Err()
+}
+
+func loadTargetFlights(exec dbExecutor, ids []string) (map[string]*models.CSV, error) {
+	found := map[string]*models.CSV{}
+	if len(ids) == 0 {
+		return found, nil
+	}
+	rows, err := exec.Query(`SELECT id, name, file, status, departure, destination, flightHours, aircraftId,
+			`+sqlEpochMillis("createdAt")+`, `+sqlEpochMillis("updatedAt")+`
+		FROM Csv WHERE id IN (`+placeholders(len(ids))+`)`, stringArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var f models.CSV
+		var createdAt, updatedAt sql.NullInt64
+		if err := rows.Scan(&f.ID, &f.Name, &f.File, &f.Status, &f.Departure, &f.Destination,
+			&f.FlightHours, &f.AircraftID, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		f.CreatedAt, f.UpdatedAt = time.UnixMilli(createdAt.Int64), time.UnixMilli(updatedAt.Int64)
+		found[f.ID] = &f
+	}
+	return found, rows.Err()
+}
+
+func loadTargetSubscriptions(exec dbExecutor, ids []string) (map[string]*models.Subscription, error) {
+	found := map[string]*models.Subscription{}
+	if len(ids) == 0 {
+		return found, nil
+	}
+	rows, err := exec.Query(`SELECT id, planName, planType, maxUsers, maxAircraft, maxFlightsPerMonth, maxStorageGB,
+			price, currency, startDate, endDate, isActive, autoRenew, lastPaymentDate,
+			nextPaymentDate, alertSentAt, createdAt, updatedAt
+		FROM Subscription WHERE id IN (`+placeholders(len(ids))+`)`, stringArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sub models.Subscription
+		if err := rows.Scan(&sub.ID, &sub.PlanName, &sub.PlanType, &sub.MaxUsers, &sub.MaxAircraft,
+			&sub.MaxFlightsPerMonth, &sub.MaxStorageGB, &sub.Price, &sub.Currency,
+			&sub.StartDate, &sub.EndDate, &sub.IsActive, &sub.AutoRenew,
+			&sub.LastPaymentDate, &sub.NextPaymentDate, &sub.AlertSentAt,
+			&sub.CreatedAt, &sub.UpdatedAt); err != nil {
+			return nil, err
+		}
+		found[sub.ID] = &sub
+	}
+	return found, rows.Err()
+}
+
+// loadTargetUsers loads the public fields of users; passwords are never read
+func loadTargetUsers(exec dbExecutor, ids []string) (map[string]*models.User, error) {
+	found := map[string]*models.User{}
+	if len(ids) == 0 {
+		return found, nil
+	}
+	rows, err := exec.Query(`SELECT id, email, role, fullName, designation, department, username, image, isActive, companyId,
+			`+sqlEpochMillis("createdAt")+`, `+sqlEpochMillis("updatedAt")+`
+		FROM User WHERE id IN (`+placeholders(len(ids))+`)`, stringArgs(ids)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u models.User
+		var createdAt, updatedAt sql.NullInt64
+		if err := rows.Scan(&u.ID, &u.Email, &u.Role, &u.FullName, &u.Designation, &u.Department, &u.Username,
+			&u.Image, &u.IsActive, &u.CompanyID, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		u.CreatedAt, u.UpdatedAt = time.UnixMilli(createdAt.Int64), time.UnixMilli(updatedAt.Int64)
+		found[u.ID] = &u
+	}
+	return found, rows.Err()
+}
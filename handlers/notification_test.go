@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fdm-backend/models"
+	"net/http"
+	"testing"
+)
+
+func TestNotificationsAreOwnerOrAdmin(t *testing.T) {
+	gatekeeperBActor := tenantActor{"gatekeeper-b", models.RoleGatekeeper, "company-b"}
+	userBActor := tenantActor{"user-b", models.RoleUser, "company-b"}
+
+	cases := []struct {
+		actor tenantActor
+		want  int
+	}{
+		{gatekeeperBActor, http.StatusOK},
+		{adminActor, http.StatusOK},
+		{userBActor, http.StatusForbidden},
+		{fdaActor, http.StatusForbidden},
+		{gatekeeperAActor, http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		db := newTenantTestDB(t)
+		router := newTenantTestRouter(db, tc.actor)
+		for _, req := range []tenantRequest{
+			{method: http.MethodGet, path: "/api/notifications/user/gatekeeper-b"},
+			{method: http.MethodPut, path: "/api/notifications/notification-b/read"},
+			{method: http.MethodPut, path: "/api/notifications/user/gatekeeper-b/mark-all-read"},
+		} {
+			w := req.serve(router)
+			if w.Code != tc.want {
+				t.Errorf("%s %s %s: status = %d, want %d (body %s)", tc.actor.userID, req.method, req.path, w.Code, tc.want, w.Body)
+			}
+		}
+
+		var isRead bool
+		if err := db.QueryRow("SELECT isRead FROM Notification WHERE id = 'notification-b'").Scan(&isRead); err != nil {
+			t.Fatal(err)
+		}
+		if isRead != (tc.want == http.StatusOK) {
+			t.Errorf("%s: notification read = %v after the requests", tc.actor.userID, isRead)
+		}
+	}
+}
+
+func TestNotificationPreferencesAreOwnerOrAdmin(t *testing.T) {
+	db := newTenantTestDB(t)
+	gatekeeperBActor := tenantActor{"gatekeeper-b", models.RoleGatekeeper, "company-b"}
+	userBActor := tenantActor{"user-b", models.RoleUser, "company-b"}
+
+	cases := []struct {
+		actor tenantActor
+		want  int
+	}{
+		{userBActor, http.StatusOK},
+		{adminActor, http.StatusOK},
+		{gatekeeperBActor, http.StatusForbidden},
+		{fdaActor, http.StatusForbidden},
+		{gatekeeperAActor, http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		router := newTenantTestRouter(db, tc.actor)
+		for _, req := range []tenantRequest{
+			{method: http.MethodGet, path: "/api/notifications/user/user-b/preferences"},
+			{method: http.MethodPut, path: "/api/notifications/user/user-b/preferences", body: `{"defaultMode":"daily"}`},
+		} {
+			w := req.serve(router)
+			if w.Code != tc.want {
+				t.Errorf("%s %s %s: status = %d, want %d (body %s)", tc.actor.userID, req.method, req.path, w.Code, tc.want, w.Body)
+			}
+		}
+	}
+}
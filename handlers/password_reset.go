@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fdm-backend/config"
+	"fdm-backend/mailer"
+	"fdm-backend/models"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordResetTTL      = time.Hour
+	passwordResetThrottle = time.Minute // minimum time between two reset emails to a user
+	minPasswordLength     = 8
+)
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RequestPasswordReset emails a password reset link to an active user. The
+// response is the same whether or not the address belongs to an account.
+func (h *UserHandler) RequestPasswordReset(c *gin.Context) {
+	var req models.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	const message = "If the address belongs to an active account, a password reset link has been sent"
+
+	var userID, email string
+	var fullName sql.NullString
+	err := h.db.QueryRow("SELECT id, email, fullName FROM User WHERE lower(email) = lower(?) AND isActive = 1", req.Email).
+		Scan(&userID, &email, &fullName)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !mailer.Enabled() {
+		log.Printf("Password reset requested for %s but email delivery is disabled", email)
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+
+	now := time.Now()
+	var recent int
+	err = h.db.QueryRow("SELECT COUNT(*) FROM PasswordReset WHERE userId = ? AND createdAt > ?",
+		userID, now.Add(-passwordResetThrottle).UnixMilli()).Scan(&recent)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if recent > 0 {
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating reset token"})
+		return
+	}
+	token := hex.EncodeToString(buf)
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Only the latest link works
+	if _, err := tx.Exec("DELETE FROM PasswordReset WHERE userId = ? AND usedAt IS NULL", userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating reset token"})
+		return
+	}
+	_, err = tx.Exec("INSERT INTO PasswordReset (id, userId, tokenHash, expiresAt, createdAt) VALUES (?, ?, ?, ?, ?)",
+		uuid.New().String(), userID, hashResetToken(token), now.Add(passwordResetTTL).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating reset token"})
+		return
+	}
+	name := fullName.String
+	if name == "" {
+		name = email
+	}
+	data := map[string]interface{}{
+		"Name":      name,
+		"Link":      config.GetAppURL() + "/reset-password?token=" + url.QueryEscape(token),
+		"ExpiresIn": "1 hour",
+	}
+	if _, err := queueEmail(tx, &userID, nil, email, mailer.TemplatePasswordReset, data, now); err != nil {
+		log.Println("Error queueing password reset email:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending reset email"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating reset token"})
+		return
+	}
+	wakeEmailWorker()
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// ResetPassword sets a new password with a reset token and ends every session
+// of the user
+func (h *UserHandler) ResetPassword(c *gin.Context) {
+	var req models.ConfirmPasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(req.Password) < minPasswordLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters"})
+		return
+	}
+
+	now := time.Now()
+	var resetID, userID string
+	err := h.db.QueryRow(`SELECT id, userId FROM PasswordReset
+		WHERE tokenHash = ? AND usedAt IS NULL AND expiresAt > ?`, hashResetToken(req.Token), now.UnixMilli()).
+		Scan(&resetID, &userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error hashing password"})
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Claim the token first so it cannot be used twice
+	result, err := tx.Exec("UPDATE PasswordReset SET usedAt = ? WHERE id = ? AND usedAt IS NULL", now.UnixMilli(), resetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password"})
+		return
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE User SET password = ?, updatedAt = ? WHERE id = ?", string(hashedPassword), now, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password"})
+		return
+	}
+	if _, err := tx.Exec("UPDATE Session SET isActive = 0, updatedAt = ? WHERE userId = ? AND isActive = 1", now.UnixMilli(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error resetting password"})
+		return
+	}
+
+	log.Printf("User %s reset their password", userID)
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in"})
+}
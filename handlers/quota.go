@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/config"
+	"fdm-backend/mailer"
+	"fdm-backend/models"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Subscription quotas limit the users, aircraft, monthly flights and storage
+// of a company. checkQuota is called before an operation adds to a resource
+// and refuses it with QUOTA_EXCEEDED once the limit would be passed, unless
+// an admin has set an override for the company. It is called in the
+// transaction making the addition, which holds the database write lock, so
+// concurrent requests cannot both take the last of a quota. warnQuota is
+// called after the operation and warns the company's gatekeepers as usage
+// crosses the configured percentages. Companies without a subscription are
+// not limited.
+
+const gigabyte = 1 << 30
+
+// quotaLimits are the limits of a company's subscription
+type quotaLimits struct {
+	subscriptionID string
+	planName       string
+	limits         map[string]int64
+}
+
+// loadQuotaLimits returns the limits of a company's subscription, or nil when
+// it has none
+func loadQuotaLimits(exec dbExecutor, companyID string) (*quotaLimits, error) {
+	var q quotaLimits
+	var users, aircraft, flights, storageGB int64
+	err := exec.QueryRow(`SELECT s.id, s.planName, s.maxUsers, s.maxAircraft, s.maxFlightsPerMonth, s.maxStorageGB
+		FROM Company c JOIN Subscription s ON c.subscriptionId = s.id
+		WHERE c.id = ?`, companyID).Scan(&q.subscriptionID, &q.planName, &users, &aircraft, &flights, &storageGB)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	q.limits = map[string]int64{
+		models.QuotaUsers:    users,
+		models.QuotaAircraft: aircraft,
+		models.QuotaFlights:  flights,
+		models.QuotaStorage:  storageGB * gigabyte,
+	}
+	return &q, nil
+}
+
+// quotaPeriod is the calendar month the flight quota counts, in UTC
+func quotaPeriod(now time.Time) (time.Time, string) {
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start, start.Format("2006-01")
+}
+
+// quotaUsed returns how much of a resource a company uses
+func quotaUsed(exec dbExecutor, companyID, resource string, now time.Time) (int64, error) {
+	var used int64
+	var err error
+	switch resource {
+	case models.QuotaUsers:
+		err = exec.QueryRow("SELECT COUNT(*) FROM User WHERE companyId = ? AND isActive = 1", companyID).Scan(&used)
+	case models.QuotaAircraft:
+		err = exec.QueryRow("SELECT COUNT(*) FROM Aircraft WHERE companyId = ?", companyID).Scan(&used)
+	case models.QuotaFlights:
+		start, _ := quotaPeriod(now)
+		err = exec.QueryRow(`SELECT COUNT(*) FROM Csv f JOIN Aircraft a ON f.aircraftId = a.id
+			WHERE a.companyId = ? AND `+sqlEpochMillis("f.createdAt")+` >= ?`, companyID, start.UnixMilli()).Scan(&used)
+	case models.QuotaStorage:
+		if err := fillFlightFileSizes(exec, companyID); err != nil {
+			return 0, err
+		}
+		err = exec.QueryRow(`SELECT
+			(SELECT COALESCE(SUM(f.fileSize), 0) FROM Csv f JOIN Aircraft a ON f.aircraftId = a.id WHERE a.companyId = ?) +
+			(SELECT COALESCE(SUM(at.size), 0) FROM ExceedanceAttachment at
+				JOIN Exceedance e ON at.exceedanceId = e.id JOIN Aircraft a ON e.aircraftId = a.id WHERE a.companyId = ?) +
+			(SELECT COALESCE(SUM(size), 0) FROM Report WHERE companyId = ?)`, companyID, companyID, companyID).Scan(&used)
+	default:
+		err = fmt.Errorf("unknown quota resource %q", resource)
+	}
+	return used, err
+}
+
+// fillFlightFileSizes records the size of flight files uploaded before sizes
+// were stored. Missing files count as empty.
+func fillFlightFileSizes(exec dbExecutor, companyID string) error {
+	rows, err := exec.Query(`SELECT f.id, f.file FROM Csv f JOIN Aircraft a ON f.aircraftId = a.id
+		WHERE a.companyId = ? AND f.fileSize IS NULL`, companyID)
+	if err != nil {
+		return err
+	}
+	files := map[string]string{}
+	for rows.Next() {
+		var id, file string
+		if err := rows.Scan(&id, &file); err == nil {
+			files[id] = file
+		}
+	}
+	rows.Close()
+
+	for id, file := range files {
+		var size int64
+		if info, err := os.Stat(flightFilePath(file)); err == nil {
+			size = info.Size()
+		}
+		if _, err := exec.Exec("UPDATE Csv SET fileSize = ? WHERE id = ?", size, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quotaUsage measures a resource against its limit after adding to it
+func quotaUsage(exec dbExecutor, companyID, resource string, limit, adding int64, now time.Time) (models.QuotaUsage, error) {
+	used, err := quotaUsed(exec, companyID, resource, now)
+	if err != nil {
+		return models.QuotaUsage{}, err
+	}
+	usage := models.QuotaUsage{Resource: resource, Used: used, Limit: limit}
+	if limit <= 0 {
+		usage.Limit = 0
+		return usage, nil
+	}
+	usage.Percent = float64(used) * 100 / float64(limit)
+	usage.Exceeded = used+adding > limit
+	for _, percent := range config.GetQuotaWarningPercents() {
+		if usage.Percent >= float64(percent) && percent > usage.Warning {
+			usage.Warning = percent
+		}
+	}
+	return usage, nil
+}
+
+// activeQuotaOverride returns the company's override when it has one that
+// has not expired
+func activeQuotaOverride(exec dbExecutor, companyID string, now time.Time) (*models.QuotaOverride, error) {
+	o := models.QuotaOverride{CompanyID: companyID}
+	var expiresAt sql.NullInt64
+	var createdAt int64
+	err := exec.QueryRow("SELECT expiresAt, reason, createdBy, createdAt FROM QuotaOverride WHERE companyId = ?", companyID).
+		Scan(&expiresAt, &o.Reason, &o.CreatedBy, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		if expiresAt.Int64 <= now.UnixMilli() {
+			return nil, nil
+		}
+		t := time.UnixMilli(expiresAt.Int64)
+		o.ExpiresAt = &t
+	}
+	o.CreatedAt = time.UnixMilli(createdAt)
+	return &o, nil
+}
+
+// checkQuota reports whether a company may add to a resource, writing a
+// QUOTA_EXCEEDED error response when it may not
+func checkQuota(c *gin.Context, exec dbExecutor, companyID, resource string, adding int64) bool {
+	if companyID == "" {
+		return true
+	}
+	now := time.Now()
+	limits, err := loadQuotaLimits(exec, companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking subscription quota"})
+		return false
+	}
+	if limits == nil || limits.limits[resource] <= 0 {
+		return true
+	}
+	usage, err := quotaUsage(exec, companyID, resource, limits.limits[resource], adding, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking subscription quota"})
+		return false
+	}
+	if !usage.Exceeded {
+		return true
+	}
+	override, err := activeQuotaOverride(exec, companyID, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking subscription quota"})
+		return false
+	}
+	if override != nil {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Subscription " + resource + " quota exceeded",
+		"code":    "QUOTA_EXCEEDED",
+		"message": fmt.Sprintf("The %s subscription allows %s %s and %s are in use. Contact your account manager to upgrade.", limits.planName, formatQuota(resource, usage.Limit), quotaUnits[resource], formatQuota(resource, usage.Used)),
+		"quota":   usage,
+	})
+	return false
+}
+
+// quotaUnits describes what each quota limits
+var quotaUnits = map[string]string{
+	models.QuotaUsers:    "active users",
+	models.QuotaAircraft: "aircraft",
+	models.QuotaFlights:  "flight uploads a month",
+	models.QuotaStorage:  "of storage",
+}
+
+// formatQuota formats an amount of a resource, storage in GB
+func formatQuota(resource string, amount int64) string {
+	if resource == models.QuotaStorage {
+		return fmt.Sprintf("%.1f GB", float64(amount)/gigabyte)
+	}
+	return fmt.Sprintf("%d", amount)
+}
+
+// warnQuota is called once an operation added to a resource. When usage has
+// reached a warning percentage it sets the X-Quota-Warning header and, the
+// first time that month, notifies the company's active gatekeepers in the app
+// and by email. Failures are logged; the operation already succeeded.
+func warnQuota(c *gin.Context, db *sql.DB, companyID, resource string) {
+	if companyID == "" {
+		return
+	}
+	now := time.Now()
+	limits, err := loadQuotaLimits(db, companyID)
+	if err != nil || limits == nil {
+		return
+	}
+	usage, err := quotaUsage(db, companyID, resource, limits.limits[resource], 0, now)
+	if err != nil {
+		log.Printf("Error measuring %s quota of company %s: %v", resource, companyID, err)
+		return
+	}
+	if usage.Warning == 0 {
+		return
+	}
+	c.Header("X-Quota-Warning", fmt.Sprintf("%s %.0f%%", resource, usage.Percent))
+
+	_, period := quotaPeriod(now)
+	result, err := db.Exec("INSERT OR IGNORE INTO QuotaWarning (companyId, resource, threshold, period, createdAt) VALUES (?, ?, ?, ?, ?)",
+		companyID, resource, usage.Warning, period, now.UnixMilli())
+	if err != nil {
+		log.Printf("Error recording %s quota warning of company %s: %v", resource, companyID, err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return
+	}
+	if err := sendQuotaWarning(db, companyID, limits, usage, now); err != nil {
+		log.Printf("Error sending %s quota warning to company %s: %v", resource, companyID, err)
+	}
+	wakeEmailWorker()
+}
+
+func sendQuotaWarning(db *sql.DB, companyID string, limits *quotaLimits, usage models.QuotaUsage, now time.Time) error {
+	var companyName string
+	if err := db.QueryRow("SELECT name FROM Company WHERE id = ?", companyID).Scan(&companyName); err != nil {
+		return err
+	}
+	rows, err := db.Query("SELECT id FROM User WHERE companyId = ? AND role = ? AND isActive = 1", companyID, models.RoleGatekeeper)
+	if err != nil {
+		return err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	rows.Close()
+
+	target := subscriptionTarget(limits.subscriptionID)
+	percent := fmt.Sprintf("%.0f", usage.Percent)
+	message := fmt.Sprintf("%s has used %s%% of its %s quota (%s of %s)", companyName, percent, usage.Resource,
+		formatQuota(usage.Resource, usage.Used), formatQuota(usage.Resource, usage.Limit))
+	data := map[string]interface{}{
+		"Company":  companyName,
+		"Resource": usage.Resource,
+		"Percent":  percent,
+		"Used":     formatQuota(usage.Resource, usage.Used),
+		"Limit":    formatQuota(usage.Resource, usage.Limit),
+		"Link":     target.link().URL,
+	}
+	for _, userID := range userIDs {
+		if _, err := createNotification(db, userID, target, message, "quota", now); err != nil {
+			return err
+		}
+		if err := queueUserEmail(db, userID, nil, mailer.TemplateQuotaWarning, data, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCompanyQuota returns a company's usage of each quota of its subscription
+func (h *SubscriptionHandler) GetCompanyQuota(c *gin.Context) {
+	companyID := c.Param("id")
+	if !companyResource.authorize(c, h.db, companyID) {
+		return
+	}
+
+	now := time.Now()
+	_, period := quotaPeriod(now)
+	quota := models.CompanyQuota{CompanyID: companyID, Period: period, Quotas: []models.QuotaUsage{}}
+	limits, err := loadQuotaLimits(h.db, companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if limits != nil {
+		quota.SubscriptionID, quota.PlanName = &limits.subscriptionID, &limits.planName
+	}
+	for _, resource := range models.QuotaResources {
+		var limit int64
+		if limits != nil {
+			limit = limits.limits[resource]
+		}
+		usage, err := quotaUsage(h.db, companyID, resource, limit, 0, now)
+		if err != nil {
+			log.Println("Error measuring quota:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		usage.Exceeded = usage.Limit > 0 && usage.Used > usage.Limit
+		quota.Quotas = append(quota.Quotas, usage)
+	}
+	if quota.Override, err = activeQuotaOverride(h.db, companyID, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, quota)
+}
+
+// SetQuotaOverride lets a company exceed its quotas, until expiresAt when
+// given. It replaces any override the company has.
+func (h *SubscriptionHandler) SetQuotaOverride(c *gin.Context) {
+	companyID := c.Param("id")
+	if !companyResource.authorize(c, h.db, companyID) {
+		return
+	}
+	var req models.QuotaOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expiresAt must be in the future"})
+		return
+	}
+
+	userID := c.GetString("userId")
+	override := models.QuotaOverride{CompanyID: companyID, ExpiresAt: req.ExpiresAt, Reason: req.Reason, CreatedBy: &userID, CreatedAt: now}
+	var expiresAt interface{}
+	if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt.UnixMilli()
+	}
+	_, err := h.db.Exec(`INSERT INTO QuotaOverride (companyId, expiresAt, reason, createdBy, createdAt) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(companyId) DO UPDATE SET expiresAt = excluded.expiresAt, reason = excluded.reason,
+			createdBy = excluded.createdBy, createdAt = excluded.createdAt`,
+		companyID, expiresAt, req.Reason, userID, now.UnixMilli())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving quota override"})
+		return
+	}
+	c.JSON(http.StatusOK, override)
+}
+
+// DeleteQuotaOverride enforces a company's quotas again
+func (h *SubscriptionHandler) DeleteQuotaOverride(c *gin.Context) {
+	companyID := c.Param("id")
+	if !companyResource.authorize(c, h.db, companyID) {
+		return
+	}
+	result, err := h.db.Exec("DELETE FROM QuotaOverride WHERE companyId = ?", companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing quota override"})
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quota override not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Quota override removed"})
+}
@@ -0,0 +1,573 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fdm-backend/models"
+	"fdm-backend/reports"
+	"fdm-backend/storage"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ReportHandler generates safety reports, keeps them for download and runs
+// the monthly report schedules
+type ReportHandler struct {
+	db *sql.DB
+}
+
+func NewReportHandler(db *sql.DB) *ReportHandler {
+	return &ReportHandler{db: db}
+}
+
+const maxReportDays = 366
+
+const reportColumns = `id, companyId, scheduleId, template, title, format, periodStart, periodEnd,
+	aircraftId, eventCode, size, createdBy, createdAt`
+
+const reportScheduleColumns = `id, companyId, template, formats, aircraftId, eventCode, isActive, lastPeriod,
+	createdBy, createdAt, updatedAt`
+
+func scanReport(row interface{ Scan(...interface{}) error }) (models.Report, error) {
+	var r models.Report
+	var periodStart, periodEnd, createdAt int64
+	err := row.Scan(&r.ID, &r.CompanyID, &r.ScheduleID, &r.Template, &r.Title, &r.Format, &periodStart, &periodEnd,
+		&r.AircraftID, &r.EventCode, &r.Size, &r.CreatedBy, &createdAt)
+	if err != nil {
+		return r, err
+	}
+	r.PeriodStart = time.UnixMilli(periodStart).UTC()
+	r.PeriodEnd = time.UnixMilli(periodEnd).UTC()
+	r.CreatedAt = time.UnixMilli(createdAt)
+	return r, nil
+}
+
+func scanReportSchedule(row interface{ Scan(...interface{}) error }) (models.ReportSchedule, error) {
+	var s models.ReportSchedule
+	var formats string
+	var createdAt, updatedAt int64
+	err := row.Scan(&s.ID, &s.CompanyID, &s.Template, &formats, &s.AircraftID, &s.EventCode, &s.IsActive,
+		&s.LastPeriod, &s.CreatedBy, &createdAt, &updatedAt)
+	if err != nil {
+		return s, err
+	}
+	json.Unmarshal([]byte(formats), &s.Formats)
+	if s.Formats == nil {
+		s.Formats = []string{}
+	}
+	s.CreatedAt = time.UnixMilli(createdAt)
+	s.UpdatedAt = time.UnixMilli(updatedAt)
+	return s, nil
+}
+
+// validateReportOptions checks the template, formats and the optional aircraft
+// of a report or schedule
+func validateReportOptions(exec dbExecutor, companyID, template string, formats []string, aircraftID *string) error {
+	if !containsString(models.ReportTemplates, template) {
+		return errors.New("template must be one of " + strings.Join(models.ReportTemplates, ", "))
+	}
+	if len(formats) == 0 {
+		return errors.New("at least one format is required")
+	}
+	for _, format := range formats {
+		if !reports.IsFormat(format) {
+			return errors.New("format must be pdf or xlsx")
+		}
+	}
+	if aircraftID != nil {
+		owner, err := aircraftResource.companyID(exec, *aircraftID)
+		if err == sql.ErrNoRows || (err == nil && (!owner.Valid || owner.String != companyID)) {
+			return errors.New("Aircraft not found")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emptyToNil drops blank optional strings
+func emptyToNil(s *string) *string {
+	if s == nil || strings.TrimSpace(*s) == "" {
+		return nil
+	}
+	v := strings.TrimSpace(*s)
+	return &v
+}
+
+// previousMonth returns the calendar month before now, in UTC
+func previousMonth(now time.Time) (time.Time, time.Time) {
+	end := time.Date(now.UTC().Year(), now.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	return end.AddDate(0, -1, 0), end
+}
+
+// generateReports renders spec once per format, stores the files and records
+// them in one transaction. A report generated for a schedule also marks its
+// period as done in that transaction. The stored files are deleted again when
+// anything fails.
+func generateReports(db *sql.DB, spec reportSpec, formats []string, scheduleID, userID *string, now time.Time) ([]models.Report, error) {
+	doc, err := buildReport(db, spec, now)
+	if err != nil {
+		return nil, err
+	}
+
+	generated := []models.Report{}
+	var keys []string
+	recorded := false
+	defer func() {
+		if !recorded {
+			removeStoredFiles(keys)
+		}
+	}()
+	for _, format := range formats {
+		data, err := reports.Render(doc, format)
+		if err != nil {
+			return nil, err
+		}
+		r := models.Report{
+			ID:          uuid.New().String(),
+			CompanyID:   spec.companyID,
+			ScheduleID:  scheduleID,
+			Template:    spec.template,
+			Title:       doc.Title,
+			Format:      format,
+			PeriodStart: spec.from,
+			PeriodEnd:   spec.to,
+			AircraftID:  spec.aircraftID,
+			EventCode:   spec.eventCode,
+			Size:        int64(len(data)),
+			CreatedBy:   userID,
+			CreatedAt:   now,
+		}
+		key := "reports/" + spec.companyID + "/" + r.ID + "." + format
+		if _, err := storage.Default().Save(key, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		generated = append(generated, r)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for i, r := range generated {
+		_, err = tx.Exec(`INSERT INTO Report (`+reportColumns+`, storageKey)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			r.ID, r.CompanyID, r.ScheduleID, r.Template, r.Title, r.Format, r.PeriodStart.UnixMilli(), r.PeriodEnd.UnixMilli(),
+			r.AircraftID, r.EventCode, r.Size, r.CreatedBy, now.UnixMilli(), keys[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if scheduleID != nil {
+		_, err := tx.Exec("UPDATE ReportSchedule SET lastPeriod = ? WHERE id = ?", spec.from.Format("2006-01"), *scheduleID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	recorded = true
+	return generated, nil
+}
+
+// GetReportTemplates lists the report templates and formats
+func (h *ReportHandler) GetReportTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"templates": models.ReportTemplates,
+		"formats":   []string{reports.FormatPDF, reports.FormatXLSX},
+	})
+}
+
+// GetReports lists the company's generated reports, newest first
+//
+//	?company=<id>&template=monthly_summary&format=pdf&schedule=<id>
+func (h *ReportHandler) GetReports(c *gin.Context) {
+	condition, args := tenantOf(c).condition("companyId")
+	for param, column := range map[string]string{
+		"company":  "companyId",
+		"template": "template",
+		"format":   "format",
+		"schedule": "scheduleId",
+	} {
+		if v := strings.TrimSpace(c.Query(param)); v != "" {
+			condition += " AND " + column + " = ?"
+			args = append(args, v)
+		}
+	}
+
+	rows, err := h.db.Query("SELECT "+reportColumns+" FROM Report WHERE "+condition+" ORDER BY createdAt DESC", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Report{}
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			log.Println("Error scanning report:", err)
+			continue
+		}
+		list = append(list, r)
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// GetReportByID returns a single report
+func (h *ReportHandler) GetReportByID(c *gin.Context) {
+	id := c.Param("id")
+	if !reportResource.authorize(c, h.db, id) {
+		return
+	}
+
+	r, err := scanReport(h.db.QueryRow("SELECT "+reportColumns+" FROM Report WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, r)
+}
+
+// GenerateReport renders a report now, once per requested format
+func (h *ReportHandler) GenerateReport(c *gin.Context) {
+	var req models.GenerateReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	companyID, ok := requestedCompany(c, h.db, req.CompanyID)
+	if !ok {
+		return
+	}
+
+	formats := cleanList(req.Formats, true)
+	if req.Formats == nil {
+		formats = []string{reports.FormatPDF}
+	}
+	spec := reportSpec{
+		companyID:  companyID,
+		template:   req.Template,
+		aircraftID: emptyToNil(req.AircraftID),
+		eventCode:  emptyToNil(req.EventCode),
+	}
+	if err := validateReportOptions(h.db, companyID, spec.template, formats, spec.aircraftID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case req.Month != nil && (req.From != nil || req.To != nil):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "give either month or from and to"})
+		return
+	case req.From != nil || req.To != nil:
+		if req.From == nil || req.To == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are both required"})
+			return
+		}
+		from, err := parseDateParam(*req.From, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+			return
+		}
+		to, err := parseDateParam(*req.To, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+			return
+		}
+		spec.from, spec.to = from.UTC(), to.UTC().Add(time.Millisecond)
+		if !spec.to.After(spec.from) || spec.to.Sub(spec.from) > maxReportDays*24*time.Hour {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the period must end after it starts and span at most 366 days"})
+			return
+		}
+	case req.Month != nil:
+		month, err := time.Parse("2006-01", strings.TrimSpace(*req.Month))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "month must be YYYY-MM"})
+			return
+		}
+		spec.from, spec.to, spec.monthly = month, month.AddDate(0, 1, 0), true
+	default:
+		spec.from, spec.to = previousMonth(now)
+		spec.monthly = true
+	}
+
+	userID := c.GetString("userId")
+	generated, err := generateReports(h.db, spec, formats, nil, &userID, now)
+	if err != nil {
+		log.Println("Error generating report:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating report"})
+		return
+	}
+	c.JSON(http.StatusCreated, generated)
+}
+
+// DownloadReport streams a stored report file
+func (h *ReportHandler) DownloadReport(c *gin.Context) {
+	id := c.Param("id")
+	if !reportResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var key, format, title string
+	var periodStart int64
+	err := h.db.QueryRow("SELECT storageKey, format, title, periodStart FROM Report WHERE id = ?", id).
+		Scan(&key, &format, &title, &periodStart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	reader, err := storage.Default().Open(key)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report file not found"})
+		return
+	}
+	defer reader.Close()
+
+	filename := strings.Map(func(r rune) rune {
+		if r == '"' || r == '/' || r == '\\' || r < 32 {
+			return '_'
+		}
+		return r
+	}, title) + " " + time.UnixMilli(periodStart).UTC().Format("2006-01") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", reports.ContentType(format))
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, reader)
+}
+
+// DeleteReport removes a report and its file
+func (h *ReportHandler) DeleteReport(c *gin.Context) {
+	id := c.Param("id")
+	if !reportResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var key string
+	if err := h.db.QueryRow("SELECT storageKey FROM Report WHERE id = ?", id).Scan(&key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if _, err := h.db.Exec("DELETE FROM Report WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting report"})
+		return
+	}
+	if err := storage.Default().Delete(key); err != nil {
+		log.Printf("Warning: Failed to delete report file %s: %v", key, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report deleted successfully"})
+}
+
+// GetReportSchedules lists the company's report schedules
+func (h *ReportHandler) GetReportSchedules(c *gin.Context) {
+	condition, args := tenantOf(c).condition("companyId")
+	if v := strings.TrimSpace(c.Query("company")); v != "" {
+		condition += " AND companyId = ?"
+		args = append(args, v)
+	}
+
+	rows, err := h.db.Query("SELECT "+reportScheduleColumns+" FROM ReportSchedule WHERE "+condition+" ORDER BY createdAt", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	schedules := []models.ReportSchedule{}
+	for rows.Next() {
+		s, err := scanReportSchedule(rows)
+		if err != nil {
+			log.Println("Error scanning report schedule:", err)
+			continue
+		}
+		schedules = append(schedules, s)
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// CreateReportSchedule schedules a monthly report. The previous month's report
+// is generated at the next check, then at the start of every month.
+func (h *ReportHandler) CreateReportSchedule(c *gin.Context) {
+	var req models.ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	companyID, ok := requestedCompany(c, h.db, req.CompanyID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	userID := c.GetString("userId")
+	s := models.ReportSchedule{
+		ID:        uuid.New().String(),
+		CompanyID: companyID,
+		Template:  models.ReportTemplateMonthlySummary,
+		Formats:   []string{reports.FormatPDF},
+		IsActive:  true,
+		CreatedBy: &userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	applyReportScheduleRequest(&s, req)
+	if err := validateReportOptions(h.db, companyID, s.Template, s.Formats, s.AircraftID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.db.Exec(`INSERT INTO ReportSchedule (`+reportScheduleColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.CompanyID, s.Template, jsonText(s.Formats), s.AircraftID, s.EventCode, s.IsActive, s.LastPeriod,
+		s.CreatedBy, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating report schedule"})
+		return
+	}
+	c.JSON(http.StatusCreated, s)
+}
+
+// applyReportScheduleRequest copies the fields present in req onto s
+func applyReportScheduleRequest(s *models.ReportSchedule, req models.ReportScheduleRequest) {
+	if req.Template != nil {
+		s.Template = *req.Template
+	}
+	if req.Formats != nil {
+		s.Formats = cleanList(req.Formats, true)
+	}
+	if req.AircraftID != nil {
+		s.AircraftID = emptyToNil(req.AircraftID)
+	}
+	if req.EventCode != nil {
+		s.EventCode = emptyToNil(req.EventCode)
+	}
+	if req.IsActive != nil {
+		s.IsActive = *req.IsActive
+	}
+}
+
+// UpdateReportSchedule changes a report schedule
+func (h *ReportHandler) UpdateReportSchedule(c *gin.Context) {
+	id := c.Param("id")
+	if !reportScheduleResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var req models.ReportScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s, err := scanReportSchedule(h.db.QueryRow("SELECT "+reportScheduleColumns+" FROM ReportSchedule WHERE id = ?", id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.CompanyID != nil && *req.CompanyID != s.CompanyID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "companyId cannot be changed"})
+		return
+	}
+	applyReportScheduleRequest(&s, req)
+	if err := validateReportOptions(h.db, s.CompanyID, s.Template, s.Formats, s.AircraftID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	s.UpdatedAt = now
+	_, err = h.db.Exec(`UPDATE ReportSchedule SET template = ?, formats = ?, aircraftId = ?, eventCode = ?, isActive = ?, updatedAt = ?
+		WHERE id = ?`,
+		s.Template, jsonText(s.Formats), s.AircraftID, s.EventCode, s.IsActive, now.UnixMilli(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating report schedule"})
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// DeleteReportSchedule stops a schedule. Reports it generated are kept.
+func (h *ReportHandler) DeleteReportSchedule(c *gin.Context) {
+	id := c.Param("id")
+	if !reportScheduleResource.authorize(c, h.db, id) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE Report SET scheduleId = NULL WHERE scheduleId = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting report schedule"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM ReportSchedule WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting report schedule"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting report schedule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report schedule deleted successfully"})
+}
+
+// runDueSchedules generates the previous month's report of every active
+// schedule that does not have it yet, for the report_schedules job. It returns
+// how many schedules were generated and how many failed.
+func (h *ReportHandler) runDueSchedules(now time.Time) (int, int, error) {
+	from, to := previousMonth(now)
+	period := from.Format("2006-01")
+
+	rows, err := h.db.Query("SELECT "+reportScheduleColumns+` FROM ReportSchedule
+		WHERE isActive = 1 AND (lastPeriod IS NULL OR lastPeriod < ?)`, period)
+	if err != nil {
+		return 0, 0, err
+	}
+	var due []models.ReportSchedule
+	for rows.Next() {
+		if s, err := scanReportSchedule(rows); err == nil {
+			due = append(due, s)
+		}
+	}
+	rows.Close()
+
+	generated, failed := 0, 0
+	for _, s := range due {
+		spec := reportSpec{
+			companyID:  s.CompanyID,
+			template:   s.Template,
+			aircraftID: s.AircraftID,
+			eventCode:  s.EventCode,
+			from:       from,
+			to:         to,
+			monthly:    true,
+		}
+		if _, err := generateReports(h.db, spec, s.Formats, &s.ID, nil, now); err != nil {
+			log.Printf("Error generating scheduled report %s: %v", s.ID, err)
+			failed++
+			continue
+		}
+		generated++
+	}
+	return generated, failed, nil
+}
@@ -0,0 +1,505 @@
+package handlers
+
+import (
+	"fdm-backend/config"
+	"fdm-backend/models"
+	"fdm-backend/reports"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Report templates turn a company's flights and exceedances over a period into
+// a reports.Document. Flights and their exceedances count in the period the
+// flight was uploaded, as in the analytics endpoints.
+
+const maxReportRows = 1000 // exceedances listed per section
+
+// reportSpec is what a report covers
+type reportSpec struct {
+	companyID  string
+	template   string
+	aircraftID *string
+	eventCode  *string
+	from, to   time.Time // to is exclusive
+	monthly    bool      // the period is a calendar month
+}
+
+// reportFlight and reportEvent are the rows templates aggregate
+type reportFlight struct {
+	aircraftID, aircraft, aircraftType string
+}
+
+type reportEvent struct {
+	createdAt                   time.Time
+	flightID, flightName, route string
+	aircraftID                  string
+	eventCode, eventName        string
+	severity, phase, status     string
+}
+
+// reportData holds the flights and exceedances of a period
+type reportData struct {
+	flights  []reportFlight
+	events   []reportEvent
+	aircraft map[string]reportFlight // by aircraft id
+}
+
+func loadReportData(exec dbExecutor, spec reportSpec) (*reportData, error) {
+	where := " WHERE a.companyId = ? AND " + sqlEpochMillis("f.createdAt") + " >= ? AND " + sqlEpochMillis("f.createdAt") + " < ?"
+	args := []interface{}{spec.companyID, spec.from.UnixMilli(), spec.to.UnixMilli()}
+	if spec.aircraftID != nil {
+		where += " AND f.aircraftId = ?"
+		args = append(args, *spec.aircraftID)
+	}
+
+	data := &reportData{aircraft: map[string]reportFlight{}}
+	rows, err := exec.Query(`SELECT f.aircraftId, COALESCE(a.registration, a.serialNumber, f.aircraftId),
+			TRIM(COALESCE(a.aircraftMake, '') || ' ' || COALESCE(a.modelNumber, ''))
+		FROM Csv f
+		JOIN Aircraft a ON f.aircraftId = a.id`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var f reportFlight
+		if err := rows.Scan(&f.aircraftID, &f.aircraft, &f.aircraftType); err != nil {
+			continue
+		}
+		data.flights = append(data.flights, f)
+		data.aircraft[f.aircraftID] = f
+	}
+	rows.Close()
+
+	if spec.eventCode != nil {
+		where += " AND el.eventCode = ?"
+		args = append(args, *spec.eventCode)
+	}
+	rows, err = exec.Query(`SELECT `+sqlEpochMillis("f.createdAt")+`, f.id, COALESCE(f.name, ''), COALESCE(f.departure, ''),
+			COALESCE(f.destination, ''), f.aircraftId, COALESCE(el.eventCode, ''), COALESCE(el.displayName, e.description, ''),
+			lower(COALESCE(NULLIF(e.exceedanceLevel, ''), 'unknown')), COALESCE(e.flightPhase, ''), COALESCE(e.eventStatus, '')
+		FROM Exceedance e
+		JOIN Csv f ON e.flightId = f.id
+		JOIN Aircraft a ON f.aircraftId = a.id
+		LEFT JOIN EventLog el ON e.eventId = el.id`+where+`
+		ORDER BY 1, e.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e reportEvent
+		var createdAt int64
+		var departure, destination string
+		err := rows.Scan(&createdAt, &e.flightID, &e.flightName, &departure, &destination, &e.aircraftID,
+			&e.eventCode, &e.eventName, &e.severity, &e.phase, &e.status)
+		if err != nil {
+			continue
+		}
+		e.createdAt = time.UnixMilli(createdAt).UTC()
+		e.route = routeKey(departure, destination)
+		if e.eventCode == "" {
+			e.eventCode = "Unknown"
+		}
+		data.events = append(data.events, e)
+	}
+	return data, rows.Err()
+}
+
+// buildReport renders the template of spec into a document
+func buildReport(exec dbExecutor, spec reportSpec, now time.Time) (reports.Document, error) {
+	var companyName string
+	if err := exec.QueryRow("SELECT name FROM Company WHERE id = ?", spec.companyID).Scan(&companyName); err != nil {
+		return reports.Document{}, err
+	}
+	data, err := loadReportData(exec, spec)
+	if err != nil {
+		return reports.Document{}, err
+	}
+
+	doc := reports.Document{
+		Subtitle: reportPeriodLabel(spec) + " | generated " + now.UTC().Format("2 Jan 2006 15:04") + " UTC",
+	}
+	switch spec.template {
+	case models.ReportTemplateMonthlySummary:
+		doc.Title = companyName + " - FDM summary"
+		previous := spec
+		previous.to = spec.from
+		previous.from = spec.from.Add(-spec.to.Sub(spec.from))
+		if spec.monthly {
+			previous.from = spec.from.AddDate(0, -1, 0)
+		}
+		previousData, err := loadReportData(exec, previous)
+		if err != nil {
+			return reports.Document{}, err
+		}
+		peers, err := reportPeerComparison(exec, spec)
+		if err != nil {
+			return reports.Document{}, err
+		}
+		doc.Sections = summarySections(data, previousData, peers)
+	case models.ReportTemplateAircraft:
+		doc.Title = companyName + " - Aircraft exceedance report"
+		if spec.aircraftID != nil {
+			if _, ok := data.aircraft[*spec.aircraftID]; !ok {
+				// Still name the aircraft when it did not fly
+				var f reportFlight
+				err := exec.QueryRow(`SELECT id, COALESCE(registration, serialNumber, id),
+					TRIM(COALESCE(aircraftMake, '') || ' ' || COALESCE(modelNumber, '')) FROM Aircraft WHERE id = ?`,
+					*spec.aircraftID).Scan(&f.aircraftID, &f.aircraft, &f.aircraftType)
+				if err != nil {
+					return reports.Document{}, err
+				}
+				data.aircraft[f.aircraftID] = f
+			}
+		}
+		doc.Sections = aircraftSections(data)
+	case models.ReportTemplateEvent:
+		doc.Title = companyName + " - Event exceedance report"
+		doc.Sections = eventSections(data)
+	default:
+		return reports.Document{}, fmt.Errorf("unknown template %q", spec.template)
+	}
+	return doc, nil
+}
+
+func reportPeriodLabel(spec reportSpec) string {
+	if spec.monthly {
+		return spec.from.Format("January 2006")
+	}
+	return spec.from.Format("2 Jan 2006") + " - " + spec.to.Add(-time.Millisecond).Format("2 Jan 2006")
+}
+
+func countSeverities(events []reportEvent) map[string]int {
+	counts := map[string]int{}
+	for _, e := range events {
+		counts[e.severity]++
+	}
+	return counts
+}
+
+// sortedSeverities orders severities from most to least severe
+func sortedSeverities(counts map[string]int) []string {
+	severities := make([]string, 0, len(counts))
+	for s := range counts {
+		severities = append(severities, s)
+	}
+	sort.Slice(severities, func(i, j int) bool {
+		if wi, wj := severityWeight(severities[i]), severityWeight(severities[j]); wi != wj {
+			return wi > wj
+		}
+		return severities[i] < severities[j]
+	})
+	return severities
+}
+
+func optionalNumber(v *float64) interface{} {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
+
+func summarySections(data, previous *reportData, peers models.BenchmarkComparison) []reports.Section {
+	flights, events := len(data.flights), len(data.events)
+	prevFlights, prevEvents := len(previous.flights), len(previous.events)
+	severe := func(d *reportData) int {
+		n := 0
+		for _, e := range d.events {
+			if severityWeight(e.severity) >= 3 {
+				n++
+			}
+		}
+		return n
+	}
+
+	overview := &reports.Table{Columns: []string{"Metric", "This period", "Previous period", "Change %"}}
+	change := func(previous, current float64) interface{} {
+		return optionalNumber(changePercent(previous, current))
+	}
+	overview.AddRow("Flights", flights, prevFlights, change(float64(prevFlights), float64(flights)))
+	overview.AddRow("Exceedances", events, prevEvents, change(float64(prevEvents), float64(events)))
+	rate, prevRate := eventRate(events, flights), eventRate(prevEvents, prevFlights)
+	overview.AddRow("Rate per 1,000 flights", rate, prevRate, change(prevRate, rate))
+	overview.AddRow("High and critical exceedances", severe(data), severe(previous),
+		change(float64(severe(previous)), float64(severe(data))))
+
+	severities := &reports.Table{Columns: []string{"Severity", "Exceedances", "Rate per 1,000 flights", "Share %"}}
+	counts := countSeverities(data.events)
+	for _, s := range sortedSeverities(counts) {
+		severities.AddRow(s, counts[s], eventRate(counts[s], flights), round2(float64(counts[s])*100/float64(events)))
+	}
+
+	// Top events by count
+	type eventCount struct {
+		code, name string
+		count      int
+	}
+	byCode := map[string]*eventCount{}
+	for _, e := range data.events {
+		if byCode[e.eventCode] == nil {
+			byCode[e.eventCode] = &eventCount{code: e.eventCode, name: e.eventName}
+		}
+		byCode[e.eventCode].count++
+	}
+	codes := make([]*eventCount, 0, len(byCode))
+	for _, ec := range byCode {
+		codes = append(codes, ec)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if codes[i].count != codes[j].count {
+			return codes[i].count > codes[j].count
+		}
+		return codes[i].code < codes[j].code
+	})
+	if len(codes) > 15 {
+		codes = codes[:15]
+	}
+	topEvents := &reports.Table{Columns: []string{"Event code", "Event", "Exceedances", "Rate per 1,000 flights"}}
+	for _, ec := range codes {
+		topEvents.AddRow(ec.code, ec.name, ec.count, eventRate(ec.count, flights))
+	}
+
+	aircraft := &reports.Table{Columns: []string{"Aircraft", "Type", "Flights", "Exceedances", "Rate per 1,000 flights"}}
+	aircraftFlights, aircraftEvents := map[string]int{}, map[string]int{}
+	for _, f := range data.flights {
+		aircraftFlights[f.aircraftID]++
+	}
+	for _, e := range data.events {
+		aircraftEvents[e.aircraftID]++
+	}
+	ids := make([]string, 0, len(aircraftFlights))
+	for id := range aircraftFlights {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ri := eventRate(aircraftEvents[ids[i]], aircraftFlights[ids[i]])
+		rj := eventRate(aircraftEvents[ids[j]], aircraftFlights[ids[j]])
+		if ri != rj {
+			return ri > rj
+		}
+		return data.aircraft[ids[i]].aircraft < data.aircraft[ids[j]].aircraft
+	})
+	for _, id := range ids {
+		a := data.aircraft[id]
+		aircraft.AddRow(a.aircraft, a.aircraftType, aircraftFlights[id], aircraftEvents[id],
+			eventRate(aircraftEvents[id], aircraftFlights[id]))
+	}
+
+	statuses := &reports.Table{Columns: []string{"Review status", "Exceedances"}}
+	statusCounts := map[string]int{}
+	for _, e := range data.events {
+		statusCounts[e.status]++
+	}
+	for _, s := range models.ExceedanceStatuses {
+		if statusCounts[s] > 0 {
+			statuses.AddRow(s, statusCounts[s])
+			delete(statusCounts, s)
+		}
+	}
+	others := make([]string, 0, len(statusCounts))
+	for s := range statusCounts {
+		others = append(others, s)
+	}
+	sort.Strings(others)
+	for _, s := range others {
+		statuses.AddRow(s, statusCounts[s])
+	}
+
+	comparison := reports.Section{Heading: "Industry comparison"}
+	if peers.Peers.Suppressed {
+		comparison.Paragraphs = []string{fmt.Sprintf(
+			"Too few other operators flew in this period to compare anonymously (at least %d are needed).",
+			config.GetBenchmarkMinGroupSize())}
+	} else {
+		comparison.Paragraphs = []string{"Exceedance rates per 1,000 flights of other operators, who are not named."}
+		table := &reports.Table{Columns: []string{"Metric", "Value"}}
+		table.AddRow("Company rate", peers.Company.Rate)
+		table.AddRow("Peer operators", peers.Peers.Operators)
+		table.AddRow("Peer mean", optionalNumber(peers.Peers.Mean))
+		for _, p := range []string{"p25", "p50", "p75", "p90"} {
+			table.AddRow("Peer "+p, peers.Peers.Percentiles[p])
+		}
+		table.AddRow("Share of peers with a lower rate %", optionalNumber(peers.PercentileRank))
+		comparison.Table = table
+	}
+
+	return []reports.Section{
+		{Heading: "Overview", Table: overview},
+		{Heading: "Exceedances by severity", Table: severities},
+		{Heading: "Top events", Table: topEvents},
+		{Heading: "Aircraft", Table: aircraft},
+		{Heading: "Review status", Table: statuses},
+		comparison,
+	}
+}
+
+// reportPeerComparison compares the company's rate with other operators in the
+// period, with the same anonymity rules as GET /api/analytics/benchmarks
+func reportPeerComparison(exec dbExecutor, spec reportSpec) (models.BenchmarkComparison, error) {
+	where := " WHERE a.companyId IS NOT NULL AND " + sqlEpochMillis("f.createdAt") + " >= ? AND " + sqlEpochMillis("f.createdAt") + " < ?"
+	args := []interface{}{spec.from.UnixMilli(), spec.to.UnixMilli()}
+
+	group := benchmarkGroup{}
+	for _, query := range []string{
+		`SELECT a.companyId, COUNT(*), 0 FROM Csv f JOIN Aircraft a ON f.aircraftId = a.id` + where + ` GROUP BY 1`,
+		`SELECT a.companyId, 0, COUNT(*) FROM Exceedance e JOIN Csv f ON e.flightId = f.id
+			JOIN Aircraft a ON f.aircraftId = a.id` + where + ` GROUP BY 1`,
+	} {
+		rows, err := exec.Query(query, args...)
+		if err != nil {
+			return models.BenchmarkComparison{}, err
+		}
+		for rows.Next() {
+			var operator string
+			var flights, events int
+			if err := rows.Scan(&operator, &flights, &events); err == nil {
+				group.add(operator, flights, events)
+			}
+		}
+		rows.Close()
+	}
+
+	var noise *benchmarkNoise
+	if epsilon := config.GetBenchmarkEpsilon(); epsilon > 0 {
+		noise = &benchmarkNoise{epsilon: epsilon}
+	}
+	return compareWithPeers("overall", spec.companyID, group, config.GetBenchmarkMinGroupSize(), noise), nil
+}
+
+// exceedanceTable lists exceedances, capped at maxReportRows
+func exceedanceTable(events []reportEvent, data *reportData, withAircraft, withEvent bool) (*reports.Table, string) {
+	columns := []string{"Date"}
+	if withAircraft {
+		columns = append(columns, "Aircraft")
+	}
+	columns = append(columns, "Flight", "Route")
+	if withEvent {
+		columns = append(columns, "Event")
+	}
+	table := &reports.Table{Columns: append(columns, "Severity", "Phase", "Status")}
+
+	note := ""
+	if len(events) > maxReportRows {
+		note = fmt.Sprintf("Showing the first %d of %d exceedances.", maxReportRows, len(events))
+		events = events[:maxReportRows]
+	}
+	for _, e := range events {
+		row := []interface{}{e.createdAt.Format("2006-01-02")}
+		if withAircraft {
+			row = append(row, data.aircraft[e.aircraftID].aircraft)
+		}
+		row = append(row, e.flightName, e.route)
+		if withEvent {
+			name := e.eventCode
+			if e.eventName != "" && e.eventName != e.eventCode {
+				name += " " + e.eventName
+			}
+			row = append(row, name)
+		}
+		table.Rows = append(table.Rows, append(row, e.severity, e.phase, e.status))
+	}
+	return table, note
+}
+
+func aircraftSections(data *reportData) []reports.Section {
+	flights := map[string]int{}
+	for _, f := range data.flights {
+		flights[f.aircraftID]++
+	}
+	events := map[string][]reportEvent{}
+	for _, e := range data.events {
+		events[e.aircraftID] = append(events[e.aircraftID], e)
+	}
+
+	ids := make([]string, 0, len(data.aircraft))
+	for id := range data.aircraft {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return data.aircraft[ids[i]].aircraft < data.aircraft[ids[j]].aircraft })
+
+	sections := []reports.Section{}
+	for _, id := range ids {
+		a := data.aircraft[id]
+		heading := a.aircraft
+		if a.aircraftType != "" {
+			heading += " (" + a.aircraftType + ")"
+		}
+		section := reports.Section{
+			Heading: heading,
+			Paragraphs: []string{fmt.Sprintf("%d flights, %d exceedances, %.2f per 1,000 flights. %s",
+				flights[id], len(events[id]), eventRate(len(events[id]), flights[id]), severitySummary(events[id]))},
+		}
+		if len(events[id]) > 0 {
+			table, note := exceedanceTable(events[id], data, false, true)
+			if note != "" {
+				section.Paragraphs = append(section.Paragraphs, note)
+			}
+			section.Table = table
+		}
+		sections = append(sections, section)
+	}
+	if len(sections) == 0 {
+		sections = append(sections, reports.Section{Heading: "Aircraft", Paragraphs: []string{"No flights in this period."}})
+	}
+	return sections
+}
+
+func eventSections(data *reportData) []reports.Section {
+	byCode := map[string][]reportEvent{}
+	for _, e := range data.events {
+		byCode[e.eventCode] = append(byCode[e.eventCode], e)
+	}
+	codes := make([]string, 0, len(byCode))
+	for code := range byCode {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if len(byCode[codes[i]]) != len(byCode[codes[j]]) {
+			return len(byCode[codes[i]]) > len(byCode[codes[j]])
+		}
+		return codes[i] < codes[j]
+	})
+
+	sections := []reports.Section{}
+	for _, code := range codes {
+		events := byCode[code]
+		heading := code
+		if name := events[0].eventName; name != "" && name != code {
+			heading += " " + name
+		}
+		eventFlights := map[string]bool{}
+		for _, e := range events {
+			eventFlights[e.flightID] = true
+		}
+		table, note := exceedanceTable(events, data, true, false)
+		section := reports.Section{
+			Heading: heading,
+			Paragraphs: []string{fmt.Sprintf("%d exceedances on %d of %d flights, %.2f per 1,000 flights. %s",
+				len(events), len(eventFlights), len(data.flights), eventRate(len(events), len(data.flights)), severitySummary(events))},
+			Table: table,
+		}
+		if note != "" {
+			section.Paragraphs = append(section.Paragraphs, note)
+		}
+		sections = append(sections, section)
+	}
+	if len(sections) == 0 {
+		sections = append(sections, reports.Section{Heading: "Events", Paragraphs: []string{"No exceedances in this period."}})
+	}
+	return sections
+}
+
+// severitySummary reads "Severity: 2 high, 1 low."
+func severitySummary(events []reportEvent) string {
+	if len(events) == 0 {
+		return ""
+	}
+	counts := countSeverities(events)
+	parts := []string{}
+	for _, s := range sortedSeverities(counts) {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[s], s))
+	}
+	return "Severity: " + strings.Join(parts, ", ") + "."
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/middleware"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes sets up the routes of the server on router. authenticate
+// identifies the caller on protected routes; the server passes
+// middleware.AuthenticateToken() and the tests stand in their own.
+func RegisterRoutes(router *gin.Engine, db *sql.DB, authenticate gin.HandlerFunc) {
+	userHandler := NewUserHandler(db)
+	companyHandler := NewCompanyHandler(db)
+	subscriptionHandler := NewSubscriptionHandler(db)
+	aircraftHandler := NewAircraftHandler(db)
+	csvHandler := NewCSVHandler(db)
+	eventHandler := NewEventHandler(db)
+	exceedanceHandler := NewExceedanceHandler(db)
+	notificationHandler := NewNotificationHandler(db)
+	analyticsHandler := NewAnalyticsHandler(db)
+	spiHandler := NewSPIHandler(db)
+	crewHandler := NewCrewHandler(db)
+	reportHandler := NewReportHandler(db)
+	exportHandler := NewExportHandler(db)
+	emailHandler := NewEmailHandler(db)
+	streamHandler := NewStreamHandler(db)
+	webhookHandler := NewWebhookHandler(db)
+	escalationHandler := NewEscalationHandler(db)
+	schedulerHandler := NewSchedulerHandler(db)
+	usageHandler := NewUsageHandler(db)
+
+	// Public routes
+	router.POST("/login", userHandler.Login)
+	router.POST("/password-reset", userHandler.RequestPasswordReset)
+	router.POST("/password-reset/confirm", userHandler.ResetPassword)
+	router.GET("/test-simple", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Server is working"})
+	})
+	router.GET("/test-db", func(c *gin.Context) {
+		// Test database connection and query
+		query := `SELECT COUNT(*) as count FROM User`
+		var count int
+		err := db.QueryRow(query).Scan(&count)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database test failed", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Database connected", "user_count": count})
+	})
+	router.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Hello World!"})
+	})
+
+	// Server-sent event stream. EventSource cannot send headers, so the token
+	// may also be passed as ?access_token=
+	router.GET("/api/stream", middleware.TokenFromQuery(), authenticate, streamHandler.Stream)
+
+	// Protected routes - all require authentication
+	api := router.Group("/api")
+	api.Use(authenticate, MeterAPICalls())
+	{
+		// Company Management Routes (Admin Only)
+		companies := api.Group("/companies")
+		companies.Use(middleware.AdminOnly())
+		{
+			companies.POST("", companyHandler.CreateCompany)
+			companies.GET("", companyHandler.GetCompanies)
+			companies.PUT("/:id", companyHandler.UpdateCompany)
+			companies.DELETE("/:id", companyHandler.DeleteCompany)
+			companies.PUT("/:id/suspend", companyHandler.SuspendCompany)
+			companies.PUT("/:id/activate", companyHandler.ActivateCompany)
+			companies.PUT("/:id/quota-override", subscriptionHandler.SetQuotaOverride)
+			companies.DELETE("/:id/quota-override", subscriptionHandler.DeleteQuotaOverride)
+		}
+		// Public company endpoint - any authenticated user can view company by ID
+		api.GET("/companies/:id", middleware.AnyAuthenticatedUser(), companyHandler.GetCompanyByID)
+		api.GET("/companies/:id/quota", middleware.GatekeeperOrAbove(), subscriptionHandler.GetCompanyQuota)
+		api.GET("/companies/:id/usage", middleware.GatekeeperOrAbove(), usageHandler.GetCompanyUsage)
+		api.GET("/usage", middleware.AdminOnly(), usageHandler.GetUsage)
+
+		// Subscription Management Routes (Admin Only)
+		subscriptions := api.Group("/subscriptions")
+		subscriptions.Use(middleware.AdminOnly())
+		{
+			subscriptions.POST("", subscriptionHandler.CreateSubscription)
+			subscriptions.GET("", subscriptionHandler.GetSubscriptions)
+			subscriptions.GET("/:id", subscriptionHandler.GetSubscriptionByID)
+			subscriptions.PUT("/:id", subscriptionHandler.UpdateSubscription)
+			subscriptions.DELETE("/:id", subscriptionHandler.DeleteSubscription)
+			subscriptions.GET("/:id/status", subscriptionHandler.GetSubscriptionStatus)
+			subscriptions.POST("/check-expired", subscriptionHandler.CheckExpiredSubscriptions)
+		}
+
+		// Scheduled maintenance jobs (Admin Only)
+		jobs := api.Group("/jobs")
+		jobs.Use(middleware.AdminOnly())
+		{
+			jobs.GET("", schedulerHandler.GetJobs)
+			jobs.PUT("/:name", schedulerHandler.UpdateJob)
+			jobs.POST("/:name/run", schedulerHandler.RunJob)
+			jobs.GET("/runs", schedulerHandler.GetJobRuns)
+			jobs.GET("/runs/:id", schedulerHandler.GetJobRunByID)
+		}
+
+		// User Management Routes
+		users := api.Group("/users")
+		{
+			users.GET("", middleware.GatekeeperOrAbove(), userHandler.GetUsers)
+			users.POST("", middleware.GatekeeperOrAbove(), userHandler.CreateUser)
+			users.GET("/email/:email", middleware.AnyAuthenticatedUser(), userHandler.GetUserByEmail)
+			users.GET("/:id", middleware.AnyAuthenticatedUser(), userHandler.GetUserByID)
+			users.PUT("/:id", middleware.GatekeeperOrAbove(), userHandler.UpdateUser)
+			users.DELETE("/:id", middleware.AdminOrFDA(), userHandler.DeleteUser)
+			users.PUT("/:id/activate", middleware.AdminOrFDA(), userHandler.ActivateUser)
+			users.PUT("/:id/deactivate", middleware.AdminOrFDA(), userHandler.DeactivateUser)
+			users.GET("/company/:companyId", middleware.GatekeeperOrAbove(), middleware.CompanyAccessControl(), userHandler.GetUsersByCompanyID)
+		}
+
+		// Session Management Routes - Single Device Login Enforcement
+		api.POST("/logout", userHandler.Logout)
+		api.POST("/logout-all", userHandler.LogoutAllDevices)
+		api.GET("/sessions", userHandler.GetActiveSessions)
+
+		// Aircraft Management Routes (Company-scoped)
+		aircrafts := api.Group("/aircrafts")
+		{
+			aircrafts.GET("", middleware.AnyAuthenticatedUser(), aircraftHandler.GetAircrafts)
+			aircrafts.POST("", middleware.GatekeeperOrAbove(), aircraftHandler.CreateAircraft)
+			aircrafts.GET("/company/:id", middleware.AnyAuthenticatedUser(), aircraftHandler.GetAircraftsByUserID)
+			aircrafts.GET("/:id", middleware.AnyAuthenticatedUser(), aircraftHandler.GetAircraftByID)
+			aircrafts.PUT("/:id", middleware.GatekeeperOrAbove(), aircraftHandler.UpdateAircraft)
+			aircrafts.DELETE("/:id", middleware.AdminOrFDA(), aircraftHandler.DeleteAircraft)
+		}
+
+		// CSV/Flight Data Routes
+		csvs := api.Group("/csv")
+		{
+			csvs.POST("", middleware.GatekeeperOrAbove(), csvHandler.UploadCSV)
+			csvs.GET("", middleware.AnyAuthenticatedUser(), csvHandler.GetCSVs)
+			csvs.GET("/:id", middleware.AnyAuthenticatedUser(), csvHandler.DownloadCSV)
+			csvs.DELETE("/:id", middleware.AdminOrFDA(), csvHandler.DeleteCSV)
+		}
+		api.GET("/flight/:id", middleware.AnyAuthenticatedUser(), csvHandler.GetCSVByID)
+		api.GET("/flight/:id/measurements", middleware.AnyAuthenticatedUser(), analyticsHandler.GetFlightMeasurements)
+		api.GET("/flight/:id/crew", middleware.GatekeeperOrAbove(), crewHandler.GetFlightCrew)
+		api.PUT("/flight/:id/crew", middleware.GatekeeperOrAbove(), crewHandler.UpdateFlightCrew)
+
+		// Event Management Routes
+		events := api.Group("/events")
+		{
+			events.GET("", middleware.AnyAuthenticatedUser(), eventHandler.GetEvents)
+			events.POST("", middleware.GatekeeperOrAbove(), eventHandler.CreateEvent)
+			events.GET("/:id", middleware.AnyAuthenticatedUser(), eventHandler.GetEventByID)
+			events.PUT("/:id", middleware.AdminOrFDA(), eventHandler.UpdateEvent) // Only FDA can validate
+			events.DELETE("/:id", middleware.AdminOrFDA(), eventHandler.DeleteEvent)
+		}
+
+		// Exceedance Routes
+		exceedances := api.Group("/exceedances")
+		{
+			exceedances.GET("", middleware.AnyAuthenticatedUser(), exceedanceHandler.GetExceedances)
+			exceedances.GET("/benchmarks", middleware.AnyAuthenticatedUser(), exceedanceHandler.GetGlobalBenchmarks)
+			exceedances.GET("/workflow", middleware.AnyAuthenticatedUser(), exceedanceHandler.GetExceedanceWorkflow)
+			exceedances.GET("/queue", middleware.AdminOrFDA(), exceedanceHandler.GetExceedanceQueue)
+			exceedances.POST("/assign", middleware.AdminOrFDA(), exceedanceHandler.BulkAssignExceedances)
+			exceedances.POST("/bulk", middleware.GatekeeperOrAbove(), exceedanceHandler.BulkUpdateExceedances) // Actions are checked per role
+			exceedances.GET("/:id", middleware.AnyAuthenticatedUser(), exceedanceHandler.GetExceedanceByID)
+			exceedances.GET("/flight/:id", middleware.AnyAuthenticatedUser(), exceedanceHandler.GetExceedancesByFlightID)
+			exceedances.POST("", middleware.GatekeeperOrAbove(), exceedanceHandler.CreateExceedances)
+			exceedances.GET("/:id/history", middleware.AnyAuthenticatedUser(), exceedanceHandler.GetExceedanceHistory)
+			exceedances.PUT("/:id", middleware.GatekeeperOrAbove(), exceedanceHandler.UpdateExceedance) // Transitions are checked per role
+			exceedances.PUT("/:id/assignment", middleware.AdminOrFDA(), exceedanceHandler.UpdateExceedanceAssignment)
+			exceedances.GET("/:id/comments", middleware.AnyAuthenticatedUser(), exceedanceHandler.GetExceedanceComments)
+			exceedances.POST("/:id/comments", middleware.GatekeeperOrAbove(), exceedanceHandler.CreateExceedanceComment)
+			exceedances.PUT("/:id/comments/:commentId", middleware.GatekeeperOrAbove(), exceedanceHandler.UpdateExceedanceComment)
+			exceedances.DELETE("/:id/comments/:commentId", middleware.GatekeeperOrAbove(), exceedanceHandler.DeleteExceedanceComment)
+			exceedances.GET("/:id/attachments", middleware.AnyAuthenticatedUser(), exceedanceHandler.GetExceedanceAttachments)
+			exceedances.POST("/:id/attachments", middleware.GatekeeperOrAbove(), exceedanceHandler.UploadExceedanceAttachment)
+			exceedances.GET("/:id/attachments/:attachmentId", middleware.AnyAuthenticatedUser(), exceedanceHandler.DownloadExceedanceAttachment)
+			exceedances.DELETE("/:id/attachments/:attachmentId", middleware.GatekeeperOrAbove(), exceedanceHandler.DeleteExceedanceAttachment)
+			exceedances.DELETE("/:id", middleware.AdminOrFDA(), exceedanceHandler.DeleteExceedance)
+		}
+
+		// Analytics Routes
+		analytics := api.Group("/analytics")
+		{
+			analytics.GET("/trends", middleware.AnyAuthenticatedUser(), analyticsHandler.GetTrends)
+			analytics.GET("/benchmarks", middleware.AnyAuthenticatedUser(), analyticsHandler.GetBenchmarks)
+			analytics.GET("/airports", middleware.AnyAuthenticatedUser(), analyticsHandler.GetAirportStats)
+			analytics.GET("/airports/:code/flights", middleware.AnyAuthenticatedUser(), analyticsHandler.GetAirportFlights)
+			analytics.GET("/routes", middleware.AnyAuthenticatedUser(), analyticsHandler.GetRouteStats)
+			analytics.GET("/routes/flights", middleware.AnyAuthenticatedUser(), analyticsHandler.GetRouteFlights)
+			analytics.GET("/crew", middleware.GatekeeperOrAbove(), analyticsHandler.GetCrewStats)
+			analytics.GET("/measurements", middleware.AnyAuthenticatedUser(), analyticsHandler.GetMeasurementDefinitions)
+			analytics.POST("/measurements/compute", middleware.AdminOrFDA(), analyticsHandler.ComputeMeasurements)
+			analytics.GET("/measurements/:code", middleware.AnyAuthenticatedUser(), analyticsHandler.GetMeasurementDistribution)
+		}
+
+		// Safety Performance Indicator Routes
+		spis := api.Group("/spis")
+		{
+			spis.GET("", middleware.AnyAuthenticatedUser(), spiHandler.GetSPIs)
+			spis.POST("", middleware.GatekeeperOrAbove(), spiHandler.CreateSPI)
+			spis.GET("/:id", middleware.AnyAuthenticatedUser(), spiHandler.GetSPIByID)
+			spis.PUT("/:id", middleware.GatekeeperOrAbove(), spiHandler.UpdateSPI)
+			spis.DELETE("/:id", middleware.GatekeeperOrAbove(), spiHandler.DeleteSPI)
+			spis.GET("/:id/history", middleware.AnyAuthenticatedUser(), spiHandler.GetSPIHistory)
+		}
+
+		// Crew Routes - identities are only revealed to FDAs through a logged contact
+		crew := api.Group("/crew")
+		{
+			crew.GET("", middleware.GatekeeperOrAbove(), crewHandler.GetCrewMembers)
+			crew.POST("", middleware.GatekeeperOrAbove(), crewHandler.CreateCrewMember)
+			crew.GET("/:id", middleware.GatekeeperOrAbove(), crewHandler.GetCrewMemberByID)
+			crew.PUT("/:id", middleware.GatekeeperOrAbove(), crewHandler.UpdateCrewMember)
+			crew.POST("/:id/contact", middleware.FDAOnly(), crewHandler.ContactCrewMember)
+			crew.GET("/:id/contacts", middleware.AdminOrFDA(), crewHandler.GetCrewContacts)
+		}
+
+		// Report Routes
+		reports := api.Group("/reports")
+		{
+			reports.GET("", middleware.AnyAuthenticatedUser(), reportHandler.GetReports)
+			reports.POST("", middleware.GatekeeperOrAbove(), reportHandler.GenerateReport)
+			reports.GET("/templates", middleware.AnyAuthenticatedUser(), reportHandler.GetReportTemplates)
+			reports.GET("/schedules", middleware.AnyAuthenticatedUser(), reportHandler.GetReportSchedules)
+			reports.POST("/schedules", middleware.GatekeeperOrAbove(), reportHandler.CreateReportSchedule)
+			reports.PUT("/schedules/:id", middleware.GatekeeperOrAbove(), reportHandler.UpdateReportSchedule)
+			reports.DELETE("/schedules/:id", middleware.GatekeeperOrAbove(), reportHandler.DeleteReportSchedule)
+			reports.GET("/:id", middleware.AnyAuthenticatedUser(), reportHandler.GetReportByID)
+			reports.GET("/:id/download", middleware.AnyAuthenticatedUser(), reportHandler.DownloadReport)
+			reports.DELETE("/:id", middleware.GatekeeperOrAbove(), reportHandler.DeleteReport)
+		}
+
+		// Export Routes
+		export := api.Group("/export")
+		{
+			export.GET("/exceedances", middleware.AnyAuthenticatedUser(), exportHandler.ExportExceedances)
+			export.GET("/flights", middleware.AnyAuthenticatedUser(), exportHandler.ExportFlights)
+			export.GET("/events", middleware.AnyAuthenticatedUser(), exportHandler.ExportEvents)
+		}
+
+		// Notification Routes
+		notifications := api.Group("/notifications")
+		{
+			notifications.POST("", middleware.GatekeeperOrAbove(), notificationHandler.CreateNotifications)
+			notifications.GET("/user/:userId", middleware.AnyAuthenticatedUser(), notificationHandler.GetUserNotifications)
+			notifications.PUT("/:id/read", middleware.AnyAuthenticatedUser(), notificationHandler.MarkNotificationAsRead)
+			notifications.PUT("/user/:userId/mark-all-read", middleware.AnyAuthenticatedUser(), notificationHandler.MarkAllNotificationsAsRead)
+			notifications.GET("/user/:userId/preferences", middleware.AnyAuthenticatedUser(), notificationHandler.GetNotificationPreferences)
+			notifications.PUT("/user/:userId/preferences", middleware.AnyAuthenticatedUser(), notificationHandler.UpdateNotificationPreferences)
+		}
+
+		// Notification Rule Routes
+		notificationRules := api.Group("/notification-rules")
+		{
+			notificationRules.GET("", middleware.GatekeeperOrAbove(), notificationHandler.GetNotificationRules)
+			notificationRules.POST("", middleware.GatekeeperOrAbove(), notificationHandler.CreateNotificationRule)
+			notificationRules.GET("/:id", middleware.GatekeeperOrAbove(), notificationHandler.GetNotificationRuleByID)
+			notificationRules.PUT("/:id", middleware.GatekeeperOrAbove(), notificationHandler.UpdateNotificationRule)
+			notificationRules.DELETE("/:id", middleware.GatekeeperOrAbove(), notificationHandler.DeleteNotificationRule)
+		}
+
+		// Escalation Policy Routes
+		escalationPolicies := api.Group("/escalation-policies")
+		{
+			escalationPolicies.GET("", middleware.GatekeeperOrAbove(), escalationHandler.GetEscalationPolicies)
+			escalationPolicies.POST("", middleware.GatekeeperOrAbove(), escalationHandler.CreateEscalationPolicy)
+			escalationPolicies.GET("/:id", middleware.GatekeeperOrAbove(), escalationHandler.GetEscalationPolicyByID)
+			escalationPolicies.PUT("/:id", middleware.GatekeeperOrAbove(), escalationHandler.UpdateEscalationPolicy)
+			escalationPolicies.DELETE("/:id", middleware.GatekeeperOrAbove(), escalationHandler.DeleteEscalationPolicy)
+		}
+
+		// Email Delivery Routes
+		emailDeliveries := api.Group("/email-deliveries")
+		{
+			emailDeliveries.GET("", middleware.AdminOnly(), emailHandler.GetEmailDeliveries)
+			emailDeliveries.POST("/test", middleware.AdminOnly(), emailHandler.SendTestEmail)
+			emailDeliveries.GET("/:id", middleware.AdminOnly(), emailHandler.GetEmailDeliveryByID)
+			emailDeliveries.POST("/:id/retry", middleware.AdminOnly(), emailHandler.RetryEmailDelivery)
+		}
+
+		// Webhook Routes
+		webhooks := api.Group("/webhooks")
+		{
+			webhooks.GET("", middleware.GatekeeperOrAbove(), webhookHandler.GetWebhooks)
+			webhooks.POST("", middleware.GatekeeperOrAbove(), webhookHandler.CreateWebhook)
+			webhooks.GET("/:id", middleware.GatekeeperOrAbove(), webhookHandler.GetWebhookByID)
+			webhooks.PUT("/:id", middleware.GatekeeperOrAbove(), webhookHandler.UpdateWebhook)
+			webhooks.DELETE("/:id", middleware.GatekeeperOrAbove(), webhookHandler.DeleteWebhook)
+			webhooks.POST("/:id/rotate-secret", middleware.GatekeeperOrAbove(), webhookHandler.RotateWebhookSecret)
+			webhooks.GET("/:id/deliveries", middleware.GatekeeperOrAbove(), webhookHandler.GetWebhookDeliveries)
+			webhooks.POST("/:id/deliveries/:deliveryId/redeliver", middleware.GatekeeperOrAbove(), webhookHandler.RedeliverWebhook)
+		}
+	}
+
+	// Catch-all for unmatched routes (for debugging)
+	router.NoRoute(func(c *gin.Context) {
+		log.Printf("NoRoute: Method=%s Path=%s", c.Request.Method, c.Request.URL.Path)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Route not found", "path": c.Request.URL.Path, "method": c.Request.Method})
+	})
+}
@@ -0,0 +1,593 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fdm-backend/config"
+	"fdm-backend/models"
+	"fdm-backend/utils"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Maintenance jobs run in process on cron schedules kept in ScheduledJob.
+// Every minute MonitorJobs claims the jobs that are due. A claim is a lock held
+// in the database, so when several server instances share it only one of them
+// runs a job at a time; the lock is renewed every jobLockRenewal while the job
+// runs, so a lock left by an instance that died expires within jobLockTimeout.
+// Every run, scheduled or manual, is recorded in JobRun.
+// Schedules are evaluated in UTC.
+
+const (
+	jobPollInterval = time.Minute
+	jobLockTimeout  = time.Hour
+	jobLockRenewal  = jobLockTimeout / 4
+	jobRunRetention = 30 * 24 * time.Hour
+)
+
+// jobFunc runs a job and counts what it did
+type jobFunc func(now time.Time) (map[string]int, error)
+
+// maintenanceJob is a job the scheduler knows how to run
+type maintenanceJob struct {
+	name        string
+	description string
+	schedule    string // default cron schedule
+	run         jobFunc
+}
+
+type SchedulerHandler struct {
+	db       *sql.DB
+	instance string
+	jobs     []maintenanceJob
+}
+
+func NewSchedulerHandler(db *sql.DB) *SchedulerHandler {
+	host, _ := os.Hostname()
+	h := &SchedulerHandler{db: db, instance: fmt.Sprintf("%s-%d", host, os.Getpid())}
+
+	subscriptions := NewSubscriptionHandler(db)
+	notifications := NewNotificationHandler(db)
+	reports := NewReportHandler(db)
+	usage := NewUsageHandler(db)
+	h.jobs = []maintenanceJob{
+		{
+			name:        models.JobSubscriptionExpiry,
+			description: "Suspend companies whose subscription has expired and warn those expiring within 7 days",
+			schedule:    "0 * * * *",
+			run: func(now time.Time) (map[string]int, error) {
+				expired, expiring, err := subscriptions.checkExpiredSubscriptions(now)
+				return map[string]int{"expired": len(expired), "expiring": len(expiring)}, err
+			},
+		},
+		{
+			name:        models.JobSessionCleanup,
+			description: "Delete expired sessions",
+			schedule:    "15 * * * *",
+			run: func(now time.Time) (map[string]int, error) {
+				deleted, err := deleteRows(db, "DELETE FROM Session WHERE expiresAt < ?", now.UnixMilli())
+				return map[string]int{"sessions": deleted}, err
+			},
+		},
+		{
+			name:        models.JobNotificationDigests,
+			description: "Send the digests of held notifications that are due",
+			schedule:    "* * * * *",
+			run: func(now time.Time) (map[string]int, error) {
+				sent, failed, err := notifications.sendDueDigests(now)
+				return map[string]int{"sent": sent, "failed": failed}, err
+			},
+		},
+		{
+			name:        models.JobReportSchedules,
+			description: "Generate the previous month's report of every report schedule",
+			schedule:    "0 * * * *",
+			run: func(now time.Time) (map[string]int, error) {
+				generated, failed, err := reports.runDueSchedules(now)
+				return map[string]int{"generated": generated, "failed": failed}, err
+			},
+		},
+		{
+			name:        models.JobRetentionPurge,
+			description: "Delete delivery logs, read notifications, password reset tokens and job runs past their retention",
+			schedule:    "30 3 * * *",
+			run: func(now time.Time) (map[string]int, error) {
+				return purgeExpiredRecords(db, now)
+			},
+		},
+		{
+			name:        models.JobUsageSnapshots,
+			description: "Measure the active users, aircraft and storage of every company for the daily usage history",
+			schedule:    "50 * * * *",
+			run: func(now time.Time) (map[string]int, error) {
+				measured, failed, err := usage.snapshotUsage(now)
+				return map[string]int{"measured": measured, "failed": failed}, err
+			},
+		},
+	}
+	return h
+}
+
+// deleteRows runs a DELETE and returns the number of rows it removed
+func deleteRows(exec dbExecutor, query string, args ...interface{}) (int, error) {
+	result, err := exec.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// purgeExpiredRecords deletes finished email and webhook deliveries and read
+// notifications older than the retention period, expired password reset
+// tokens and old job runs. It returns the rows deleted per table.
+func purgeExpiredRecords(db *sql.DB, now time.Time) (map[string]int, error) {
+	cutoff := now.AddDate(0, 0, -config.GetRetentionDays()).UnixMilli()
+	purges := []struct {
+		table string
+		query string
+		args  []interface{}
+	}{
+		{"EmailDelivery", "DELETE FROM EmailDelivery WHERE status IN (?, ?) AND createdAt < ?",
+			[]interface{}{models.EmailStatusSent, models.EmailStatusFailed, cutoff}},
+		{"WebhookDelivery", "DELETE FROM WebhookDelivery WHERE status IN (?, ?) AND createdAt < ?",
+			[]interface{}{models.WebhookStatusDelivered, models.WebhookStatusFailed, cutoff}},
+		{"Notification", "DELETE FROM Notification WHERE isRead = 1 AND createdAt < ?",
+			[]interface{}{cutoff}},
+		{"PasswordReset", "DELETE FROM PasswordReset WHERE expiresAt < ?",
+			[]interface{}{now.UnixMilli()}},
+		{"JobRun", "DELETE FROM JobRun WHERE status != ? AND startedAt < ?",
+			[]interface{}{models.JobRunStatusRunning, now.Add(-jobRunRetention).UnixMilli()}},
+	}
+	deleted := map[string]int{}
+	for _, p := range purges {
+		n, err := deleteRows(db, p.query, p.args...)
+		if err != nil {
+			return deleted, fmt.Errorf("purging %s: %v", p.table, err)
+		}
+		deleted[p.table] = n
+	}
+	return deleted, nil
+}
+
+func (h *SchedulerHandler) job(name string) (maintenanceJob, bool) {
+	for _, job := range h.jobs {
+		if job.name == name {
+			return job, true
+		}
+	}
+	return maintenanceJob{}, false
+}
+
+// nextRun returns when a schedule next falls due after now
+func nextRun(schedule string, now time.Time) (time.Time, error) {
+	cron, err := utils.ParseCron(schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := cron.Next(now.UTC())
+	if next.IsZero() {
+		return next, errors.New("the schedule never runs")
+	}
+	return next, nil
+}
+
+// MonitorJobs registers the maintenance jobs and runs them as they fall due
+// until the process exits
+func (h *SchedulerHandler) MonitorJobs() {
+	if err := h.registerJobs(time.Now()); err != nil {
+		log.Println("Error registering scheduled jobs:", err)
+	}
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	for {
+		h.runDueJobs(time.Now())
+		<-ticker.C
+	}
+}
+
+// registerJobs stores the jobs that are not stored yet with their default
+// schedule. Stored jobs keep the schedule an admin gave them.
+func (h *SchedulerHandler) registerJobs(now time.Time) error {
+	for _, job := range h.jobs {
+		next, err := nextRun(job.schedule, now)
+		if err != nil {
+			return fmt.Errorf("%s: %v", job.name, err)
+		}
+		_, err = h.db.Exec(`INSERT OR IGNORE INTO ScheduledJob (name, schedule, isEnabled, nextRunAt, createdAt, updatedAt)
+			VALUES (?, ?, 1, ?, ?, ?)`, job.name, job.schedule, next.UnixMilli(), now.UnixMilli(), now.UnixMilli())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runDueJobs starts every enabled job that is due and not running elsewhere.
+// A job still running when it falls due again runs once it finishes.
+func (h *SchedulerHandler) runDueJobs(now time.Time) {
+	rows, err := h.db.Query("SELECT name, schedule FROM ScheduledJob WHERE isEnabled = 1 AND nextRunAt <= ?", now.UnixMilli())
+	if err != nil {
+		log.Println("Error finding due jobs:", err)
+		return
+	}
+	due := map[string]string{}
+	for rows.Next() {
+		var name, schedule string
+		if err := rows.Scan(&name, &schedule); err == nil {
+			due[name] = schedule
+		}
+	}
+	rows.Close()
+
+	for name, schedule := range due {
+		job, ok := h.job(name)
+		if !ok {
+			continue
+		}
+		next, err := nextRun(schedule, now)
+		if err != nil {
+			log.Printf("Error scheduling job %s: %v", name, err)
+			continue
+		}
+		result, err := h.db.Exec(`UPDATE ScheduledJob SET lockedBy = ?, lockedUntil = ?, nextRunAt = ?
+			WHERE name = ? AND isEnabled = 1 AND nextRunAt <= ? AND (lockedUntil IS NULL OR lockedUntil < ?)`,
+			h.instance, now.Add(jobLockTimeout).UnixMilli(), next.UnixMilli(), name, now.UnixMilli(), now.UnixMilli())
+		if err != nil {
+			log.Printf("Error claiming job %s: %v", name, err)
+			continue
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			continue
+		}
+		run, err := h.startRun(job.name, models.JobRunSourceSchedule, nil, now)
+		if err != nil {
+			log.Printf("Error starting job %s: %v", name, err)
+			h.release(job.name)
+			continue
+		}
+		go h.execute(job, run)
+	}
+}
+
+// claimManual locks a job for a manual run. It reports false when the job is
+// running already.
+func (h *SchedulerHandler) claimManual(name string, now time.Time) (bool, error) {
+	result, err := h.db.Exec(`UPDATE ScheduledJob SET lockedBy = ?, lockedUntil = ?
+		WHERE name = ? AND (lockedUntil IS NULL OR lockedUntil < ?)`,
+		h.instance, now.Add(jobLockTimeout).UnixMilli(), name, now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// startRun records the start of a run. Runs of the job still marked running
+// were interrupted: their instance stopped without releasing the lock.
+func (h *SchedulerHandler) startRun(name, source string, triggeredBy *string, now time.Time) (models.JobRun, error) {
+	run := models.JobRun{
+		ID:          uuid.New().String(),
+		JobName:     name,
+		Source:      source,
+		Status:      models.JobRunStatusRunning,
+		TriggeredBy: triggeredBy,
+		Instance:    h.instance,
+		StartedAt:   now,
+	}
+	tx, err := h.db.Begin()
+	if err != nil {
+		return run, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE JobRun SET status = ?, error = ?, finishedAt = ? WHERE jobName = ? AND status = ?",
+		models.JobRunStatusFailed, "interrupted", now.UnixMilli(), name, models.JobRunStatusRunning); err != nil {
+		return run, err
+	}
+	if _, err := tx.Exec(`INSERT INTO JobRun (id, jobName, source, status, triggeredBy, instance, startedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, run.ID, name, source, run.Status, triggeredBy, h.instance, now.UnixMilli()); err != nil {
+		return run, err
+	}
+	return run, tx.Commit()
+}
+
+// execute runs a claimed job, records the outcome and releases the lock
+func (h *SchedulerHandler) execute(job maintenanceJob, run models.JobRun) {
+	defer h.release(job.name)
+	defer h.renewLock(job.name)()
+
+	var counts map[string]int
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		counts, err = job.run(run.StartedAt)
+		return err
+	}()
+
+	status, message := models.JobRunStatusSucceeded, ""
+	if err != nil {
+		log.Printf("Job %s failed: %v", job.name, err)
+		status, message = models.JobRunStatusFailed, err.Error()
+	}
+	if _, err := h.db.Exec("UPDATE JobRun SET status = ?, result = ?, error = ?, finishedAt = ? WHERE id = ?",
+		status, jsonText(counts), nullIfEmpty(message), time.Now().UnixMilli(), run.ID); err != nil {
+		log.Printf("Error recording run of job %s: %v", job.name, err)
+	}
+}
+
+// renewLock extends the lock on a job every jobLockRenewal until the returned
+// function is called
+func (h *SchedulerHandler) renewLock(name string) (stop func()) {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(jobLockRenewal)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if _, err := h.db.Exec("UPDATE ScheduledJob SET lockedUntil = ? WHERE name = ? AND lockedBy = ?",
+					now.Add(jobLockTimeout).UnixMilli(), name, h.instance); err != nil {
+					log.Printf("Error renewing lock of job %s: %v", name, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (h *SchedulerHandler) release(name string) {
+	if _, err := h.db.Exec("UPDATE ScheduledJob SET lockedBy = NULL, lockedUntil = NULL WHERE name = ? AND lockedBy = ?",
+		name, h.instance); err != nil {
+		log.Printf("Error releasing job %s: %v", name, err)
+	}
+}
+
+const jobRunColumns = "id, jobName, source, status, triggeredBy, instance, result, error, startedAt, finishedAt"
+
+func scanJobRun(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.JobRun, error) {
+	var run models.JobRun
+	var result, runError sql.NullString
+	var startedAt int64
+	var finishedAt sql.NullInt64
+	dest := []interface{}{&run.ID, &run.JobName, &run.Source, &run.Status, &run.TriggeredBy, &run.Instance,
+		&result, &runError, &startedAt, &finishedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return run, err
+	}
+	if result.Valid {
+		if err := json.Unmarshal([]byte(result.String), &run.Result); err != nil {
+			return run, err
+		}
+	}
+	if runError.Valid {
+		run.Error = &runError.String
+	}
+	run.StartedAt = time.UnixMilli(startedAt)
+	if finishedAt.Valid {
+		t := time.UnixMilli(finishedAt.Int64)
+		duration := finishedAt.Int64 - startedAt
+		run.FinishedAt, run.DurationMs = &t, &duration
+	}
+	return run, nil
+}
+
+// loadScheduledJob returns a registered job with its stored schedule, lock and
+// latest run
+func (h *SchedulerHandler) loadScheduledJob(job maintenanceJob, now time.Time) (models.ScheduledJob, error) {
+	j := models.ScheduledJob{Name: job.name, Description: job.description}
+	var nextRunAt, lockedUntil sql.NullInt64
+	var createdAt, updatedAt int64
+	err := h.db.QueryRow(`SELECT schedule, isEnabled, nextRunAt, lockedBy, lockedUntil, createdAt, updatedAt
+		FROM ScheduledJob WHERE name = ?`, job.name).
+		Scan(&j.Schedule, &j.IsEnabled, &nextRunAt, &j.LockedBy, &lockedUntil, &createdAt, &updatedAt)
+	if err != nil {
+		return j, err
+	}
+	if nextRunAt.Valid && j.IsEnabled {
+		t := time.UnixMilli(nextRunAt.Int64)
+		j.NextRunAt = &t
+	}
+	if lockedUntil.Valid {
+		t := time.UnixMilli(lockedUntil.Int64)
+		j.LockedUntil = &t
+		j.Running = t.After(now)
+	}
+	j.CreatedAt, j.UpdatedAt = time.UnixMilli(createdAt), time.UnixMilli(updatedAt)
+
+	run, err := scanJobRun(h.db.QueryRow("SELECT "+jobRunColumns+" FROM JobRun WHERE jobName = ? ORDER BY startedAt DESC, id DESC LIMIT 1", job.name))
+	if err == nil {
+		j.LastRun = &run
+	} else if err != sql.ErrNoRows {
+		return j, err
+	}
+	return j, nil
+}
+
+// GetJobs lists the maintenance jobs with their schedule and latest run
+func (h *SchedulerHandler) GetJobs(c *gin.Context) {
+	now := time.Now()
+	jobs := []models.ScheduledJob{}
+	for _, job := range h.jobs {
+		j, err := h.loadScheduledJob(job, now)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			log.Println("Error loading scheduled job:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		jobs = append(jobs, j)
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// UpdateJob changes the schedule of a job or pauses it. The next run is
+// computed again from the new schedule.
+func (h *SchedulerHandler) UpdateJob(c *gin.Context) {
+	job, ok := h.job(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	var req models.ScheduledJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	current, err := h.loadScheduledJob(job, now)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	schedule, enabled := current.Schedule, current.IsEnabled
+	if req.Schedule != nil {
+		schedule = strings.Join(strings.Fields(*req.Schedule), " ")
+	}
+	if req.IsEnabled != nil {
+		enabled = *req.IsEnabled
+	}
+	next, err := nextRun(schedule, now)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid schedule: " + err.Error()})
+		return
+	}
+
+	if _, err := h.db.Exec("UPDATE ScheduledJob SET schedule = ?, isEnabled = ?, nextRunAt = ?, updatedAt = ? WHERE name = ?",
+		schedule, enabled, next.UnixMilli(), now.UnixMilli(), job.name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating job"})
+		return
+	}
+	updated, err := h.loadScheduledJob(job, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Job updated but failed to fetch"})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// RunJob starts a job now, whether or not it is enabled, and returns its run
+// without waiting for it to finish. A job running already is not started
+// again.
+func (h *SchedulerHandler) RunJob(c *gin.Context) {
+	job, ok := h.job(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+
+	now := time.Now()
+	claimed, err := h.claimManual(job.name, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Job is already running"})
+		return
+	}
+	userID := c.GetString("userId")
+	run, err := h.startRun(job.name, models.JobRunSourceManual, &userID, now)
+	if err != nil {
+		h.release(job.name)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting job"})
+		return
+	}
+	go h.execute(job, run)
+	c.JSON(http.StatusAccepted, run)
+}
+
+// jobRunListSpec lists the filters and sort keys accepted by GetJobRuns
+var jobRunListSpec = &listSpec{
+	idColumn: "id",
+	sorts: map[string]string{
+		"startedAt": "startedAt",
+		"status":    "status",
+	},
+	defaultSort: "-startedAt",
+	filters: map[string]listFilter{
+		"job":    eqFilter("jobName"),
+		"status": lowerFilter("status"),
+		"source": lowerFilter("source"),
+		"from":   dateFilter("startedAt", false),
+		"to":     dateFilter("startedAt", true),
+	},
+}
+
+// GetJobRuns lists the run history of the jobs, one page at a time
+func (h *SchedulerHandler) GetJobRuns(c *gin.Context) {
+	list, err := parseListQuery(c, jobRunListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	const from = " FROM JobRun"
+	total, err := list.count(h.db, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	clause, args := list.pageClause()
+	rows, err := h.db.Query("SELECT "+jobRunColumns+", "+list.sortColumn()+from+clause, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	runs := []models.JobRun{}
+	for rows.Next() {
+		var sortValue interface{}
+		run, err := scanJobRun(rows, &sortValue)
+		if err != nil {
+			log.Println("Error scanning job run:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning job run"})
+			return
+		}
+		if !list.accept(run.ID, sortValue) {
+			break
+		}
+		runs = append(runs, run)
+	}
+
+	list.writeHeaders(c, total)
+	c.JSON(http.StatusOK, runs)
+}
+
+// GetJobRunByID returns one run of a job
+func (h *SchedulerHandler) GetJobRunByID(c *gin.Context) {
+	run, err := scanJobRun(h.db.QueryRow("SELECT "+jobRunColumns+" FROM JobRun WHERE id = ?", c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job run not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
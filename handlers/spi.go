@@ -0,0 +1,699 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fdm-backend/models"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SPIHandler manages Safety Performance Indicators
+type SPIHandler struct {
+	db *sql.DB
+}
+
+func NewSPIHandler(db *sql.DB) *SPIHandler {
+	return &SPIHandler{db: db}
+}
+
+const (
+	minSPIBaseline      = 3  // months with flights needed before alert levels apply
+	maxSPIHistoryMonths = 60 // oldest month computed
+	spiNotifyMonths     = 2  // only the current and previous month raise notifications
+	spiMonitorInterval  = 24 * time.Hour
+)
+
+const spiColumns = `id, companyId, name, description, eventCodes, eventTypes, severities, formula,
+	ratePer, target, alertSigmas, baselineMonths, isActive, createdBy, createdAt, updatedAt`
+
+func scanSPI(row interface{ Scan(...interface{}) error }) (models.SafetyPerformanceIndicator, error) {
+	var spi models.SafetyPerformanceIndicator
+	var eventCodes, eventTypes, severities, alertSigmas string
+	var createdAt, updatedAt int64
+	err := row.Scan(&spi.ID, &spi.CompanyID, &spi.Name, &spi.Description, &eventCodes, &eventTypes, &severities,
+		&spi.Formula, &spi.RatePer, &spi.Target, &alertSigmas, &spi.BaselineMonths, &spi.IsActive, &spi.CreatedBy,
+		&createdAt, &updatedAt)
+	if err != nil {
+		return spi, err
+	}
+	json.Unmarshal([]byte(eventCodes), &spi.EventCodes)
+	json.Unmarshal([]byte(eventTypes), &spi.EventTypes)
+	json.Unmarshal([]byte(severities), &spi.Severities)
+	json.Unmarshal([]byte(alertSigmas), &spi.AlertSigmas)
+	if spi.EventCodes == nil {
+		spi.EventCodes = []string{}
+	}
+	if spi.EventTypes == nil {
+		spi.EventTypes = []string{}
+	}
+	if spi.Severities == nil {
+		spi.Severities = []string{}
+	}
+	spi.CreatedAt = time.UnixMilli(createdAt)
+	spi.UpdatedAt = time.UnixMilli(updatedAt)
+	return spi, nil
+}
+
+func getSPI(exec dbExecutor, id string) (models.SafetyPerformanceIndicator, error) {
+	return scanSPI(exec.QueryRow("SELECT "+spiColumns+" FROM SafetyPerformanceIndicator WHERE id = ?", id))
+}
+
+// applySPIRequest copies the fields present in req onto spi
+func applySPIRequest(spi *models.SafetyPerformanceIndicator, req models.SPIRequest) {
+	if req.Name != nil {
+		spi.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		spi.Description = req.Description
+	}
+	if req.EventCodes != nil {
+		spi.EventCodes = cleanList(req.EventCodes, false)
+	}
+	if req.EventTypes != nil {
+		spi.EventTypes = cleanList(req.EventTypes, true)
+	}
+	if req.Severities != nil {
+		spi.Severities = cleanList(req.Severities, true)
+	}
+	if req.Formula != nil {
+		spi.Formula = *req.Formula
+	}
+	if req.RatePer != nil {
+		spi.RatePer = *req.RatePer
+	}
+	if req.Target != nil {
+		spi.Target = req.Target
+	}
+	if req.AlertSigmas != nil {
+		spi.AlertSigmas = req.AlertSigmas
+	}
+	if req.BaselineMonths != nil {
+		spi.BaselineMonths = *req.BaselineMonths
+	}
+	if req.IsActive != nil {
+		spi.IsActive = *req.IsActive
+	}
+}
+
+func validateSPI(spi models.SafetyPerformanceIndicator) error {
+	if spi.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(spi.EventCodes) == 0 && len(spi.EventTypes) == 0 {
+		return errors.New("at least one event code or event type is required")
+	}
+	if spi.Formula != models.SPIFormulaRate && spi.Formula != models.SPIFormulaCount {
+		return errors.New("formula must be rate or count")
+	}
+	if spi.RatePer < 1 {
+		return errors.New("ratePer must be a positive integer")
+	}
+	if len(spi.AlertSigmas) == 0 || len(spi.AlertSigmas) > 3 {
+		return errors.New("alertSigmas must list one to three alert levels")
+	}
+	for i, n := range spi.AlertSigmas {
+		if n <= 0 || (i > 0 && n <= spi.AlertSigmas[i-1]) {
+			return errors.New("alertSigmas must be positive and increasing")
+		}
+	}
+	if spi.BaselineMonths < minSPIBaseline || spi.BaselineMonths > maxSPIHistoryMonths {
+		return fmt.Errorf("baselineMonths must be between %d and %d", minSPIBaseline, maxSPIHistoryMonths)
+	}
+	return nil
+}
+
+// cleanList trims values and drops empty and duplicate entries
+func cleanList(values []string, lower bool) []string {
+	seen := map[string]bool{}
+	cleaned := []string{}
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if lower {
+			v = strings.ToLower(v)
+		}
+		if v != "" && !seen[v] {
+			seen[v] = true
+			cleaned = append(cleaned, v)
+		}
+	}
+	return cleaned
+}
+
+func jsonText(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// GetSPIs lists the SPIs of the caller's company with their latest value
+func (h *SPIHandler) GetSPIs(c *gin.Context) {
+	condition, args := tenantOf(c).condition("companyId")
+	if v := strings.TrimSpace(c.Query("company")); v != "" {
+		condition += " AND companyId = ?"
+		args = append(args, v)
+	}
+
+	rows, err := h.db.Query("SELECT "+spiColumns+" FROM SafetyPerformanceIndicator WHERE "+condition+" ORDER BY name", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	spis := []models.SafetyPerformanceIndicator{}
+	for rows.Next() {
+		spi, err := scanSPI(rows)
+		if err != nil {
+			log.Println("Error scanning SPI:", err)
+			continue
+		}
+		spis = append(spis, spi)
+	}
+	rows.Close()
+
+	for i := range spis {
+		values, err := loadSPIValues(h.db, spis[i], true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if len(values) > 0 {
+			spis[i].Latest = &values[0]
+		}
+	}
+
+	c.JSON(http.StatusOK, spis)
+}
+
+// GetSPIByID returns a single SPI
+func (h *SPIHandler) GetSPIByID(c *gin.Context) {
+	id := c.Param("id")
+	if !spiResource.authorize(c, h.db, id) {
+		return
+	}
+
+	spi, err := getSPI(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, spi)
+}
+
+// CreateSPI defines a new SPI. Gatekeepers create SPIs for their own company;
+// admins and FDAs must name the company.
+func (h *SPIHandler) CreateSPI(c *gin.Context) {
+	var req models.SPIRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyID, ok := requestedCompany(c, h.db, req.CompanyID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	userID := c.GetString("userId")
+	spi := models.SafetyPerformanceIndicator{
+		ID:             uuid.New().String(),
+		CompanyID:      companyID,
+		EventCodes:     []string{},
+		EventTypes:     []string{},
+		Severities:     []string{},
+		Formula:        models.SPIFormulaRate,
+		RatePer:        1000,
+		AlertSigmas:    []float64{1, 2, 3},
+		BaselineMonths: 12,
+		IsActive:       true,
+		CreatedBy:      &userID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	applySPIRequest(&spi, req)
+	if err := validateSPI(spi); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.db.Exec(`INSERT INTO SafetyPerformanceIndicator (`+spiColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		spi.ID, spi.CompanyID, spi.Name, spi.Description, jsonText(spi.EventCodes), jsonText(spi.EventTypes),
+		jsonText(spi.Severities), spi.Formula, spi.RatePer, spi.Target, jsonText(spi.AlertSigmas), spi.BaselineMonths,
+		spi.IsActive, spi.CreatedBy, now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating SPI"})
+		return
+	}
+
+	if values, err := h.compute(spi, now); err != nil {
+		log.Println("Error computing SPI:", err)
+	} else if len(values) > 0 {
+		spi.Latest = &values[len(values)-1]
+	}
+	c.JSON(http.StatusCreated, spi)
+}
+
+// UpdateSPI changes an SPI definition and recomputes its history
+func (h *SPIHandler) UpdateSPI(c *gin.Context) {
+	id := c.Param("id")
+	if !spiResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var req models.SPIRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	spi, err := getSPI(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.CompanyID != nil && *req.CompanyID != spi.CompanyID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "companyId cannot be changed"})
+		return
+	}
+	applySPIRequest(&spi, req)
+	if err := validateSPI(spi); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	spi.UpdatedAt = now
+	_, err = h.db.Exec(`UPDATE SafetyPerformanceIndicator SET name = ?, description = ?, eventCodes = ?, eventTypes = ?,
+		severities = ?, formula = ?, ratePer = ?, target = ?, alertSigmas = ?, baselineMonths = ?, isActive = ?, updatedAt = ?
+		WHERE id = ?`,
+		spi.Name, spi.Description, jsonText(spi.EventCodes), jsonText(spi.EventTypes), jsonText(spi.Severities),
+		spi.Formula, spi.RatePer, spi.Target, jsonText(spi.AlertSigmas), spi.BaselineMonths, spi.IsActive,
+		now.UnixMilli(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating SPI"})
+		return
+	}
+
+	if spi.IsActive {
+		if values, err := h.compute(spi, now); err != nil {
+			log.Println("Error computing SPI:", err)
+		} else if len(values) > 0 {
+			spi.Latest = &values[len(values)-1]
+		}
+	}
+	c.JSON(http.StatusOK, spi)
+}
+
+// DeleteSPI removes an SPI and its computed history
+func (h *SPIHandler) DeleteSPI(c *gin.Context) {
+	id := c.Param("id")
+	if !spiResource.authorize(c, h.db, id) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM SafetyPerformanceIndicatorValue WHERE spiId = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting SPI"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM SafetyPerformanceIndicator WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting SPI"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting SPI"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "SPI deleted successfully"})
+}
+
+// GetSPIHistory returns the stored monthly values of an SPI, oldest first.
+// Active SPIs are recomputed daily and whenever they are created or updated.
+func (h *SPIHandler) GetSPIHistory(c *gin.Context) {
+	id := c.Param("id")
+	if !spiResource.authorize(c, h.db, id) {
+		return
+	}
+
+	spi, err := getSPI(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	values, err := loadSPIValues(h.db, spi, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if len(values) > 0 {
+		spi.Latest = &values[len(values)-1]
+	}
+
+	c.JSON(http.StatusOK, gin.H{"spi": spi, "history": values})
+}
+
+// MonitorSPIs recomputes every active SPI once a day so alert breaches are
+// notified without anyone opening the SPI. It runs until the process exits.
+func (h *SPIHandler) MonitorSPIs() {
+	ticker := time.NewTicker(spiMonitorInterval)
+	defer ticker.Stop()
+	for {
+		h.computeActiveSPIs(time.Now())
+		<-ticker.C
+	}
+}
+
+func (h *SPIHandler) computeActiveSPIs(now time.Time) {
+	rows, err := h.db.Query("SELECT " + spiColumns + " FROM SafetyPerformanceIndicator WHERE isActive = 1")
+	if err != nil {
+		log.Println("Error loading SPIs:", err)
+		return
+	}
+	var spis []models.SafetyPerformanceIndicator
+	for rows.Next() {
+		if spi, err := scanSPI(rows); err == nil {
+			spis = append(spis, spi)
+		}
+	}
+	rows.Close()
+
+	for _, spi := range spis {
+		if _, err := h.compute(spi, now); err != nil {
+			log.Printf("Error computing SPI %s: %v", spi.ID, err)
+		}
+	}
+}
+
+// compute recomputes and stores an SPI's history in one transaction
+func (h *SPIHandler) compute(spi models.SafetyPerformanceIndicator, now time.Time) ([]models.SPIValue, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	values, err := computeSPI(tx, spi, now)
+	if err != nil {
+		return nil, err
+	}
+	return values, tx.Commit()
+}
+
+// computeSPI calculates the monthly values of an SPI from the company's first
+// flight (at most maxSPIHistoryMonths back) through the current month, stores
+// them and notifies the company's gatekeepers and FDAs of new alert breaches.
+// Flights and their exceedances are counted in the month the flight was uploaded.
+func computeSPI(exec dbExecutor, spi models.SafetyPerformanceIndicator, now time.Time) ([]models.SPIValue, error) {
+	month := models.TrendIntervalMonth
+	end := addPeriods(periodStart(now.UTC(), month), month, 1)
+
+	var first sql.NullInt64
+	err := exec.QueryRow(`SELECT MIN(`+sqlEpochMillis("f.createdAt")+`) FROM Csv f
+		JOIN Aircraft a ON f.aircraftId = a.id
+		WHERE a.companyId = ?`, spi.CompanyID).Scan(&first)
+	if err != nil {
+		return nil, err
+	}
+	if !first.Valid {
+		_, err := exec.Exec("DELETE FROM SafetyPerformanceIndicatorValue WHERE spiId = ?", spi.ID)
+		return []models.SPIValue{}, err
+	}
+	start := periodStart(time.UnixMilli(first.Int64).UTC(), month)
+	if earliest := addPeriods(end, month, -maxSPIHistoryMonths); start.Before(earliest) {
+		start = earliest
+	}
+
+	var bounds []time.Time
+	for t := start; t.Before(end); t = addPeriods(t, month, 1) {
+		bounds = append(bounds, t)
+	}
+	bounds = append(bounds, end)
+	months := len(bounds) - 1
+	counts := newTrendCounts(spi.ID, spi.Name, months)
+	latestEvent := make([]string, months)
+
+	flightTime := sqlEpochMillis("f.createdAt")
+	rows, err := exec.Query(`SELECT `+flightTime+` FROM Csv f
+		JOIN Aircraft a ON f.aircraftId = a.id
+		WHERE a.companyId = ? AND `+flightTime+` >= ? AND `+flightTime+` < ?`,
+		spi.CompanyID, start.UnixMilli(), end.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var createdAt int64
+		if err := rows.Scan(&createdAt); err != nil {
+			continue
+		}
+		if i := bucketIndex(bounds, time.UnixMilli(createdAt)); i >= 0 {
+			counts.flights[i]++
+		}
+	}
+	rows.Close()
+
+	var matches []string
+	args := []interface{}{spi.CompanyID, start.UnixMilli(), end.UnixMilli()}
+	if len(spi.EventCodes) > 0 {
+		matches = append(matches, "trim(el.eventCode) IN ("+placeholders(len(spi.EventCodes))+")")
+		args = append(args, stringArgs(spi.EventCodes)...)
+	}
+	if len(spi.EventTypes) > 0 {
+		matches = append(matches, "lower(el.eventType) IN ("+placeholders(len(spi.EventTypes))+")")
+		args = append(args, stringArgs(spi.EventTypes)...)
+	}
+	query := `SELECT e.id, ` + flightTime + ` FROM Exceedance e
+		JOIN Csv f ON e.flightId = f.id
+		JOIN Aircraft a ON f.aircraftId = a.id
+		JOIN EventLog el ON e.eventId = el.id
+		WHERE a.companyId = ? AND ` + flightTime + ` >= ? AND ` + flightTime + ` < ?
+		AND (` + strings.Join(matches, " OR ") + `)`
+	if len(spi.Severities) > 0 {
+		query += " AND lower(e.exceedanceLevel) IN (" + placeholders(len(spi.Severities)) + ")"
+		args = append(args, stringArgs(spi.Severities)...)
+	}
+	rows, err = exec.Query(query+" ORDER BY e.createdAt", args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		var createdAt int64
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			continue
+		}
+		if i := bucketIndex(bounds, time.UnixMilli(createdAt)); i >= 0 {
+			counts.events[i]++
+			latestEvent[i] = id
+		}
+	}
+	rows.Close()
+
+	values := make([]models.SPIValue, months)
+	for i := range values {
+		v := models.SPIValue{
+			Month:           periodLabel(bounds[i], month),
+			Flights:         counts.flights[i],
+			Events:          counts.events[i],
+			Value:           spiValue(spi, counts.events[i], counts.flights[i]),
+			AlertThresholds: []float64{},
+			ComputedAt:      now,
+		}
+
+		// The baseline is the preceding months that had flights
+		var baseline []float64
+		for j := i - spi.BaselineMonths; j < i; j++ {
+			if j >= 0 && counts.flights[j] > 0 {
+				baseline = append(baseline, values[j].Value)
+			}
+		}
+		if len(baseline) >= minSPIBaseline {
+			mean, stdDev := meanStdDev(baseline)
+			v.Mean, v.StdDev = &mean, &stdDev
+			for _, n := range spi.AlertSigmas {
+				threshold := round2(mean + n*stdDev)
+				v.AlertThresholds = append(v.AlertThresholds, threshold)
+				if v.Flights > 0 && v.Value > threshold {
+					v.AlertLevel++
+				}
+			}
+		}
+		v.TargetMet = spiTargetMet(spi, v)
+		values[i] = v
+
+		_, err := exec.Exec(`INSERT INTO SafetyPerformanceIndicatorValue
+			(spiId, month, flights, events, value, mean, stdDev, alertThresholds, alertLevel, computedAt)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(spiId, month) DO UPDATE SET flights = excluded.flights, events = excluded.events,
+				value = excluded.value, mean = excluded.mean, stdDev = excluded.stdDev,
+				alertThresholds = excluded.alertThresholds, alertLevel = excluded.alertLevel,
+				computedAt = excluded.computedAt`,
+			spi.ID, v.Month, v.Flights, v.Events, v.Value, v.Mean, v.StdDev, jsonText(v.AlertThresholds),
+			v.AlertLevel, now.UnixMilli())
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = exec.Exec("DELETE FROM SafetyPerformanceIndicatorValue WHERE spiId = ? AND month < ?", spi.ID, values[0].Month)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := months - spiNotifyMonths; i < months; i++ {
+		if i < 0 || values[i].AlertLevel == 0 {
+			continue
+		}
+		var notified int
+		err := exec.QueryRow("SELECT notifiedLevel FROM SafetyPerformanceIndicatorValue WHERE spiId = ? AND month = ?",
+			spi.ID, values[i].Month).Scan(&notified)
+		if err != nil {
+			return nil, err
+		}
+		if values[i].AlertLevel <= notified {
+			continue
+		}
+		if err := notifySPIBreach(exec, spi, values[i], latestEvent[i], now); err != nil {
+			return nil, err
+		}
+		_, err = exec.Exec("UPDATE SafetyPerformanceIndicatorValue SET notifiedLevel = ? WHERE spiId = ? AND month = ?",
+			values[i].AlertLevel, spi.ID, values[i].Month)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return values, nil
+}
+
+// notifySPIBreach notifies the company's active gatekeepers and FDAs that an SPI
+// breached an alert level. The notifications point at the latest exceedance
+// counted in the breached month.
+func notifySPIBreach(exec dbExecutor, spi models.SafetyPerformanceIndicator, v models.SPIValue, exceedanceID string, now time.Time) error {
+	if exceedanceID == "" {
+		return nil
+	}
+
+	rows, err := exec.Query(`SELECT id FROM User
+		WHERE isActive = 1 AND companyId = ? AND role IN ('gatekeeper', 'fda')`, spi.CompanyID)
+	if err != nil {
+		return err
+	}
+	var userIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			userIDs = append(userIDs, id)
+		}
+	}
+	rows.Close()
+
+	value := strconv.FormatFloat(v.Value, 'f', -1, 64)
+	threshold := strconv.FormatFloat(v.AlertThresholds[v.AlertLevel-1], 'f', -1, 64)
+	unit := " events"
+	if spi.Formula == models.SPIFormulaRate {
+		unit = " per " + strconv.Itoa(spi.RatePer) + " flights"
+	}
+	message := fmt.Sprintf("SPI %s breached alert level %d in %s: %s%s (alert level above %s%s)",
+		spi.Name, v.AlertLevel, v.Month, value, unit, threshold, unit)
+
+	target, err := exceedanceTarget(exec, exceedanceID)
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if _, err := createNotification(exec, userID, target, message, strconv.Itoa(v.AlertLevel), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSPIValues reads the stored history of an SPI, oldest first, or only the
+// latest month
+func loadSPIValues(exec dbExecutor, spi models.SafetyPerformanceIndicator, latest bool) ([]models.SPIValue, error) {
+	query := `SELECT month, flights, events, value, mean, stdDev, alertThresholds, alertLevel, computedAt
+		FROM SafetyPerformanceIndicatorValue WHERE spiId = ? ORDER BY month`
+	if latest {
+		query += " DESC LIMIT 1"
+	}
+	rows, err := exec.Query(query, spi.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []models.SPIValue{}
+	for rows.Next() {
+		var v models.SPIValue
+		var thresholds string
+		var computedAt int64
+		err := rows.Scan(&v.Month, &v.Flights, &v.Events, &v.Value, &v.Mean, &v.StdDev, &thresholds,
+			&v.AlertLevel, &computedAt)
+		if err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(thresholds), &v.AlertThresholds)
+		if v.AlertThresholds == nil {
+			v.AlertThresholds = []float64{}
+		}
+		v.TargetMet = spiTargetMet(spi, v)
+		v.ComputedAt = time.UnixMilli(computedAt)
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
+
+// spiValue applies the SPI formula
+func spiValue(spi models.SafetyPerformanceIndicator, events, flights int) float64 {
+	if spi.Formula == models.SPIFormulaCount {
+		return float64(events)
+	}
+	if flights == 0 {
+		return 0
+	}
+	return round2(float64(events) * float64(spi.RatePer) / float64(flights))
+}
+
+// spiTargetMet reports whether a month with flights stayed at or below target
+func spiTargetMet(spi models.SafetyPerformanceIndicator, v models.SPIValue) *bool {
+	if spi.Target == nil || v.Flights == 0 {
+		return nil
+	}
+	met := v.Value <= *spi.Target
+	return &met
+}
+
+// meanStdDev returns the mean and sample standard deviation of values
+func meanStdDev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+	if len(values) < 2 {
+		return round2(mean), 0
+	}
+	var squares float64
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return round2(mean), round2(math.Sqrt(squares / float64(len(values)-1)))
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fdm-backend/middleware"
+	"fdm-backend/models"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Events are written to StreamEvent by publishEvent, usually inside the
+// transaction that caused them. The hub polls the table for new rows and fans
+// them out to the connected streams; a client reconnecting with Last-Event-ID
+// first replays the rows it missed from the table.
+
+const (
+	streamPollInterval = time.Second
+	streamHeartbeat    = 25 * time.Second // also how often the session is checked
+	streamRetention    = 24 * time.Hour
+	streamReplayLimit  = 500
+	streamBuffer       = 64
+)
+
+// StreamHandler serves the server-sent event stream
+type StreamHandler struct {
+	db *sql.DB
+}
+
+func NewStreamHandler(db *sql.DB) *StreamHandler {
+	return &StreamHandler{db: db}
+}
+
+// streamEvent is a row of StreamEvent
+type streamEvent struct {
+	id        int64
+	eventType string
+	userID    string
+	companyID string
+	data      string
+}
+
+// streamSubscriber is a connected client
+type streamSubscriber struct {
+	userID    string
+	companyID string
+	all       bool // admins and FDAs receive the events of every company
+	types     []string
+	events    chan streamEvent
+}
+
+// receives reports whether an event is addressed to the subscriber
+func (s *streamSubscriber) receives(e streamEvent) bool {
+	if len(s.types) > 0 && !containsString(s.types, e.eventType) {
+		return false
+	}
+	if e.userID != "" {
+		return e.userID == s.userID
+	}
+	return s.all || (e.companyID != "" && e.companyID == s.companyID)
+}
+
+// condition is the SQL form of receives
+func (s *streamSubscriber) condition() (string, []interface{}) {
+	condition := "(userId = ? OR (userId IS NULL AND companyId = ?))"
+	if s.all {
+		condition = "(userId = ? OR userId IS NULL)"
+	}
+	args := []interface{}{s.userID}
+	if !s.all {
+		args = append(args, s.companyID)
+	}
+	if len(s.types) > 0 {
+		condition += " AND type IN (" + placeholders(len(s.types)) + ")"
+		args = append(args, stringArgs(s.types)...)
+	}
+	return condition, args
+}
+
+// streamHub fans out new events to the connected subscribers
+type streamHub struct {
+	mu          sync.Mutex
+	subscribers map[*streamSubscriber]struct{}
+	lastID      int64
+}
+
+var streams = &streamHub{subscribers: map[*streamSubscriber]struct{}{}}
+
+func (h *streamHub) subscribe(s *streamSubscriber) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[s] = struct{}{}
+	return h.lastID
+}
+
+func (h *streamHub) unsubscribe(s *streamSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[s]; ok {
+		delete(h.subscribers, s)
+		close(s.events)
+	}
+}
+
+// broadcast delivers events to the subscribers they are addressed to. A
+// subscriber that cannot keep up is disconnected; it resumes from its last
+// event id when it reconnects.
+func (h *streamHub) broadcast(events []streamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, e := range events {
+		for s := range h.subscribers {
+			if !s.receives(e) {
+				continue
+			}
+			select {
+			case s.events <- e:
+			default:
+				delete(h.subscribers, s)
+				close(s.events)
+			}
+		}
+		h.lastID = e.id
+	}
+}
+
+// skipTo moves past events nobody was connected to receive
+func (h *streamHub) skipTo(id int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subscribers) == 0 && id > h.lastID {
+		h.lastID = id
+	}
+}
+
+func (h *streamHub) last() (int64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastID, len(h.subscribers) == 0
+}
+
+// publishEvent records an event for the stream. userID addresses it to one
+// user; otherwise it goes to the users of companyID.
+func publishEvent(exec dbExecutor, eventType, userID, companyID string, payload interface{}, now time.Time) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec("INSERT INTO StreamEvent (type, userId, companyId, data, createdAt) VALUES (?, ?, ?, ?, ?)",
+		eventType, nullIfEmpty(userID), nullIfEmpty(companyID), string(data), now.UnixMilli())
+	return err
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// publishIngestProgress records ingest progress, logging instead of failing
+// the job when it cannot
+func publishIngestProgress(exec dbExecutor, userID, companyID string, progress models.IngestProgress) {
+	if err := publishEvent(exec, models.StreamEventIngestProgress, userID, companyID, progress, time.Now()); err != nil {
+		log.Printf("Error publishing ingest progress for %s: %v", progress.JobID, err)
+	}
+}
+
+func scanStreamEvents(rows *sql.Rows) ([]streamEvent, error) {
+	defer rows.Close()
+	var events []streamEvent
+	for rows.Next() {
+		var e streamEvent
+		var userID, companyID sql.NullString
+		if err := rows.Scan(&e.id, &e.eventType, &userID, &companyID, &e.data); err != nil {
+			return nil, err
+		}
+		e.userID, e.companyID = userID.String, companyID.String
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+const streamEventColumns = "id, type, userId, companyId, data"
+
+// MonitorStreams delivers new events to the connected streams and removes
+// events past the retention until the process exits
+func (h *StreamHandler) MonitorStreams() {
+	var latest int64
+	if err := h.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM StreamEvent").Scan(&latest); err != nil {
+		log.Println("Error reading last stream event:", err)
+	}
+	streams.skipTo(latest)
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+	lastPrune := time.Time{}
+	for now := range ticker.C {
+		if now.Sub(lastPrune) >= time.Hour {
+			if _, err := h.db.Exec("DELETE FROM StreamEvent WHERE createdAt < ?", now.Add(-streamRetention).UnixMilli()); err != nil {
+				log.Println("Error pruning stream events:", err)
+			}
+			lastPrune = now
+		}
+		lastID, idle := streams.last()
+		if idle {
+			// Nobody to deliver to; new subscribers start from the latest event
+			if err := h.db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM StreamEvent").Scan(&latest); err == nil {
+				streams.skipTo(latest)
+			}
+			continue
+		}
+		rows, err := h.db.Query("SELECT "+streamEventColumns+" FROM StreamEvent WHERE id > ? ORDER BY id", lastID)
+		if err != nil {
+			log.Println("Error polling stream events:", err)
+			continue
+		}
+		events, err := scanStreamEvents(rows)
+		if err != nil {
+			log.Println("Error polling stream events:", err)
+			continue
+		}
+		streams.broadcast(events)
+	}
+}
+
+// lastEventID returns the id the client resumes after, from the Last-Event-ID
+// header sent by EventSource on reconnect or the lastEventId query parameter
+func lastEventID(c *gin.Context) (int64, bool) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("lastEventId")
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || id < 0 {
+		return 0, false
+	}
+	return id, true
+}
+
+// Stream pushes notifications, exceedance status changes and ingest progress
+// to the user as server-sent events.
+//
+//	GET /api/stream?types=notification,exceedance_status
+func (h *StreamHandler) Stream(c *gin.Context) {
+	types := cleanList(splitList(c.Query("types")), true)
+	for _, t := range types {
+		if !containsString(models.StreamEventTypes, t) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event type: " + t, "allowed": models.StreamEventTypes})
+			return
+		}
+	}
+	tenant := tenantOf(c)
+	subscriber := &streamSubscriber{
+		userID:    c.GetString("userId"),
+		companyID: tenant.companyID,
+		all:       tenant.all,
+		types:     types,
+		events:    make(chan streamEvent, streamBuffer),
+	}
+	sessionID := c.GetString("sessionId")
+
+	// Subscribe before replaying so nothing published in between is lost;
+	// events delivered by both are sent once
+	sent := streams.subscribe(subscriber)
+	defer streams.unsubscribe(subscriber)
+
+	var replay []streamEvent
+	reset := false
+	if after, ok := lastEventID(c); ok && after < sent {
+		condition, args := subscriber.condition()
+		args = append([]interface{}{after}, args...)
+		rows, err := h.db.Query("SELECT "+streamEventColumns+" FROM StreamEvent WHERE id > ? AND "+condition+
+			" ORDER BY id LIMIT "+strconv.Itoa(streamReplayLimit+1), args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if replay, err = scanStreamEvents(rows); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if len(replay) > streamReplayLimit {
+			replay, reset = nil, true
+		} else {
+			sent = after
+		}
+	}
+
+	w := c.Writer
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+
+	send := func(e streamEvent) {
+		if e.id <= sent {
+			return
+		}
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.id, e.eventType, e.data)
+		sent = e.id
+	}
+	if reset {
+		// The client missed too much; it reloads its state and continues from here
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: {}\n\n", sent, models.StreamEventReset)
+	} else {
+		for _, e := range replay {
+			send(e)
+		}
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-subscriber.events:
+			if !ok {
+				return // too slow; the client reconnects and replays
+			}
+			send(e)
+			w.Flush()
+		case <-heartbeat.C:
+			if !middleware.SessionValid(subscriber.userID, sessionID) {
+				fmt.Fprint(w, "event: session_ended\ndata: {}\n\n")
+				w.Flush()
+				return
+			}
+			fmt.Fprint(w, ": ping\n\n")
+			w.Flush()
+		}
+	}
+}
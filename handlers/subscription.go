@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"database/sql"
+	"fdm-backend/mailer"
 	"fdm-backend/models"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
@@ -127,7 +130,7 @@ func (h *SubscriptionHandler) GetSubscriptionByID(c *gin.Context) {
 
 // GetSubscriptionStatus retrieves subscription status with usage
 func (h *SubscriptionHandler) GetSubscriptionStatus(c *gin.Context) {
-	companyID := c.Param("companyId")
+	companyID := c.Param("id") // the route shares its :id with the subscription routes
 
 	// Get company
 	var subscriptionID *string
@@ -160,16 +163,17 @@ func (h *SubscriptionHandler) GetSubscriptionStatus(c *gin.Context) {
 		status = "expiring_soon"
 	}
 
-	// Get usage statistics
-	var usersUsed, aircraftUsed, flightsUsed int
-	var storageUsedGB float64
-
-	h.db.QueryRow("SELECT COUNT(*) FROM User WHERE companyId = ?", companyID).Scan(&usersUsed)
-	h.db.QueryRow("SELECT COUNT(*) FROM Aircraft WHERE companyId = ?", companyID).Scan(&aircraftUsed)
-	h.db.QueryRow("SELECT COUNT(*) FROM Csv WHERE aircraftId IN (SELECT id FROM Aircraft WHERE companyId = ?)", companyID).Scan(&flightsUsed)
-
-	// Calculate storage (simplified - you may want to sum actual file sizes)
-	storageUsedGB = float64(flightsUsed) * 0.5 // Assume 0.5GB per flight average
+	// Get usage statistics, counted like the subscription quotas: active
+	// users, flights uploaded this month and the bytes of stored files
+	used := map[string]int64{}
+	for _, resource := range models.QuotaResources {
+		n, err := quotaUsed(h.db, companyID, resource, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to measure usage", "details": err.Error()})
+			return
+		}
+		used[resource] = n
+	}
 
 	subscriptionStatus := models.SubscriptionStatus{
 		IsActive:       subscription.IsActive && status != "expired",
@@ -177,13 +181,13 @@ func (h *SubscriptionHandler) GetSubscriptionStatus(c *gin.Context) {
 		Status:         status,
 		EndDate:        subscription.EndDate,
 		PlanName:       subscription.PlanName,
-		UsersUsed:      usersUsed,
+		UsersUsed:      int(used[models.QuotaUsers]),
 		UsersLimit:     subscription.MaxUsers,
-		AircraftUsed:   aircraftUsed,
+		AircraftUsed:   int(used[models.QuotaAircraft]),
 		AircraftLimit:  subscription.MaxAircraft,
-		FlightsUsed:    flightsUsed,
+		FlightsUsed:    int(used[models.QuotaFlights]),
 		FlightsLimit:   subscription.MaxFlightsPerMonth,
-		StorageUsedGB:  storageUsedGB,
+		StorageUsedGB:  round2(float64(used[models.QuotaStorage]) / gigabyte),
 		StorageLimitGB: subscription.MaxStorageGB,
 	}
 
@@ -316,13 +320,33 @@ func (h *SubscriptionHandler) DeleteSubscription(c *gin.Context) {
 		return
 	}
 
+	if _, err := h.db.Exec("DELETE FROM Notification WHERE subscriptionId = ?", id); err != nil {
+		log.Printf("Warning: Failed to delete subscription notifications: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Subscription deleted successfully"})
 }
 
-// CheckExpiredSubscriptions checks and updates expired subscriptions
+// CheckExpiredSubscriptions checks and updates expired subscriptions. The
+// subscription_expiry job does the same every hour.
 func (h *SubscriptionHandler) CheckExpiredSubscriptions(c *gin.Context) {
-	now := time.Now()
+	expiredCompanies, expiringCompanies, err := h.checkExpiredSubscriptions(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check subscriptions", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Subscription check completed",
+		"expiredCompanies":  expiredCompanies,
+		"expiringCompanies": expiringCompanies,
+	})
+}
 
+// checkExpiredSubscriptions suspends companies whose subscription has expired
+// and warns those whose subscription expires within 7 days. It returns the
+// names of both.
+func (h *SubscriptionHandler) checkExpiredSubscriptions(now time.Time) ([]string, []string, error) {
 	// Get all companies with active subscriptions
 	query := `
 		SELECT c.id, c.name, c.email, s.endDate, s.id as subscriptionId
@@ -333,24 +357,31 @@ func (h *SubscriptionHandler) CheckExpiredSubscriptions(c *gin.Context) {
 
 	rows, err := h.db.Query(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check subscriptions", "details": err.Error()})
-		return
+		return nil, nil, err
 	}
-	defer rows.Close()
-
-	expiredCompanies := []string{}
-	expiringCompanies := []string{}
-
+	type companySubscription struct {
+		companyID, companyName, companyEmail, subscriptionID string
+		endDate                                              time.Time
+	}
+	var companies []companySubscription
 	for rows.Next() {
-		var companyID, companyName, companyEmail, subscriptionID string
-		var endDate time.Time
-
-		err := rows.Scan(&companyID, &companyName, &companyEmail, &endDate, &subscriptionID)
+		var cs companySubscription
+		err := rows.Scan(&cs.companyID, &cs.companyName, &cs.companyEmail, &cs.endDate, &cs.subscriptionID)
 		if err != nil {
 			continue
 		}
+		companies = append(companies, cs)
+	}
+	// Close the cursor before writing; an open read blocks the updates below
+	rows.Close()
 
-		daysRemaining := int(time.Until(endDate).Hours() / 24)
+	expiredCompanies := []string{}
+	expiringCompanies := []string{}
+
+	for _, cs := range companies {
+		companyID, companyName, companyEmail, subscriptionID, endDate := cs.companyID, cs.companyName, cs.companyEmail, cs.subscriptionID, cs.endDate
+
+		daysRemaining := int(endDate.Sub(now).Hours() / 24)
 
 		if daysRemaining <= 0 {
 			// Suspend expired companies
@@ -366,15 +397,70 @@ func (h *SubscriptionHandler) CheckExpiredSubscriptions(c *gin.Context) {
 
 			if alertSentAt == nil || time.Since(*alertSentAt).Hours() > 24 {
 				h.db.Exec("UPDATE Subscription SET alertSentAt = ? WHERE id = ?", now, subscriptionID)
+				if err := h.queueExpiryWarnings(companyID, companyName, companyEmail, subscriptionID, endDate, daysRemaining, now); err != nil {
+					log.Println("Error queueing subscription expiry emails:", err)
+				}
+				event := models.SubscriptionExpiringEvent{
+					CompanyID:     companyID,
+					CompanyName:   companyName,
+					EndDate:       endDate,
+					DaysRemaining: daysRemaining,
+				}
+				if err := queueWebhooks(h.db, companyID, models.WebhookEventSubscriptionExpiring, event, now); err != nil {
+					log.Println("Error queueing subscription expiry webhooks:", err)
+				}
 			}
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message":           "Subscription check completed",
-		"expiredCompanies":  expiredCompanies,
-		"expiringCompanies": expiringCompanies,
-	})
+	wakeEmailWorker()
+	wakeWebhookWorker()
+
+	return expiredCompanies, expiringCompanies, nil
+}
+
+// queueExpiryWarnings emails the company address and its active gatekeepers
+// that the subscription expires soon, and notifies the gatekeepers in the app
+func (h *SubscriptionHandler) queueExpiryWarnings(companyID, companyName, companyEmail, subscriptionID string, endDate time.Time, daysRemaining int, now time.Time) error {
+	data := map[string]interface{}{
+		"Company":       companyName,
+		"EndDate":       endDate.Format("2 January 2006"),
+		"DaysRemaining": daysRemaining,
+	}
+	if _, err := queueEmail(h.db, nil, nil, companyEmail, mailer.TemplateSubscriptionExpiring, data, now); err != nil {
+		return err
+	}
+
+	rows, err := h.db.Query("SELECT id, email != ? FROM User WHERE companyId = ? AND role = ? AND isActive = 1",
+		companyEmail, companyID, models.RoleGatekeeper)
+	if err != nil {
+		return err
+	}
+	var userIDs, emailIDs []string
+	for rows.Next() {
+		var id string
+		var email bool
+		if err := rows.Scan(&id, &email); err == nil {
+			userIDs = append(userIDs, id)
+			if email {
+				emailIDs = append(emailIDs, id)
+			}
+		}
+	}
+	rows.Close()
+	for _, userID := range emailIDs {
+		if err := queueUserEmail(h.db, userID, nil, mailer.TemplateSubscriptionExpiring, data, now); err != nil {
+			return err
+		}
+	}
+
+	message := fmt.Sprintf("The %s subscription expires on %s", companyName, endDate.Format("2 January 2006"))
+	for _, userID := range userIDs {
+		if _, err := createNotification(h.db, userID, subscriptionTarget(subscriptionID), message, "subscription", now); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Helper function
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/models"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tenant isolation: admins and FDAs work across all operators, every other role
+// only reads and writes data owned by its own company. List queries are restricted
+// with tenantScope; single records are checked with a tenantResource before they
+// are read or changed.
+
+// tenantScope is the set of companies the requesting user may access
+type tenantScope struct {
+	all       bool
+	companyID string
+}
+
+// tenantOf returns the tenant scope of the requesting user
+func tenantOf(c *gin.Context) tenantScope {
+	role := c.GetString("userRole")
+	return tenantScope{
+		all:       role == models.RoleAdmin || role == models.RoleFDA,
+		companyID: c.GetString("userCompanyId"),
+	}
+}
+
+// allows reports whether data owned by companyID is within the scope
+func (t tenantScope) allows(companyID sql.NullString) bool {
+	if t.all {
+		return true
+	}
+	return companyID.Valid && t.companyID != "" && companyID.String == t.companyID
+}
+
+// condition returns a SQL condition limiting column to the scope. Users without
+// a company see nothing.
+func (t tenantScope) condition(column string) (string, []interface{}) {
+	if t.all {
+		return "1 = 1", nil
+	}
+	if t.companyID == "" {
+		return "1 = 0", nil
+	}
+	return column + " = ?", []interface{}{t.companyID}
+}
+
+// restrict limits a list query to the scope
+func (t tenantScope) restrict(q *listQuery, column string) {
+	condition, args := t.condition(column)
+	if condition != "1 = 1" {
+		q.where(condition, args...)
+	}
+}
+
+// nullString converts an optional company id to the form stored in the database
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+// canAccessCompanyData reports whether the requesting user may see data owned by a company.
+// Admins and FDAs work across all operators; other roles only see their own company.
+func canAccessCompanyData(c *gin.Context, companyID sql.NullString) bool {
+	return tenantOf(c).allows(companyID)
+}
+
+// tenantResource looks up the company owning a record
+type tenantResource struct {
+	name  string // used in "<name> not found" responses
+	query string // selects the owning company id for a record id
+}
+
+var (
+	exceedanceResource = tenantResource{"Exceedance", `SELECT a.companyId FROM Exceedance e
+		LEFT JOIN Aircraft a ON e.aircraftId = a.id
+		WHERE e.id = ?`}
+	flightResource = tenantResource{"Flight", `SELECT a.companyId FROM Csv f
+		LEFT JOIN Aircraft a ON f.aircraftId = a.id
+		WHERE f.id = ?`}
+	eventResource = tenantResource{"Event", `SELECT a.companyId FROM EventLog el
+		LEFT JOIN Aircraft a ON el.aircraftId = a.id
+		WHERE el.id = ?`}
+	aircraftResource         = tenantResource{"Aircraft", `SELECT companyId FROM Aircraft WHERE id = ?`}
+	companyResource          = tenantResource{"Company", `SELECT id FROM Company WHERE id = ?`}
+	userResource             = tenantResource{"User", `SELECT companyId FROM User WHERE id = ?`}
+	spiResource              = tenantResource{"SPI", `SELECT companyId FROM SafetyPerformanceIndicator WHERE id = ?`}
+	crewResource             = tenantResource{"Crew member", `SELECT companyId FROM CrewMember WHERE id = ?`}
+	reportResource           = tenantResource{"Report", `SELECT companyId FROM Report WHERE id = ?`}
+	reportScheduleResource   = tenantResource{"Report schedule", `SELECT companyId FROM ReportSchedule WHERE id = ?`}
+	notificationRuleResource = tenantResource{"Notification rule", `SELECT companyId FROM NotificationRule WHERE id = ?`}
+	webhookResource          = tenantResource{"Webhook", `SELECT companyId FROM Webhook WHERE id = ?`}
+	escalationPolicyResource = tenantResource{"Escalation policy", `SELECT companyId FROM EscalationPolicy WHERE id = ?`}
+)
+
+// companyID returns the company owning a record. sql.ErrNoRows is returned when
+// the record does not exist.
+func (r tenantResource) companyID(exec dbExecutor, id string) (sql.NullString, error) {
+	var companyID sql.NullString
+	err := exec.QueryRow(r.query, id).Scan(&companyID)
+	return companyID, err
+}
+
+// authorize writes an error response and returns false unless the record exists
+// and the requesting user may access it
+func (r tenantResource) authorize(c *gin.Context, exec dbExecutor, id string) bool {
+	companyID, err := r.companyID(exec, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": r.name + " not found"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return false
+	}
+	if !canAccessCompanyData(c, companyID) {
+		denyCrossTenant(c)
+		return false
+	}
+	return true
+}
+
+// authorizeUser is authorize for user records: users may always access their own
+// record, even when they do not belong to a company
+func authorizeUser(c *gin.Context, exec dbExecutor, userID string) bool {
+	if userID != "" && userID == c.GetString("userId") {
+		return true
+	}
+	return userResource.authorize(c, exec, userID)
+}
+
+// denyCrossTenant writes the response for requests touching another company's data
+func denyCrossTenant(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Access denied",
+		"message": "You can only access your own company's data",
+	})
+}
+
+// exceedanceCompanyID returns the company owning an exceedance's aircraft.
+// sql.ErrNoRows is returned when the exceedance does not exist.
+func exceedanceCompanyID(exec dbExecutor, exceedanceID string) (sql.NullString, error) {
+	return exceedanceResource.companyID(exec, exceedanceID)
+}
+
+// authorizeExceedance writes an error response and returns false unless the
+// exceedance exists and the requesting user may access it
+func authorizeExceedance(c *gin.Context, exec dbExecutor, exceedanceID string) bool {
+	return exceedanceResource.authorize(c, exec, exceedanceID)
+}
+
+// requestedCompany resolves the company a gatekeeper, admin or FDA acts for:
+// gatekeepers always act for their own company, admins and FDAs must name one.
+// It writes an error response and returns false when there is none.
+func requestedCompany(c *gin.Context, exec dbExecutor, requested *string) (string, bool) {
+	tenant := tenantOf(c)
+	companyID := ""
+	if requested != nil {
+		companyID = strings.TrimSpace(*requested)
+	}
+	if !tenant.all {
+		if companyID != "" && companyID != tenant.companyID {
+			denyCrossTenant(c)
+			return "", false
+		}
+		companyID = tenant.companyID
+	}
+	if companyID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "companyId is required"})
+		return "", false
+	}
+	if _, err := companyResource.companyID(exec, companyID); err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Company not found"})
+		return "", false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return "", false
+	}
+	return companyID, true
+}
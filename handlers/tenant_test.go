@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fdm-backend/database"
+	"fdm-backend/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Base tables created by Prisma; later columns and tables come from database/migrations
+const tenantTestSchema = `
+CREATE TABLE Subscription (id TEXT PRIMARY KEY, planName TEXT NOT NULL, planType TEXT NOT NULL, maxUsers INTEGER NOT NULL DEFAULT 5,
+	maxAircraft INTEGER NOT NULL DEFAULT 2, maxFlightsPerMonth INTEGER NOT NULL DEFAULT 100, maxStorageGB INTEGER NOT NULL DEFAULT 10,
+	price REAL NOT NULL, currency TEXT NOT NULL DEFAULT 'USD', startDate DATETIME NOT NULL, endDate DATETIME NOT NULL,
+	isActive BOOLEAN NOT NULL DEFAULT true, autoRenew BOOLEAN NOT NULL DEFAULT false, lastPaymentDate DATETIME, nextPaymentDate DATETIME,
+	alertSentAt DATETIME, createdAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, updatedAt DATETIME NOT NULL);
+CREATE TABLE Company (id TEXT PRIMARY KEY, name TEXT NOT NULL, email TEXT NOT NULL, phone TEXT, address TEXT, country TEXT, logo TEXT,
+	status TEXT NOT NULL DEFAULT 'active', subscriptionId TEXT, createdAt DATETIME NOT NULL, updatedAt DATETIME NOT NULL);
+CREATE TABLE User (id TEXT PRIMARY KEY, email TEXT NOT NULL UNIQUE, role TEXT NOT NULL DEFAULT 'user', fullName TEXT, designation TEXT,
+	department TEXT, username TEXT, password TEXT, image TEXT, phone TEXT, isActive BOOLEAN NOT NULL DEFAULT true, companyId TEXT,
+	lastLoginAt DATETIME, createdAt DATETIME NOT NULL, updatedAt DATETIME NOT NULL);
+CREATE TABLE Aircraft (id TEXT PRIMARY KEY, airline TEXT NOT NULL, aircraftMake TEXT NOT NULL, modelNumber TEXT, serialNumber TEXT NOT NULL,
+	registration TEXT, companyId TEXT NOT NULL, parameters TEXT, createdAt DATETIME NOT NULL, updatedAt DATETIME NOT NULL);
+CREATE TABLE Csv (id TEXT PRIMARY KEY, name TEXT NOT NULL, file TEXT NOT NULL, status TEXT, departure TEXT, pilot TEXT, destination TEXT,
+	flightHours TEXT, aircraftId TEXT NOT NULL, createdAt DATETIME NOT NULL, updatedAt DATETIME NOT NULL);
+CREATE TABLE EventLog (id TEXT PRIMARY KEY, eventName TEXT, displayName TEXT NOT NULL, eventCode TEXT NOT NULL, eventDescription TEXT NOT NULL,
+	eventParameter TEXT NOT NULL, eventTrigger TEXT NOT NULL, eventType TEXT NOT NULL, flightPhase TEXT NOT NULL, high TEXT, high1 TEXT,
+	high2 TEXT, low TEXT, low1 TEXT, low2 TEXT, sop TEXT NOT NULL, aircraftId TEXT NOT NULL, createdAt DATETIME NOT NULL,
+	updatedAt DATETIME NOT NULL, detectionPeriod TEXT, severities TEXT, triggerType TEXT);
+CREATE TABLE Exceedance (id TEXT PRIMARY KEY, exceedanceValues TEXT NOT NULL, flightPhase TEXT NOT NULL, parameterName TEXT NOT NULL,
+	description TEXT NOT NULL, eventStatus TEXT NOT NULL, aircraftId TEXT NOT NULL, flightId TEXT NOT NULL, file TEXT, eventId TEXT,
+	createdAt DATETIME NOT NULL, updatedAt DATETIME NOT NULL, exceedanceLevel TEXT, comment TEXT);
+CREATE TABLE Notification (id TEXT PRIMARY KEY, userId TEXT NOT NULL, exceedanceId TEXT NOT NULL, message TEXT NOT NULL, level TEXT NOT NULL,
+	isRead BOOLEAN NOT NULL DEFAULT false, createdAt DATETIME NOT NULL, updatedAt DATETIME NOT NULL);
+`
+
+// Two operators, A and B, each with a gatekeeper, an aircraft, a flight, an event and an exceedance
+const tenantTestFixtures = `
+INSERT INTO Company (id, name, email, createdAt, updatedAt) VALUES
+	('company-a', 'Operator A', 'ops@a.test', :now, :now),
+	('company-b', 'Operator B', 'ops@b.test', :now, :now);
+INSERT INTO User (id, email, role, fullName, username, companyId, createdAt, updatedAt) VALUES
+	('admin', 'admin@fdm.test', 'admin', 'Admin', 'admin', NULL, :now, :now),
+	('fda', 'fda@fdm.test', 'fda', 'Analyst', 'fda', NULL, :now, :now),
+	('gatekeeper-a', 'gk@a.test', 'gatekeeper', 'Gatekeeper A', 'gka', 'company-a', :now, :now),
+	('gatekeeper-b', 'gk@b.test', 'gatekeeper', 'Gatekeeper B', 'gkb', 'company-b', :now, :now),
+	('user-b', 'user@b.test', 'user', 'User B', 'userb', 'company-b', :now, :now);
+INSERT INTO Aircraft (id, airline, aircraftMake, serialNumber, companyId, createdAt, updatedAt) VALUES
+	('aircraft-a', 'Operator A', 'Dash 8', '5Y-AAA', 'company-a', :ms, :ms),
+	('aircraft-b', 'Operator B', 'Dash 8', '5Y-BBB', 'company-b', :ms, :ms);
+INSERT INTO Csv (id, name, file, aircraftId, createdAt, updatedAt) VALUES
+	('flight-a', 'Flight A', 'flight-a.csv', 'aircraft-a', :now, :now),
+	('flight-b', 'Flight B', 'flight-b.csv', 'aircraft-b', :now, :now);
+INSERT INTO EventLog (id, displayName, eventCode, eventDescription, eventParameter, eventTrigger, eventType, flightPhase, sop, aircraftId, createdAt, updatedAt) VALUES
+	('event-a', 'High pitch', 'E1', 'Pitch', 'PITCH', '>', 'exceedance', 'TAKEOFF', 'SOP', 'aircraft-a', :ms, :ms),
+	('event-b', 'High pitch', 'E1', 'Pitch', 'PITCH', '>', 'exceedance', 'TAKEOFF', 'SOP', 'aircraft-b', :ms, :ms);
+INSERT INTO Exceedance (id, exceedanceValues, flightPhase, parameterName, description, eventStatus, aircraftId, flightId, eventId, exceedanceLevel, createdAt, updatedAt) VALUES
+	('exceedance-a', '12', 'TAKEOFF', 'PITCH', 'High pitch', 'new', 'aircraft-a', 'flight-a', 'event-a', 'high', :ms, :ms),
+	('exceedance-b', '12', 'TAKEOFF', 'PITCH', 'High pitch', 'new', 'aircraft-b', 'flight-b', 'event-b', 'high', :ms, :ms);
+INSERT INTO Notification (id, userId, exceedanceId, message, level, isRead, createdAt, updatedAt) VALUES
+	('notification-b', 'gatekeeper-b', 'exceedance-b', 'High pitch', 'high', false, :ms, :ms);
+`
+
+type tenantActor struct {
+	userID    string
+	role      string
+	companyID string
+}
+
+var (
+	adminActor       = tenantActor{"admin", models.RoleAdmin, ""}
+	fdaActor         = tenantActor{"fda", models.RoleFDA, ""}
+	gatekeeperAActor = tenantActor{"gatekeeper-a", models.RoleGatekeeper, "company-a"}
+)
+
+// newTenantTestDB creates a database with two operators, migrated like production
+func newTenantTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tenant.db")+"?_pragma=busy_timeout(5000)&_txlock=immediate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(tenantTestSchema); err != nil {
+		t.Fatal("creating schema:", err)
+	}
+
+	// RunMigrations reads database/migrations relative to the repository root
+	wd, _ := os.Getwd()
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	err = database.RunMigrations(db)
+	os.Chdir(wd)
+	if err != nil {
+		t.Fatal("running migrations:", err)
+	}
+
+	now := time.Now()
+	if _, err := db.Exec(tenantTestFixtures, sql.Named("now", now), sql.Named("ms", now.UnixMilli())); err != nil {
+		t.Fatal("inserting fixtures:", err)
+	}
+	return db
+}
+
+// newTenantTestRouter registers the server routes, authenticating every request as actor
+func newTenantTestRouter(db *sql.DB, actor tenantActor) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterRoutes(router, db, func(c *gin.Context) {
+		c.Set("userId", actor.userID)
+		c.Set("userRole", actor.role)
+		if actor.companyID != "" {
+			c.Set("userCompanyId", actor.companyID)
+		}
+	})
+	return router
+}
+
+type tenantRequest struct {
+	method string
+	path   string
+	body   string
+	form   url.Values
+}
+
+func (r tenantRequest) serve(router *gin.Engine) *httptest.ResponseRecorder {
+	var req *http.Request
+	if r.form != nil {
+		req = httptest.NewRequest(r.method, r.path, strings.NewReader(r.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTenantListsOnlyReturnOwnCompanyData(t *testing.T) {
+	db := newTenantTestDB(t)
+
+	lists := []struct {
+		path string
+		own  string
+	}{
+		{"/api/exceedances", "exceedance-a"},
+		{"/api/csv", "flight-a"},
+		{"/api/events", "event-a"},
+		{"/api/aircrafts", "aircraft-a"},
+	}
+
+	for _, list := range lists {
+		t.Run(list.path, func(t *testing.T) {
+			w := tenantRequest{method: http.MethodGet, path: list.path}.serve(newTenantTestRouter(db, gatekeeperAActor))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", w.Code, w.Body)
+			}
+			var rows []struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &rows); err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 1 || rows[0].ID != list.own {
+				t.Errorf("rows = %+v, want only %s", rows, list.own)
+			}
+			if total := w.Header().Get("X-Total-Count"); total != "1" {
+				t.Errorf("X-Total-Count = %s, want 1", total)
+			}
+
+			for _, actor := range []tenantActor{adminActor, fdaActor} {
+				w := tenantRequest{method: http.MethodGet, path: list.path}.serve(newTenantTestRouter(db, actor))
+				if total := w.Header().Get("X-Total-Count"); total != "2" {
+					t.Errorf("%s: X-Total-Count = %s, want 2", actor.role, total)
+				}
+			}
+		})
+	}
+}
+
+func TestCrossTenantReadsAreRejected(t *testing.T) {
+	db := newTenantTestDB(t)
+	router := newTenantTestRouter(db, gatekeeperAActor)
+
+	paths := []string{
+		"/api/exceedances/exceedance-b",
+		"/api/exceedances/exceedance-b/history",
+		"/api/exceedances/exceedance-b/comments",
+		"/api/exceedances/exceedance-b/attachments",
+		"/api/exceedances/flight/flight-b",
+		"/api/flight/flight-b",
+		"/api/csv/flight-b",
+		"/api/csv/flight-b.csv",
+		"/api/events/event-b",
+		"/api/aircrafts/aircraft-b",
+		"/api/aircrafts/company/company-b",
+		"/api/companies/company-b",
+		"/api/users/gatekeeper-b",
+		"/api/users/email/gk@b.test",
+		"/api/users/company/company-b",
+		"/api/notifications/user/gatekeeper-b",
+	}
+
+	for _, path := range paths {
+		w := tenantRequest{method: http.MethodGet, path: path}.serve(router)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("GET %s: status = %d, want %d (body %s)", path, w.Code, http.StatusForbidden, w.Body)
+		}
+	}
+}
+
+func TestCrossTenantWritesAreRejected(t *testing.T) {
+	db := newTenantTestDB(t)
+	router := newTenantTestRouter(db, gatekeeperAActor)
+
+	requests := []struct {
+		name string
+		req  tenantRequest
+		want int
+	}{
+		{"change exceedance status", tenantRequest{method: http.MethodPut, path: "/api/exceedances/exceedance-b",
+			body: `{"eventStatus":"closed"}`}, http.StatusForbidden},
+		{"comment on exceedance", tenantRequest{method: http.MethodPost, path: "/api/exceedances/exceedance-b/comments",
+			body: `{"body":"looks fine"}`}, http.StatusForbidden},
+		{"bulk comment", tenantRequest{method: http.MethodPost, path: "/api/exceedances/bulk",
+			body: `{"action":"comment","comment":"looks fine","ids":["exceedance-a","exceedance-b"]}`}, http.StatusUnprocessableEntity},
+		{"create exceedance", tenantRequest{method: http.MethodPost, path: "/api/exceedances",
+			body: `[{"aircraftId":"aircraft-b","flightId":"flight-b","exceedanceValues":"1","flightPhase":"TAKEOFF","parameterName":"PITCH","description":"x"}]`}, http.StatusBadRequest},
+		{"upload flight", tenantRequest{method: http.MethodPost, path: "/api/csv",
+			form: url.Values{"name": {"Flight"}, "aircraftId": {"aircraft-b"}}}, http.StatusForbidden},
+		{"create event", tenantRequest{method: http.MethodPost, path: "/api/events",
+			body: `{"displayName":"x","eventCode":"E2","eventDescription":"x","eventParameter":"x","eventTrigger":"x","eventType":"x","flightPhase":"x","sop":"x","aircraftId":"aircraft-b"}`}, http.StatusForbidden},
+		{"create aircraft", tenantRequest{method: http.MethodPost, path: "/api/aircrafts",
+			body: `{"airline":"x","aircraftMake":"x","serialNumber":"5Y-CCC","companyId":"company-b"}`}, http.StatusForbidden},
+		{"update aircraft", tenantRequest{method: http.MethodPut, path: "/api/aircrafts/aircraft-b",
+			body: `{"airline":"x","aircraftMake":"x","serialNumber":"5Y-BBB","companyId":"company-b"}`}, http.StatusForbidden},
+		{"move aircraft to another company", tenantRequest{method: http.MethodPut, path: "/api/aircrafts/aircraft-a",
+			body: `{"airline":"x","aircraftMake":"x","serialNumber":"5Y-AAA","companyId":"company-b"}`}, http.StatusForbidden},
+		{"create user", tenantRequest{method: http.MethodPost, path: "/api/users",
+			body: `{"fullName":"x","role":"user","username":"x","email":"x@b.test","password":"secret","companyId":"company-b"}`}, http.StatusForbidden},
+		{"update user", tenantRequest{method: http.MethodPut, path: "/api/users/user-b",
+			body: `{"fullName":"x"}`}, http.StatusForbidden},
+		{"mark notification read", tenantRequest{method: http.MethodPut, path: "/api/notifications/notification-b/read"}, http.StatusForbidden},
+		{"mark all notifications read", tenantRequest{method: http.MethodPut, path: "/api/notifications/user/gatekeeper-b/mark-all-read"}, http.StatusForbidden},
+	}
+
+	for _, tc := range requests {
+		w := tc.req.serve(router)
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d (body %s)", tc.name, w.Code, tc.want, w.Body)
+		}
+	}
+
+	// Nothing owned by operator B may have changed
+	checks := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT eventStatus FROM Exceedance WHERE id = 'exceedance-b'", "new"},
+		{"SELECT COUNT(*) FROM ExceedanceComment", "0"},
+		{"SELECT COUNT(*) FROM Exceedance", "2"},
+		{"SELECT COUNT(*) FROM Csv", "2"},
+		{"SELECT COUNT(*) FROM EventLog", "2"},
+		{"SELECT COUNT(*) FROM Aircraft WHERE companyId = 'company-b'", "1"},
+		{"SELECT airline FROM Aircraft WHERE id = 'aircraft-b'", "Operator B"},
+		{"SELECT COUNT(*) FROM User", "5"},
+		{"SELECT fullName FROM User WHERE id = 'user-b'", "User B"},
+		{"SELECT COUNT(*) FROM Notification WHERE isRead", "0"},
+	}
+	for _, check := range checks {
+		var got string
+		if err := db.QueryRow(check.query).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != check.want {
+			t.Errorf("%s = %s, want %s", check.query, got, check.want)
+		}
+	}
+}
+
+func TestGatekeepersCannotGrantCrossTenantRoles(t *testing.T) {
+	db := newTenantTestDB(t)
+	router := newTenantTestRouter(db, gatekeeperAActor)
+
+	w := tenantRequest{method: http.MethodPost, path: "/api/users",
+		body: `{"fullName":"x","role":"admin","username":"x","email":"x@a.test","password":"secret"}`}.serve(router)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("create admin: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = tenantRequest{method: http.MethodPut, path: "/api/users/gatekeeper-a", body: `{"role":"fda"}`}.serve(router)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("promote to fda: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestOwnCompanyAndCrossTenantRolesAreAllowed(t *testing.T) {
+	db := newTenantTestDB(t)
+
+	cases := []struct {
+		actor tenantActor
+		path  string
+	}{
+		{gatekeeperAActor, "/api/exceedances/exceedance-a"},
+		{gatekeeperAActor, "/api/flight/flight-a"},
+		{gatekeeperAActor, "/api/events/event-a"},
+		{gatekeeperAActor, "/api/aircrafts/aircraft-a"},
+		{gatekeeperAActor, "/api/users/gatekeeper-a"},
+		{gatekeeperAActor, "/api/users/company/company-a"},
+		{adminActor, "/api/exceedances/exceedance-b"},
+		{adminActor, "/api/users/company/company-b"},
+		{fdaActor, "/api/exceedances/exceedance-b"},
+		{fdaActor, "/api/flight/flight-b"},
+		{fdaActor, "/api/aircrafts/aircraft-b"},
+		{fdaActor, "/api/notifications/user/fda"},
+	}
+
+	for _, tc := range cases {
+		w := tenantRequest{method: http.MethodGet, path: tc.path}.serve(newTenantTestRouter(db, tc.actor))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s GET %s: status = %d, want %d (body %s)", tc.actor.role, tc.path, w.Code, http.StatusOK, w.Body)
+		}
+	}
+}
+
+func TestListsAreEmptyWithoutCompany(t *testing.T) {
+	db := newTenantTestDB(t)
+	router := newTenantTestRouter(db, tenantActor{"gatekeeper-a", models.RoleGatekeeper, ""})
+
+	for _, path := range []string{"/api/users", "/api/exceedances", "/api/csv", "/api/aircrafts"} {
+		w := tenantRequest{method: http.MethodGet, path: path}.serve(router)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, body = %s", path, w.Code, w.Body)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != "[]" {
+			t.Errorf("GET %s = %s, want []", path, body)
+		}
+	}
+}
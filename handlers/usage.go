@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/models"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Usage metering keeps each company's usage per UTC day in UsageSnapshot.
+// Flight uploads are counted as they are stored; API calls are counted in
+// memory and written every minute. The usage_snapshots job measures active
+// users, aircraft and storage, counted like the subscription quotas. The
+// history is kept so account managers can follow growth and plan upgrades.
+
+const (
+	apiCallFlushInterval = time.Minute
+	defaultUsageDays     = 30
+	defaultUsagePeriods  = 12 // weeks or months
+	maxUsagePeriods      = 366
+)
+
+// Usage counters of UsageSnapshot
+const (
+	usageFlightsProcessed = "flightsProcessed"
+	usageAPICalls         = "apiCalls"
+)
+
+type UsageHandler struct {
+	db *sql.DB
+}
+
+func NewUsageHandler(db *sql.DB) *UsageHandler {
+	return &UsageHandler{db: db}
+}
+
+// usageDate is the UTC day usage is recorded on
+func usageDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// addUsage adds n to a counter of a company's usage on a day
+func addUsage(exec dbExecutor, companyID, date, counter string, n int64, now time.Time) error {
+	_, err := exec.Exec(`INSERT INTO UsageSnapshot (companyId, date, `+counter+`, updatedAt) VALUES (?, ?, ?, ?)
+		ON CONFLICT(companyId, date) DO UPDATE SET `+counter+` = `+counter+` + excluded.`+counter+`, updatedAt = excluded.updatedAt`,
+		companyID, date, n, now.UnixMilli())
+	return err
+}
+
+// apiCallKey is a company's API calls on a day
+type apiCallKey struct {
+	companyID string
+	date      string
+}
+
+// apiCallMeter counts API calls until they are written to UsageSnapshot
+type apiCallMeter struct {
+	mu     sync.Mutex
+	counts map[apiCallKey]int64
+}
+
+var apiCalls = &apiCallMeter{counts: map[apiCallKey]int64{}}
+
+func (m *apiCallMeter) add(key apiCallKey, n int64) {
+	m.mu.Lock()
+	m.counts[key] += n
+	m.mu.Unlock()
+}
+
+// take returns the counts and starts counting afresh
+func (m *apiCallMeter) take() map[apiCallKey]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := m.counts
+	m.counts = map[apiCallKey]int64{}
+	return counts
+}
+
+// MeterAPICalls counts the API calls made by users of a company. It runs after
+// the request is authenticated; calls by users without a company are not
+// counted.
+func MeterAPICalls() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if companyID := c.GetString("userCompanyId"); companyID != "" {
+			apiCalls.add(apiCallKey{companyID, usageDate(time.Now())}, 1)
+		}
+		c.Next()
+	}
+}
+
+// MonitorAPICalls writes the counted API calls every minute. It runs until the
+// process exits.
+func (h *UsageHandler) MonitorAPICalls() {
+	ticker := time.NewTicker(apiCallFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.flushAPICalls(time.Now())
+	}
+}
+
+// flushAPICalls writes the counted API calls. Counts that fail to be written
+// are kept for the next flush.
+func (h *UsageHandler) flushAPICalls(now time.Time) {
+	for key, n := range apiCalls.take() {
+		if err := addUsage(h.db, key.companyID, key.date, usageAPICalls, n, now); err != nil {
+			log.Printf("Error recording API calls of company %s: %v", key.companyID, err)
+			apiCalls.add(key, n)
+		}
+	}
+}
+
+// snapshotUsage measures the active users, aircraft and storage of every
+// company on today's snapshot
+func (h *UsageHandler) snapshotUsage(now time.Time) (measured, failed int, err error) {
+	h.flushAPICalls(now)
+
+	rows, err := h.db.Query("SELECT id FROM Company")
+	if err != nil {
+		return 0, 0, err
+	}
+	var companyIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			companyIDs = append(companyIDs, id)
+		}
+	}
+	rows.Close()
+
+	date := usageDate(now)
+	for _, companyID := range companyIDs {
+		if err := h.snapshotCompany(companyID, date, now); err != nil {
+			log.Printf("Error measuring usage of company %s: %v", companyID, err)
+			failed++
+			continue
+		}
+		measured++
+	}
+	return measured, failed, nil
+}
+
+func (h *UsageHandler) snapshotCompany(companyID, date string, now time.Time) error {
+	var used [3]int64
+	for i, resource := range []string{models.QuotaUsers, models.QuotaAircraft, models.QuotaStorage} {
+		n, err := quotaUsed(h.db, companyID, resource, now)
+		if err != nil {
+			return err
+		}
+		used[i] = n
+	}
+	_, err := h.db.Exec(`INSERT INTO UsageSnapshot (companyId, date, activeUsers, aircraft, storageBytes, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(companyId, date) DO UPDATE SET activeUsers = excluded.activeUsers, aircraft = excluded.aircraft,
+			storageBytes = excluded.storageBytes, updatedAt = excluded.updatedAt`,
+		companyID, date, used[0], used[1], used[2], now.UnixMilli())
+	return err
+}
+
+// usageDay is one row of UsageSnapshot
+type usageDay struct {
+	date                           time.Time
+	activeUsers, aircraft, storage *int64
+	flightsProcessed, apiCalls     int64
+}
+
+// loadUsage returns the usage per company from start until end, in date
+// order. An empty companyID loads every company.
+func loadUsage(exec dbExecutor, companyID string, start, end time.Time) (map[string][]usageDay, error) {
+	query := `SELECT companyId, date, activeUsers, aircraft, storageBytes, flightsProcessed, apiCalls
+		FROM UsageSnapshot WHERE date >= ? AND date < ?`
+	args := []interface{}{usageDate(start), usageDate(end)}
+	if companyID != "" {
+		query += " AND companyId = ?"
+		args = append(args, companyID)
+	}
+	rows, err := exec.Query(query+" ORDER BY companyId, date", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := map[string][]usageDay{}
+	for rows.Next() {
+		var id, date string
+		var day usageDay
+		var activeUsers, aircraft, storage sql.NullInt64
+		if err := rows.Scan(&id, &date, &activeUsers, &aircraft, &storage, &day.flightsProcessed, &day.apiCalls); err != nil {
+			return nil, err
+		}
+		if day.date, err = time.Parse("2006-01-02", date); err != nil {
+			continue
+		}
+		day.activeUsers, day.aircraft, day.storage = nullInt64Ptr(activeUsers), nullInt64Ptr(aircraft), nullInt64Ptr(storage)
+		usage[id] = append(usage[id], day)
+	}
+	return usage, rows.Err()
+}
+
+func nullInt64Ptr(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	return &v.Int64
+}
+
+// addUsageDay counts a day into a point. Days are added in date order, so the
+// measurements are the last of the period.
+func addUsageDay(p *models.UsagePoint, day usageDay) {
+	p.FlightsProcessed += day.flightsProcessed
+	p.APICalls += day.apiCalls
+	if day.activeUsers != nil {
+		p.ActiveUsers = day.activeUsers
+	}
+	if day.aircraft != nil {
+		p.Aircraft = day.aircraft
+	}
+	if day.storage != nil {
+		p.StorageBytes = day.storage
+	}
+}
+
+// usagePoints returns a point for every period from start until end
+func usagePoints(days []usageDay, start, end time.Time, interval string) []models.UsagePoint {
+	var points []models.UsagePoint
+	index := map[string]int{}
+	for t := start; t.Before(end); t = addPeriods(t, interval, 1) {
+		index[periodLabel(t, interval)] = len(points)
+		points = append(points, models.UsagePoint{Period: periodLabel(t, interval), Start: t})
+	}
+	for _, day := range days {
+		if i, ok := index[periodLabel(periodStart(day.date, interval), interval)]; ok {
+			addUsageDay(&points[i], day)
+		}
+	}
+	return points
+}
+
+// usageTotal sums the days from start until end into a single point
+func usageTotal(days []usageDay, start, end time.Time) models.UsagePoint {
+	total := models.UsagePoint{Start: start}
+	for _, day := range days {
+		if !day.date.Before(start) && day.date.Before(end) {
+			addUsageDay(&total, day)
+		}
+	}
+	return total
+}
+
+// usageGrowth compares a range with the previous range of the same length
+func usageGrowth(previous, current models.UsagePoint) models.UsageGrowth {
+	gauge := func(previous, current *int64) *float64 {
+		if previous == nil || current == nil {
+			return nil
+		}
+		return changePercent(float64(*previous), float64(*current))
+	}
+	return models.UsageGrowth{
+		ActiveUsers:      gauge(previous.ActiveUsers, current.ActiveUsers),
+		Aircraft:         gauge(previous.Aircraft, current.Aircraft),
+		StorageBytes:     gauge(previous.StorageBytes, current.StorageBytes),
+		FlightsProcessed: changePercent(float64(previous.FlightsProcessed), float64(current.FlightsProcessed)),
+		APICalls:         changePercent(float64(previous.APICalls), float64(current.APICalls)),
+	}
+}
+
+// usageRange reads the from and to parameters as whole periods, by default
+// the last 30 days or 12 weeks or months. It writes an error response and
+// returns false when they are invalid.
+func usageRange(c *gin.Context, interval string) (start, end time.Time, periods int, ok bool) {
+	end = time.Now().UTC()
+	if v := c.Query("to"); v != "" {
+		t, err := parseDateParam(v, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to: " + err.Error()})
+			return
+		}
+		end = t.UTC()
+	}
+	end = addPeriods(periodStart(end, interval), interval, 1)
+
+	start = addPeriods(end, interval, -defaultUsagePeriods)
+	if interval == models.TrendIntervalDay {
+		start = addPeriods(end, interval, -defaultUsageDays)
+	}
+	if v := c.Query("from"); v != "" {
+		t, err := parseDateParam(v, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from: " + err.Error()})
+			return
+		}
+		start = periodStart(t.UTC(), interval)
+	}
+	if !start.Before(end) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	for t := start; t.Before(end); t = addPeriods(t, interval, 1) {
+		if periods++; periods > maxUsagePeriods {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d periods can be requested", maxUsagePeriods)})
+			return
+		}
+	}
+	return start, end, periods, true
+}
+
+// GetCompanyUsage returns a company's usage by day, week or month.
+//
+//	?interval=day|week|month&from=2025-01-01&to=2025-12-31
+//
+// Growth compares the range with the same number of periods before it.
+func (h *UsageHandler) GetCompanyUsage(c *gin.Context) {
+	companyID := c.Param("id")
+	if !companyResource.authorize(c, h.db, companyID) {
+		return
+	}
+
+	interval := c.DefaultQuery("interval", models.TrendIntervalDay)
+	if interval != models.TrendIntervalDay && interval != models.TrendIntervalWeek && interval != models.TrendIntervalMonth {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be day, week or month"})
+		return
+	}
+	start, end, periods, ok := usageRange(c, interval)
+	if !ok {
+		return
+	}
+
+	usage := models.CompanyUsage{CompanyID: companyID, Interval: interval, From: start, To: end}
+	if err := h.db.QueryRow("SELECT name FROM Company WHERE id = ?", companyID).Scan(&usage.CompanyName); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	limits, err := loadQuotaLimits(h.db, companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if limits != nil {
+		usage.PlanName, usage.Limits = &limits.planName, limits.limits
+	}
+
+	previousStart := addPeriods(start, interval, -periods)
+	days, err := loadUsage(h.db, companyID, previousStart, end)
+	if err != nil {
+		log.Println("Error loading usage:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	usage.Points = usagePoints(days[companyID], start, end, interval)
+	usage.Growth = usageGrowth(usageTotal(days[companyID], previousStart, start), usageTotal(days[companyID], start, end))
+	c.JSON(http.StatusOK, usage)
+}
+
+// GetUsage returns the usage of every company over a range of days, by
+// default the last 30, with its growth from the range before
+//
+//	?from=2025-01-01&to=2025-01-31
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	start, end, periods, ok := usageRange(c, models.TrendIntervalDay)
+	if !ok {
+		return
+	}
+	previousStart := start.AddDate(0, 0, -periods)
+	days, err := loadUsage(h.db, "", previousStart, end)
+	if err != nil {
+		log.Println("Error loading usage:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT c.id, c.name, s.planName, s.maxUsers, s.maxAircraft, s.maxFlightsPerMonth, s.maxStorageGB
+		FROM Company c LEFT JOIN Subscription s ON c.subscriptionId = s.id ORDER BY c.name`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	summaries := []models.UsageSummary{}
+	for rows.Next() {
+		var summary models.UsageSummary
+		var users, aircraft, flights, storageGB sql.NullInt64
+		if err := rows.Scan(&summary.CompanyID, &summary.CompanyName, &summary.PlanName, &users, &aircraft, &flights, &storageGB); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if summary.PlanName != nil {
+			summary.Limits = map[string]int64{
+				models.QuotaUsers:    users.Int64,
+				models.QuotaAircraft: aircraft.Int64,
+				models.QuotaFlights:  flights.Int64,
+				models.QuotaStorage:  storageGB.Int64 * gigabyte,
+			}
+		}
+		summary.Usage = usageTotal(days[summary.CompanyID], start, end)
+		summary.Growth = usageGrowth(usageTotal(days[summary.CompanyID], previousStart, start), summary.Usage)
+		summaries = append(summaries, summary)
+	}
+	c.JSON(http.StatusOK, gin.H{"from": start, "to": end, "companies": summaries})
+}
@@ -300,34 +300,57 @@ func (h *UserHandler) GetActiveSessions(c *gin.Context) {
 	})
 }
 
-// GetUsers retrieves all users with their company information
+// userListSpec lists the filters and sort keys accepted by GetUsers
+var userListSpec = &listSpec{
+	idColumn: "u.id",
+	sorts: map[string]string{
+		"createdAt":   sqlEpochMillis("u.createdAt"),
+		"lastLoginAt": "COALESCE(" + sqlEpochMillis("u.lastLoginAt") + ", 0)",
+		"email":       "lower(u.email)",
+		"fullName":    "lower(COALESCE(u.fullName, ''))",
+		"role":        "u.role",
+	},
+	defaultSort: "-createdAt",
+	filters: map[string]listFilter{
+		"company": eqFilter("u.companyId"),
+		"role":    lowerFilter("u.role"),
+		"active":  boolFilter("u.isActive"),
+		"from":    dateFilter("u.createdAt", false),
+		"to":      dateFilter("u.createdAt", true),
+	},
+}
+
+// GetUsers retrieves users with their company information, one page at a time
 func (h *UserHandler) GetUsers(c *gin.Context) {
-	// Get requesting user's role and company
-	userRole, _ := c.Get("userRole")
-	userCompanyID, companyExists := c.Get("userCompanyId")
+	list, err := parseListQuery(c, userListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Non-admin users can only see users from their company
+	tenantOf(c).restrict(list, "u.companyId")
+
+	const from = `FROM User u
+		LEFT JOIN Company c ON u.companyId = c.id`
+
+	total, err := list.count(h.db, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
+		return
+	}
 
 	query := `
 		SELECT 
 			u.id, u.email, u.role, u.fullName, u.designation, u.department, u.username, u.image, 
 			u.phone, u.isActive, u.companyId, u.lastLoginAt, u.createdAt, u.updatedAt,
 			c.id, c.name, c.email, c.phone, c.address, c.country, 
-			c.logo, c.status, c.subscriptionId, c.createdAt, c.updatedAt
-		FROM User u
-		LEFT JOIN Company c ON u.companyId = c.id
-	`
-	args := []interface{}{}
-
-	// Non-admin users can only see users from their company
-	if userRole != models.RoleAdmin && userRole != models.RoleFDA {
-		if companyExists {
-			query += " WHERE u.companyId = ?"
-			args = append(args, userCompanyID)
-		}
-	}
+			c.logo, c.status, c.subscriptionId, c.createdAt, c.updatedAt,
+			` + list.sortColumn() + `
+		` + from
 
-	query += " ORDER BY u.createdAt DESC"
-
-	rows, err := h.db.Query(query, args...)
+	clause, args := list.pageClause()
+	rows, err := h.db.Query(query+clause, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
 		return
@@ -344,18 +367,22 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 		var cID, cName, cEmail, cPhone, cAddress, cCountry sql.NullString
 		var cLogo, cStatus, cSubscriptionID sql.NullString
 		var cCreatedAt, cUpdatedAt sql.NullTime
+		var sortValue interface{}
 
 		err := rows.Scan(
 			&user.ID, &user.Email, &user.Role, &fullName, &designation,
 			&department, &username, &image, &phone, &user.IsActive,
 			&companyID, &lastLoginAt, &user.CreatedAt, &user.UpdatedAt,
 			&cID, &cName, &cEmail, &cPhone, &cAddress, &cCountry,
-			&cLogo, &cStatus, &cSubscriptionID, &cCreatedAt, &cUpdatedAt,
+			&cLogo, &cStatus, &cSubscriptionID, &cCreatedAt, &cUpdatedAt, &sortValue,
 		)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning user"})
 			return
 		}
+		if !list.accept(user.ID, sortValue) {
+			break
+		}
 
 		// Map nullable user fields
 		if fullName.Valid {
@@ -418,12 +445,16 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 		users = append(users, user)
 	}
 
+	list.writeHeaders(c, total)
 	c.JSON(http.StatusOK, users)
 }
 
 // GetUserByID retrieves a specific user
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	id := c.Param("id")
+	if !authorizeUser(c, h.db, id) {
+		return
+	}
 
 	user, err := h.getUserByID(id)
 	if err != nil {
@@ -451,6 +482,10 @@ func (h *UserHandler) GetUserByEmail(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
 		return
 	}
+	if user.ID != c.GetString("userId") && !canAccessCompanyData(c, nullString(user.CompanyID)) {
+		denyCrossTenant(c)
+		return
+	}
 
 	c.JSON(http.StatusOK, user)
 }
@@ -544,6 +579,21 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	// Gatekeepers create users in their own company only, and cannot grant cross-company roles
+	if tenant := tenantOf(c); !tenant.all {
+		if req.CompanyID == nil {
+			req.CompanyID = &tenant.companyID
+		}
+		if !tenant.allows(nullString(req.CompanyID)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only create users in your company"})
+			return
+		}
+		if req.Role == models.RoleAdmin || req.Role == models.RoleFDA {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to create " + req.Role + " users"})
+			return
+		}
+	}
+
 	// Check if company exists if companyID is provided
 	if req.CompanyID != nil {
 		var companyExists bool
@@ -566,6 +616,16 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	id := uuid.New().String()
 	now := time.Now()
 
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if req.CompanyID != nil && !checkQuota(c, tx, *req.CompanyID, models.QuotaUsers, 1) {
+		return
+	}
+
 	// Insert user with new schema
 	query := `
 		INSERT INTO User (
@@ -574,10 +634,13 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?)
 	`
 
-	_, err = h.db.Exec(query,
+	_, err = tx.Exec(query,
 		id, req.Email, req.Role, req.FullName, req.Username, string(hashedPassword),
 		req.Phone, req.Designation, req.Department, req.CompanyID, now, now,
 	)
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		log.Printf("CreateUser: Database error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user", "details": err.Error()})
@@ -585,6 +648,9 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	}
 
 	log.Printf("CreateUser: User created successfully with ID: %s", id)
+	if req.CompanyID != nil {
+		warnQuota(c, h.db, *req.CompanyID, models.QuotaUsers)
+	}
 
 	// Fetch and return created user
 	user, err := h.getUserByID(id)
@@ -646,7 +712,38 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "You can only update users in your company"})
 			return
 		}
+
+		// Users cannot be moved to another company or given cross-company roles
+		if req.CompanyID != nil && *req.CompanyID != requestingUserCompanyID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only update users in your company"})
+			return
+		}
+		if req.Role != nil && (*req.Role == models.RoleAdmin || *req.Role == models.RoleFDA) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to assign the " + *req.Role + " role"})
+			return
+		}
+	}
+
+	// Activating a user or moving them to another company counts against the company's user quota
+	var currentCompanyID sql.NullString
+	var currentActive bool
+	err := h.db.QueryRow("SELECT companyId, isActive FROM User WHERE id = ?", id).Scan(&currentCompanyID, &currentActive)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching user", "details": err.Error()})
+		return
+	}
+	quotaCompanyID, active := currentCompanyID.String, currentActive
+	if req.CompanyID != nil {
+		quotaCompanyID = *req.CompanyID
+	}
+	if req.IsActive != nil {
+		active = *req.IsActive
 	}
+	addsUser := active && quotaCompanyID != "" && (!currentActive || quotaCompanyID != currentCompanyID.String)
 
 	query := "UPDATE User SET updatedAt = ?"
 	args := []interface{}{now}
@@ -700,7 +797,17 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 	query += " WHERE id = ?"
 	args = append(args, id)
 
-	result, err := h.db.Exec(query, args...)
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if addsUser && !checkQuota(c, tx, quotaCompanyID, models.QuotaUsers, 1) {
+		return
+	}
+
+	result, err := tx.Exec(query, args...)
 	if err != nil {
 		log.Printf("UpdateUser: Error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user", "details": err.Error()})
@@ -712,6 +819,13 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+	if addsUser {
+		warnQuota(c, h.db, quotaCompanyID, models.QuotaUsers)
+	}
 
 	// Fetch and return updated user
 	user, err := h.getUserByID(id)
@@ -740,6 +854,10 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	if _, err := h.db.Exec("DELETE FROM Notification WHERE userId = ? OR targetUserId = ?", id, id); err != nil {
+		log.Printf("Warning: Failed to delete user notifications: %v", err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
@@ -747,8 +865,32 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 func (h *UserHandler) ActivateUser(c *gin.Context) {
 	id := c.Param("id")
 
+	// Reactivated users count against their company's user quota again
+	var companyID sql.NullString
+	var isActive bool
+	err := h.db.QueryRow("SELECT companyId, isActive FROM User WHERE id = ?", id).Scan(&companyID, &isActive)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error activating user"})
+		return
+	}
+	addsUser := !isActive && companyID.String != ""
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if addsUser && !checkQuota(c, tx, companyID.String, models.QuotaUsers, 1) {
+		return
+	}
+
 	query := "UPDATE User SET isActive = 1, updatedAt = ? WHERE id = ?"
-	result, err := h.db.Exec(query, time.Now(), id)
+	result, err := tx.Exec(query, time.Now(), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error activating user"})
 		return
@@ -759,6 +901,13 @@ func (h *UserHandler) ActivateUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error activating user"})
+		return
+	}
+	if addsUser {
+		warnQuota(c, h.db, companyID.String, models.QuotaUsers)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User activated successfully"})
 }
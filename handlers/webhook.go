@@ -0,0 +1,689 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fdm-backend/config"
+	"fdm-backend/models"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Webhooks are queued in WebhookDelivery inside the transaction that caused
+// the event and posted by a background worker that callers wake once the
+// transaction is committed, as emails are. Every payload is signed with the
+// webhook's secret:
+//
+//	X-FDM-Signature: t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">
+
+// WebhookHandler manages webhooks, their delivery log and the delivery worker
+type WebhookHandler struct {
+	db *sql.DB
+}
+
+func NewWebhookHandler(db *sql.DB) *WebhookHandler {
+	return &WebhookHandler{db: db}
+}
+
+const (
+	webhookPollInterval  = 30 * time.Second
+	webhookBatchSize     = 100
+	webhookTimeout       = 10 * time.Second
+	webhookResponseLimit = 500 // bytes of a failed response kept in lastError
+)
+
+// webhookRetryDelays[n-1] is the wait after the nth failed attempt. A delivery
+// is marked failed when its attempts run out.
+var webhookRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute, 2 * time.Hour, 12 * time.Hour}
+
+// webhookWake nudges the delivery worker when deliveries were queued
+var webhookWake = make(chan struct{}, 1)
+
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// webhookClient posts deliveries. Redirects are not followed and, unless
+// WEBHOOK_ALLOW_PRIVATE_NETWORKS is set, loopback and private addresses
+// cannot be reached.
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: webhookTimeout, Control: webhookDialControl}).DialContext,
+		TLSHandshakeTimeout: webhookTimeout,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	if config.GetWebhookAllowPrivateNetworks() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("webhook address %s is not allowed", host)
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// signWebhook returns the X-FDM-Signature header for a body
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "t=" + strconv.FormatInt(timestamp, 10) + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// queueWebhooks queues an event for every active webhook of the company
+// subscribed to its type
+func queueWebhooks(exec dbExecutor, companyID, eventType string, data interface{}, now time.Time) error {
+	if companyID == "" {
+		return nil
+	}
+	rows, err := exec.Query("SELECT id, eventTypes FROM Webhook WHERE companyId = ? AND isActive = 1", companyID)
+	if err != nil {
+		return err
+	}
+	var webhookIDs []string
+	for rows.Next() {
+		var id, eventTypes string
+		if err := rows.Scan(&id, &eventTypes); err != nil {
+			rows.Close()
+			return err
+		}
+		var types []string
+		json.Unmarshal([]byte(eventTypes), &types)
+		if containsString(types, eventType) {
+			webhookIDs = append(webhookIDs, id)
+		}
+	}
+	rows.Close()
+	if len(webhookIDs) == 0 {
+		return nil
+	}
+
+	eventID := uuid.New().String()
+	payload, err := json.Marshal(models.WebhookPayload{
+		ID:        eventID,
+		Type:      eventType,
+		CompanyID: companyID,
+		CreatedAt: now,
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	for _, webhookID := range webhookIDs {
+		if err := insertWebhookDelivery(exec, webhookID, eventType, eventID, string(payload), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertWebhookDelivery(exec dbExecutor, webhookID, eventType, eventID, payload string, now time.Time) error {
+	_, err := exec.Exec(`INSERT INTO WebhookDelivery (id, webhookId, eventType, eventId, payload, status, attempts,
+			nextAttemptAt, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?)`,
+		uuid.New().String(), webhookID, eventType, eventID, payload, models.WebhookStatusPending,
+		now.UnixMilli(), now.UnixMilli(), now.UnixMilli())
+	return err
+}
+
+// flightWebhookData is the data of a flight.uploaded event; the pilot and
+// the stored file are left out, and crew are only named by their codes
+func flightWebhookData(f models.CSV) gin.H {
+	crew := []gin.H{}
+	for _, m := range f.Crew {
+		crew = append(crew, gin.H{"code": m.Code, "role": m.Role})
+	}
+	return gin.H{
+		"id":          f.ID,
+		"aircraftId":  f.AircraftID,
+		"departure":   f.Departure,
+		"destination": f.Destination,
+		"flightHours": f.FlightHours,
+		"crew":        crew,
+		"createdAt":   f.CreatedAt,
+	}
+}
+
+// exceedanceWebhookData is the data of an exceedance.created event; the
+// recorded values are left out
+func exceedanceWebhookData(e models.Exceedance) gin.H {
+	return gin.H{
+		"id":              e.ID,
+		"flightId":        e.FlightID,
+		"aircraftId":      e.AircraftID,
+		"eventId":         e.EventID,
+		"description":     e.Description,
+		"flightPhase":     e.FlightPhase,
+		"parameterName":   e.ParameterName,
+		"exceedanceLevel": e.ExceedanceLevel,
+		"priority":        e.Priority,
+		"eventStatus":     e.EventStatus,
+		"createdAt":       e.CreatedAt,
+	}
+}
+
+const webhookColumns = "id, companyId, url, description, eventTypes, isActive, createdBy, createdAt, updatedAt"
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (models.Webhook, error) {
+	var w models.Webhook
+	var eventTypes string
+	var createdAt, updatedAt int64
+	err := row.Scan(&w.ID, &w.CompanyID, &w.URL, &w.Description, &eventTypes, &w.IsActive, &w.CreatedBy,
+		&createdAt, &updatedAt)
+	if err != nil {
+		return w, err
+	}
+	json.Unmarshal([]byte(eventTypes), &w.EventTypes)
+	if w.EventTypes == nil {
+		w.EventTypes = []string{}
+	}
+	w.CreatedAt = time.UnixMilli(createdAt)
+	w.UpdatedAt = time.UnixMilli(updatedAt)
+	return w, nil
+}
+
+func getWebhook(exec dbExecutor, id string) (models.Webhook, error) {
+	return scanWebhook(exec.QueryRow("SELECT "+webhookColumns+" FROM Webhook WHERE id = ?", id))
+}
+
+// applyWebhookRequest copies the fields present in req onto w
+func applyWebhookRequest(w *models.Webhook, req models.WebhookRequest) {
+	if req.URL != nil {
+		w.URL = strings.TrimSpace(*req.URL)
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		w.Description = &description
+	}
+	if req.EventTypes != nil {
+		w.EventTypes = cleanList(req.EventTypes, true)
+	}
+	if req.IsActive != nil {
+		w.IsActive = *req.IsActive
+	}
+}
+
+func validateWebhook(w models.Webhook) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	if len(w.EventTypes) == 0 {
+		return errors.New("at least one event type is required")
+	}
+	for _, eventType := range w.EventTypes {
+		if !containsString(models.WebhookEventTypes, eventType) {
+			return errors.New("eventTypes must be one of " + strings.Join(models.WebhookEventTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// GetWebhooks lists the webhooks of the caller's company
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	condition, args := tenantOf(c).condition("companyId")
+	if v := strings.TrimSpace(c.Query("company")); v != "" {
+		condition += " AND companyId = ?"
+		args = append(args, v)
+	}
+
+	rows, err := h.db.Query("SELECT "+webhookColumns+" FROM Webhook WHERE "+condition+" ORDER BY createdAt", args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []models.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			log.Println("Error scanning webhook:", err)
+			continue
+		}
+		webhooks = append(webhooks, w)
+	}
+	c.JSON(http.StatusOK, webhooks)
+}
+
+// GetWebhookByID returns a single webhook
+func (h *WebhookHandler) GetWebhookByID(c *gin.Context) {
+	id := c.Param("id")
+	if !webhookResource.authorize(c, h.db, id) {
+		return
+	}
+
+	w, err := getWebhook(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+// CreateWebhook subscribes a URL to events. Gatekeepers create webhooks for
+// their own company; admins and FDAs must name the company. The response
+// carries the signing secret.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	companyID, ok := requestedCompany(c, h.db, req.CompanyID)
+	if !ok {
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating webhook"})
+		return
+	}
+	now := time.Now()
+	userID := c.GetString("userId")
+	w := models.Webhook{
+		ID:         uuid.New().String(),
+		CompanyID:  companyID,
+		EventTypes: []string{},
+		Secret:     secret,
+		IsActive:   true,
+		CreatedBy:  &userID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	applyWebhookRequest(&w, req)
+	if err := validateWebhook(w); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = h.db.Exec(`INSERT INTO Webhook (id, companyId, url, description, eventTypes, secret, isActive, createdBy, createdAt, updatedAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.ID, w.CompanyID, w.URL, w.Description, jsonText(w.EventTypes), w.Secret, w.IsActive, w.CreatedBy,
+		now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		log.Println("Error creating webhook:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating webhook"})
+		return
+	}
+	c.JSON(http.StatusCreated, w)
+}
+
+// UpdateWebhook changes a webhook
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	id := c.Param("id")
+	if !webhookResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var req models.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	w, err := getWebhook(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if req.CompanyID != nil && *req.CompanyID != w.CompanyID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "companyId cannot be changed"})
+		return
+	}
+	applyWebhookRequest(&w, req)
+	if err := validateWebhook(w); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	w.UpdatedAt = now
+	_, err = h.db.Exec("UPDATE Webhook SET url = ?, description = ?, eventTypes = ?, isActive = ?, updatedAt = ? WHERE id = ?",
+		w.URL, w.Description, jsonText(w.EventTypes), w.IsActive, now.UnixMilli(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, w)
+}
+
+// RotateWebhookSecret replaces the signing secret and returns the webhook with
+// the new secret. Deliveries still queued are signed with the new secret.
+func (h *WebhookHandler) RotateWebhookSecret(c *gin.Context) {
+	id := c.Param("id")
+	if !webhookResource.authorize(c, h.db, id) {
+		return
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error rotating secret"})
+		return
+	}
+	now := time.Now()
+	if _, err := h.db.Exec("UPDATE Webhook SET secret = ?, updatedAt = ? WHERE id = ?", secret, now.UnixMilli(), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error rotating secret"})
+		return
+	}
+	w, err := getWebhook(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	w.Secret = secret
+	c.JSON(http.StatusOK, w)
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id := c.Param("id")
+	if !webhookResource.authorize(c, h.db, id) {
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM WebhookDelivery WHERE webhookId = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting webhook"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM Webhook WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting webhook"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// MonitorWebhookDeliveries posts queued deliveries until the process exits
+func (h *WebhookHandler) MonitorWebhookDeliveries() {
+	// Deliveries a previous process stopped sending are sent again
+	_, err := h.db.Exec("UPDATE WebhookDelivery SET status = ? WHERE status = ?", models.WebhookStatusPending, models.WebhookStatusSending)
+	if err != nil {
+		log.Println("Error resetting webhook deliveries:", err)
+	}
+
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		h.deliverDueWebhooks(time.Now())
+		select {
+		case <-ticker.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+// deliverDueWebhooks posts the deliveries that are due. Deliveries of disabled
+// webhooks wait until the webhook is enabled again.
+func (h *WebhookHandler) deliverDueWebhooks(now time.Time) {
+	rows, err := h.db.Query(`SELECT d.id FROM WebhookDelivery d
+		JOIN Webhook w ON d.webhookId = w.id
+		WHERE d.status = ? AND d.nextAttemptAt <= ? AND w.isActive = 1
+		ORDER BY d.nextAttemptAt LIMIT ?`, models.WebhookStatusPending, now.UnixMilli(), webhookBatchSize)
+	if err != nil {
+		log.Println("Error loading webhook deliveries:", err)
+		return
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := deliverWebhook(h.db, id); err != nil {
+			log.Println("Error delivering webhook:", err)
+		}
+	}
+}
+
+// deliverWebhook posts a pending delivery once and records the outcome.
+// Deliveries already claimed by another worker are left alone.
+func deliverWebhook(db *sql.DB, id string) error {
+	now := time.Now()
+	result, err := db.Exec("UPDATE WebhookDelivery SET status = ?, updatedAt = ? WHERE id = ? AND status = ?",
+		models.WebhookStatusSending, now.UnixMilli(), id, models.WebhookStatusPending)
+	if err != nil {
+		return err
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return nil
+	}
+
+	var target, secret, eventType, payload string
+	var attempts int
+	err = db.QueryRow(`SELECT w.url, w.secret, d.eventType, d.payload, d.attempts FROM WebhookDelivery d
+		JOIN Webhook w ON d.webhookId = w.id
+		WHERE d.id = ?`, id).Scan(&target, &secret, &eventType, &payload, &attempts)
+	if err != nil {
+		return err
+	}
+
+	responseStatus, sendErr := postWebhook(target, secret, id, eventType, []byte(payload))
+	var status *int
+	if responseStatus != 0 {
+		status = &responseStatus
+	}
+	attempts++
+	now = time.Now()
+	switch {
+	case sendErr == nil:
+		_, err = db.Exec(`UPDATE WebhookDelivery SET status = ?, attempts = ?, responseStatus = ?, lastError = NULL,
+			nextAttemptAt = NULL, deliveredAt = ?, updatedAt = ? WHERE id = ?`,
+			models.WebhookStatusDelivered, attempts, status, now.UnixMilli(), now.UnixMilli(), id)
+	case attempts > len(webhookRetryDelays):
+		log.Printf("Webhook delivery %s to %s failed after %d attempts: %v", id, target, attempts, sendErr)
+		_, err = db.Exec(`UPDATE WebhookDelivery SET status = ?, attempts = ?, responseStatus = ?, lastError = ?,
+			nextAttemptAt = NULL, updatedAt = ? WHERE id = ?`,
+			models.WebhookStatusFailed, attempts, status, sendErr.Error(), now.UnixMilli(), id)
+	default:
+		next := now.Add(webhookRetryDelays[attempts-1])
+		_, err = db.Exec(`UPDATE WebhookDelivery SET status = ?, attempts = ?, responseStatus = ?, lastError = ?,
+			nextAttemptAt = ?, updatedAt = ? WHERE id = ?`,
+			models.WebhookStatusPending, attempts, status, sendErr.Error(), next.UnixMilli(), now.UnixMilli(), id)
+	}
+	return err
+}
+
+// postWebhook posts a signed payload. Any 2xx response is a success.
+func postWebhook(target, secret, deliveryID, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FDM-Webhooks/1.0")
+	req.Header.Set("X-FDM-Event", eventType)
+	req.Header.Set("X-FDM-Delivery", deliveryID)
+	req.Header.Set("X-FDM-Signature", signWebhook(secret, time.Now().Unix(), body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, webhookResponseLimit))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := "HTTP " + strconv.Itoa(resp.StatusCode)
+		if text := strings.TrimSpace(string(snippet)); text != "" {
+			msg += ": " + text
+		}
+		return resp.StatusCode, errors.New(msg)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookDeliveryListSpec lists the filters and sort keys accepted by GetWebhookDeliveries
+var webhookDeliveryListSpec = &listSpec{
+	idColumn: "id",
+	sorts: map[string]string{
+		"createdAt": "createdAt",
+		"status":    "status",
+	},
+	defaultSort: "-createdAt",
+	filters: map[string]listFilter{
+		"status": lowerFilter("status"),
+		"event":  eqFilter("eventType"),
+		"from":   dateFilter("createdAt", false),
+		"to":     dateFilter("createdAt", true),
+	},
+}
+
+const webhookDeliveryColumns = `id, webhookId, eventType, eventId, payload, status, attempts, responseStatus, lastError,
+	nextAttemptAt, deliveredAt, createdAt, updatedAt`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload string
+	var nextAttemptAt, deliveredAt sql.NullInt64
+	var createdAt, updatedAt int64
+	dest := []interface{}{&d.ID, &d.WebhookID, &d.EventType, &d.EventID, &payload, &d.Status, &d.Attempts,
+		&d.ResponseStatus, &d.LastError, &nextAttemptAt, &deliveredAt, &createdAt, &updatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return d, err
+	}
+	d.Payload = json.RawMessage(payload)
+	if nextAttemptAt.Valid {
+		t := time.UnixMilli(nextAttemptAt.Int64)
+		d.NextAttemptAt = &t
+	}
+	if deliveredAt.Valid {
+		t := time.UnixMilli(deliveredAt.Int64)
+		d.DeliveredAt = &t
+	}
+	d.CreatedAt = time.UnixMilli(createdAt)
+	d.UpdatedAt = time.UnixMilli(updatedAt)
+	return d, nil
+}
+
+// GetWebhookDeliveries lists the delivery log of a webhook, one page at a time
+func (h *WebhookHandler) GetWebhookDeliveries(c *gin.Context) {
+	id := c.Param("id")
+	if !webhookResource.authorize(c, h.db, id) {
+		return
+	}
+	list, err := parseListQuery(c, webhookDeliveryListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	list.where("webhookId = ?", id)
+
+	const from = " FROM WebhookDelivery"
+	total, err := list.count(h.db, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	clause, args := list.pageClause()
+	rows, err := h.db.Query("SELECT "+webhookDeliveryColumns+", "+list.sortColumn()+from+clause, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var sortValue interface{}
+		d, err := scanWebhookDelivery(rows, &sortValue)
+		if err != nil {
+			log.Println("Error scanning webhook delivery:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scanning webhook delivery"})
+			return
+		}
+		if !list.accept(d.ID, sortValue) {
+			break
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	list.writeHeaders(c, total)
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// RedeliverWebhook queues an event again as a new delivery, whatever the
+// outcome of the original one. The payload and event id are unchanged.
+func (h *WebhookHandler) RedeliverWebhook(c *gin.Context) {
+	id := c.Param("id")
+	if !webhookResource.authorize(c, h.db, id) {
+		return
+	}
+
+	var eventType, eventID, payload string
+	var isActive bool
+	err := h.db.QueryRow(`SELECT d.eventType, d.eventId, d.payload, w.isActive FROM WebhookDelivery d
+		JOIN Webhook w ON d.webhookId = w.id
+		WHERE d.id = ? AND d.webhookId = ?`, c.Param("deliveryId"), id).Scan(&eventType, &eventID, &payload, &isActive)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook delivery not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if !isActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "Webhook is disabled"})
+		return
+	}
+
+	if err := insertWebhookDelivery(h.db, id, eventType, eventID, payload, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error queueing delivery"})
+		return
+	}
+	wakeWebhookWorker()
+	c.JSON(http.StatusAccepted, gin.H{"message": "Delivery queued"})
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fdm-backend/models"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadTestFlight posts a flight file with the form fields from a temporary
+// working directory, since uploads are stored relative to it
+func uploadTestFlight(t *testing.T, router *gin.Engine, fields map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Mkdir(flightFileDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	file, _ := form.CreateFormFile("file", "flight.csv")
+	file.Write([]byte("TIME,ALT\n0,0\n"))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/csv", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestFlightUploadedWebhookCarriesCrew(t *testing.T) {
+	db := newTenantTestDB(t)
+	_, err := db.Exec(`INSERT INTO CrewMember (id, companyId, code, employeeId, name, role, createdAt, updatedAt)
+		VALUES ('crew-a', 'company-a', 'CRW-0001', 'E1', 'Captain A', 'captain', 0, 0);
+	INSERT INTO Webhook (id, companyId, url, eventTypes, secret, createdAt, updatedAt)
+		VALUES ('webhook-a', 'company-a', 'https://example.com/hook', '["flight.uploaded"]', 'secret', 0, 0)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := uploadTestFlight(t, newTenantTestRouter(db, gatekeeperAActor), map[string]string{
+		"name": "Flight A2", "aircraftId": "aircraft-a", "captainId": "crew-a"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: status = %d, want %d (body %s)", w.Code, http.StatusOK, w.Body)
+	}
+
+	var payload string
+	if err := db.QueryRow("SELECT payload FROM WebhookDelivery WHERE webhookId = 'webhook-a' AND eventType = ?",
+		models.WebhookEventFlightUploaded).Scan(&payload); err != nil {
+		t.Fatal("loading webhook delivery:", err)
+	}
+	var event struct {
+		Data struct {
+			Crew []struct{ Code, Role string } `json:"crew"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatal(err)
+	}
+	if len(event.Data.Crew) != 1 || event.Data.Crew[0].Code != "CRW-0001" || event.Data.Crew[0].Role != models.CrewRoleCaptain {
+		t.Errorf("webhook crew = %+v, want CRW-0001 as captain (payload %s)", event.Data.Crew, payload)
+	}
+}
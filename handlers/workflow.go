@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"database/sql"
+	"fdm-backend/models"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// dbExecutor is satisfied by both *sql.DB and *sql.Tx so helpers can run
+// inside or outside a transaction
+type dbExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// exceedanceChildTables lists tables holding rows keyed by exceedanceId that
+// must be removed together with their exceedance
+var exceedanceChildTables = []string{"ExceedanceStatusHistory", "ExceedanceComment", "ExceedanceAttachment", "Notification",
+	"ExceedanceEscalation"}
+
+// deleteExceedanceChildren removes dependent rows and stored attachments for every
+// exceedance matching filter. Transactional callers should use
+// deleteExceedanceChildRows and remove stored files once the transaction commits.
+func deleteExceedanceChildren(exec dbExecutor, filter string, args ...interface{}) error {
+	keys, err := attachmentStorageKeys(exec, filter, args...)
+	if err != nil {
+		return err
+	}
+	if err := deleteExceedanceChildRows(exec, filter, args...); err != nil {
+		return err
+	}
+	removeStoredFiles(keys)
+	return nil
+}
+
+// deleteExceedanceChildRows removes dependent rows for every exceedance matching filter
+func deleteExceedanceChildRows(exec dbExecutor, filter string, args ...interface{}) error {
+	_, err := exec.Exec(`DELETE FROM ExceedanceCommentMention WHERE commentId IN (
+		SELECT id FROM ExceedanceComment WHERE exceedanceId IN (SELECT id FROM Exceedance WHERE `+filter+`))`, args...)
+	if err != nil {
+		return err
+	}
+	for _, table := range exceedanceChildTables {
+		query := "DELETE FROM " + table + " WHERE exceedanceId IN (SELECT id FROM Exceedance WHERE " + filter + ")"
+		if _, err := exec.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordStatusTransition appends an entry to the exceedance status history
+func recordStatusTransition(exec dbExecutor, exceedanceID string, fromStatus *string, toStatus, userID string, comment *string, at time.Time) error {
+	var user *string
+	if userID != "" {
+		user = &userID
+	}
+	_, err := exec.Exec(`INSERT INTO ExceedanceStatusHistory (id, exceedanceId, fromStatus, toStatus, userId, comment, createdAt)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		uuid.New().String(), exceedanceID, fromStatus, toStatus, user, comment, at.UnixMilli())
+	return err
+}
+
+// workflowError is returned when a status change is refused. It carries the
+// HTTP status and response body describing the refusal.
+type workflowError struct {
+	status int
+	body   gin.H
+}
+
+func (e *workflowError) Error() string {
+	msg, _ := e.body["error"].(string)
+	if detail, ok := e.body["message"].(string); ok {
+		msg += ": " + detail
+	}
+	return msg
+}
+
+// changeExceedanceStatus moves an exceedance to a new status on behalf of a user,
+// keeps the comment on the exceedance thread and records the transition
+func changeExceedanceStatus(exec dbExecutor, id, status, role, userID string, comment *string, now time.Time) error {
+	var currentStatus, flightID, aircraftID string
+	var level, companyID sql.NullString
+	err := exec.QueryRow(`SELECT e.eventStatus, e.flightId, e.aircraftId, e.exceedanceLevel, a.companyId FROM Exceedance e
+		LEFT JOIN Aircraft a ON e.aircraftId = a.id
+		WHERE e.id = ?`, id).Scan(&currentStatus, &flightID, &aircraftID, &level, &companyID)
+	if err == sql.ErrNoRows {
+		return &workflowError{http.StatusNotFound, gin.H{"error": "Exceedance not found"}}
+	}
+	if err != nil {
+		return err
+	}
+
+	if status != currentStatus {
+		if !models.IsExceedanceTransition(currentStatus, status) {
+			return &workflowError{http.StatusConflict, gin.H{
+				"error":        "Invalid status transition",
+				"from":         currentStatus,
+				"to":           status,
+				"nextStatuses": models.NextExceedanceStatuses(currentStatus, role),
+			}}
+		}
+		if !models.CanTransitionExceedance(currentStatus, status, role) {
+			return &workflowError{http.StatusForbidden, gin.H{
+				"error":    "Access denied",
+				"message":  "Your role cannot move this exceedance from " + currentStatus + " to " + status,
+				"userRole": role,
+			}}
+		}
+	}
+
+	query := `UPDATE Exceedance SET comment = COALESCE(?, comment), eventStatus = ?, updatedAt = ? WHERE id = ? AND eventStatus = ?`
+	result, err := exec.Exec(query, comment, status, now.UnixMilli(), id, currentStatus)
+	if err != nil {
+		return err
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return &workflowError{http.StatusConflict, gin.H{"error": "Exceedance was modified by another user, please reload"}}
+	}
+
+	// The comment is also kept on the exceedance thread
+	if comment != nil && strings.TrimSpace(*comment) != "" {
+		if _, err := addComment(exec, id, userID, strings.TrimSpace(*comment), now); err != nil {
+			return err
+		}
+	}
+
+	if status != currentStatus {
+		if err := recordStatusTransition(exec, id, &currentStatus, status, userID, comment, now); err != nil {
+			return err
+		}
+		event := models.ExceedanceStatusEvent{
+			ExceedanceID: id,
+			FlightID:     flightID,
+			AircraftID:   aircraftID,
+			FromStatus:   currentStatus,
+			ToStatus:     status,
+			UserID:       userID,
+			ChangedAt:    now,
+		}
+		if level.Valid {
+			event.Level = &level.String
+		}
+		if err := publishEvent(exec, models.StreamEventExceedanceStatus, "", companyID.String, event, now); err != nil {
+			return err
+		}
+		if err := queueWebhooks(exec, companyID.String, models.WebhookEventExceedanceStatusChanged, event, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetExceedanceWorkflow returns the workflow states and the roles allowed to make each transition
+func (h *ExceedanceHandler) GetExceedanceWorkflow(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"statuses":    models.ExceedanceStatuses,
+		"transitions": models.ExceedanceWorkflow(),
+	})
+}
+
+// GetExceedanceHistory returns the status transitions and escalations recorded
+// for an exceedance
+func (h *ExceedanceHandler) GetExceedanceHistory(c *gin.Context) {
+	id := c.Param("id")
+	if !authorizeExceedance(c, h.db, id) {
+		return
+	}
+
+	var currentStatus string
+	err := h.db.QueryRow("SELECT eventStatus FROM Exceedance WHERE id = ?", id).Scan(&currentStatus)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exceedance not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	rows, err := h.db.Query(`SELECT h.id, h.exceedanceId, h.fromStatus, h.toStatus, h.userId, u.fullName, h.comment, h.createdAt
+		FROM ExceedanceStatusHistory h
+		LEFT JOIN User u ON h.userId = u.id
+		WHERE h.exceedanceId = ?
+		ORDER BY h.createdAt ASC`, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	defer rows.Close()
+
+	history := []models.ExceedanceStatusHistory{}
+	for rows.Next() {
+		var entry models.ExceedanceStatusHistory
+		var createdAt int64
+		err := rows.Scan(&entry.ID, &entry.ExceedanceID, &entry.FromStatus, &entry.ToStatus,
+			&entry.UserID, &entry.UserName, &entry.Comment, &createdAt)
+		if err != nil {
+			continue
+		}
+		entry.CreatedAt = time.UnixMilli(createdAt)
+		history = append(history, entry)
+	}
+
+	escalations, err := exceedanceEscalations(h.db, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	role := c.GetString("userRole")
+	c.JSON(http.StatusOK, gin.H{
+		"currentStatus": currentStatus,
+		"nextStatuses":  models.NextExceedanceStatuses(currentStatus, role),
+		"history":       history,
+		"escalations":   escalations,
+	})
+}
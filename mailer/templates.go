@@ -0,0 +1,187 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Templates
+const (
+	TemplateExceedanceAlert      = "exceedance_alert"
+	TemplateSubscriptionExpiring = "subscription_expiring"
+	TemplatePasswordReset        = "password_reset"
+	TemplateNotificationDigest   = "notification_digest"
+	TemplateExceedanceEscalation = "exceedance_escalation"
+	TemplateQuotaWarning         = "quota_warning"
+	TemplateTest                 = "test"
+)
+
+// Each template has a subject, a plain text body and an HTML body that is
+// placed inside htmlLayout. Every key a template uses must be in its data.
+var templateSources = map[string]struct{ subject, text, html string }{
+	TemplateExceedanceAlert: {
+		subject: `[{{.Level}}] {{.Description}}{{if .Aircraft}} on {{.Aircraft}}{{end}}`,
+		text: `A {{.Level}} exceedance was detected.
+
+Event:      {{.Description}}{{if .EventCode}} ({{.EventCode}}){{end}}
+Aircraft:   {{.Aircraft}}
+Flight:     {{.Flight}}
+Phase:      {{.Phase}}
+Parameter:  {{.Parameter}}
+
+Review it at {{.Link}}
+`,
+		html: `<p>A <strong>{{.Level}}</strong> exceedance was detected.</p>
+<table cellpadding="4">
+<tr><td>Event</td><td>{{.Description}}{{if .EventCode}} ({{.EventCode}}){{end}}</td></tr>
+<tr><td>Aircraft</td><td>{{.Aircraft}}</td></tr>
+<tr><td>Flight</td><td>{{.Flight}}</td></tr>
+<tr><td>Phase</td><td>{{.Phase}}</td></tr>
+<tr><td>Parameter</td><td>{{.Parameter}}</td></tr>
+</table>
+<p><a href="{{.Link}}">Review the exceedance</a></p>`,
+	},
+	TemplateExceedanceEscalation: {
+		subject: `Escalation: [{{.Level}}] {{.Description}} unreviewed for {{.Hours}} hour{{if ne .Hours 1}}s{{end}}`,
+		text: `A {{.Level}} exceedance has not been reviewed {{.Hours}} hour{{if ne .Hours 1}}s{{end}} after it was detected.
+It is escalated to you under "{{.Policy}}" (tier {{.Tier}}).
+
+Event:      {{.Description}}
+Aircraft:   {{.Aircraft}}
+Flight:     {{.Flight}}
+
+Review it at {{.Link}}
+`,
+		html: `<p>A <strong>{{.Level}}</strong> exceedance has not been reviewed {{.Hours}} hour{{if ne .Hours 1}}s{{end}} after it was detected.
+It is escalated to you under &ldquo;{{.Policy}}&rdquo; (tier {{.Tier}}).</p>
+<table cellpadding="4">
+<tr><td>Event</td><td>{{.Description}}</td></tr>
+<tr><td>Aircraft</td><td>{{.Aircraft}}</td></tr>
+<tr><td>Flight</td><td>{{.Flight}}</td></tr>
+</table>
+<p><a href="{{.Link}}">Review the exceedance</a></p>`,
+	},
+	TemplateSubscriptionExpiring: {
+		subject: `Your FDM subscription expires in {{.DaysRemaining}} day{{if ne .DaysRemaining 1}}s{{end}}`,
+		text: `The FDM subscription of {{.Company}} expires on {{.EndDate}}.
+
+Renew it before then to keep uploading and analysing flights. Contact your
+account manager to renew.
+`,
+		html: `<p>The FDM subscription of <strong>{{.Company}}</strong> expires on <strong>{{.EndDate}}</strong>.</p>
+<p>Renew it before then to keep uploading and analysing flights. Contact your account manager to renew.</p>`,
+	},
+	TemplateQuotaWarning: {
+		subject: `{{.Company}} has used {{.Percent}}% of its {{.Resource}} quota`,
+		text: `{{.Company}} has used {{.Percent}}% of the {{.Resource}} quota of its FDM
+subscription: {{.Used}} of {{.Limit}}.
+
+Once the quota is reached, adding more is refused. Contact your account
+manager to upgrade the subscription. Usage: {{.Link}}
+`,
+		html: `<p><strong>{{.Company}}</strong> has used {{.Percent}}% of the {{.Resource}} quota of its FDM subscription: {{.Used}} of {{.Limit}}.</p>
+<p>Once the quota is reached, adding more is refused. Contact your account manager to upgrade the subscription.</p>
+<p><a href="{{.Link}}">View usage</a></p>`,
+	},
+	TemplatePasswordReset: {
+		subject: `Reset your FDM password`,
+		text: `Hello {{.Name}},
+
+We received a request to reset your password. Open the link below within
+{{.ExpiresIn}} to choose a new one:
+
+{{.Link}}
+
+If you did not ask for this, ignore this email; your password is unchanged.
+`,
+		html: `<p>Hello {{.Name}},</p>
+<p>We received a request to reset your password. Open the link below within {{.ExpiresIn}} to choose a new one:</p>
+<p><a href="{{.Link}}">Reset your password</a></p>
+<p>If you did not ask for this, ignore this email; your password is unchanged.</p>`,
+	},
+	TemplateNotificationDigest: {
+		subject: `{{.Count}} new FDM notification{{if ne .Count 1}}s{{end}}`,
+		text: `Hello {{.Name}},
+
+You have {{.Count}} unread notification{{if ne .Count 1}}s{{end}}:
+{{range .Items}}
+- [{{.Level}}] {{.Message}}{{if .Link}}
+  {{.Link}}{{end}}{{end}}
+
+See them all at {{.Link}}
+`,
+		html: `<p>Hello {{.Name}},</p>
+<p>You have {{.Count}} unread notification{{if ne .Count 1}}s{{end}}:</p>
+<ul>{{range .Items}}
+<li><strong>{{.Level}}</strong> {{if .Link}}<a href="{{.Link}}">{{.Message}}</a>{{else}}{{.Message}}{{end}}</li>{{end}}
+</ul>
+<p><a href="{{.Link}}">See all notifications</a></p>`,
+	},
+	TemplateTest: {
+		subject: `FDM test email`,
+		text:    "This is a test email from the FDM backend. Email delivery works.\n",
+		html:    `<p>This is a test email from the FDM backend. Email delivery works.</p>`,
+	},
+}
+
+const htmlLayout = `<!DOCTYPE html>
+<html><body style="font-family: Helvetica, Arial, sans-serif; font-size: 14px; color: #222;">
+{{.}}
+<p style="color: #888; font-size: 12px;">Flight Data Monitoring</p>
+</body></html>`
+
+type compiledTemplate struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+var templates = map[string]compiledTemplate{}
+
+func init() {
+	for name, src := range templateSources {
+		templates[name] = compiledTemplate{
+			subject: texttemplate.Must(texttemplate.New(name).Option("missingkey=error").Parse(src.subject)),
+			text:    texttemplate.Must(texttemplate.New(name).Option("missingkey=error").Parse(src.text)),
+			html:    htmltemplate.Must(htmltemplate.New(name).Option("missingkey=error").Parse(src.html)),
+		}
+	}
+}
+
+var layout = htmltemplate.Must(htmltemplate.New("layout").Parse(htmlLayout))
+
+// IsTemplate reports whether a template exists
+func IsTemplate(name string) bool {
+	_, ok := templates[name]
+	return ok
+}
+
+// Render renders a template for one recipient
+func Render(name, to string, data map[string]interface{}) (Message, error) {
+	t, ok := templates[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+	var subject, text, body, html bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return Message{}, err
+	}
+	if err := t.text.Execute(&text, data); err != nil {
+		return Message{}, err
+	}
+	if err := t.html.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	if err := layout.Execute(&html, htmltemplate.HTML(body.String())); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      to,
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
@@ -64,52 +64,8 @@ func AuthenticateToken() gin.HandlerFunc {
 
 			// Validate session - single device enforcement
 			if db != nil && sessionID != "" {
-				var isActive bool
-				var expiresAt int64
-				err := db.QueryRow(
-					"SELECT isActive, expiresAt FROM Session WHERE id = ? AND userId = ?",
-					sessionID, userID,
-				).Scan(&isActive, &expiresAt)
-
-				if err == sql.ErrNoRows {
-					log.Printf("Session not found for user %s, session %s", userID, sessionID)
-					c.JSON(http.StatusUnauthorized, gin.H{
-						"error":   "Session expired or invalid",
-						"code":    "SESSION_INVALID",
-						"message": "You have been logged out. Please login again.",
-					})
-					c.Abort()
-					return
-				}
-
-				if err != nil {
-					log.Printf("Error checking session: %v", err)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating session"})
-					c.Abort()
-					return
-				}
-
-				// Check if session is still active
-				if !isActive {
-					c.JSON(http.StatusUnauthorized, gin.H{
-						"error":   "Session has been terminated",
-						"code":    "SESSION_TERMINATED",
-						"message": "Your session was terminated because you logged in from another device.",
-					})
-					c.Abort()
-					return
-				}
-
-				// Check if session has expired
-				if time.Now().UnixMilli() > expiresAt {
-					// Mark session as inactive
-					db.Exec("UPDATE Session SET isActive = 0, updatedAt = ? WHERE id = ?", 
-						time.Now().UnixMilli(), sessionID)
-					c.JSON(http.StatusUnauthorized, gin.H{
-						"error":   "Session expired",
-						"code":    "SESSION_EXPIRED",
-						"message": "Your session has expired. Please login again.",
-					})
+				if status, body := checkSession(userID, sessionID); status != 0 {
+					c.JSON(status, body)
 					c.Abort()
 					return
 				}
@@ -163,6 +119,78 @@ func AuthenticateToken() gin.HandlerFunc {
 	}
 }
 
+// checkSession enforces single device login: the session must exist, be active
+// and not be expired. It returns the status and body to respond with when the
+// session cannot be used, or 0 when it is valid.
+func checkSession(userID, sessionID string) (int, gin.H) {
+	var isActive bool
+	var expiresAt int64
+	err := db.QueryRow(
+		"SELECT isActive, expiresAt FROM Session WHERE id = ? AND userId = ?",
+		sessionID, userID,
+	).Scan(&isActive, &expiresAt)
+
+	if err == sql.ErrNoRows {
+		log.Printf("Session not found for user %s, session %s", userID, sessionID)
+		return http.StatusUnauthorized, gin.H{
+			"error":   "Session expired or invalid",
+			"code":    "SESSION_INVALID",
+			"message": "You have been logged out. Please login again.",
+		}
+	}
+
+	if err != nil {
+		log.Printf("Error checking session: %v", err)
+		return http.StatusInternalServerError, gin.H{"error": "Error validating session"}
+	}
+
+	// Check if session is still active
+	if !isActive {
+		return http.StatusUnauthorized, gin.H{
+			"error":   "Session has been terminated",
+			"code":    "SESSION_TERMINATED",
+			"message": "Your session was terminated because you logged in from another device.",
+		}
+	}
+
+	// Check if session has expired
+	if time.Now().UnixMilli() > expiresAt {
+		// Mark session as inactive
+		db.Exec("UPDATE Session SET isActive = 0, updatedAt = ? WHERE id = ?",
+			time.Now().UnixMilli(), sessionID)
+		return http.StatusUnauthorized, gin.H{
+			"error":   "Session expired",
+			"code":    "SESSION_EXPIRED",
+			"message": "Your session has expired. Please login again.",
+		}
+	}
+	return 0, nil
+}
+
+// SessionValid reports whether a session can still be used. Long lived
+// connections call it to end once the user is logged out.
+func SessionValid(userID, sessionID string) bool {
+	if db == nil || sessionID == "" {
+		return true
+	}
+	status, _ := checkSession(userID, sessionID)
+	return status == 0
+}
+
+// TokenFromQuery accepts the token in the access_token query parameter when no
+// Authorization header is sent, for clients such as the browser EventSource
+// that cannot set headers
+func TokenFromQuery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			if token := c.Query("access_token"); token != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+token)
+			}
+		}
+		c.Next()
+	}
+}
+
 // ErrorHandler handles errors and sends appropriate responses
 func ErrorHandler() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -53,6 +53,11 @@ func AdminOrFDA() gin.HandlerFunc {
 	return RoleRequired(models.RoleAdmin, models.RoleFDA)
 }
 
+// FDAOnly middleware - only FDA can access
+func FDAOnly() gin.HandlerFunc {
+	return RoleRequired(models.RoleFDA)
+}
+
 // GatekeeperOrAbove middleware - gatekeeper, FDA, or admin can access
 func GatekeeperOrAbove() gin.HandlerFunc {
 	return RoleRequired(models.RoleAdmin, models.RoleFDA, models.RoleGatekeeper)
@@ -103,10 +108,8 @@ func CanManageSubscriptions(role string) bool {
 // CompanyAccessControl middleware - ensures user can only access their company's data
 func CompanyAccessControl() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, _ := c.Get("userRole")
-		userCompanyID, _ := c.Get("userCompanyId")
-
-		role := userRole.(string)
+		role := c.GetString("userRole")
+		userCompanyID := c.GetString("userCompanyId")
 
 		// Admin and FDA can access all companies' data
 		if role == models.RoleAdmin || role == models.RoleFDA {
@@ -120,7 +123,7 @@ func CompanyAccessControl() gin.HandlerFunc {
 			requestedCompanyID = c.Query("companyId")
 		}
 
-		if requestedCompanyID != "" && requestedCompanyID != userCompanyID.(string) {
+		if requestedCompanyID != "" && requestedCompanyID != userCompanyID {
 			c.JSON(http.StatusForbidden, gin.H{
 				"error":   "Access denied",
 				"message": "You can only access your own company's data",
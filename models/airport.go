@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// AirportStats aggregates the exceedances attributed to an airport. Takeoff
+// phase events count against the departure airport and approach and landing
+// phase events against the destination.
+type AirportStats struct {
+	Airport         string         `json:"airport"`
+	Departures      int            `json:"departures"`
+	Arrivals        int            `json:"arrivals"`
+	DepartureEvents int            `json:"departureEvents"`
+	ArrivalEvents   int            `json:"arrivalEvents"`
+	DepartureRate   float64        `json:"departureRate"` // events per 1,000 departures
+	ArrivalRate     float64        `json:"arrivalRate"`   // events per 1,000 arrivals
+	DepartureRisk   float64        `json:"departureRisk"` // severity-weighted events per 1,000 departures
+	ArrivalRisk     float64        `json:"arrivalRisk"`   // severity-weighted events per 1,000 arrivals
+	Severities      map[string]int `json:"severities"`
+}
+
+// RouteStats aggregates the exceedances of flights on a city pair
+type RouteStats struct {
+	Route           string         `json:"route"` // HKJK-HKMO
+	Departure       string         `json:"departure"`
+	Destination     string         `json:"destination"`
+	Flights         int            `json:"flights"`
+	Events          int            `json:"events"`
+	DepartureEvents int            `json:"departureEvents"`
+	EnRouteEvents   int            `json:"enRouteEvents"`
+	ArrivalEvents   int            `json:"arrivalEvents"`
+	Rate            float64        `json:"rate"` // events per 1,000 flights
+	Risk            float64        `json:"risk"` // severity-weighted events per 1,000 flights
+	Severities      map[string]int `json:"severities"`
+}
+
+// AirportFlight is a flight in an airport or route drill-down with the
+// exceedances attributed to the selected airport or route
+type AirportFlight struct {
+	FlightID      string    `json:"flightId"`
+	Name          string    `json:"name"`
+	AircraftID    string    `json:"aircraftId"`
+	AircraftLabel string    `json:"aircraftLabel"`
+	Departure     string    `json:"departure"`
+	Destination   string    `json:"destination"`
+	Events        int       `json:"events"`
+	Risk          float64   `json:"risk"`
+	Phases        []string  `json:"phases"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// Trend intervals and breakdowns accepted by the trends endpoint. Usage
+// history can also be read by day.
+const (
+	TrendIntervalMonth = "month"
+	TrendIntervalWeek  = "week"
+	TrendIntervalDay   = "day"
+)
+
+// TrendGroups lists the dimensions a trend can be broken down by
+var TrendGroups = []string{"eventCode", "severity", "phase", "aircraft", "route"}
+
+// TrendPoint is the event rate for one month or week
+type TrendPoint struct {
+	Period        string    `json:"period"` // 2025-11 or 2025-W47
+	Start         time.Time `json:"start"`
+	Flights       int       `json:"flights"`
+	Events        int       `json:"events"`
+	Rate          float64   `json:"rate"`          // events per 1,000 flights
+	MovingAverage float64   `json:"movingAverage"` // rate over the trailing window
+}
+
+// TrendTotals summarises a date range
+type TrendTotals struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Flights int       `json:"flights"`
+	Events  int       `json:"events"`
+	Rate    float64   `json:"rate"`
+}
+
+// TrendComparison compares the requested range with the range of equal length before it
+type TrendComparison struct {
+	Current           TrendTotals `json:"current"`
+	Previous          TrendTotals `json:"previous"`
+	RateChange        float64     `json:"rateChange"`
+	RateChangePercent *float64    `json:"rateChangePercent"` // nil when the previous rate is zero
+}
+
+// TrendSeries is the trend of one event code, severity, phase, aircraft or route
+type TrendSeries struct {
+	Key               string       `json:"key"`
+	Label             string       `json:"label"`
+	Flights           int          `json:"flights"`
+	Events            int          `json:"events"`
+	Rate              float64      `json:"rate"`
+	PreviousRate      float64      `json:"previousRate"`
+	RateChangePercent *float64     `json:"rateChangePercent"`
+	Points            []TrendPoint `json:"points"`
+}
+
+// TrendsResponse is returned by GET /api/analytics/trends
+type TrendsResponse struct {
+	Interval   string          `json:"interval"`
+	GroupBy    string          `json:"groupBy,omitempty"`
+	Window     int             `json:"window"`
+	CompanyID  *string         `json:"companyId"`
+	Periods    []TrendPoint    `json:"periods"`
+	Series     []TrendSeries   `json:"series"`
+	Comparison TrendComparison `json:"comparison"`
+}
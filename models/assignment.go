@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OptionalTime is a time field of a partial update. Set reports whether the
+// field was sent at all; a null value leaves Time nil.
+type OptionalTime struct {
+	Set  bool
+	Time *time.Time
+}
+
+// UnmarshalJSON records that the field was sent
+func (t *OptionalTime) UnmarshalJSON(data []byte) error {
+	t.Set = true
+	t.Time = nil
+	if string(data) == "null" {
+		return nil
+	}
+	var v time.Time
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	t.Time = &v
+	return nil
+}
+
+// UpdateAssignmentRequest changes the assignee, due date or priority of an exceedance.
+// Omitted fields are left unchanged; an empty assigneeId unassigns the exceedance
+// and a null dueDate clears it.
+type UpdateAssignmentRequest struct {
+	AssigneeID *string      `json:"assigneeId"`
+	DueDate    OptionalTime `json:"dueDate"`
+	Priority   *string      `json:"priority"`
+}
+
+// BulkAssignRequest reassigns several exceedances at once
+type BulkAssignRequest struct {
+	IDs        []string     `json:"ids" binding:"required"`
+	AssigneeID *string      `json:"assigneeId"`
+	DueDate    OptionalTime `json:"dueDate"`
+	Priority   *string      `json:"priority"`
+}
+
+// ExceedanceQueueItem is a lightweight exceedance row for the analyst work queue
+type ExceedanceQueueItem struct {
+	ID              string     `json:"id"`
+	EventStatus     string     `json:"eventStatus"`
+	ExceedanceLevel *string    `json:"exceedanceLevel"`
+	Priority        *string    `json:"priority"`
+	AssigneeID      *string    `json:"assigneeId"`
+	AssigneeName    *string    `json:"assigneeName"`
+	DueDate         *time.Time `json:"dueDate"`
+	Overdue         bool       `json:"overdue"`
+	AgeHours        float64    `json:"ageHours"`
+	Description     string     `json:"description"`
+	FlightPhase     string     `json:"flightPhase"`
+	EventName       *string    `json:"eventName"`
+	FlightID        string     `json:"flightId"`
+	FlightName      *string    `json:"flightName"`
+	AircraftID      string     `json:"aircraftId"`
+	CompanyID       *string    `json:"companyId"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
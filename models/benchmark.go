@@ -0,0 +1,42 @@
+package models
+
+// BenchmarkFigures are a company's own flights, exceedances and rate per 1,000 flights
+type BenchmarkFigures struct {
+	Flights int     `json:"flights"`
+	Events  int     `json:"events"`
+	Rate    float64 `json:"rate"`
+}
+
+// PeerAggregate summarises the rates of other operators. Aggregates of groups
+// with fewer operators than the minimum group size are suppressed.
+type PeerAggregate struct {
+	Operators   int                `json:"operators"`
+	Suppressed  bool               `json:"suppressed"`
+	Mean        *float64           `json:"mean,omitempty"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"` // p25, p50, p75, p90; only without noise
+}
+
+// BenchmarkComparison compares a company with its peers. PercentileRank is the
+// share of peers with a lower rate; lower rates are better.
+type BenchmarkComparison struct {
+	Key            string           `json:"key"`
+	Company        BenchmarkFigures `json:"company"`
+	Peers          PeerAggregate    `json:"peers"`
+	PercentileRank *float64         `json:"percentileRank"`
+}
+
+// BenchmarkNoise describes the Laplace noise added to peer aggregates
+type BenchmarkNoise struct {
+	Epsilon float64 `json:"epsilon"`
+	RateCap float64 `json:"rateCap"` // per-operator rates are clipped to this before aggregating
+}
+
+// BenchmarkResponse is returned by GET /api/analytics/benchmarks
+type BenchmarkResponse struct {
+	CompanyID    string                `json:"companyId"`
+	MinGroupSize int                   `json:"minGroupSize"`
+	Noise        *BenchmarkNoise       `json:"noise"`
+	Overall      BenchmarkComparison   `json:"overall"`
+	ByType       []BenchmarkComparison `json:"byType"`
+	BySeverity   []BenchmarkComparison `json:"bySeverity"`
+}
@@ -0,0 +1,45 @@
+package models
+
+// Bulk exceedance actions
+const (
+	BulkActionStatus  = "status"
+	BulkActionComment = "comment"
+	BulkActionAssign  = "assign"
+	BulkActionDelete  = "delete"
+)
+
+// ExceedanceFilter selects exceedances for bulk operations
+type ExceedanceFilter struct {
+	FlightID  string `json:"flightId"`
+	EventCode string `json:"eventCode"`
+	Phase     string `json:"phase"`
+	Severity  string `json:"severity"`
+	Status    string `json:"status"`
+}
+
+// BulkExceedanceRequest applies one action to exceedances selected either by
+// ids or by filter. Fields other than action, ids and filter depend on the action.
+type BulkExceedanceRequest struct {
+	Action      string            `json:"action" binding:"required"` // status, comment, assign, delete
+	IDs         []string          `json:"ids"`
+	Filter      *ExceedanceFilter `json:"filter"`
+	EventStatus string            `json:"eventStatus"`
+	Comment     *string           `json:"comment"`
+	AssigneeID  *string           `json:"assigneeId"`
+	DueDate     OptionalTime      `json:"dueDate"`
+	Priority    *string           `json:"priority"`
+}
+
+// BulkItemResult reports the outcome of a bulk action for one exceedance
+type BulkItemResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RowError describes a validation failure for one row of a batch request
+type RowError struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// ExceedanceComment is a single entry in an exceedance discussion thread
+type ExceedanceComment struct {
+	ID           string     `json:"id"`
+	ExceedanceID string     `json:"exceedanceId"`
+	UserID       *string    `json:"userId"`
+	UserName     *string    `json:"userName"`
+	Body         string     `json:"body"`
+	Mentions     []string   `json:"mentions"`
+	EditedAt     *time.Time `json:"editedAt"`
+	CreatedAt    time.Time  `json:"createdAt"`
+	UpdatedAt    time.Time  `json:"updatedAt"`
+}
+
+// CommentRequest creates or edits a comment. Users are mentioned with
+// @username or @email and receive a notification.
+type CommentRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// ExceedanceAttachment describes a file attached to an exceedance
+type ExceedanceAttachment struct {
+	ID           string    `json:"id"`
+	ExceedanceID string    `json:"exceedanceId"`
+	UserID       *string   `json:"userId"`
+	UserName     *string   `json:"userName"`
+	FileName     string    `json:"fileName"`
+	ContentType  *string   `json:"contentType"`
+	Size         int64     `json:"size"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
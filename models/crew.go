@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// Crew roles
+const (
+	CrewRoleCaptain      = "captain"
+	CrewRoleFirstOfficer = "first_officer"
+)
+
+// CrewMember is a pilot of an operator. Code is the de-identified reference
+// used everywhere; EmployeeID and Name are only returned by a crew contact.
+type CrewMember struct {
+	ID         string    `json:"id"`
+	CompanyID  string    `json:"companyId"`
+	Code       string    `json:"code"`
+	Role       string    `json:"role"` // captain, first_officer
+	IsActive   bool      `json:"isActive"`
+	EmployeeID *string   `json:"employeeId,omitempty"`
+	Name       *string   `json:"name,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// CrewMemberRequest creates or updates a crew member. Omitted fields keep
+// their current value.
+type CrewMemberRequest struct {
+	CompanyID  *string `json:"companyId"`
+	EmployeeID *string `json:"employeeId"`
+	Name       *string `json:"name"`
+	Role       *string `json:"role"`
+	IsActive   *bool   `json:"isActive"`
+}
+
+// FlightCrewMember is a crew member's seat on a flight
+type FlightCrewMember struct {
+	CrewMemberID string `json:"crewMemberId"`
+	Code         string `json:"code"`
+	Role         string `json:"role"`
+}
+
+// FlightCrewRequest sets the crew of a flight. An empty id removes the seat.
+type FlightCrewRequest struct {
+	CaptainID      *string `json:"captainId"`
+	FirstOfficerID *string `json:"firstOfficerId"`
+}
+
+// CrewStats aggregates the exceedances of the flights a crew member flew
+type CrewStats struct {
+	CrewMemberID string         `json:"crewMemberId"`
+	Code         string         `json:"code"`
+	Role         string         `json:"role"`
+	Flights      int            `json:"flights"`
+	Events       int            `json:"events"`
+	Rate         float64        `json:"rate"` // events per 1,000 flights
+	Risk         float64        `json:"risk"` // severity-weighted events per 1,000 flights
+	Severities   map[string]int `json:"severities"`
+}
+
+// CrewContactRequest reveals a crew member's identity. The reason is logged.
+type CrewContactRequest struct {
+	Reason       string  `json:"reason" binding:"required"`
+	ExceedanceID *string `json:"exceedanceId"`
+}
+
+// CrewContact is a logged identity disclosure
+type CrewContact struct {
+	ID           string    `json:"id"`
+	CrewMemberID string    `json:"crewMemberId"`
+	ExceedanceID *string   `json:"exceedanceId"`
+	UserID       *string   `json:"userId"`
+	UserName     *string   `json:"userName,omitempty"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// CrewContactResponse returns the logged contact with the revealed identity
+type CrewContactResponse struct {
+	Contact    CrewContact `json:"contact"`
+	CrewMember CrewMember  `json:"crewMember"`
+}
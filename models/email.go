@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Email delivery statuses
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSending = "sending"
+	EmailStatusSent    = "sent"
+	EmailStatusFailed  = "failed" // gave up after the last retry
+)
+
+// EmailDelivery is an entry of the outgoing email log. Message bodies are not
+// exposed; they may hold links such as password reset tokens.
+type EmailDelivery struct {
+	ID            string     `json:"id"`
+	UserID        *string    `json:"userId"`
+	ExceedanceID  *string    `json:"exceedanceId"`
+	To            string     `json:"to"`
+	Template      string     `json:"template"`
+	Subject       string     `json:"subject"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	LastError     *string    `json:"lastError"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt"`
+	SentAt        *time.Time `json:"sentAt"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
+
+// TestEmailRequest sends a test email, e.g. to check the SMTP settings against
+// a local mail catcher
+type TestEmailRequest struct {
+	To string `json:"to" binding:"required,email"`
+}
+
+// PasswordResetRequest asks for a password reset link
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ConfirmPasswordResetRequest sets a new password with a reset token
+type ConfirmPasswordResetRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// EscalationTier notifies its recipients when an exceedance is still new
+// AfterHours after it was created. Recipients are the listed users plus the
+// company's active users holding one of the listed roles.
+type EscalationTier struct {
+	AfterHours int      `json:"afterHours"`
+	UserIDs    []string `json:"userIds"`
+	Roles      []string `json:"roles"`
+	Channels   []string `json:"channels"`
+}
+
+// EscalationPolicy escalates a company's unacknowledged exceedances of the
+// listed severities (any when empty) through its tiers, in order
+type EscalationPolicy struct {
+	ID         string           `json:"id"`
+	CompanyID  string           `json:"companyId"`
+	Name       string           `json:"name"`
+	Severities []string         `json:"severities"`
+	Tiers      []EscalationTier `json:"tiers"`
+	IsActive   bool             `json:"isActive"`
+	CreatedBy  *string          `json:"createdBy"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	UpdatedAt  time.Time        `json:"updatedAt"`
+}
+
+// EscalationPolicyRequest creates or updates a policy. Omitted fields keep
+// their current value, or the default when creating.
+type EscalationPolicyRequest struct {
+	CompanyID  *string          `json:"companyId"`
+	Name       *string          `json:"name"`
+	Severities []string         `json:"severities"`
+	Tiers      []EscalationTier `json:"tiers"`
+	IsActive   *bool            `json:"isActive"`
+}
+
+// ExceedanceEscalation records a tier of a policy escalating an exceedance
+type ExceedanceEscalation struct {
+	ID           string    `json:"id"`
+	ExceedanceID string    `json:"exceedanceId"`
+	PolicyID     *string   `json:"policyId"` // nil once the policy is deleted
+	PolicyName   *string   `json:"policyName,omitempty"`
+	Tier         int       `json:"tier"` // 1 for the first tier
+	AfterHours   int       `json:"afterHours"`
+	Recipients   []string  `json:"recipients"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Scheduled maintenance jobs
+const (
+	JobSubscriptionExpiry  = "subscription_expiry"
+	JobSessionCleanup      = "session_cleanup"
+	JobNotificationDigests = "notification_digests"
+	JobReportSchedules     = "report_schedules"
+	JobRetentionPurge      = "retention_purge"
+	JobUsageSnapshots      = "usage_snapshots"
+)
+
+// Job run statuses
+const (
+	JobRunStatusRunning   = "running"
+	JobRunStatusSucceeded = "succeeded"
+	JobRunStatusFailed    = "failed"
+)
+
+// Job run sources
+const (
+	JobRunSourceSchedule = "schedule"
+	JobRunSourceManual   = "manual"
+)
+
+// ScheduledJob is a maintenance job run by the scheduler on a cron schedule.
+// LockedBy names the server instance running it, until LockedUntil.
+type ScheduledJob struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Schedule    string     `json:"schedule"`
+	IsEnabled   bool       `json:"isEnabled"`
+	Running     bool       `json:"running"`
+	NextRunAt   *time.Time `json:"nextRunAt"`
+	LockedBy    *string    `json:"lockedBy"`
+	LockedUntil *time.Time `json:"lockedUntil"`
+	LastRun     *JobRun    `json:"lastRun"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// ScheduledJobRequest changes a job's schedule or pauses it. Omitted fields
+// keep their current value.
+type ScheduledJobRequest struct {
+	Schedule  *string `json:"schedule"`
+	IsEnabled *bool   `json:"isEnabled"`
+}
+
+// JobRun is an entry of the job run history. Result counts what the run did,
+// such as the rows it purged.
+type JobRun struct {
+	ID          string         `json:"id"`
+	JobName     string         `json:"jobName"`
+	Source      string         `json:"source"`
+	Status      string         `json:"status"`
+	TriggeredBy *string        `json:"triggeredBy"`
+	Instance    string         `json:"instance"`
+	Result      map[string]int `json:"result"`
+	Error       *string        `json:"error"`
+	StartedAt   time.Time      `json:"startedAt"`
+	FinishedAt  *time.Time     `json:"finishedAt"`
+	DurationMs  *int64         `json:"durationMs"`
+}
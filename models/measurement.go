@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// MeasurementDefinition describes a value measured on every flight at a key
+// flight point, such as the vertical acceleration at touchdown
+type MeasurementDefinition struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Unit        string `json:"unit"`
+	Description string `json:"description"`
+}
+
+// FlightMeasurement is a measurement computed for one flight when it was ingested
+type FlightMeasurement struct {
+	FlightID   string    `json:"flightId"`
+	AircraftID string    `json:"aircraftId"`
+	Code       string    `json:"code"`
+	Name       string    `json:"name"`
+	Unit       string    `json:"unit"`
+	Value      float64   `json:"value"`
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+// HistogramBin counts values in [Lower, Upper). The last bin includes Upper.
+type HistogramBin struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int     `json:"count"`
+}
+
+// MeasurementStats summarises the distribution of a measurement
+type MeasurementStats struct {
+	Count       int                `json:"count"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Mean        float64            `json:"mean"`
+	StdDev      float64            `json:"stdDev"`
+	Percentiles map[string]float64 `json:"percentiles"` // p5, p25, p50, p75, p95, p99
+	Histogram   []HistogramBin     `json:"histogram"`
+}
+
+// MeasurementOutlier is a flight outside the Tukey fences (1.5 × IQR beyond the quartiles)
+type MeasurementOutlier struct {
+	FlightID      string    `json:"flightId"`
+	FlightName    string    `json:"flightName"`
+	AircraftID    string    `json:"aircraftId"`
+	AircraftLabel string    `json:"aircraftLabel"`
+	Value         float64   `json:"value"`
+	Fence         float64   `json:"fence"`
+	Direction     string    `json:"direction"` // high or low
+	FlightDate    time.Time `json:"flightDate"`
+}
+
+// MeasurementGroup is the distribution for one aircraft, aircraft type or company
+type MeasurementGroup struct {
+	Key      string               `json:"key"`
+	Label    string               `json:"label"`
+	Stats    MeasurementStats     `json:"stats"`
+	Outliers []MeasurementOutlier `json:"outliers"`
+}
+
+// MeasurementDistribution is returned by the measurement distribution endpoint
+type MeasurementDistribution struct {
+	Measurement MeasurementDefinition `json:"measurement"`
+	GroupBy     string                `json:"groupBy,omitempty"`
+	Overall     MeasurementGroup      `json:"overall"`
+	Groups      []MeasurementGroup    `json:"groups"`
+}
+
+// ComputeMeasurementsRequest recomputes measurements from stored flight files.
+// All flights in scope are recomputed when flightIds is empty.
+type ComputeMeasurementsRequest struct {
+	FlightIDs []string `json:"flightIds"`
+}
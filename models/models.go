@@ -47,19 +47,21 @@ type Aircraft struct {
 	Company      *Company  `json:"company,omitempty"`
 }
 
-// CSV represents a CSV file in the system
+// CSV represents a CSV file in the system. The free-text pilot name entered
+// at upload is stored but never loaded; Crew holds the de-identified crew codes.
 type CSV struct {
-	ID          string    `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	File        string    `json:"file" db:"file"`
-	Status      *string   `json:"status" db:"status"`
-	Departure   *string   `json:"departure" db:"departure"`
-	Pilot       *string   `json:"pilot" db:"pilot"`
-	Destination *string   `json:"destination" db:"destination"`
-	FlightHours *string   `json:"flightHours" db:"flightHours"`
-	AircraftID  string    `json:"aircraftId" db:"aircraftId"`
-	CreatedAt   time.Time `json:"createdAt" db:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt" db:"updatedAt"`
+	ID          string             `json:"id" db:"id"`
+	Name        string             `json:"name" db:"name"`
+	File        string             `json:"file" db:"file"`
+	Status      *string            `json:"status" db:"status"`
+	Departure   *string            `json:"departure" db:"departure"`
+	Destination *string            `json:"destination" db:"destination"`
+	FlightHours *string            `json:"flightHours" db:"flightHours"`
+	FlightDate  *time.Time         `json:"flightDate,omitempty" db:"flightDate"`
+	AircraftID  string             `json:"aircraftId" db:"aircraftId"`
+	Crew        []FlightCrewMember `json:"crew,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt" db:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" db:"updatedAt"`
 }
 
 // Flight represents a flight in the system
@@ -99,20 +101,23 @@ type EventLog struct {
 
 // Exceedance represents an exceedance in the system
 type Exceedance struct {
-	ID               string    `json:"id" db:"id"`
-	ExceedanceValues string    `json:"exceedanceValues" db:"exceedanceValues"`
-	FlightPhase      string    `json:"flightPhase" db:"flightPhase"`
-	ParameterName    string    `json:"parameterName" db:"parameterName"`
-	Description      string    `json:"description" db:"description"`
-	EventStatus      string    `json:"eventStatus" db:"eventStatus"`
-	AircraftID       string    `json:"aircraftId" db:"aircraftId"`
-	FlightID         string    `json:"flightId" db:"flightId"`
-	File             *string   `json:"file" db:"file"`
-	EventID          *string   `json:"eventId" db:"eventId"`
-	Comment          *string   `json:"comment" db:"comment"`
-	ExceedanceLevel  *string   `json:"exceedanceLevel" db:"exceedanceLevel"`
-	CreatedAt        time.Time `json:"createdAt" db:"createdAt"`
-	UpdatedAt        time.Time `json:"updatedAt" db:"updatedAt"`
+	ID               string     `json:"id" db:"id"`
+	ExceedanceValues string     `json:"exceedanceValues" db:"exceedanceValues"`
+	FlightPhase      string     `json:"flightPhase" db:"flightPhase"`
+	ParameterName    string     `json:"parameterName" db:"parameterName"`
+	Description      string     `json:"description" db:"description"`
+	EventStatus      string     `json:"eventStatus" db:"eventStatus"`
+	AircraftID       string     `json:"aircraftId" db:"aircraftId"`
+	FlightID         string     `json:"flightId" db:"flightId"`
+	File             *string    `json:"file" db:"file"`
+	EventID          *string    `json:"eventId" db:"eventId"`
+	Comment          *string    `json:"comment" db:"comment"`
+	ExceedanceLevel  *string    `json:"exceedanceLevel" db:"exceedanceLevel"`
+	AssigneeID       *string    `json:"assigneeId" db:"assigneeId"`
+	DueDate          *time.Time `json:"dueDate" db:"dueDate"`
+	Priority         *string    `json:"priority" db:"priority"`
+	CreatedAt        time.Time  `json:"createdAt" db:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt" db:"updatedAt"`
 	// Related data - populated via JOINs
 	AircraftRegistration *string   `json:"aircraftRegistration,omitempty"`
 	EventLog             *EventLog `json:"EventLog,omitempty"`
@@ -183,6 +188,11 @@ type UploadCSVRequest struct {
 	Destination *string `form:"destination,omitempty"`
 	FlightHours *string `form:"flightHours,omitempty"`
 	Pilot       *string `form:"pilot,omitempty"`
+	// Date the flight was flown, YYYY-MM-DD or RFC3339; defaults to the upload time
+	FlightDate *string `form:"flightDate,omitempty"`
+	// Crew member ids, see POST /api/crew
+	CaptainID      *string `form:"captainId,omitempty"`
+	FirstOfficerID *string `form:"firstOfficerId,omitempty"`
 }
 
 // CreateEventRequest represents the create event request payload
@@ -2,23 +2,68 @@ package models
 
 import "time"
 
+// Notification tells a user about a target record: an exceedance, a flight,
+// a subscription or a user. The id of the target is in the matching field;
+// FlightID is also set on exceedance notifications to group them by flight.
 type Notification struct {
-	ID           string    `json:"id"`
-	UserID       string    `json:"userId"`
-	ExceedanceID string    `json:"exceedanceId"`
-	Message      string    `json:"message"`
-	Level        string    `json:"level"`
-	IsRead       bool      `json:"isRead"`
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
-	
-	// Relations
-	Exceedance   *Exceedance `json:"exceedance,omitempty"`
-	User         *User       `json:"user,omitempty"`
+	ID             string           `json:"id"`
+	UserID         string           `json:"userId"`
+	TargetType     string           `json:"targetType"`
+	ExceedanceID   *string          `json:"exceedanceId"`
+	FlightID       *string          `json:"flightId"`
+	SubscriptionID *string          `json:"subscriptionId"`
+	TargetUserID   *string          `json:"targetUserId"`
+	Link           NotificationLink `json:"link"`
+	Message        string           `json:"message"`
+	Level          string           `json:"level"`
+	IsRead         bool             `json:"isRead"`
+	DeliveryMode   string           `json:"deliveryMode"`
+	DigestDueAt    *time.Time       `json:"digestDueAt"` // set while held for a digest or quiet hours
+	DigestID       *string          `json:"digestId"`
+	CreatedAt      time.Time        `json:"createdAt"`
+	UpdatedAt      time.Time        `json:"updatedAt"`
+
+	// Relations: the target record, loaded by the notification endpoints
+	Exceedance   *Exceedance   `json:"exceedance,omitempty"`
+	Flight       *CSV          `json:"flight,omitempty"`
+	Subscription *Subscription `json:"subscription,omitempty"`
+	TargetUser   *User         `json:"targetUser,omitempty"`
+	User         *User         `json:"user,omitempty"`
+}
+
+// Notification target types
+const (
+	NotificationTargetExceedance   = "exceedance"
+	NotificationTargetFlight       = "flight"
+	NotificationTargetSubscription = "subscription"
+	NotificationTargetUser         = "user"
+)
+
+// NotificationLink is the deep link a client opens for a notification. Path
+// is the route in the web app and URL the same route under APP_URL.
+type NotificationLink struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Path string `json:"path"`
+	URL  string `json:"url"`
+}
+
+// NotificationGroup holds the notifications of one flight. Notifications that
+// do not concern a flight are grouped under a nil FlightID.
+type NotificationGroup struct {
+	FlightID      *string        `json:"flightId"`
+	Flight        *CSV           `json:"flight,omitempty"`
+	Count         int            `json:"count"`
+	Unread        int            `json:"unread"`
+	LatestAt      time.Time      `json:"latestAt"`
+	Notifications []Notification `json:"notifications"`
 }
 
+// CreateNotificationRequest applies the notification rules to the exceedances
+// of a flight. Only flightId is read; aircraftId and exceedances are accepted
+// for older clients.
 type CreateNotificationRequest struct {
-	FlightID    string `json:"flightId"`
+	FlightID    string `json:"flightId" binding:"required"`
 	AircraftID  string `json:"aircraftId"`
 	Exceedances []struct {
 		Description string `json:"description"`
@@ -26,4 +71,96 @@ type CreateNotificationRequest struct {
 		Phase      string `json:"phase"`
 		Parameter  string `json:"parameter"`
 	} `json:"exceedances"`
-}
\ No newline at end of file
+}
+
+// Notification channels
+const (
+	NotificationChannelInApp = "in_app"
+	NotificationChannelEmail = "email"
+)
+
+// NotificationChannels lists the channels a rule can deliver through
+var NotificationChannels = []string{NotificationChannelInApp, NotificationChannelEmail}
+
+// NotificationRule decides who is notified of new exceedances of a company.
+// Empty match lists match any value. Recipients are the listed users plus the
+// company's active users holding one of the listed roles.
+type NotificationRule struct {
+	ID          string    `json:"id"`
+	CompanyID   string    `json:"companyId"`
+	Name        string    `json:"name"`
+	EventCodes  []string  `json:"eventCodes"`
+	Severities  []string  `json:"severities"`
+	AircraftIDs []string  `json:"aircraftIds"`
+	Phases      []string  `json:"phases"`
+	UserIDs     []string  `json:"userIds"`
+	Roles       []string  `json:"roles"`
+	Channels    []string  `json:"channels"`
+	IsActive    bool      `json:"isActive"`
+	CreatedBy   *string   `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// NotificationRuleRequest creates or updates a rule. Omitted fields keep their
+// current value, or the default when creating.
+type NotificationRuleRequest struct {
+	CompanyID   *string  `json:"companyId"`
+	Name        *string  `json:"name"`
+	EventCodes  []string `json:"eventCodes"`
+	Severities  []string `json:"severities"`
+	AircraftIDs []string `json:"aircraftIds"`
+	Phases      []string `json:"phases"`
+	UserIDs     []string `json:"userIds"`
+	Roles       []string `json:"roles"`
+	Channels    []string `json:"channels"`
+	IsActive    *bool    `json:"isActive"`
+}
+
+// Notification delivery modes
+const (
+	NotificationModeImmediate = "immediate"
+	NotificationModeHourly    = "hourly" // held for a digest at the start of the next hour
+	NotificationModeDaily     = "daily"  // held for a digest at the preference's digest hour
+)
+
+// NotificationModes lists the delivery modes
+var NotificationModes = []string{NotificationModeImmediate, NotificationModeHourly, NotificationModeDaily}
+
+// NotificationPreference holds how a user wants to be notified. Channels
+// narrows the channels notification rules deliver through. SeverityModes maps
+// exceedance severities to a delivery mode; other notifications, such as
+// mentions and SPI alerts, use DefaultMode. Nothing is pushed or emailed during
+// quiet hours; what arrives then is sent when they end.
+type NotificationPreference struct {
+	UserID          string            `json:"userId"`
+	Channels        []string          `json:"channels"`
+	SeverityModes   map[string]string `json:"severityModes"`
+	DefaultMode     string            `json:"defaultMode"`
+	DigestHour      int               `json:"digestHour"`      // local hour of daily digests
+	QuietHoursStart *string           `json:"quietHoursStart"` // 22:00
+	QuietHoursEnd   *string           `json:"quietHoursEnd"`   // 07:00
+	Timezone        string            `json:"timezone"`        // IANA name, e.g. Africa/Nairobi
+	UpdatedAt       *time.Time        `json:"updatedAt"`       // nil until the user saves preferences
+}
+
+// NotificationPreferenceRequest updates preferences. Omitted fields keep their
+// current value; an empty quiet hour turns quiet hours off.
+type NotificationPreferenceRequest struct {
+	Channels        []string          `json:"channels"`
+	SeverityModes   map[string]string `json:"severityModes"`
+	DefaultMode     *string           `json:"defaultMode"`
+	DigestHour      *int              `json:"digestHour"`
+	QuietHoursStart *string           `json:"quietHoursStart"`
+	QuietHoursEnd   *string           `json:"quietHoursEnd"`
+	Timezone        *string           `json:"timezone"`
+}
+
+// NotificationDigest summarises the notifications sent together in a digest
+type NotificationDigest struct {
+	ID              string         `json:"id"`
+	Count           int            `json:"count"`
+	Levels          map[string]int `json:"levels"`
+	NotificationIDs []string       `json:"notificationIds"`
+	CreatedAt       time.Time      `json:"createdAt"`
+}
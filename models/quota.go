@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Subscription quota resources
+const (
+	QuotaUsers    = "users"
+	QuotaAircraft = "aircraft"
+	QuotaFlights  = "flights"
+	QuotaStorage  = "storage"
+)
+
+// QuotaResources lists the resources a subscription limits
+var QuotaResources = []string{QuotaUsers, QuotaAircraft, QuotaFlights, QuotaStorage}
+
+// QuotaUsage is a company's use of one resource against its subscription.
+// Users counts active users, flights those uploaded this calendar month and
+// storage the bytes of flight files, attachments and reports. A limit of 0
+// is unlimited.
+type QuotaUsage struct {
+	Resource string  `json:"resource"`
+	Used     int64   `json:"used"`
+	Limit    int64   `json:"limit"`
+	Percent  float64 `json:"percent"`
+	Warning  int     `json:"warning,omitempty"` // highest warning threshold reached
+	Exceeded bool    `json:"exceeded"`
+}
+
+// QuotaOverride lets a company exceed its quotas until ExpiresAt, or until it
+// is removed when ExpiresAt is nil
+type QuotaOverride struct {
+	CompanyID string     `json:"companyId"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Reason    *string    `json:"reason"`
+	CreatedBy *string    `json:"createdBy"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// QuotaOverrideRequest sets a company's quota override
+type QuotaOverrideRequest struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+	Reason    *string    `json:"reason"`
+}
+
+// CompanyQuota is a company's usage of every quota of its subscription
+type CompanyQuota struct {
+	CompanyID      string         `json:"companyId"`
+	SubscriptionID *string        `json:"subscriptionId"`
+	PlanName       *string        `json:"planName"`
+	Period         string         `json:"period"` // month the flight quota counts
+	Quotas         []QuotaUsage   `json:"quotas"`
+	Override       *QuotaOverride `json:"override"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import "time"
+
+// Report templates
+const (
+	ReportTemplateMonthlySummary = "monthly_summary" // fleet totals, severities, top events, aircraft and industry comparison
+	ReportTemplateAircraft       = "aircraft"        // exceedances per aircraft
+	ReportTemplateEvent          = "event"           // exceedances per event code
+)
+
+// ReportTemplates lists the available templates
+var ReportTemplates = []string{ReportTemplateMonthlySummary, ReportTemplateAircraft, ReportTemplateEvent}
+
+// Report is a generated report file stored for download
+type Report struct {
+	ID          string    `json:"id"`
+	CompanyID   string    `json:"companyId"`
+	ScheduleID  *string   `json:"scheduleId"`
+	Template    string    `json:"template"`
+	Title       string    `json:"title"`
+	Format      string    `json:"format"` // pdf, xlsx
+	PeriodStart time.Time `json:"periodStart"`
+	PeriodEnd   time.Time `json:"periodEnd"` // exclusive
+	AircraftID  *string   `json:"aircraftId"`
+	EventCode   *string   `json:"eventCode"`
+	Size        int64     `json:"size"`
+	CreatedBy   *string   `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// GenerateReportRequest generates a report now. The period is a month
+// (default the previous month) or a from/to date range.
+type GenerateReportRequest struct {
+	CompanyID  *string  `json:"companyId"`
+	Template   string   `json:"template" binding:"required"`
+	Formats    []string `json:"formats"` // default ["pdf"]
+	Month      *string  `json:"month"`   // 2025-11
+	From       *string  `json:"from"`
+	To         *string  `json:"to"`
+	AircraftID *string  `json:"aircraftId"` // aircraft template: a single aircraft
+	EventCode  *string  `json:"eventCode"`  // event template: a single event code
+}
+
+// ReportSchedule generates a company's report for the previous month at the
+// start of every month
+type ReportSchedule struct {
+	ID         string    `json:"id"`
+	CompanyID  string    `json:"companyId"`
+	Template   string    `json:"template"`
+	Formats    []string  `json:"formats"`
+	AircraftID *string   `json:"aircraftId"`
+	EventCode  *string   `json:"eventCode"`
+	IsActive   bool      `json:"isActive"`
+	LastPeriod *string   `json:"lastPeriod"` // last month generated, 2025-11
+	CreatedBy  *string   `json:"createdBy"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// ReportScheduleRequest creates or updates a schedule. Omitted fields keep
+// their current value, or the default when creating.
+type ReportScheduleRequest struct {
+	CompanyID  *string  `json:"companyId"`
+	Template   *string  `json:"template"`
+	Formats    []string `json:"formats"`
+	AircraftID *string  `json:"aircraftId"`
+	EventCode  *string  `json:"eventCode"`
+	IsActive   *bool    `json:"isActive"`
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// SPI formulas
+const (
+	SPIFormulaRate  = "rate"  // matching events per ratePer flights
+	SPIFormulaCount = "count" // matching events
+)
+
+// SafetyPerformanceIndicator is a company safety indicator, e.g. unstable
+// approaches per 1,000 landings. It counts exceedances of events matching
+// eventCodes or eventTypes, optionally limited to some severities.
+type SafetyPerformanceIndicator struct {
+	ID             string    `json:"id"`
+	CompanyID      string    `json:"companyId"`
+	Name           string    `json:"name"`
+	Description    *string   `json:"description"`
+	EventCodes     []string  `json:"eventCodes"`
+	EventTypes     []string  `json:"eventTypes"`
+	Severities     []string  `json:"severities"`
+	Formula        string    `json:"formula"`
+	RatePer        int       `json:"ratePer"`
+	Target         *float64  `json:"target"`
+	AlertSigmas    []float64 `json:"alertSigmas"` // alert level n is breached above mean + alertSigmas[n-1]·σ
+	BaselineMonths int       `json:"baselineMonths"`
+	IsActive       bool      `json:"isActive"`
+	CreatedBy      *string   `json:"createdBy"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+	Latest         *SPIValue `json:"latest,omitempty"`
+}
+
+// SPIRequest creates or updates an SPI. Omitted fields keep their current
+// value, or the default when creating.
+type SPIRequest struct {
+	CompanyID      *string   `json:"companyId"`
+	Name           *string   `json:"name"`
+	Description    *string   `json:"description"`
+	EventCodes     []string  `json:"eventCodes"`
+	EventTypes     []string  `json:"eventTypes"`
+	Severities     []string  `json:"severities"`
+	Formula        *string   `json:"formula"`
+	RatePer        *int      `json:"ratePer"`
+	Target         *float64  `json:"target"`
+	AlertSigmas    []float64 `json:"alertSigmas"`
+	BaselineMonths *int      `json:"baselineMonths"`
+	IsActive       *bool     `json:"isActive"`
+}
+
+// SPIValue is the value of an SPI for one month. Alert thresholds are derived
+// from the preceding baseline months and are empty until enough history exists.
+type SPIValue struct {
+	Month           string    `json:"month"` // 2025-11
+	Flights         int       `json:"flights"`
+	Events          int       `json:"events"`
+	Value           float64   `json:"value"`
+	Mean            *float64  `json:"mean"`
+	StdDev          *float64  `json:"stdDev"`
+	AlertThresholds []float64 `json:"alertThresholds"`
+	AlertLevel      int       `json:"alertLevel"` // 0 when no alert level is breached
+	TargetMet       *bool     `json:"targetMet"`
+	ComputedAt      time.Time `json:"computedAt"`
+}
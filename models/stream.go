@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// Stream event types
+const (
+	StreamEventNotification       = "notification"        // Notification, sent to its user
+	StreamEventNotificationDigest = "notification_digest" // NotificationDigest, sent to its user
+	StreamEventExceedanceStatus   = "exceedance_status"   // ExceedanceStatusEvent, sent to the aircraft's company
+	StreamEventIngestProgress     = "ingest_progress"     // IngestProgress
+	StreamEventReset              = "reset"               // too many missed events to replay; reload state
+)
+
+// StreamEventTypes lists the types a client can subscribe to
+var StreamEventTypes = []string{StreamEventNotification, StreamEventNotificationDigest, StreamEventExceedanceStatus,
+	StreamEventIngestProgress}
+
+// ExceedanceStatusEvent reports an exceedance moving through the review workflow
+type ExceedanceStatusEvent struct {
+	ExceedanceID string    `json:"exceedanceId"`
+	FlightID     string    `json:"flightId"`
+	AircraftID   string    `json:"aircraftId"`
+	Level        *string   `json:"level"`
+	FromStatus   string    `json:"fromStatus"`
+	ToStatus     string    `json:"toStatus"`
+	UserID       string    `json:"userId"`
+	ChangedAt    time.Time `json:"changedAt"`
+}
+
+// Ingest jobs
+const (
+	IngestJobUpload       = "upload"       // a flight file upload
+	IngestJobMeasurements = "measurements" // recomputing flight measurements
+)
+
+// Ingest stages
+const (
+	IngestStageReceived   = "received"
+	IngestStageProcessing = "processing"
+	IngestStageCompleted  = "completed"
+	IngestStageFailed     = "failed"
+)
+
+// IngestProgress reports the progress of an ingest job
+type IngestProgress struct {
+	JobID     string `json:"jobId"`
+	Job       string `json:"job"`
+	FlightID  string `json:"flightId,omitempty"`
+	Stage     string `json:"stage"`
+	Processed int    `json:"processed"`
+	Total     int    `json:"total"`
+	Error     string `json:"error,omitempty"`
+}
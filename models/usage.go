@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// UsagePoint is a company's usage over a day, week or month. Flights
+// processed and API calls add up over the period; active users, aircraft and
+// storage are the last measurement in it, or null when none was taken.
+type UsagePoint struct {
+	Period           string    `json:"period,omitempty"` // 2025-11-17, 2025-W47 or 2025-11
+	Start            time.Time `json:"start"`
+	ActiveUsers      *int64    `json:"activeUsers"`
+	Aircraft         *int64    `json:"aircraft"`
+	StorageBytes     *int64    `json:"storageBytes"`
+	FlightsProcessed int64     `json:"flightsProcessed"`
+	APICalls         int64     `json:"apiCalls"`
+}
+
+// UsageGrowth is the percent change of each measure from the first to the
+// last point of a range, or null when there is nothing to compare with
+type UsageGrowth struct {
+	ActiveUsers      *float64 `json:"activeUsers"`
+	Aircraft         *float64 `json:"aircraft"`
+	StorageBytes     *float64 `json:"storageBytes"`
+	FlightsProcessed *float64 `json:"flightsProcessed"`
+	APICalls         *float64 `json:"apiCalls"`
+}
+
+// CompanyUsage is a company's usage history with the limits of its
+// subscription, keyed by quota resource (0 is unlimited)
+type CompanyUsage struct {
+	CompanyID   string           `json:"companyId"`
+	CompanyName string           `json:"companyName"`
+	PlanName    *string          `json:"planName"`
+	Limits      map[string]int64 `json:"limits"`
+	Interval    string           `json:"interval"`
+	From        time.Time        `json:"from"`
+	To          time.Time        `json:"to"`
+	Points      []UsagePoint     `json:"points"`
+	Growth      UsageGrowth      `json:"growth"`
+}
+
+// UsageSummary is a company's usage over a whole range, for the overview of
+// all companies
+type UsageSummary struct {
+	CompanyID   string           `json:"companyId"`
+	CompanyName string           `json:"companyName"`
+	PlanName    *string          `json:"planName"`
+	Limits      map[string]int64 `json:"limits"`
+	Usage       UsagePoint       `json:"usage"`
+	Growth      UsageGrowth      `json:"growth"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook event types
+const (
+	WebhookEventFlightUploaded          = "flight.uploaded"
+	WebhookEventExceedanceCreated       = "exceedance.created"
+	WebhookEventExceedanceStatusChanged = "exceedance.status_changed"
+	WebhookEventExceedanceEscalated     = "exceedance.escalated"
+	WebhookEventSubscriptionExpiring    = "subscription.expiring"
+)
+
+// WebhookEventTypes lists the event types a webhook can subscribe to
+var WebhookEventTypes = []string{
+	WebhookEventFlightUploaded, WebhookEventExceedanceCreated,
+	WebhookEventExceedanceStatusChanged, WebhookEventExceedanceEscalated, WebhookEventSubscriptionExpiring,
+}
+
+// Webhook delivery statuses
+const (
+	WebhookStatusPending   = "pending"
+	WebhookStatusSending   = "sending"
+	WebhookStatusDelivered = "delivered"
+	WebhookStatusFailed    = "failed" // gave up after the last retry
+)
+
+// Webhook posts a company's events of the subscribed types to a URL. The
+// secret signs every payload; it is only returned when the webhook is created
+// or the secret is rotated.
+type Webhook struct {
+	ID          string    `json:"id"`
+	CompanyID   string    `json:"companyId"`
+	URL         string    `json:"url"`
+	Description *string   `json:"description"`
+	EventTypes  []string  `json:"eventTypes"`
+	Secret      string    `json:"secret,omitempty"`
+	IsActive    bool      `json:"isActive"`
+	CreatedBy   *string   `json:"createdBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// WebhookRequest creates or updates a webhook. Omitted fields keep their
+// current value.
+type WebhookRequest struct {
+	CompanyID   *string  `json:"companyId"`
+	URL         *string  `json:"url"`
+	Description *string  `json:"description"`
+	EventTypes  []string `json:"eventTypes"`
+	IsActive    *bool    `json:"isActive"`
+}
+
+// WebhookPayload is the JSON body posted to a webhook. ID identifies the event
+// and is the same on every delivery of it, so receivers can drop duplicates.
+type WebhookPayload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CompanyID string      `json:"companyId"`
+	CreatedAt time.Time   `json:"createdAt"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDelivery is an entry of a webhook's delivery log
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhookId"`
+	EventType      string          `json:"eventType"`
+	EventID        string          `json:"eventId"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"responseStatus"`
+	LastError      *string         `json:"lastError"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+}
+
+// SubscriptionExpiringEvent is the data of a subscription.expiring event
+type SubscriptionExpiringEvent struct {
+	CompanyID     string    `json:"companyId"`
+	CompanyName   string    `json:"companyName"`
+	EndDate       time.Time `json:"endDate"`
+	DaysRemaining int       `json:"daysRemaining"`
+}
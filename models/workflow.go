@@ -0,0 +1,189 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Exceedance review workflow states
+const (
+	ExceedanceStatusNew              = "new"
+	ExceedanceStatusUnderReview      = "under_review"
+	ExceedanceStatusValidated        = "validated"
+	ExceedanceStatusFalsePositive    = "false_positive"
+	ExceedanceStatusNeedsCrewContact = "needs_crew_contact"
+	ExceedanceStatusClosed           = "closed"
+)
+
+// ExceedanceStatuses lists every workflow state in review order
+var ExceedanceStatuses = []string{
+	ExceedanceStatusNew,
+	ExceedanceStatusUnderReview,
+	ExceedanceStatusValidated,
+	ExceedanceStatusFalsePositive,
+	ExceedanceStatusNeedsCrewContact,
+	ExceedanceStatusClosed,
+}
+
+// exceedanceTransitions maps current status -> next status -> roles allowed to
+// make that move. Admins may perform any transition listed here.
+var exceedanceTransitions = map[string]map[string][]string{
+	ExceedanceStatusNew: {
+		ExceedanceStatusUnderReview: {RoleFDA},
+	},
+	ExceedanceStatusUnderReview: {
+		ExceedanceStatusValidated:        {RoleFDA},
+		ExceedanceStatusFalsePositive:    {RoleFDA},
+		ExceedanceStatusNeedsCrewContact: {RoleFDA},
+	},
+	ExceedanceStatusNeedsCrewContact: {
+		ExceedanceStatusUnderReview: {RoleFDA, RoleGatekeeper}, // crew feedback received
+		ExceedanceStatusClosed:      {RoleFDA},
+	},
+	ExceedanceStatusValidated: {
+		ExceedanceStatusClosed:      {RoleFDA, RoleGatekeeper},
+		ExceedanceStatusUnderReview: {RoleFDA},
+	},
+	ExceedanceStatusFalsePositive: {
+		ExceedanceStatusClosed:      {RoleFDA, RoleGatekeeper},
+		ExceedanceStatusUnderReview: {RoleFDA},
+	},
+	ExceedanceStatusClosed: {
+		ExceedanceStatusUnderReview: {RoleFDA}, // reopen
+	},
+}
+
+// legacyExceedanceStatuses maps free-text statuses used before the workflow
+// existed onto workflow states
+var legacyExceedanceStatuses = map[string]string{
+	"under review":       ExceedanceStatusUnderReview,
+	"in review":          ExceedanceStatusUnderReview,
+	"valid":              ExceedanceStatusValidated,
+	"approved":           ExceedanceStatusValidated,
+	"confirmed":          ExceedanceStatusValidated,
+	"false":              ExceedanceStatusFalsePositive,
+	"false positive":     ExceedanceStatusFalsePositive,
+	"nuisance":           ExceedanceStatusFalsePositive,
+	"invalid":            ExceedanceStatusFalsePositive,
+	"needs crew contact": ExceedanceStatusNeedsCrewContact,
+	"crew contact":       ExceedanceStatusNeedsCrewContact,
+}
+
+// NormalizeExceedanceStatus converts a workflow state or a known legacy label
+// to its canonical form. The second return value is false for unknown values.
+func NormalizeExceedanceStatus(status string) (string, bool) {
+	s := strings.ToLower(strings.TrimSpace(status))
+	for _, known := range ExceedanceStatuses {
+		if s == known {
+			return known, true
+		}
+	}
+	if mapped, ok := legacyExceedanceStatuses[s]; ok {
+		return mapped, true
+	}
+	return "", false
+}
+
+// IsExceedanceTransition reports whether the workflow defines a move from one status to another
+func IsExceedanceTransition(from, to string) bool {
+	_, ok := exceedanceTransitions[from][to]
+	return ok
+}
+
+// CanTransitionExceedance reports whether a role may move an exceedance between two statuses
+func CanTransitionExceedance(from, to, role string) bool {
+	roles, ok := exceedanceTransitions[from][to]
+	if !ok {
+		return false
+	}
+	if role == RoleAdmin {
+		return true
+	}
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// NextExceedanceStatuses returns the statuses a role may move an exceedance to from its current status
+func NextExceedanceStatuses(from, role string) []string {
+	next := []string{}
+	for _, to := range ExceedanceStatuses {
+		if CanTransitionExceedance(from, to, role) {
+			next = append(next, to)
+		}
+	}
+	return next
+}
+
+// ExceedanceWorkflow describes the workflow for clients
+func ExceedanceWorkflow() map[string]map[string][]string {
+	workflow := map[string]map[string][]string{}
+	for from, targets := range exceedanceTransitions {
+		workflow[from] = map[string][]string{}
+		for to, roles := range targets {
+			workflow[from][to] = append([]string{RoleAdmin}, roles...)
+		}
+	}
+	return workflow
+}
+
+// ExceedanceStatusHistory records a single workflow transition
+type ExceedanceStatusHistory struct {
+	ID           string    `json:"id"`
+	ExceedanceID string    `json:"exceedanceId"`
+	FromStatus   *string   `json:"fromStatus"`
+	ToStatus     string    `json:"toStatus"`
+	UserID       *string   `json:"userId"`
+	UserName     *string   `json:"userName,omitempty"`
+	Comment      *string   `json:"comment"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Exceedance priorities, highest first
+const (
+	ExceedancePriorityCritical = "critical"
+	ExceedancePriorityHigh     = "high"
+	ExceedancePriorityMedium   = "medium"
+	ExceedancePriorityLow      = "low"
+)
+
+// ExceedancePriorities lists every priority from most to least urgent
+var ExceedancePriorities = []string{
+	ExceedancePriorityCritical,
+	ExceedancePriorityHigh,
+	ExceedancePriorityMedium,
+	ExceedancePriorityLow,
+}
+
+// OpenExceedanceStatuses are the workflow states that still need analyst attention
+var OpenExceedanceStatuses = []string{
+	ExceedanceStatusNew,
+	ExceedanceStatusUnderReview,
+	ExceedanceStatusNeedsCrewContact,
+}
+
+// NormalizeExceedancePriority returns the canonical priority. The second return
+// value is false for unknown values.
+func NormalizeExceedancePriority(priority string) (string, bool) {
+	p := strings.ToLower(strings.TrimSpace(priority))
+	for _, known := range ExceedancePriorities {
+		if p == known {
+			return known, true
+		}
+	}
+	return "", false
+}
+
+// PriorityForLevel derives a default priority from an exceedance severity level
+func PriorityForLevel(level *string) string {
+	if level == nil {
+		return ExceedancePriorityLow
+	}
+	if p, ok := NormalizeExceedancePriority(*level); ok {
+		return p
+	}
+	return ExceedancePriorityLow
+}
@@ -0,0 +1,96 @@
+// Package reports renders safety reports to PDF and XLSX without external
+// dependencies. A Document is a title followed by sections of paragraphs and
+// tables; every renderer lays out the same document. Flat tables, such as data
+// exports, are streamed row by row with a TableWriter.
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// Formats
+const (
+	FormatPDF  = "pdf"
+	FormatXLSX = "xlsx"
+)
+
+// Document is a rendered report
+type Document struct {
+	Title    string
+	Subtitle string
+	Sections []Section
+}
+
+// Section is a heading with paragraphs and an optional table. Each section
+// becomes a worksheet in XLSX output.
+type Section struct {
+	Heading    string
+	Paragraphs []string
+	Table      *Table
+}
+
+// Table cells are strings or numbers (int, int64, float64); numbers stay
+// numeric in spreadsheets.
+type Table struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// AddRow appends a row to the table
+func (t *Table) AddRow(cells ...interface{}) {
+	t.Rows = append(t.Rows, cells)
+}
+
+// Render renders the document in the given format
+func Render(doc Document, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case FormatPDF:
+		err = writePDF(&buf, doc)
+	case FormatXLSX:
+		err = writeXLSX(&buf, doc)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	return buf.Bytes(), err
+}
+
+// ContentType returns the MIME type of a format
+func ContentType(format string) string {
+	switch format {
+	case FormatPDF:
+		return "application/pdf"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatJSON:
+		return "application/json; charset=utf-8"
+	}
+	return "application/octet-stream"
+}
+
+// IsFormat reports whether format can be rendered
+func IsFormat(format string) bool {
+	return format == FormatPDF || format == FormatXLSX
+}
+
+// cellText formats a cell for text output
+func cellText(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,298 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 portrait in points
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+	pdfBottom     = 60.0 // leaves room for the footer
+	pdfCellPad    = 4.0
+	pdfRowHeight  = 14.0
+	pdfTableSize  = 8.5
+	pdfTextSize   = 10.0
+)
+
+// pdfLayout places text on pages top to bottom with the standard Helvetica
+// fonts, which every PDF reader provides
+type pdfLayout struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func (l *pdfLayout) newPage() {
+	l.page = &bytes.Buffer{}
+	l.pages = append(l.pages, l.page)
+	l.y = pdfPageHeight - pdfMargin
+}
+
+// ensure starts a new page unless height fits above the bottom margin
+func (l *pdfLayout) ensure(height float64) bool {
+	if l.y-height < pdfBottom {
+		l.newPage()
+		return true
+	}
+	return false
+}
+
+func (l *pdfLayout) text(x, y float64, bold bool, size float64, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(l.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(s))
+}
+
+func (l *pdfLayout) rule(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(l.page, "0.75 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", x1, y1, x2, y2)
+}
+
+func (l *pdfLayout) shade(x, y, w, h float64) {
+	fmt.Fprintf(l.page, "0.92 g %.2f %.2f %.2f %.2f re f 0 g\n", x, y, w, h)
+}
+
+// paragraph writes wrapped text
+func (l *pdfLayout) paragraph(s string, bold bool, size float64) {
+	lineHeight := size * 1.35
+	for _, line := range wrapText(s, pdfPageWidth-2*pdfMargin, size) {
+		l.ensure(lineHeight)
+		l.y -= lineHeight
+		l.text(pdfMargin, l.y, bold, size, line)
+	}
+}
+
+// table writes a table, repeating the header row on every page
+func (l *pdfLayout) table(t *Table) {
+	widths := columnWidths(t, pdfPageWidth-2*pdfMargin)
+	numeric := make([]bool, len(t.Columns))
+	for i := range t.Columns {
+		numeric[i] = len(t.Rows) > 0
+		for _, row := range t.Rows {
+			if i < len(row) {
+				if _, ok := row[i].(string); ok {
+					numeric[i] = false
+					break
+				}
+			}
+		}
+	}
+
+	header := func() {
+		l.ensure(pdfRowHeight)
+		l.y -= pdfRowHeight
+		l.shade(pdfMargin, l.y, pdfPageWidth-2*pdfMargin, pdfRowHeight)
+		l.row(t.Columns, widths, numeric, true)
+	}
+	header()
+	for _, cells := range t.Rows {
+		if l.ensure(pdfRowHeight) {
+			header()
+		}
+		l.y -= pdfRowHeight
+		texts := make([]string, len(t.Columns))
+		for i := range texts {
+			if i < len(cells) {
+				texts[i] = cellText(cells[i])
+			}
+		}
+		l.row(texts, widths, numeric, false)
+		l.rule(pdfMargin, l.y, pdfPageWidth-pdfMargin, l.y)
+	}
+}
+
+func (l *pdfLayout) row(texts []string, widths []float64, numeric []bool, bold bool) {
+	x := pdfMargin
+	for i, s := range texts {
+		s = truncateText(s, widths[i]-2*pdfCellPad, pdfTableSize)
+		tx := x + pdfCellPad
+		if numeric[i] {
+			tx = x + widths[i] - pdfCellPad - textWidth(s, pdfTableSize)
+		}
+		l.text(tx, l.y+4, bold, pdfTableSize, s)
+		x += widths[i]
+	}
+}
+
+// writePDF renders the document as a PDF 1.4 file
+func writePDF(w io.Writer, doc Document) error {
+	l := &pdfLayout{}
+	l.newPage()
+	l.paragraph(doc.Title, true, 18)
+	if doc.Subtitle != "" {
+		l.y -= 4
+		l.paragraph(doc.Subtitle, false, 11)
+	}
+	for _, section := range doc.Sections {
+		l.y -= 10
+		l.ensure(3 * pdfRowHeight)
+		l.paragraph(section.Heading, true, 13)
+		l.y -= 2
+		for _, p := range section.Paragraphs {
+			l.paragraph(p, false, pdfTextSize)
+		}
+		if section.Table != nil {
+			l.y -= 4
+			l.table(section.Table)
+		}
+	}
+	for i, page := range l.pages {
+		footer := fmt.Sprintf("%s - page %d of %d", doc.Title, i+1, len(l.pages))
+		fmt.Fprintf(page, "BT /F1 8 Tf %.2f %.2f Td (%s) Tj ET\n", pdfMargin, pdfMargin-20, pdfEscape(footer))
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3-4 fonts, then a page and its content per page
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, len(l.pages))
+	for i := range l.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(l.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range l.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// pdfEscape encodes s as a WinAnsi string literal body. Characters outside
+// Latin-1 are replaced.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteByte(' ')
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// textWidth estimates the width of s in Helvetica at size points
+func textWidth(s string, size float64) float64 {
+	var em float64
+	for _, r := range s {
+		switch {
+		case r == ' ' || r == '.' || r == ',' || r == ':' || r == ';' || r == 'i' || r == 'l' || r == 'j' || r == '|':
+			em += 0.28
+		case r >= 'A' && r <= 'Z' || r == 'm' || r == 'w' || r == '%' || r == '@':
+			em += 0.72
+		case r >= '0' && r <= '9':
+			em += 0.556
+		default:
+			em += 0.5
+		}
+	}
+	return em * size
+}
+
+// truncateText shortens s with an ellipsis to fit width
+func truncateText(s string, width, size float64) string {
+	if textWidth(s, size) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes)+"...", size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+// wrapText breaks s into lines no wider than width
+func wrapText(s string, width, size float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && textWidth(candidate, size) > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	return append(lines, line)
+}
+
+// columnWidths sizes columns to their content. When the content is wider than
+// the page, narrow columns keep their width and the wide ones share the rest.
+func columnWidths(t *Table, available float64) []float64 {
+	widths := make([]float64, len(t.Columns))
+	var total float64
+	for i, column := range t.Columns {
+		w := textWidth(column, pdfTableSize) * 1.1
+		for _, row := range t.Rows {
+			if i < len(row) {
+				if cw := textWidth(cellText(row[i]), pdfTableSize); cw > w {
+					w = cw
+				}
+			}
+		}
+		widths[i] = w + 2*pdfCellPad
+		total += widths[i]
+	}
+
+	if total <= available {
+		// Spread leftover space so tables span the page
+		for i := range widths {
+			widths[i] *= available / total
+		}
+		return widths
+	}
+
+	fixed := make([]bool, len(widths))
+	remaining, open := available, len(widths)
+	for changed := true; changed && open > 0; {
+		changed = false
+		share := remaining / float64(open)
+		for i, w := range widths {
+			if !fixed[i] && w <= share {
+				fixed[i] = true
+				remaining -= w
+				open--
+				changed = true
+			}
+		}
+	}
+	for i := range widths {
+		if !fixed[i] {
+			widths[i] = remaining / float64(open)
+		}
+	}
+	return widths
+}
@@ -0,0 +1,161 @@
+package reports
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Export formats, for flat tables streamed row by row
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// MaxXLSXRows is the number of data rows a worksheet holds below its header
+const MaxXLSXRows = 1048575
+
+// TableWriter streams a flat table without holding it in memory. CSV and XLSX
+// start with a header row; JSON is an array of objects keyed by column.
+type TableWriter interface {
+	WriteRow(cells []interface{}) error
+	// Close completes the output. It does not close the underlying writer.
+	Close() error
+}
+
+// IsTableFormat reports whether a table can be streamed in format
+func IsTableFormat(format string) bool {
+	return format == FormatCSV || format == FormatJSON || format == FormatXLSX
+}
+
+// NewTableWriter starts a table with the given columns. XLSX tables are
+// written to a single worksheet named sheet.
+func NewTableWriter(w io.Writer, format, sheet string, columns []string) (TableWriter, error) {
+	switch format {
+	case FormatCSV:
+		t := &csvTable{w: csv.NewWriter(w)}
+		return t, t.write(columns)
+	case FormatJSON:
+		t := &jsonTable{w: w, columns: columns}
+		_, err := io.WriteString(w, "[")
+		return t, err
+	case FormatXLSX:
+		return newXLSXTable(w, sheet, columns)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+type csvTable struct {
+	w *csv.Writer
+}
+
+func (t *csvTable) write(record []string) error {
+	t.w.Write(record)
+	return t.w.Error()
+}
+
+func (t *csvTable) WriteRow(cells []interface{}) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = cellText(cell)
+	}
+	return t.write(record)
+}
+
+func (t *csvTable) Close() error {
+	t.w.Flush()
+	return t.w.Error()
+}
+
+type jsonTable struct {
+	w       io.Writer
+	columns []string
+	rows    int
+}
+
+func (t *jsonTable) WriteRow(cells []interface{}) error {
+	var b strings.Builder
+	if t.rows > 0 {
+		b.WriteString(",")
+	}
+	b.WriteString("\n{")
+	for i, column := range t.columns {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		var cell interface{}
+		if i < len(cells) {
+			cell = cells[i]
+		}
+		key, _ := json.Marshal(column)
+		value, err := json.Marshal(cell)
+		if err != nil {
+			return err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(value)
+	}
+	b.WriteString("}")
+	t.rows++
+	_, err := io.WriteString(t.w, b.String())
+	return err
+}
+
+func (t *jsonTable) Close() error {
+	end := "]\n"
+	if t.rows > 0 {
+		end = "\n]\n"
+	}
+	_, err := io.WriteString(t.w, end)
+	return err
+}
+
+type xlsxTable struct {
+	z     *zip.Writer
+	sheet io.Writer
+	rows  int
+}
+
+func newXLSXTable(w io.Writer, sheet string, columns []string) (*xlsxTable, error) {
+	z := zip.NewWriter(w)
+	if err := writeXLSXPackage(z, []string{sheetName(sheet, map[string]bool{})}); err != nil {
+		return nil, err
+	}
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	t := &xlsxTable{z: z, sheet: f}
+	if _, err := io.WriteString(f, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+	writeXLSXRow(f, 0, header, true)
+	return t, nil
+}
+
+func (t *xlsxTable) WriteRow(cells []interface{}) error {
+	if t.rows >= MaxXLSXRows {
+		return fmt.Errorf("worksheets hold at most %d rows", MaxXLSXRows)
+	}
+	t.rows++
+	var b strings.Builder
+	writeXLSXRow(&b, t.rows, cells, false)
+	_, err := io.WriteString(t.sheet, b.String())
+	return err
+}
+
+func (t *xlsxTable) Close() error {
+	if _, err := io.WriteString(t.sheet, `</sheetData></worksheet>`); err != nil {
+		return err
+	}
+	return t.z.Close()
+}
@@ -0,0 +1,196 @@
+package reports
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// writeXLSX renders the document as an Office Open XML workbook: a first sheet
+// with the title and paragraphs, then one sheet per section table
+func writeXLSX(w io.Writer, doc Document) error {
+	type sheet struct {
+		name string
+		rows [][]interface{}
+		bold map[int]bool // rows in bold
+	}
+
+	overview := sheet{name: "Report", bold: map[int]bool{0: true}}
+	overview.rows = append(overview.rows, []interface{}{doc.Title})
+	if doc.Subtitle != "" {
+		overview.rows = append(overview.rows, []interface{}{doc.Subtitle})
+	}
+	sheets := []sheet{overview}
+	used := map[string]bool{"report": true}
+	for _, section := range doc.Sections {
+		if section.Table == nil {
+			sheets[0].rows = append(sheets[0].rows, nil)
+			sheets[0].bold[len(sheets[0].rows)] = true
+			sheets[0].rows = append(sheets[0].rows, []interface{}{section.Heading})
+			for _, p := range section.Paragraphs {
+				sheets[0].rows = append(sheets[0].rows, []interface{}{p})
+			}
+			continue
+		}
+		s := sheet{name: sheetName(section.Heading, used), bold: map[int]bool{}}
+		for _, p := range section.Paragraphs {
+			s.rows = append(s.rows, []interface{}{p})
+		}
+		if len(section.Paragraphs) > 0 {
+			s.rows = append(s.rows, nil)
+		}
+		header := make([]interface{}, len(section.Table.Columns))
+		for i, column := range section.Table.Columns {
+			header[i] = column
+		}
+		s.bold[len(s.rows)] = true
+		s.rows = append(s.rows, header)
+		s.rows = append(s.rows, section.Table.Rows...)
+		sheets = append(sheets, s)
+	}
+
+	names := make([]string, len(sheets))
+	for i, s := range sheets {
+		names[i] = s.name
+	}
+	z := zip.NewWriter(w)
+	if err := writeXLSXPackage(z, names); err != nil {
+		return err
+	}
+
+	for i, s := range sheets {
+		var data strings.Builder
+		for r, row := range s.rows {
+			writeXLSXRow(&data, r, row, s.bold[r])
+		}
+		content := `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			data.String() + `</sheetData></worksheet>`
+		if err := writeXLSXPart(z, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), content); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// writeXLSXPackage writes every workbook part except the worksheets, which
+// are stored as xl/worksheets/sheet<n>.xml in the order of names
+func writeXLSXPackage(z *zip.Writer, names []string) error {
+	var overrides, workbookSheets, relationships strings.Builder
+	for i, name := range names {
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+		fmt.Fprintf(&workbookSheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), i+1, i+1)
+		fmt.Fprintf(&relationships, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, i+1)
+	}
+	fmt.Fprintf(&relationships, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`, len(names)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+			overrides.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + workbookSheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			relationships.String() + `</Relationships>`},
+		// Style 1 is bold
+		{"xl/styles.xml", `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for _, part := range parts {
+		if err := writeXLSXPart(z, part.name, part.content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeXLSXPart(z *zip.Writer, name, content string) error {
+	f, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, xml.Header+content)
+	return err
+}
+
+// writeXLSXRow writes the zero-based row r of a worksheet
+func writeXLSXRow(w io.Writer, r int, row []interface{}, bold bool) {
+	fmt.Fprintf(w, `<row r="%d">`, r+1)
+	style := ""
+	if bold {
+		style = ` s="1"`
+	}
+	for c, cell := range row {
+		ref := columnName(c) + strconv.Itoa(r+1)
+		switch v := cell.(type) {
+		case nil:
+		case int, int64, float64:
+			fmt.Fprintf(w, `<c r="%s"%s><v>%s</v></c>`, ref, style, cellText(v))
+		default:
+			fmt.Fprintf(w, `<c r="%s" t="inlineStr"%s><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(cellText(v)))
+		}
+	}
+	io.WriteString(w, `</row>`)
+}
+
+// sheetName returns a unique worksheet name: at most 31 characters, without []:*?/\
+func sheetName(heading string, used map[string]bool) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return ' '
+		}
+		return r
+	}, strings.TrimSpace(heading))
+	if name == "" {
+		name = "Sheet"
+	}
+	if len([]rune(name)) > 31 {
+		name = string([]rune(name)[:31])
+	}
+	base := name
+	for n := 2; used[strings.ToLower(name)]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		runes := []rune(base)
+		if len(runes)+len(suffix) > 31 {
+			runes = runes[:31-len(suffix)]
+		}
+		name = string(runes) + suffix
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// columnName returns the spreadsheet column letters of a zero-based index
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func xmlEscape(s string) string {
+	// Control characters are not allowed in XML 1.0
+	s = strings.Map(func(r rune) rune {
+		if r < 32 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
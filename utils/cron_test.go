@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	exprs := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-a * * * *",
+		"@yearly",
+	}
+	for _, expr := range exprs {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+// location loads a time zone, skipping the test when tzdata is not installed
+func location(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestCronNext(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	// Monday 19 October 2026
+	monday := utc(2026, 10, 19, 10, 5)
+
+	cases := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", monday, utc(2026, 10, 19, 10, 6)},
+		{"seconds are dropped", "* * * * *", monday.Add(30 * time.Second), utc(2026, 10, 19, 10, 6)},
+		{"step", "*/15 * * * *", monday, utc(2026, 10, 19, 10, 15)},
+		{"list", "7,50 * * * *", monday, utc(2026, 10, 19, 10, 7)},
+		{"step on a range", "0-30/10 * * * *", monday, utc(2026, 10, 19, 10, 10)},
+		{"step on a range ends at its bound", "0-30/10 * * * *", utc(2026, 10, 19, 10, 30), utc(2026, 10, 19, 11, 0)},
+		{"step from a value runs to the maximum", "10/20 * * * *", utc(2026, 10, 19, 10, 50), utc(2026, 10, 19, 11, 10)},
+		{"hour range step", "0 9-17/4 * * *", monday, utc(2026, 10, 19, 13, 0)},
+		{"next day", "0 9 * * *", monday, utc(2026, 10, 20, 9, 0)},
+		{"7 is Sunday", "0 9 * * 7", monday, utc(2026, 10, 25, 9, 0)},
+		{"0 is Sunday", "0 9 * * 0", monday, utc(2026, 10, 25, 9, 0)},
+		{"range ending on 7", "0 9 * * 5-7", monday, utc(2026, 10, 23, 9, 0)},
+		{"day of month only", "0 0 13 * *", monday, utc(2026, 11, 13, 0, 0)},
+		{"day of week only", "0 0 * * 5", monday, utc(2026, 10, 23, 0, 0)},
+		{"day of month or week, week first", "0 0 13 * 5", monday, utc(2026, 10, 23, 0, 0)},
+		{"day of month or week, both", "0 0 13 * 5", utc(2026, 11, 10, 0, 0), utc(2026, 11, 13, 0, 0)},
+		{"day of month or week, month first", "0 0 13 * 5", utc(2027, 1, 9, 0, 0), utc(2027, 1, 13, 0, 0)},
+		{"stepped day of month is restricted", "0 0 */10 * 2", monday, utc(2026, 10, 20, 0, 0)},
+		{"month", "0 0 1 3 *", monday, utc(2027, 3, 1, 0, 0)},
+		{"new year", "0 0 1 1 *", monday, utc(2027, 1, 1, 0, 0)},
+		{"leap day", "0 0 29 2 *", monday, utc(2028, 2, 29, 0, 0)},
+		{"hourly", "@hourly", monday, utc(2026, 10, 19, 11, 0)},
+		{"daily", "@daily", monday, utc(2026, 10, 20, 0, 0)},
+		{"weekly", "@weekly", monday, utc(2026, 10, 25, 0, 0)},
+		{"monthly", "@monthly", monday, utc(2026, 11, 1, 0, 0)},
+		{"30 February never matches", "0 0 30 2 *", monday, time.Time{}},
+		{"31st of short months never matches", "0 0 31 4,6,9,11 *", monday, time.Time{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := ParseCron(tc.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tc.expr, err)
+			}
+			if got := s.Next(tc.from); !got.Equal(tc.want) {
+				t.Errorf("Next(%s) = %s, want %s", tc.from, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCronNextAcrossDaylightSaving(t *testing.T) {
+	newYork := location(t, "America/New_York")
+	santiago := location(t, "America/Santiago")
+	at := func(loc *time.Location, year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, loc)
+	}
+	// Clocks in New York go from 02:00 EST to 03:00 EDT on 8 March 2026 and
+	// from 02:00 EDT back to 01:00 EST on 1 November 2026
+	repeated := at(newYork, 2026, 11, 1, 1, 30)
+
+	cases := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"skipped hour", "0 * * * *", at(newYork, 2026, 3, 8, 1, 30), at(newYork, 2026, 3, 8, 3, 0)},
+		{"skipped minutes", "*/20 * * * *", at(newYork, 2026, 3, 8, 1, 45), at(newYork, 2026, 3, 8, 3, 0)},
+		{"skipped time never matches", "30 2 * * *", at(newYork, 2026, 3, 7, 12, 0), at(newYork, 2026, 3, 9, 2, 30)},
+		{"midnight before spring forward", "0 0 * * *", at(newYork, 2026, 3, 7, 12, 0), at(newYork, 2026, 3, 8, 0, 0)},
+		{"repeated time, first", "30 1 * * *", at(newYork, 2026, 10, 31, 12, 0), repeated},
+		{"repeated time, second", "30 1 * * *", repeated, repeated.Add(time.Hour)},
+		{"after the repeated hour", "30 1 * * *", repeated.Add(time.Hour), at(newYork, 2026, 11, 2, 1, 30)},
+		{"hourly through fall back", "0 * * * *", repeated, repeated.Add(30 * time.Minute)},
+		// Santiago skips midnight: 6 September 2026 starts at 01:00
+		{"skipped midnight", "0 0 * * *", at(santiago, 2026, 9, 5, 12, 0), at(santiago, 2026, 9, 7, 0, 0)},
+		{"first hour after skipped midnight", "0 1 * * *", at(santiago, 2026, 9, 5, 12, 0), at(santiago, 2026, 9, 6, 1, 0)},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := ParseCron(tc.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q): %v", tc.expr, err)
+			}
+			if got := s.Next(tc.from); !got.Equal(tc.want) {
+				t.Errorf("Next(%s) = %s, want %s", tc.from, got, tc.want)
+			}
+		})
+	}
+}